@@ -1,26 +1,377 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/event"
+	"github.com/ktsoator/connectify/internal/job"
 	"github.com/ktsoator/connectify/internal/repository"
 	"github.com/ktsoator/connectify/internal/repository/dao"
 	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/storage"
 	"github.com/ktsoator/connectify/internal/web"
+	"github.com/ktsoator/connectify/internal/web/article"
+	"github.com/ktsoator/connectify/internal/web/comment"
+	"github.com/ktsoator/connectify/internal/web/group"
+	"github.com/ktsoator/connectify/internal/web/message"
+	"github.com/ktsoator/connectify/internal/web/middleware"
+	"github.com/ktsoator/connectify/internal/web/notification"
+	"github.com/ktsoator/connectify/internal/web/oauth"
+	"github.com/ktsoator/connectify/internal/web/policy"
+	"github.com/ktsoator/connectify/internal/web/realtime"
+	"github.com/ktsoator/connectify/internal/web/scim"
 	"github.com/ktsoator/connectify/internal/web/user"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
 func main() {
-	router := web.InitRouter()
 	db := dao.InitDB()
-	initUser(db, router)
-	router.Run(":8080")
+	redisClient := initRedis()
+	// Features publish what happened here instead of calling the features
+	// that react to it.
+	events := event.NewBus()
+
+	policyService := service.NewPolicyService(repository.NewPolicyRepository(dao.NewPolicyDAO(db)))
+	userRepo := repository.NewUserRepository(dao.NewUserDAO(db))
+	userService := service.NewUserService(userRepo, events)
+	router := web.InitRouter(
+		// Tokens stop working once their user is deleted or deactivated.
+		middleware.NewActiveUserMiddlewareBuilder(userService).Build(),
+		// Guests may only look around until they sign up.
+		middleware.NewGuestGuardMiddlewareBuilder(userService, 10*time.Minute).
+			AllowPath("/user/profile_jwt").
+			AllowPath("/user/signup").
+			AllowPath("/user/login_phone").
+			AllowPath("/user/login_oauth").
+			AllowPath("/user/logout").
+			AllowPath("/user/consents").
+			AllowPrefix("/u/").
+			AllowPath("/users/search").
+			AllowPrefix("/pub/").
+			AllowPath("/articles/hot").
+			Build(),
+		// Users must accept newly published policies before using the app,
+		// but still need to read and accept them.
+		middleware.NewPolicyConsentMiddlewareBuilder(policyService).
+			IgnorePath("/user/consents").
+			IgnorePath("/user/logout").
+			Build(),
+	)
+
+	// Blocks apply to everything between two users, so most features ask it.
+	blockService := service.NewBlockService(repository.NewBlockRepository(dao.NewBlockDAO(db)), userRepo, events)
+	followRepo := repository.NewFollowRepository(dao.NewFollowDAO(db))
+	followService := service.NewFollowService(followRepo, userRepo, blockService, events)
+	followService.Subscribe(events)
+	privacyService := service.NewPrivacyService(userRepo, followService, blockService)
+	initUser(db, router, redisClient, userService, policyService, privacyService, followService)
+	initBlock(router, blockService, userService)
+	initFriend(db, router, userRepo, userService, blockService, events)
+	initAvatar(router, userService)
+	initPolicy(router, policyService)
+	// Views are written in batches; repeat views within 30 minutes count once.
+	interactionRepo := repository.NewInteractionRepository(dao.NewInteractionDAO(db))
+	viewAggregator := service.NewViewAggregator(interactionRepo, initViewDeduper(redisClient),
+		service.ViewAggregatorConfig{
+			FlushInterval: 5 * time.Second,
+			FlushSize:     1000,
+			DedupWindow:   30 * time.Minute,
+		})
+	articleRepo := repository.NewArticleRepository(dao.NewArticleDAO(db))
+	commentRepo := repository.NewCommentRepository(dao.NewCommentDAO(db))
+	interactionService := service.NewInteractionService(interactionRepo, articleRepo, viewAggregator, events)
+	articleService, feedService := initArticle(db, router, userRepo, followRepo, articleRepo, interactionService, blockService, events)
+	initComment(router, userRepo, articleRepo, commentRepo, blockService, events)
+	hotService := initHot(router, redisClient, userRepo, articleRepo, commentRepo, interactionRepo, interactionService)
+	initNotification(db, router, userRepo, events)
+	initMessage(db, router, userRepo, userService, privacyService, blockService, events)
+	initGroup(db, router, userRepo, userService)
+	pushService := initRealtime(router, redisClient, userService, policyService, events)
+	initOAuth(db, router, userService)
+	initScim(db, router, userRepo)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	scheduler := job.NewScheduler().
+		// Guests that have not been seen for a week are deleted.
+		Register(job.NewGuestCleanupJob(userService, 7*24*time.Hour, 500), time.Hour).
+		// Every instance runs this; each due article is still published once.
+		Register(job.NewScheduledPublishJob(articleService, 100), 30*time.Second).
+		// Every instance runs this too; each task is claimed by one of them.
+		Register(job.NewFeedTaskJob(feedService, 100), 2*time.Second).
+		// Only one instance at a time computes the ranking; the others skip.
+		Register(job.NewHotRankingJob(hotService), 5*time.Minute)
+	scheduler.Start(ctx)
+	viewAggregator.Start()
+	pushService.Start(ctx)
+
+	server := &http.Server{Addr: ":8080", Handler: router}
+	// Shutdown does not wait for hijacked WebSockets and would wait for
+	// streams until it times out, so real-time connections are ended first.
+	server.RegisterOnShutdown(pushService.Close)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("listen: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	// No more views come in once the server is shut down.
+	if err := viewAggregator.Stop(shutdownCtx); err != nil {
+		log.Printf("flush article views: %v", err)
+	}
+	scheduler.Wait()
+}
+
+// initRedis connects to Redis, returning nil when it is unreachable so that
+// features can fall back to working per instance.
+func initRedis() *redis.Client {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:16379"})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Printf("redis unavailable, falling back to per-instance state: %v", err)
+		_ = client.Close()
+		return nil
+	}
+	return client
+}
+
+func initViewDeduper(client *redis.Client) service.ViewDeduper {
+	if client == nil {
+		return service.NewLocalViewDeduper()
+	}
+	return service.NewRedisViewDeduper(client)
 }
 
-func initUser(db *gorm.DB, router *gin.Engine) {
-	userDAO := dao.NewUserDAO(db)
-	userRepo := repository.NewUserRepository(userDAO)
-	userService := service.NewUserService(userRepo)
-	userHandler := user.NewUserHandler(userService)
+func initUser(db *gorm.DB, router *gin.Engine, redisClient *redis.Client, userService *service.UserService,
+	policyService *service.PolicyService, privacyService *service.PrivacyService, followService *service.FollowService) {
+	screeningRepo := repository.NewScreeningRepository(dao.NewScreeningDAO(db))
+	screeningService := service.NewSignupScreeningService(screeningRepo,
+		service.NewHoneypotRule(),
+		// In production, the blocklist should be loaded from configuration.
+		service.NewDisposableDomainRule([]string{
+			"mailinator.com",
+			"guerrillamail.com",
+			"10minutemail.com",
+			"temp-mail.org",
+			"yopmail.com",
+			"trashmail.com",
+		}),
+		service.NewVelocityRule(screeningRepo, time.Hour, 5, 20),
+		service.NewMXRule(net.DefaultResolver, 2*time.Second),
+	)
+	userHandler := user.NewUserHandler(userService, policyService, screeningService, privacyService, followService)
 	userHandler.RegisterRoutes(router)
+
+	var phoneCodes service.PhoneCodeStore = service.NewLocalPhoneCodeStore()
+	if redisClient != nil {
+		phoneCodes = service.NewRedisPhoneCodeStore(redisClient)
+	}
+	// Codes are only logged until an SMS gateway is configured.
+	phoneVerifier := service.NewPhoneVerifier(phoneCodes, service.LogSMSSender{},
+		service.DefaultPhoneVerifierConfig())
+	// In production, identity providers should be loaded from configuration, e.g.:
+	//
+	//	"google": service.NewOIDCIdentityProvider(service.OIDCProviderConfig{
+	//		Name: "google", ClientID: "...", ClientSecret: "...",
+	//		TokenURL:    "https://oauth2.googleapis.com/token",
+	//		UserInfoURL: "https://openidconnect.googleapis.com/v1/userinfo",
+	//	}),
+	providers := map[string]service.IdentityProvider{}
+	signInHandler := user.NewSignInHandler(userService, policyService, screeningService, phoneVerifier, providers)
+	signInHandler.RegisterRoutes(router)
+}
+
+func initBlock(router *gin.Engine, blockService *service.BlockService, userService *service.UserService) {
+	blockHandler := user.NewBlockHandler(blockService, userService)
+	blockHandler.RegisterRoutes(router)
+}
+
+func initFriend(db *gorm.DB, router *gin.Engine, userRepo *repository.UserRepository,
+	userService *service.UserService, blockService *service.BlockService, events *event.Bus) {
+	friendRepo := repository.NewFriendRepository(dao.NewFriendDAO(db))
+	friendService := service.NewFriendService(friendRepo, userRepo, blockService, events)
+	friendService.Subscribe(events)
+	friendHandler := user.NewFriendHandler(friendService, userService)
+	friendHandler.RegisterRoutes(router)
+}
+
+func initAvatar(router *gin.Engine, userService *service.UserService) {
+	const maxAvatarBytes = 5 << 20
+	// Files are kept on local disk and served by this server. In production,
+	// this should be loaded from configuration, e.g. an S3 bucket:
+	//
+	//	objects, err := storage.NewS3Storage(storage.S3Config{
+	//		Endpoint: "s3.amazonaws.com", Region: "us-east-1", Bucket: "connectify-uploads",
+	//		AccessKeyID: "...", SecretAccessKey: "...", UseSSL: true,
+	//	})
+	objects := storage.NewLocalStorage("./data/uploads", "http://localhost:8080/uploads")
+	router.Static("/uploads", "./data/uploads")
+
+	avatarService := service.NewAvatarService(userService, objects, service.AvatarConfig{
+		MaxBytes:  maxAvatarBytes,
+		MaxPixels: 40_000_000,
+		Sizes:     []int{512, 256, 96},
+	})
+	avatarHandler := user.NewAvatarHandler(avatarService, maxAvatarBytes)
+	avatarHandler.RegisterRoutes(router)
+}
+
+func initArticle(db *gorm.DB, router *gin.Engine, userRepo *repository.UserRepository,
+	followRepo *repository.FollowRepository, articleRepo *repository.ArticleRepository,
+	interactionService *service.InteractionService, blockService *service.BlockService,
+	events *event.Bus) (*service.ArticleService, *service.FeedService) {
+	// Keep the last 50 saves of every article.
+	articleService := service.NewArticleService(articleRepo, userRepo, 50, events)
+	articleHandler := article.NewArticleHandler(articleService, interactionService)
+	articleHandler.RegisterRoutes(router)
+
+	feedRepo := repository.NewFeedRepository(dao.NewFeedDAO(db))
+	feedService := service.NewFeedService(feedRepo, followRepo, articleRepo, userRepo, blockService, service.FeedConfig{
+		// Articles of authors with more followers are pulled when feeds are read.
+		FanoutThreshold: 1000,
+		FanoutBatch:     500,
+		Backfill:        20,
+		TaskLease:       time.Minute,
+		RetryDelay:      30 * time.Second,
+		MaxAttempts:     10,
+	})
+	feedService.Subscribe(events)
+	feedHandler := article.NewFeedHandler(feedService, interactionService)
+	feedHandler.RegisterRoutes(router)
+	return articleService, feedService
+}
+
+func initComment(router *gin.Engine, userRepo *repository.UserRepository, articleRepo *repository.ArticleRepository,
+	commentRepo *repository.CommentRepository, blockService *service.BlockService, events event.Publisher) {
+	// Comments with spam words or more than two links wait for the author of
+	// the article to approve them. In production, the word list should be
+	// loaded from configuration.
+	moderator := service.NewKeywordModerator([]string{"casino", "viagra", "free money"}, 2)
+	commentService := service.NewCommentService(commentRepo, articleRepo, userRepo, blockService, moderator, 15*time.Minute, events)
+	commentHandler := comment.NewCommentHandler(commentService)
+	commentHandler.RegisterRoutes(router)
+}
+
+func initHot(router *gin.Engine, redisClient *redis.Client, userRepo *repository.UserRepository,
+	articleRepo *repository.ArticleRepository, commentRepo *repository.CommentRepository,
+	interactionRepo *repository.InteractionRepository, interactionService *service.InteractionService) *service.HotService {
+	var cache service.HotCache = service.NewLocalHotCache()
+	var locker service.Locker = service.NewLocalLocker()
+	if redisClient != nil {
+		// The list outlives a few missed runs before it is dropped.
+		cache = service.NewRedisHotCache(redisClient, time.Hour)
+		locker = service.NewRedisLocker(redisClient)
+	}
+	hotService := service.NewHotService(articleRepo, interactionRepo, commentRepo, userRepo, cache, locker,
+		service.HotConfig{
+			Window:        7 * 24 * time.Hour,
+			TopN:          100,
+			Batch:         500,
+			LikeWeight:    3,
+			CommentWeight: 5,
+			ViewWeight:    0.1,
+			Gravity:       1.5,
+			LockTTL:       time.Minute,
+		})
+	hotHandler := article.NewHotHandler(hotService, interactionService)
+	hotHandler.RegisterRoutes(router)
+	return hotService
+}
+
+func initNotification(db *gorm.DB, router *gin.Engine, userRepo *repository.UserRepository, events *event.Bus) {
+	notificationRepo := repository.NewNotificationRepository(dao.NewNotificationDAO(db))
+	notificationService := service.NewNotificationService(notificationRepo, userRepo, events)
+	notificationService.Subscribe(events)
+	notificationHandler := notification.NewNotificationHandler(notificationService)
+	notificationHandler.RegisterRoutes(router)
+}
+
+func initMessage(db *gorm.DB, router *gin.Engine, userRepo *repository.UserRepository,
+	userService *service.UserService, privacyService *service.PrivacyService, blockService *service.BlockService,
+	events event.Publisher) {
+	messageRepo := repository.NewMessageRepository(dao.NewMessageDAO(db))
+	messageService := service.NewMessageService(messageRepo, userRepo, privacyService, blockService, events)
+	messageHandler := message.NewMessageHandler(messageService, userService)
+	messageHandler.RegisterRoutes(router)
+}
+
+func initGroup(db *gorm.DB, router *gin.Engine, userRepo *repository.UserRepository, userService *service.UserService) {
+	groupRepo := repository.NewGroupRepository(dao.NewGroupDAO(db))
+	groupService := service.NewGroupService(groupRepo, userRepo)
+	groupHandler := group.NewGroupHandler(groupService, userService)
+	groupHandler.RegisterRoutes(router)
+}
+
+func initRealtime(router *gin.Engine, redisClient *redis.Client, userService *service.UserService,
+	policyService *service.PolicyService, events *event.Bus) *service.PushService {
+	var pubsub service.PubSub = service.NewLocalPubSub()
+	if redisClient != nil {
+		pubsub = service.NewRedisPubSub(redisClient)
+	}
+	pushService := service.NewPushService(pubsub, service.PushConfig{
+		Buffer:          64,
+		MaxConnsPerUser: 5,
+	})
+	pushService.Subscribe(events)
+	var tickets service.TicketStore = service.NewLocalTicketStore()
+	if redisClient != nil {
+		tickets = service.NewRedisTicketStore(redisClient)
+	}
+	ticketService := service.NewConnectTicketService(tickets, 30*time.Second)
+	realtimeHandler := realtime.NewRealtimeHandler(pushService, ticketService, userService, policyService, realtime.Config{
+		PingInterval: 25 * time.Second,
+		IdleTimeout:  60 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		// Same as the CORS origins.
+		AllowedOrigins: []string{"http://localhost:3000"},
+	})
+	realtimeHandler.RegisterRoutes(router)
+	return pushService
+}
+
+func initPolicy(router *gin.Engine, policyService *service.PolicyService) {
+	policyHandler := policy.NewPolicyHandler(policyService)
+	policyHandler.RegisterRoutes(router)
+}
+
+func initOAuth(db *gorm.DB, router *gin.Engine, userService *service.UserService) {
+	oauthDAO := dao.NewOAuthDAO(db)
+	oauthRepo := repository.NewOAuthRepository(oauthDAO)
+	// Rotate signing keys daily and keep retired keys published for another day,
+	// which comfortably outlives every token they signed.
+	keys := service.NewSigningKeyManager(oauthRepo, 24*time.Hour, 24*time.Hour)
+	oauthService := service.NewOAuthService(oauthRepo, userService, keys, service.OAuthConfig{
+		// In production, this should be loaded from configuration.
+		Issuer:         "http://localhost:8080",
+		CodeTTL:        5 * time.Minute,
+		AccessTokenTTL: time.Hour,
+		IDTokenTTL:     time.Hour,
+	})
+	oauthHandler := oauth.NewOAuthHandler(oauthService)
+	oauthHandler.RegisterRoutes(router)
+}
+
+func initScim(db *gorm.DB, router *gin.Engine, userRepo *repository.UserRepository) {
+	tenantDAO := dao.NewScimTenantDAO(db)
+	tenantRepo := repository.NewScimTenantRepository(tenantDAO)
+	scimService := service.NewScimService(tenantRepo, userRepo)
+	scimHandler := scim.NewScimHandler(scimService)
+	scimHandler.RegisterRoutes(router)
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+	"github.com/ktsoator/connectify/internal/service"
+)
+
+func main() {
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("========================================")
+	fmt.Println("     Connectify Policy Publish Tool     ")
+	fmt.Println("========================================")
+
+	kind := prompt(reader, "Please enter policy kind (terms/privacy): ")
+	version := prompt(reader, "Please enter version (e.g. 2026-01): ")
+	title := prompt(reader, "Please enter title: ")
+	path := prompt(reader, "Please enter path to the document file: ")
+	when := prompt(reader, "Please enter publish time in RFC3339 (default [now]): ")
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("Read document failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	var publishedAt time.Time
+	if when != "" {
+		publishedAt, err = time.Parse(time.RFC3339, when)
+		if err != nil {
+			fmt.Printf("Invalid publish time: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	db := dao.InitDB()
+	svc := service.NewPolicyService(repository.NewPolicyRepository(dao.NewPolicyDAO(db)))
+	id, err := svc.Publish(context.Background(), domain.Policy{
+		Kind:        kind,
+		Version:     version,
+		Title:       title,
+		Content:     string(content),
+		PublishedAt: publishedAt,
+	})
+
+	fmt.Println("----------------------------------------")
+	if err != nil {
+		fmt.Printf("Publish result: failed (%v)\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("Publish result: success")
+	fmt.Printf("Policy ID: %d\n", id)
+	fmt.Println("Users will be asked to accept it on their next request.")
+	fmt.Println("----------------------------------------")
+}
+
+func prompt(reader *bufio.Reader, label string) string {
+	fmt.Print(label)
+	v, _ := reader.ReadString('\n')
+	return strings.TrimSpace(v)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ktsoator/connectify/internal/repository"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+	"github.com/ktsoator/connectify/internal/service"
+)
+
+func main() {
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("========================================")
+	fmt.Println("     Connectify SCIM Tenant Tool        ")
+	fmt.Println("========================================")
+
+	fmt.Print("Please enter tenant name: ")
+	name, _ := reader.ReadString('\n')
+	name = strings.TrimSpace(name)
+	if name == "" {
+		fmt.Println("empty tenant name")
+		os.Exit(1)
+	}
+
+	db := dao.InitDB()
+	svc := service.NewScimService(
+		repository.NewScimTenantRepository(dao.NewScimTenantDAO(db)),
+		repository.NewUserRepository(dao.NewUserDAO(db)),
+	)
+
+	tenant, token, err := svc.CreateTenant(context.Background(), name)
+	if err != nil {
+		fmt.Printf("Create tenant failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("----------------------------------------")
+	fmt.Printf("Tenant ID: %d\n", tenant.ID)
+	fmt.Printf("Tenant name: %s\n", tenant.Name)
+	fmt.Printf("Bearer token: %s\n", token)
+	fmt.Println("Store the token now, it cannot be shown again.")
+	fmt.Println("----------------------------------------")
+}
@@ -0,0 +1,78 @@
+package domain
+
+import "time"
+
+type ArticleStatus uint8
+
+const (
+	ArticleStatusUnknown ArticleStatus = iota
+	// ArticleStatusDraft has never been published.
+	ArticleStatusDraft
+	ArticleStatusPublished
+	// ArticleStatusUnpublished was published and then taken down by the author.
+	ArticleStatusUnpublished
+)
+
+func (s ArticleStatus) String() string {
+	switch s {
+	case ArticleStatusDraft:
+		return "draft"
+	case ArticleStatusPublished:
+		return "published"
+	case ArticleStatusUnpublished:
+		return "unpublished"
+	}
+	return "unknown"
+}
+
+// Article is a piece of writing. The author edits a working copy; readers
+// only ever see the copy that was last published.
+type Article struct {
+	ID      int64
+	Title   string
+	Content string
+	// HTML is Content rendered from Markdown and sanitized.
+	HTML   string
+	Author Author
+	Status ArticleStatus
+	// PublishAt is when the working copy will be published automatically,
+	// the zero time when the article is not scheduled.
+	PublishAt time.Time
+	Ctime     time.Time
+	Utime     time.Time
+}
+
+// Author is the part of a user shown next to their content.
+type Author struct {
+	ID       int64
+	Handle   string
+	Nickname string
+}
+
+// ArticleRevision is an immutable snapshot of an article's working copy,
+// taken every time it is saved.
+type ArticleRevision struct {
+	ID        int64
+	ArticleID int64
+	AuthorID  int64
+	Title     string
+	Content   string
+	Ctime     time.Time
+}
+
+// Interaction is an article's counters together with what the viewing user
+// did with it. Liked and Bookmarked are false for anonymous viewers.
+type Interaction struct {
+	ArticleID  int64
+	Likes      int64
+	Bookmarks  int64
+	Views      int64
+	Liked      bool
+	Bookmarked bool
+}
+
+// HotArticle is an article in the trending list with its ranking score.
+type HotArticle struct {
+	ArticleID int64
+	Score     float64
+}
@@ -0,0 +1,36 @@
+package domain
+
+import "time"
+
+// BlockKind tells blocks and mutes apart.
+type BlockKind uint8
+
+const (
+	BlockKindUnknown BlockKind = iota
+	// BlockKindBlock makes two users invisible to each other: neither can
+	// follow, message or comment on the other, and neither shows up in the
+	// other's search results, feed or comment threads.
+	BlockKindBlock
+	// BlockKindMute only hides the muted user's content from the user who
+	// muted them. The muted user does not notice anything.
+	BlockKindMute
+)
+
+func (k BlockKind) String() string {
+	switch k {
+	case BlockKindBlock:
+		return "block"
+	case BlockKindMute:
+		return "mute"
+	}
+	return "unknown"
+}
+
+// Block is a user blocked or muted by another.
+type Block struct {
+	ID     int64
+	UserID int64
+	Target User
+	Kind   BlockKind
+	Ctime  time.Time
+}
@@ -0,0 +1,53 @@
+package domain
+
+import "time"
+
+type CommentStatus uint8
+
+const (
+	CommentStatusUnknown CommentStatus = iota
+	CommentStatusVisible
+	// CommentStatusPending is held for review and only shown to its author.
+	CommentStatusPending
+	// CommentStatusDeleted keeps its place in the thread without content.
+	CommentStatusDeleted
+	// CommentStatusRejected failed review and is hidden from everyone.
+	CommentStatusRejected
+)
+
+func (s CommentStatus) String() string {
+	switch s {
+	case CommentStatusVisible:
+		return "visible"
+	case CommentStatusPending:
+		return "pending"
+	case CommentStatusDeleted:
+		return "deleted"
+	case CommentStatusRejected:
+		return "rejected"
+	}
+	return "unknown"
+}
+
+// Comment is a comment on an article. Replies form threads below a root
+// comment; RootID and ParentID are 0 for root comments.
+type Comment struct {
+	ID        int64
+	ArticleID int64
+	RootID    int64
+	ParentID  int64
+	// Depth is 0 for root comments and grows by one per reply level.
+	Depth   int
+	Author  Author
+	Content string
+	Status  CommentStatus
+	Ctime   time.Time
+	Utime   time.Time
+}
+
+// CommentThread is a root comment with the first page of its replies.
+type CommentThread struct {
+	Root       Comment
+	Replies    []Comment
+	ReplyCount int64
+}
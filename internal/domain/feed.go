@@ -0,0 +1,59 @@
+package domain
+
+import "time"
+
+// FeedItem is an article in the feed of a user.
+type FeedItem struct {
+	UserID    int64
+	ArticleID int64
+	AuthorID  int64
+	// PublishedAt is when the article was first published.
+	PublishedAt time.Time
+}
+
+// FeedCursor is the position in a feed: the first publish time and ID of the
+// last article shown. The zero value is the start of the feed.
+type FeedCursor struct {
+	PublishedAt time.Time
+	ArticleID   int64
+}
+
+func (c FeedCursor) IsZero() bool {
+	return c.PublishedAt.IsZero()
+}
+
+// Before reports whether the article at c comes before the one at other in
+// a feed, i.e. is newer.
+func (c FeedCursor) Before(other FeedCursor) bool {
+	if !c.PublishedAt.Equal(other.PublishedAt) {
+		return c.PublishedAt.After(other.PublishedAt)
+	}
+	return c.ArticleID > other.ArticleID
+}
+
+type FeedTaskKind uint8
+
+const (
+	// FeedTaskFanout pushes an article into the inboxes of its author's
+	// followers.
+	FeedTaskFanout FeedTaskKind = iota + 1
+	// FeedTaskBackfill pushes the recent articles of an author into the
+	// inbox of a new follower.
+	FeedTaskBackfill
+)
+
+// FeedTask is inbox work queued by an event and done in the background.
+type FeedTask struct {
+	ID         int64
+	Kind       FeedTaskKind
+	ArticleID  int64
+	AuthorID   int64
+	FollowerID int64
+	// Cursor is the last follower a fan-out reached, so a retried fan-out
+	// resumes after the batches already written.
+	Cursor   int64
+	Attempts int
+	// RunAt is when the task is due. While an instance works on a task, it
+	// is pushed into the future so that others leave the task alone.
+	RunAt time.Time
+}
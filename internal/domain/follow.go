@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+// Follow is one edge of the follow graph: FollowerID follows FolloweeID.
+type Follow struct {
+	ID         int64
+	FollowerID int64
+	FolloweeID int64
+	Ctime      time.Time
+}
+
+// FollowStats are the follow counters of a user.
+type FollowStats struct {
+	UserID    int64
+	Followers int64
+	Following int64
+}
+
+// Relationship is how the viewer and another user follow each other.
+type Relationship struct {
+	Following  bool
+	FollowedBy bool
+}
+
+// Mutual reports whether both users follow each other.
+func (r Relationship) Mutual() bool {
+	return r.Following && r.FollowedBy
+}
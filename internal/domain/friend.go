@@ -0,0 +1,50 @@
+package domain
+
+import "time"
+
+type FriendRequestStatus uint8
+
+const (
+	FriendRequestStatusUnknown FriendRequestStatus = iota
+	// FriendRequestStatusPending waits for the addressee to answer.
+	FriendRequestStatusPending
+	FriendRequestStatusAccepted
+	FriendRequestStatusDeclined
+	// FriendRequestStatusCancelled was withdrawn by the requester.
+	FriendRequestStatusCancelled
+)
+
+func (s FriendRequestStatus) String() string {
+	switch s {
+	case FriendRequestStatusPending:
+		return "pending"
+	case FriendRequestStatusAccepted:
+		return "accepted"
+	case FriendRequestStatusDeclined:
+		return "declined"
+	case FriendRequestStatusCancelled:
+		return "cancelled"
+	}
+	return "unknown"
+}
+
+// FriendRequest asks AddresseeID to become friends with RequesterID. There
+// is at most one request per requester and addressee; sending another one
+// reopens it.
+type FriendRequest struct {
+	ID          int64
+	RequesterID int64
+	AddresseeID int64
+	Status      FriendRequestStatus
+	Ctime       time.Time
+	Utime       time.Time
+}
+
+// Friendship is one side of a mutual friendship: UserID is friends with
+// FriendID, and the other side exists as well.
+type Friendship struct {
+	ID       int64
+	UserID   int64
+	FriendID int64
+	Ctime    time.Time
+}
@@ -0,0 +1,150 @@
+package domain
+
+import "time"
+
+// GroupRole is a member's role in a group. Higher roles may do everything
+// lower ones may.
+type GroupRole uint8
+
+const (
+	GroupRoleNone GroupRole = iota
+	GroupRoleMember
+	// GroupRoleAdmin manages members, join requests and invites.
+	GroupRoleAdmin
+	// GroupRoleOwner additionally changes roles, and transfers or deletes
+	// the group. Every group has exactly one owner.
+	GroupRoleOwner
+)
+
+func (r GroupRole) String() string {
+	switch r {
+	case GroupRoleMember:
+		return "member"
+	case GroupRoleAdmin:
+		return "admin"
+	case GroupRoleOwner:
+		return "owner"
+	}
+	return "none"
+}
+
+func ParseGroupRole(s string) GroupRole {
+	switch s {
+	case "member":
+		return GroupRoleMember
+	case "admin":
+		return GroupRoleAdmin
+	case "owner":
+		return GroupRoleOwner
+	}
+	return GroupRoleNone
+}
+
+// GroupVisibility is who may see the posts and members of a group. Its name
+// and description are always visible.
+type GroupVisibility string
+
+const (
+	GroupVisibilityPublic  GroupVisibility = "public"
+	GroupVisibilityPrivate GroupVisibility = "private"
+)
+
+// GroupJoinPolicy is how users become members.
+type GroupJoinPolicy string
+
+const (
+	// GroupJoinRequest lets users ask to join; an admin approves them. Admins
+	// may invite users as well.
+	GroupJoinRequest GroupJoinPolicy = "request"
+	// GroupJoinInvite only lets invited users join.
+	GroupJoinInvite GroupJoinPolicy = "invite"
+)
+
+// GroupPostPolicy is who may post in a group.
+type GroupPostPolicy string
+
+const (
+	GroupPostMembers GroupPostPolicy = "members"
+	GroupPostAdmins  GroupPostPolicy = "admins"
+)
+
+type GroupSettings struct {
+	Visibility GroupVisibility
+	JoinPolicy GroupJoinPolicy
+	PostPolicy GroupPostPolicy
+}
+
+func (s GroupSettings) Valid() bool {
+	return (s.Visibility == GroupVisibilityPublic || s.Visibility == GroupVisibilityPrivate) &&
+		(s.JoinPolicy == GroupJoinRequest || s.JoinPolicy == GroupJoinInvite) &&
+		(s.PostPolicy == GroupPostMembers || s.PostPolicy == GroupPostAdmins)
+}
+
+type Group struct {
+	ID          int64
+	Name        string
+	Description string
+	OwnerID     int64
+	Settings    GroupSettings
+	MemberCount int64
+	Ctime       time.Time
+	Utime       time.Time
+}
+
+type GroupMember struct {
+	// ID orders members by when they joined.
+	ID      int64
+	GroupID int64
+	User    User
+	Role    GroupRole
+	Ctime   time.Time
+}
+
+// GroupPendingKind tells invites and join requests apart.
+type GroupPendingKind uint8
+
+const (
+	GroupPendingUnknown GroupPendingKind = iota
+	// GroupPendingRequest waits for an admin to approve the user.
+	GroupPendingRequest
+	// GroupPendingInvite waits for the invited user to accept.
+	GroupPendingInvite
+)
+
+func (k GroupPendingKind) String() string {
+	switch k {
+	case GroupPendingRequest:
+		return "request"
+	case GroupPendingInvite:
+		return "invite"
+	}
+	return "unknown"
+}
+
+// GroupPending is a join request or an invite that has not been answered. A
+// user has at most one of them per group.
+type GroupPending struct {
+	ID      int64
+	GroupID int64
+	User    User
+	Kind    GroupPendingKind
+	// InviterID is the admin who sent an invite.
+	InviterID int64
+	Ctime     time.Time
+}
+
+type GroupBan struct {
+	ID       int64
+	GroupID  int64
+	User     User
+	BannedBy int64
+	Ctime    time.Time
+}
+
+type GroupPost struct {
+	ID      int64
+	GroupID int64
+	Author  User
+	Content string
+	Ctime   time.Time
+}
@@ -0,0 +1,44 @@
+package domain
+
+import "time"
+
+// Conversation is a private conversation between two users, as seen by one
+// of them.
+type Conversation struct {
+	ID   int64
+	Peer User
+	// LastMessage is the newest message; its ID is 0 while there is none.
+	LastMessage Message
+	// Unread is how many messages of the peer the user has not read.
+	Unread int64
+	// LastReadID is the newest message the user has read, and PeerLastReadID
+	// the newest one the peer has read. Messages up to PeerLastReadID were
+	// seen by the peer.
+	LastReadID     int64
+	PeerLastReadID int64
+	// PeerSent is whether the peer has sent any message.
+	PeerSent bool
+	Ctime    time.Time
+	// Utime is when the last message was sent, or the conversation was
+	// started.
+	Utime time.Time
+}
+
+type Message struct {
+	ID             int64
+	ConversationID int64
+	SenderID       int64
+	Content        string
+	Ctime          time.Time
+}
+
+// ConversationCursor is the position in a conversation list: the update time
+// and ID of the last conversation shown. The zero value is the start.
+type ConversationCursor struct {
+	Utime time.Time
+	ID    int64
+}
+
+func (c ConversationCursor) IsZero() bool {
+	return c.Utime.IsZero()
+}
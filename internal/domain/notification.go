@@ -0,0 +1,83 @@
+package domain
+
+import "time"
+
+type NotificationType uint8
+
+const (
+	NotificationTypeUnknown NotificationType = iota
+	// NotificationTypeFollow groups new followers.
+	NotificationTypeFollow
+	// NotificationTypeLike groups the likes of one article.
+	NotificationTypeLike
+	// NotificationTypeComment groups the root comments on one article.
+	NotificationTypeComment
+	// NotificationTypeReply groups the replies to one comment.
+	NotificationTypeReply
+	NotificationTypeMention
+	NotificationTypeFriendAccepted
+	// NotificationTypeLoginFailed groups failed sign-ins to the account.
+	NotificationTypeLoginFailed
+	NotificationTypeHandleChanged
+)
+
+func (t NotificationType) String() string {
+	switch t {
+	case NotificationTypeFollow:
+		return "follow"
+	case NotificationTypeLike:
+		return "like"
+	case NotificationTypeComment:
+		return "comment"
+	case NotificationTypeReply:
+		return "reply"
+	case NotificationTypeMention:
+		return "mention"
+	case NotificationTypeFriendAccepted:
+		return "friend_accepted"
+	case NotificationTypeLoginFailed:
+		return "login_failed"
+	case NotificationTypeHandleChanged:
+		return "handle_changed"
+	}
+	return "unknown"
+}
+
+// Notification tells a user that something happened. While it is unread,
+// later events of the same group, e.g. more likes of the same article, are
+// merged into it instead of adding notifications.
+type Notification struct {
+	ID     int64
+	UserID int64
+	Type   NotificationType
+	// GroupKey identifies the group; it is empty for notifications that are
+	// never merged.
+	GroupKey string
+	// ArticleID and CommentID are what the notification is about, if
+	// anything.
+	ArticleID int64
+	CommentID int64
+	// Count is how many distinct users took part, or how many times it
+	// happened for notifications without actors.
+	Count int64
+	// Actors are the users who took part, most recent first. Only the most
+	// recent few are loaded.
+	Actors []User
+	// Detail is extra text, e.g. the new handle.
+	Detail string
+	Read   bool
+	Ctime  time.Time
+	// Utime is when the latest event was merged in.
+	Utime time.Time
+}
+
+// NotificationCursor is the position in an inbox: the update time and ID of
+// the last notification shown. The zero value is the start.
+type NotificationCursor struct {
+	Utime time.Time
+	ID    int64
+}
+
+func (c NotificationCursor) IsZero() bool {
+	return c.Utime.IsZero()
+}
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"crypto/rsa"
+	"time"
+)
+
+// OAuthClient is an application that signs its users in with Connectify accounts.
+type OAuthClient struct {
+	ID           int64
+	ClientID     string
+	SecretHash   string
+	Name         string
+	RedirectURIs []string
+	// Public clients (SPAs, mobile apps) cannot keep a secret and must use PKCE.
+	Public  bool
+	OwnerId int64
+	Ctime   time.Time
+}
+
+// AuthorizationCode is the short-lived code handed to the client after the user
+// approves the consent screen. It is exchanged exactly once at the token endpoint.
+type AuthorizationCode struct {
+	CodeHash            string
+	ClientID            string
+	UserId              int64
+	RedirectURI         string
+	Scopes              []string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	AuthTime            time.Time
+	ExpiresAt           time.Time
+}
+
+// OAuthConsent records which scopes a user has granted to a client.
+type OAuthConsent struct {
+	UserId   int64
+	ClientID string
+	Scopes   []string
+	Ctime    time.Time
+	Utime    time.Time
+}
+
+// SigningKey is an RSA key used to sign ID tokens and access tokens.
+type SigningKey struct {
+	KID        string
+	PrivateKey *rsa.PrivateKey
+	Ctime      time.Time
+}
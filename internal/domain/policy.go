@@ -0,0 +1,29 @@
+package domain
+
+import "time"
+
+const (
+	PolicyKindTerms   = "terms"
+	PolicyKindPrivacy = "privacy"
+)
+
+// Policy is one published version of a legal document users must accept.
+type Policy struct {
+	ID          int64
+	Kind        string
+	Version     string
+	Title       string
+	Content     string
+	PublishedAt time.Time
+}
+
+// PolicyConsent records that a user accepted a specific policy version.
+type PolicyConsent struct {
+	UserId     int64
+	PolicyId   int64
+	Kind       string
+	Version    string
+	IP         string
+	UserAgent  string
+	AcceptedAt time.Time
+}
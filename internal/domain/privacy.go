@@ -0,0 +1,38 @@
+package domain
+
+// Audience says who may do something with a user's data.
+type Audience string
+
+const (
+	AudienceEveryone  Audience = "everyone"
+	AudienceFollowers Audience = "followers"
+	AudienceNobody    Audience = "nobody"
+)
+
+func (a Audience) Valid() bool {
+	switch a {
+	case AudienceEveryone, AudienceFollowers, AudienceNobody:
+		return true
+	}
+	return false
+}
+
+// PrivacySettings controls how a user is visible to others. The owner always
+// sees their own data.
+type PrivacySettings struct {
+	// ProfileVisibility is who can see the profile page.
+	ProfileVisibility Audience
+	// Searchable is whether the user shows up in user search.
+	Searchable bool
+	// MessagePermission is who can send the user direct messages.
+	MessagePermission Audience
+}
+
+// DefaultPrivacySettings are the settings of users who never changed them.
+func DefaultPrivacySettings() PrivacySettings {
+	return PrivacySettings{
+		ProfileVisibility: AudienceEveryone,
+		Searchable:        true,
+		MessagePermission: AudienceEveryone,
+	}
+}
@@ -0,0 +1,7 @@
+package domain
+
+// ScimTenant is an enterprise customer allowed to provision users over SCIM.
+type ScimTenant struct {
+	ID   int64
+	Name string
+}
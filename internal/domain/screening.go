@@ -0,0 +1,40 @@
+package domain
+
+import "time"
+
+// ScreeningReason says why a signup attempt was rejected. It is empty when the
+// attempt was allowed.
+type ScreeningReason string
+
+const (
+	ScreeningReasonHoneypot        ScreeningReason = "honeypot"
+	ScreeningReasonDisposableEmail ScreeningReason = "disposable_email"
+	ScreeningReasonIPVelocity      ScreeningReason = "ip_velocity"
+	ScreeningReasonSubnetVelocity  ScreeningReason = "subnet_velocity"
+	ScreeningReasonNoMailServer    ScreeningReason = "no_mail_server"
+)
+
+// SignupAttempt is what the screening pipeline knows about a signup request.
+type SignupAttempt struct {
+	// Email is empty when a guest account is created.
+	Email string
+	IP    string
+	// Honeypot is a form field hidden from people; bots tend to fill it in.
+	Honeypot string
+}
+
+// ScreeningDecision is the recorded outcome of screening one signup attempt.
+type ScreeningDecision struct {
+	ID     int64
+	Email  string
+	IP     string
+	Subnet string
+	Reason ScreeningReason
+	// Detail is a human readable explanation for reviewers.
+	Detail string
+	Ctime  time.Time
+}
+
+func (d ScreeningDecision) Allowed() bool {
+	return d.Reason == ""
+}
@@ -1,9 +1,87 @@
 package domain
 
+import "time"
+
 type User struct {
-	ID       int64
-	Email    string
+	ID    int64
+	Email string
+	// Phone is an E.164 number, set for users who signed up with their phone.
+	Phone    string
 	Password string
 	Nickname string
 	Intro    string
+	// IntroHTML is Intro rendered from Markdown and sanitized.
+	IntroHTML string
+
+	// Profile details; all optional. Birthday is a date, the zero time when unset.
+	Birthday  time.Time
+	Location  string
+	Websites  []string
+	Gender    string
+	AvatarURL string
+
+	// Handle is the unique public @name, empty until the user claims one.
+	Handle          string
+	HandleChangedAt time.Time
+
+	Privacy PrivacySettings
+
+	// Guest users were created anonymously and have no credentials yet.
+	Guest bool
+
+	// TenantId and ExternalId are set for users provisioned over SCIM.
+	TenantId    int64
+	ExternalId  string
+	Deactivated bool
+
+	Ctime time.Time
+	Utime time.Time
+}
+
+const (
+	GenderMale   = "male"
+	GenderFemale = "female"
+	GenderOther  = "other"
+)
+
+// UserProfilePatch is a partial profile update. Nil fields are left as they
+// are; a pointer to the zero value clears the field.
+type UserProfilePatch struct {
+	Nickname  *string
+	Intro     *string
+	Birthday  *time.Time
+	Location  *string
+	Websites  *[]string
+	Gender    *string
+	AvatarURL *string
+}
+
+// UserFilter is a single condition when searching users, such as one clause
+// of a SCIM filter expression.
+type UserFilter struct {
+	// Field is one of the UserField constants.
+	Field string
+	// Op is one of eq, ne, co, sw, ew and pr.
+	Op    string
+	Value string
+}
+
+const (
+	UserFieldEmail      = "email"
+	UserFieldNickname   = "nickname"
+	UserFieldExternalId = "externalId"
+	UserFieldActive     = "active"
+)
+
+// ExternalIdentity is an account at a third-party identity provider that a
+// user signs in with.
+type ExternalIdentity struct {
+	// Provider is the name the provider is configured under, e.g. "google".
+	Provider string
+	// Subject identifies the account at the provider and never changes.
+	Subject string
+	// Email is only trusted when the provider says it verified it.
+	Email         string
+	EmailVerified bool
+	Name          string
 }
@@ -0,0 +1,28 @@
+package event
+
+const TopicArticlePublished = "article.published"
+
+// ArticlePublished is published every time an author publishes an article,
+// including republishing after edits and scheduled publishing.
+type ArticlePublished struct {
+	ArticleID int64
+	AuthorID  int64
+}
+
+func (ArticlePublished) Topic() string {
+	return TopicArticlePublished
+}
+
+const TopicArticleLiked = "article.liked"
+
+// ArticleLiked is published when UserID likes an article for the first time
+// since they last unliked it.
+type ArticleLiked struct {
+	ArticleID int64
+	AuthorID  int64
+	UserID    int64
+}
+
+func (ArticleLiked) Topic() string {
+	return TopicArticleLiked
+}
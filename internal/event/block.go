@@ -0,0 +1,14 @@
+package event
+
+const TopicUserBlocked = "user.blocked"
+
+// UserBlocked is published when BlockerID blocks BlockedID, so that whatever
+// ties the two users, such as follows, can be undone.
+type UserBlocked struct {
+	BlockerID int64
+	BlockedID int64
+}
+
+func (UserBlocked) Topic() string {
+	return TopicUserBlocked
+}
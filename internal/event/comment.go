@@ -0,0 +1,35 @@
+package event
+
+const (
+	TopicCommentPosted = "comment.posted"
+	TopicUserMentioned = "user.mentioned"
+)
+
+// CommentPosted is published when a comment becomes visible to readers:
+// when it is posted, or when the author of the article approves it.
+type CommentPosted struct {
+	CommentID       int64
+	ArticleID       int64
+	ArticleAuthorID int64
+	// ParentID and ParentAuthorID are 0 for root comments.
+	ParentID       int64
+	ParentAuthorID int64
+	AuthorID       int64
+}
+
+func (CommentPosted) Topic() string {
+	return TopicCommentPosted
+}
+
+// UserMentioned is published for every user mentioned by handle in a
+// comment when it becomes visible.
+type UserMentioned struct {
+	CommentID   int64
+	ArticleID   int64
+	AuthorID    int64
+	MentionedID int64
+}
+
+func (UserMentioned) Topic() string {
+	return TopicUserMentioned
+}
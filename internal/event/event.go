@@ -0,0 +1,53 @@
+package event
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// Event is something that happened which other parts of the app may react
+// to, e.g. by notifying users. Producers publish events instead of calling
+// the consumers, so they do not depend on them.
+type Event interface {
+	// Topic names the kind of event; subscribers register per topic.
+	Topic() string
+}
+
+// Publisher is what producers depend on.
+type Publisher interface {
+	Publish(ctx context.Context, e Event)
+}
+
+// Handler reacts to one event. Its error is logged; it cannot fail the
+// action that produced the event.
+type Handler func(ctx context.Context, e Event) error
+
+// Bus delivers events to the handlers subscribed to their topic, in the
+// order they subscribed. Delivery is synchronous and in-process, so handlers
+// should be quick, and events are lost if the process stops while handling.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]Handler)}
+}
+
+func (b *Bus) Subscribe(topic string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[topic] = append(b.handlers[topic], h)
+}
+
+func (b *Bus) Publish(ctx context.Context, e Event) {
+	b.mu.RLock()
+	handlers := b.handlers[e.Topic()]
+	b.mu.RUnlock()
+	for _, h := range handlers {
+		if err := h(ctx, e); err != nil {
+			log.Printf("handle %s event: %v", e.Topic(), err)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package event
+
+const (
+	TopicUserFollowed   = "user.followed"
+	TopicUserUnfollowed = "user.unfollowed"
+)
+
+// UserFollowed is published when FollowerID starts following FolloweeID.
+type UserFollowed struct {
+	FollowerID int64
+	FolloweeID int64
+}
+
+func (UserFollowed) Topic() string {
+	return TopicUserFollowed
+}
+
+// UserUnfollowed is published when FollowerID stops following FolloweeID.
+type UserUnfollowed struct {
+	FollowerID int64
+	FolloweeID int64
+}
+
+func (UserUnfollowed) Topic() string {
+	return TopicUserUnfollowed
+}
@@ -0,0 +1,15 @@
+package event
+
+const TopicFriendRequestAccepted = "friend.request_accepted"
+
+// FriendRequestAccepted is published when AddresseeID accepts the friend
+// request RequesterID sent, so that the requester can be told.
+type FriendRequestAccepted struct {
+	RequestID   int64
+	RequesterID int64
+	AddresseeID int64
+}
+
+func (FriendRequestAccepted) Topic() string {
+	return TopicFriendRequestAccepted
+}
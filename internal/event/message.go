@@ -0,0 +1,31 @@
+package event
+
+const (
+	TopicMessageSent  = "message.sent"
+	TopicMessagesRead = "message.read"
+)
+
+// MessageSent is published when SenderID sends RecipientID a direct message.
+type MessageSent struct {
+	MessageID      int64
+	ConversationID int64
+	SenderID       int64
+	RecipientID    int64
+}
+
+func (MessageSent) Topic() string {
+	return TopicMessageSent
+}
+
+// MessagesRead is published when ReaderID has read the conversation up to
+// MessageID, so that PeerID can be shown a read receipt.
+type MessagesRead struct {
+	ConversationID int64
+	ReaderID       int64
+	PeerID         int64
+	MessageID      int64
+}
+
+func (MessagesRead) Topic() string {
+	return TopicMessagesRead
+}
@@ -0,0 +1,14 @@
+package event
+
+const TopicNotificationAdded = "notification.added"
+
+// NotificationAdded is published when a notification is added to UserID's
+// inbox, or an unread one is updated because an event was merged into it.
+type NotificationAdded struct {
+	NotificationID int64
+	UserID         int64
+}
+
+func (NotificationAdded) Topic() string {
+	return TopicNotificationAdded
+}
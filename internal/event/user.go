@@ -0,0 +1,27 @@
+package event
+
+const (
+	TopicLoginFailed   = "user.login_failed"
+	TopicHandleChanged = "user.handle_changed"
+)
+
+// LoginFailed is published when someone tries to sign in to an existing
+// account with a wrong password.
+type LoginFailed struct {
+	UserID int64
+}
+
+func (LoginFailed) Topic() string {
+	return TopicLoginFailed
+}
+
+// HandleChanged is published when a user replaces their handle.
+type HandleChanged struct {
+	UserID    int64
+	OldHandle string
+	NewHandle string
+}
+
+func (HandleChanged) Topic() string {
+	return TopicHandleChanged
+}
@@ -0,0 +1,35 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/service"
+)
+
+// FeedTaskJob pushes published articles and backfills into feed inboxes.
+type FeedTaskJob struct {
+	svc   *service.FeedService
+	batch int
+}
+
+func NewFeedTaskJob(svc *service.FeedService, batch int) *FeedTaskJob {
+	return &FeedTaskJob{
+		svc:   svc,
+		batch: batch,
+	}
+}
+
+func (f *FeedTaskJob) Name() string {
+	return "feed_task"
+}
+
+func (f *FeedTaskJob) Run(ctx context.Context) error {
+	for {
+		n, err := f.svc.RunTasks(ctx, time.Now(), f.batch)
+		// A full batch means more may be due.
+		if err != nil || n < f.batch || ctx.Err() != nil {
+			return err
+		}
+	}
+}
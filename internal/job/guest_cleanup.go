@@ -0,0 +1,36 @@
+package job
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/service"
+)
+
+// GuestCleanupJob deletes guest accounts that stayed inactive past a TTL.
+type GuestCleanupJob struct {
+	svc   *service.UserService
+	ttl   time.Duration
+	batch int
+}
+
+func NewGuestCleanupJob(svc *service.UserService, ttl time.Duration, batch int) *GuestCleanupJob {
+	return &GuestCleanupJob{
+		svc:   svc,
+		ttl:   ttl,
+		batch: batch,
+	}
+}
+
+func (g *GuestCleanupJob) Name() string {
+	return "guest_cleanup"
+}
+
+func (g *GuestCleanupJob) Run(ctx context.Context) error {
+	n, err := g.svc.DeleteInactiveGuests(ctx, g.ttl, g.batch)
+	if n > 0 {
+		log.Printf("deleted %d inactive guest accounts", n)
+	}
+	return err
+}
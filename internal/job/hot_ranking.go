@@ -0,0 +1,27 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/service"
+)
+
+// HotRankingJob recomputes the trending articles.
+type HotRankingJob struct {
+	svc *service.HotService
+}
+
+func NewHotRankingJob(svc *service.HotService) *HotRankingJob {
+	return &HotRankingJob{svc: svc}
+}
+
+func (h *HotRankingJob) Name() string {
+	return "hot_ranking"
+}
+
+func (h *HotRankingJob) Run(ctx context.Context) error {
+	// Instances that find another one computing the ranking skip this run.
+	_, err := h.svc.Refresh(ctx, time.Now())
+	return err
+}
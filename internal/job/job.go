@@ -0,0 +1,78 @@
+package job
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Job is a unit of background work that runs periodically.
+type Job interface {
+	Name() string
+	Run(ctx context.Context) error
+}
+
+// Scheduler runs each registered job on its own interval until the context
+// passed to Start is cancelled.
+type Scheduler struct {
+	entries []entry
+	wg      sync.WaitGroup
+}
+
+type entry struct {
+	job      Job
+	interval time.Duration
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// Register adds a job that runs once at startup and then every interval.
+func (s *Scheduler) Register(job Job, interval time.Duration) *Scheduler {
+	s.entries = append(s.entries, entry{job: job, interval: interval})
+	return s
+}
+
+// Start launches the registered jobs in the background. Runs of the same job
+// never overlap: the next tick is skipped while one is still running.
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, e := range s.entries {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.loop(ctx, e)
+		}()
+	}
+}
+
+// Wait blocks until every job loop has exited after the context is cancelled.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, e entry) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		s.run(ctx, e.job)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, job Job) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("job %s panicked: %v", job.Name(), r)
+		}
+	}()
+	start := time.Now()
+	if err := job.Run(ctx); err != nil {
+		log.Printf("job %s failed after %v: %v", job.Name(), time.Since(start), err)
+	}
+}
@@ -0,0 +1,39 @@
+package job
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/service"
+)
+
+// ScheduledPublishJob publishes articles whose scheduled time has passed.
+type ScheduledPublishJob struct {
+	svc   *service.ArticleService
+	batch int
+}
+
+func NewScheduledPublishJob(svc *service.ArticleService, batch int) *ScheduledPublishJob {
+	return &ScheduledPublishJob{
+		svc:   svc,
+		batch: batch,
+	}
+}
+
+func (p *ScheduledPublishJob) Name() string {
+	return "scheduled_publish"
+}
+
+func (p *ScheduledPublishJob) Run(ctx context.Context) error {
+	for {
+		n, err := p.svc.PublishDue(ctx, time.Now(), p.batch)
+		if n > 0 {
+			log.Printf("published %d scheduled articles", n)
+		}
+		// A full batch means more may be due.
+		if err != nil || n < p.batch || ctx.Err() != nil {
+			return err
+		}
+	}
+}
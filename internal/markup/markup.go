@@ -0,0 +1,89 @@
+// Package markup turns user-written Markdown into HTML that is safe to embed
+// in a page.
+//
+// Rendering happens in two steps: goldmark renders the Markdown with raw HTML
+// disabled, then a bluemonday allowlist removes anything that is not plain
+// formatting. The second step alone must be enough to stop script injection,
+// so Sanitize is exported and can be checked against payloads directly.
+package markup
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"golang.org/x/net/html"
+)
+
+// Version identifies the rendering pipeline. Bump it whenever the Markdown
+// options or the allowlist change; HTML cached under an older version is
+// rendered again before it is served.
+const Version = 1
+
+var (
+	md = goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+	)
+	policy = newPolicy()
+)
+
+// newPolicy builds the allowlist. It starts from bluemonday's policy for user
+// generated content and forces every link to carry rel="nofollow"; links to
+// other sites also open in a new tab with rel="nofollow noopener".
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireParseableURLs(true)
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	// GFM task lists render disabled checkboxes.
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}
+
+// Render converts Markdown to sanitized HTML.
+func Render(src string) string {
+	if strings.TrimSpace(src) == "" {
+		return ""
+	}
+	var buf bytes.Buffer
+	// Converting into a bytes.Buffer cannot fail.
+	_ = md.Convert([]byte(src), &buf)
+	return Sanitize(buf.String())
+}
+
+// Sanitize strips every tag and attribute that is not on the allowlist.
+func Sanitize(s string) string {
+	return policy.Sanitize(s)
+}
+
+// Fresh reports whether HTML rendered by the given pipeline version can be
+// served as is.
+func Fresh(version int) bool {
+	return version == Version
+}
+
+// Excerpt returns the first n characters of the text in a rendered HTML
+// fragment, for previews and list views.
+func Excerpt(s string, n int) string {
+	var words []string
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if tt == html.TextToken {
+			words = append(words, strings.Fields(string(z.Text()))...)
+		}
+	}
+	text := []rune(strings.Join(words, " "))
+	if len(text) <= n {
+		return string(text)
+	}
+	return strings.TrimSpace(string(text[:n])) + "…"
+}
@@ -0,0 +1,220 @@
+package markup_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ktsoator/connectify/internal/markup"
+	"golang.org/x/net/html"
+)
+
+// forbiddenElements can run script or restyle the page.
+var forbiddenElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "frame": true, "frameset": true,
+	"object": true, "embed": true, "applet": true, "svg": true, "math": true,
+	"form": true, "button": true, "textarea": true, "select": true,
+	"base": true, "link": true, "meta": true, "template": true, "noscript": true,
+	"xmp": true, "plaintext": true,
+}
+
+var urlAttributes = map[string]bool{
+	"href": true, "src": true, "action": true, "formaction": true, "background": true,
+	"cite": true, "poster": true, "srcset": true, "xlink:href": true, "data": true,
+}
+
+// assertSafe fails when out contains an element, attribute or URL that could
+// run script once embedded in a page.
+func assertSafe(t *testing.T, out string) {
+	t.Helper()
+	z := html.NewTokenizer(strings.NewReader(out))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken && tt != html.EndTagToken {
+			continue
+		}
+		tok := z.Token()
+		if forbiddenElements[tok.Data] {
+			t.Errorf("element <%s> survived in %q", tok.Data, out)
+		}
+		if tok.Data == "input" {
+			for _, a := range tok.Attr {
+				if a.Key == "type" && a.Val != "checkbox" {
+					t.Errorf("input of type %q survived in %q", a.Val, out)
+				}
+			}
+		}
+		for _, a := range tok.Attr {
+			key := strings.ToLower(a.Key)
+			switch {
+			case strings.HasPrefix(key, "on"):
+				t.Errorf("event handler %s survived in %q", a.Key, out)
+			case key == "style":
+				t.Errorf("style attribute survived in %q", out)
+			case urlAttributes[key]:
+				assertSafeURL(t, a.Val, out)
+			}
+		}
+	}
+}
+
+// assertSafeURL checks a URL the way a browser reads it: the tokenizer has
+// already decoded entities, and browsers ignore whitespace and control
+// characters inside the scheme.
+func assertSafeURL(t *testing.T, raw, out string) {
+	t.Helper()
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, raw)
+	u, err := url.Parse(cleaned)
+	if err != nil {
+		t.Errorf("unparseable URL %q survived in %q", raw, out)
+		return
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+	default:
+		t.Errorf("URL with scheme %q survived in %q", u.Scheme, out)
+	}
+}
+
+// xssCorpus are payloads users could put into an intro, article or comment.
+// Every one is run through Render and, since the allowlist alone must hold,
+// through Sanitize.
+var xssCorpus = []struct {
+	name    string
+	payload string
+}{
+	// javascript: and other script-capable URLs.
+	{"markdown link", "[click](javascript:alert(1))"},
+	{"markdown link uppercase", "[click](JaVaScRiPt:alert(1))"},
+	{"markdown link with spaces", "[click]( javascript:alert(1) )"},
+	{"markdown image", "![x](javascript:alert(1))"},
+	{"reference link", "[click][x]\n\n[x]: javascript:alert(1)"},
+	{"autolink", "<javascript:alert(1)>"},
+	{"html link", `<a href="javascript:alert(1)">click</a>`},
+	{"html link with tab", "<a href=\"java\tscript:alert(1)\">click</a>"},
+	{"html link with newline", "<a href=\"java\nscript:alert(1)\">click</a>"},
+	{"html link with leading control", "<a href=\"\x01javascript:alert(1)\">click</a>"},
+	{"vbscript", `<a href="vbscript:msgbox(1)">click</a>`},
+	{"data html", `<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">click</a>`},
+	{"data image link", "[x](data:text/html,<script>alert(1)</script>)"},
+	{"img src", `<img src="javascript:alert(1)">`},
+	{"form action", `<form action="javascript:alert(1)"><button>go</button></form>`},
+	{"button formaction", `<button formaction="javascript:alert(1)">go</button>`},
+
+	// Entity-encoded schemes.
+	{"decimal entities", `<a href="&#106;&#97;&#118;&#97;&#115;&#99;&#114;&#105;&#112;&#116;&#58;alert(1)">click</a>`},
+	{"hex entities", `<a href="&#x6A;&#x61;&#x76;&#x61;&#x73;&#x63;&#x72;&#x69;&#x70;&#x74;&#x3A;alert(1)">click</a>`},
+	{"entities without semicolons", `<a href="&#106&#97&#118&#97&#115&#99&#114&#105&#112&#116&#58alert(1)">click</a>`},
+	{"padded entities", `<a href="&#0000106&#0000097&#0000118&#0000097&#0000115&#0000099&#0000114&#0000105&#0000112&#0000116&#0000058alert(1)">click</a>`},
+	{"named colon entity", `<a href="javascript&colon;alert(1)">click</a>`},
+	{"entity tab in scheme", `<a href="jav&#x09;ascript:alert(1)">click</a>`},
+	{"markdown link with entities", "[click](&#106;avascript:alert(1))"},
+	{"markdown link with colon entity", "[click](javascript&#58;alert(1))"},
+	{"percent-encoded scheme", "[click](javascript%3Aalert(1))"},
+
+	// Event-handler attributes.
+	{"img onerror", `<img src=x onerror=alert(1)>`},
+	{"img onerror uppercase", `<IMG SRC=x ONERROR=alert(1)>`},
+	{"body onload", `<body onload=alert(1)>`},
+	{"div onmouseover", `<div onmouseover="alert(1)">hover</div>`},
+	{"link onclick", `<a href="https://example.com" onclick="alert(1)">click</a>`},
+	{"details ontoggle", `<details open ontoggle=alert(1)>`},
+	{"input onfocus", `<input autofocus onfocus=alert(1)>`},
+	{"slash separated", `<img/src=x/onerror=alert(1)>`},
+	{"quote breaking", `<a href="https://example.com" title="x" onmouseover="alert(1)">x</a>`},
+	{"video source onerror", `<video><source onerror="alert(1)"></video>`},
+	{"marquee onstart", `<marquee onstart=alert(1)>`},
+
+	// <svg>, <iframe>, <style> and other dangerous elements.
+	{"script", `<script>alert(1)</script>`},
+	{"script uppercase", `<SCRIPT SRC=https://evil.example/x.js></SCRIPT>`},
+	{"nested script", `<scr<script>ipt>alert(1)</scr</script>ipt>`},
+	{"svg onload", `<svg onload=alert(1)>`},
+	{"svg script", `<svg><script>alert(1)</script></svg>`},
+	{"svg animate", `<svg><animate onbegin=alert(1) attributeName=x dur=1s>`},
+	{"svg xlink", `<svg><a xlink:href="javascript:alert(1)"><text x="20" y="20">x</text></a></svg>`},
+	{"svg foreignObject", `<svg><foreignObject><iframe src="javascript:alert(1)"></iframe></foreignObject></svg>`},
+	{"math", `<math><mtext><table><mglyph><style><img src=x onerror=alert(1)>`},
+	{"iframe", `<iframe src="https://evil.example"></iframe>`},
+	{"iframe srcdoc", `<iframe srcdoc="<script>alert(1)</script>"></iframe>`},
+	{"frameset", `<frameset><frame src="javascript:alert(1)"></frameset>`},
+	{"object", `<object data="javascript:alert(1)"></object>`},
+	{"embed", `<embed src="javascript:alert(1)">`},
+	{"style element", `<style>body{background:url(javascript:alert(1))}</style>`},
+	{"style import", `<style>@import 'https://evil.example/x.css';</style>`},
+	{"style attribute", `<p style="background:url(javascript:alert(1))">x</p>`},
+	{"style expression", `<div style="width: expression(alert(1))">x</div>`},
+	{"base href", `<base href="https://evil.example/">`},
+	{"meta refresh", `<meta http-equiv="refresh" content="0;url=javascript:alert(1)">`},
+	{"link stylesheet", `<link rel="stylesheet" href="https://evil.example/x.css">`},
+	{"template", `<template><img src=x onerror=alert(1)></template>`},
+	{"noscript breakout", `<noscript><p title="</noscript><img src=x onerror=alert(1)>">`},
+	{"comment breakout", `<!--<img src="--><img src=x onerror=alert(1)//">`},
+	{"cdata", `<![CDATA[<script>alert(1)</script>]]>`},
+
+	// Raw HTML inside Markdown.
+	{"html block", "# Title\n\n<div>\n<script>alert(1)</script>\n</div>\n\nText"},
+	{"inline html", "Hello <img src=x onerror=alert(1)> world"},
+	{"html in emphasis", "*<script>alert(1)</script>*"},
+	{"html in link text", "[<img src=x onerror=alert(1)>](https://example.com)"},
+	{"html in list", "- item\n- <iframe src=javascript:alert(1)></iframe>"},
+	{"html in table", "| a | b |\n|---|---|\n| <svg onload=alert(1)> | x |"},
+	{"html in blockquote", "> <style>*{display:none}</style>"},
+	{"html in heading", "## <a href=\"javascript:alert(1)\">x</a>"},
+	{"fenced code", "```html\n<script>alert(1)</script>\n```"},
+	{"inline code", "`<img src=x onerror=alert(1)>`"},
+	{"link title breakout", `[x](https://example.com "a\" onmouseover=\"alert(1)")`},
+	{"image alt breakout", `![" onerror="alert(1)](https://example.com/x.png)`},
+}
+
+func TestXSSCorpus(t *testing.T) {
+	for _, tc := range xssCorpus {
+		t.Run(tc.name, func(t *testing.T) {
+			assertSafe(t, markup.Render(tc.payload))
+			assertSafe(t, markup.Sanitize(tc.payload))
+		})
+	}
+}
+
+// TestRenderKeepsFormatting guards against making the allowlist so strict
+// that ordinary Markdown stops working.
+func TestRenderKeepsFormatting(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"emphasis", "*a* **b** ~~c~~", "<p><em>a</em> <strong>b</strong> <del>c</del></p>"},
+		{"external link", "[site](https://example.com)",
+			`<p><a href="https://example.com" rel="nofollow noopener" target="_blank">site</a></p>`},
+		{"relative link", "[home](/u/alice)", `<p><a href="/u/alice" rel="nofollow">home</a></p>`},
+		{"mailto", "[mail](mailto:a@example.com)", `<p><a href="mailto:a@example.com" rel="nofollow">mail</a></p>`},
+		{"image", "![cat](https://example.com/cat.png)", `<p><img src="https://example.com/cat.png" alt="cat"></p>`},
+		{"code keeps text", "`<b>`", "<p><code>&lt;b&gt;</code></p>"},
+		{"task list", "- [x] done",
+			`<ul>` + "\n" + `<li><input checked="" disabled="" type="checkbox"> done</li>` + "\n" + `</ul>`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := strings.TrimSpace(markup.Render(tc.src)); got != tc.want {
+				t.Errorf("Render(%q) = %q, want %q", tc.src, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRenderEmpty(t *testing.T) {
+	for _, src := range []string{"", "   ", "\n\t"} {
+		if got := markup.Render(src); got != "" {
+			t.Errorf("Render(%q) = %q, want empty", src, got)
+		}
+	}
+}
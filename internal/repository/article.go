@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/markup"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+)
+
+var ErrArticleNotFound = dao.ErrRecordNotFound
+
+type ArticleRepository struct {
+	dao *dao.ArticleDAO
+}
+
+func NewArticleRepository(dao *dao.ArticleDAO) *ArticleRepository {
+	return &ArticleRepository{dao: dao}
+}
+
+func (r *ArticleRepository) Create(ctx context.Context, art domain.Article) (int64, error) {
+	return r.dao.Insert(ctx, r.toModel(art))
+}
+
+func (r *ArticleRepository) Update(ctx context.Context, art domain.Article) error {
+	return r.notFound(r.dao.UpdateById(ctx, r.toModel(art)))
+}
+
+// Sync saves the working copy and makes it the published copy.
+func (r *ArticleRepository) Sync(ctx context.Context, art domain.Article) (int64, error) {
+	id, err := r.dao.Sync(ctx, r.toModel(art))
+	return id, r.notFound(err)
+}
+
+func (r *ArticleRepository) SyncStatus(ctx context.Context, id, authorId int64, status domain.ArticleStatus) error {
+	return r.notFound(r.dao.SyncStatus(ctx, id, authorId, uint8(status)))
+}
+
+func (r *ArticleRepository) FindById(ctx context.Context, id int64) (domain.Article, error) {
+	art, err := r.dao.FindById(ctx, id)
+	if err != nil {
+		return domain.Article{}, r.notFound(err)
+	}
+	return r.toDomain(art), nil
+}
+
+func (r *ArticleRepository) FindByAuthor(ctx context.Context, authorId int64, offset, limit int) ([]domain.Article, error) {
+	arts, err := r.dao.FindByAuthor(ctx, authorId, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Article, 0, len(arts))
+	for _, art := range arts {
+		res = append(res, r.toDomain(art))
+	}
+	return res, nil
+}
+
+func (r *ArticleRepository) FindPublishedById(ctx context.Context, id int64) (domain.Article, error) {
+	art, err := r.dao.FindPublishedById(ctx, id)
+	if err != nil {
+		return domain.Article{}, r.notFound(err)
+	}
+	return r.publishedToDomain(art), nil
+}
+
+// FindPublished returns one page of the articles readers can see.
+func (r *ArticleRepository) FindPublished(ctx context.Context, offset, limit int) ([]domain.Article, error) {
+	arts, err := r.dao.FindPublished(ctx, uint8(domain.ArticleStatusPublished), offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Article, 0, len(arts))
+	for _, art := range arts {
+		res = append(res, r.publishedToDomain(art))
+	}
+	return res, nil
+}
+
+// FindPublishedByIds returns the articles among ids that readers can see,
+// keyed by ID.
+func (r *ArticleRepository) FindPublishedByIds(ctx context.Context, ids []int64) (map[int64]domain.Article, error) {
+	res := make(map[int64]domain.Article, len(ids))
+	if len(ids) == 0 {
+		return res, nil
+	}
+	arts, err := r.dao.FindPublishedByIds(ctx, ids, uint8(domain.ArticleStatusPublished))
+	if err != nil {
+		return nil, err
+	}
+	for _, art := range arts {
+		res[art.ID] = r.publishedToDomain(art)
+	}
+	return res, nil
+}
+
+// FindPublishedSince returns up to limit articles readers can see that were
+// first published at or after since, with IDs above cursor, in ID order.
+func (r *ArticleRepository) FindPublishedSince(ctx context.Context, since time.Time, cursor int64, limit int) ([]domain.Article, error) {
+	arts, err := r.dao.FindPublishedSince(ctx, uint8(domain.ArticleStatusPublished), since.UnixMilli(), cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Article, 0, len(arts))
+	for _, art := range arts {
+		res = append(res, r.publishedToDomain(art))
+	}
+	return res, nil
+}
+
+// FindPublishedByAuthors returns up to limit articles of the given authors
+// that readers can see, first published after cursor, newest first.
+func (r *ArticleRepository) FindPublishedByAuthors(ctx context.Context, authorIds []int64,
+	cursor domain.FeedCursor, limit int) ([]domain.Article, error) {
+	if len(authorIds) == 0 {
+		return nil, nil
+	}
+	arts, err := r.dao.FindPublishedByAuthors(ctx, authorIds, uint8(domain.ArticleStatusPublished), toFeedCursor(cursor), limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Article, 0, len(arts))
+	for _, art := range arts {
+		res = append(res, r.publishedToDomain(art))
+	}
+	return res, nil
+}
+
+func (r *ArticleRepository) notFound(err error) error {
+	if errors.Is(err, dao.ErrRecordNotFound) {
+		return ErrArticleNotFound
+	}
+	return err
+}
+
+func (r *ArticleRepository) toModel(art domain.Article) dao.ArticleModel {
+	return dao.ArticleModel{
+		ID:          art.ID,
+		Title:       art.Title,
+		Content:     art.Content,
+		ContentHTML: markup.Render(art.Content),
+		HTMLVersion: markup.Version,
+		AuthorId:    art.Author.ID,
+		Status:      uint8(art.Status),
+	}
+}
+
+func (r *ArticleRepository) publishedToDomain(art dao.PublishedArticleModel) domain.Article {
+	return r.toDomain(dao.ArticleModel{
+		ID:          art.ID,
+		Title:       art.Title,
+		Content:     art.Content,
+		ContentHTML: art.ContentHTML,
+		HTMLVersion: art.HTMLVersion,
+		AuthorId:    art.AuthorId,
+		Status:      art.Status,
+		CreatedAt:   art.CreatedAt,
+		UpdatedAt:   art.UpdatedAt,
+	})
+}
+
+func (r *ArticleRepository) toDomain(art dao.ArticleModel) domain.Article {
+	contentHTML := art.ContentHTML
+	if !markup.Fresh(art.HTMLVersion) {
+		// Rendered by an older pipeline; the cache is rewritten on the next save.
+		contentHTML = markup.Render(art.Content)
+	}
+	var publishAt time.Time
+	if art.PublishAt > 0 {
+		publishAt = time.UnixMilli(art.PublishAt)
+	}
+	return domain.Article{
+		ID:        art.ID,
+		Title:     art.Title,
+		Content:   art.Content,
+		HTML:      contentHTML,
+		Author:    domain.Author{ID: art.AuthorId},
+		Status:    domain.ArticleStatus(art.Status),
+		PublishAt: publishAt,
+		Ctime:     time.UnixMilli(art.CreatedAt),
+		Utime:     time.UnixMilli(art.UpdatedAt),
+	}
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+)
+
+type BlockRepository struct {
+	dao *dao.BlockDAO
+}
+
+func NewBlockRepository(dao *dao.BlockDAO) *BlockRepository {
+	return &BlockRepository{dao: dao}
+}
+
+// Add blocks or mutes targetId for userId. It reports false if that was
+// already the case.
+func (r *BlockRepository) Add(ctx context.Context, userId, targetId int64, kind domain.BlockKind) (bool, error) {
+	return r.dao.Insert(ctx, userId, targetId, uint8(kind))
+}
+
+// Remove undoes Add. It reports false if there was nothing to undo.
+func (r *BlockRepository) Remove(ctx context.Context, userId, targetId int64, kind domain.BlockKind) (bool, error) {
+	return r.dao.Delete(ctx, userId, targetId, uint8(kind))
+}
+
+// IsBlocked reports whether either user blocked the other.
+func (r *BlockRepository) IsBlocked(ctx context.Context, a, b int64) (bool, error) {
+	return r.dao.ExistsBetween(ctx, a, b, uint8(domain.BlockKindBlock))
+}
+
+// FindByUser returns up to limit blocks or mutes of a user older than the
+// one with ID cursor, newest first, with the target's ID only.
+func (r *BlockRepository) FindByUser(ctx context.Context, userId int64, kind domain.BlockKind,
+	cursor int64, limit int) ([]domain.Block, error) {
+	bs, err := r.dao.FindByUser(ctx, userId, uint8(kind), cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Block, 0, len(bs))
+	for _, b := range bs {
+		res = append(res, domain.Block{
+			ID:     b.ID,
+			UserID: b.UserId,
+			Target: domain.User{ID: b.TargetId},
+			Kind:   domain.BlockKind(b.Kind),
+			Ctime:  time.UnixMilli(b.CreatedAt),
+		})
+	}
+	return res, nil
+}
+
+// FindHidden returns the users hidden from userId: those blocked by or
+// blocking them, and, if withMuted is set, those they muted.
+func (r *BlockRepository) FindHidden(ctx context.Context, userId int64, withMuted bool) (map[int64]bool, error) {
+	kinds := []uint8{uint8(domain.BlockKindBlock)}
+	if withMuted {
+		kinds = append(kinds, uint8(domain.BlockKindMute))
+	}
+	targets, err := r.dao.FindTargetIds(ctx, userId, kinds)
+	if err != nil {
+		return nil, err
+	}
+	blockers, err := r.dao.FindUserIds(ctx, userId, uint8(domain.BlockKindBlock))
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]bool, len(targets)+len(blockers))
+	for _, id := range targets {
+		res[id] = true
+	}
+	for _, id := range blockers {
+		res[id] = true
+	}
+	return res, nil
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+)
+
+var ErrCommentNotFound = errors.New("comment not found")
+
+type CommentRepository struct {
+	dao *dao.CommentDAO
+}
+
+func NewCommentRepository(dao *dao.CommentDAO) *CommentRepository {
+	return &CommentRepository{dao: dao}
+}
+
+func (r *CommentRepository) Create(ctx context.Context, c domain.Comment) (int64, error) {
+	return r.dao.Insert(ctx, r.toModel(c))
+}
+
+func (r *CommentRepository) FindById(ctx context.Context, id int64) (domain.Comment, error) {
+	c, err := r.dao.FindById(ctx, id)
+	if err != nil {
+		return domain.Comment{}, r.notFound(err)
+	}
+	return r.toDomain(c), nil
+}
+
+// UpdateContent saves an edit, provided the comment is still in the status
+// it had when it was read.
+func (r *CommentRepository) UpdateContent(ctx context.Context, c domain.Comment, oldStatus domain.CommentStatus) error {
+	return r.notFound(r.dao.UpdateContent(ctx, c.ID, uint8(oldStatus), c.Content, uint8(c.Status)))
+}
+
+// UpdateStatus moves a comment from any of the statuses in from to status.
+func (r *CommentRepository) UpdateStatus(ctx context.Context, id int64, from []domain.CommentStatus, status domain.CommentStatus) error {
+	froms := make([]uint8, 0, len(from))
+	for _, s := range from {
+		froms = append(froms, uint8(s))
+	}
+	return r.notFound(r.dao.UpdateStatus(ctx, id, froms, uint8(status)))
+}
+
+// Delete soft deletes a comment. The row stays so that replies keep their
+// place in the thread, but its content is erased.
+func (r *CommentRepository) Delete(ctx context.Context, c domain.Comment) error {
+	return r.notFound(r.dao.UpdateContent(ctx, c.ID, uint8(c.Status), "", uint8(domain.CommentStatusDeleted)))
+}
+
+// FindThreads returns up to limit threads of an article older than cursor,
+// newest first, each with its first replies replies and its reply count.
+// Comments of the hidden authors are left out, and so are threads they
+// started.
+func (r *CommentRepository) FindThreads(ctx context.Context, articleId, viewerId, cursor int64, limit, replies int,
+	hidden []int64) ([]domain.CommentThread, error) {
+	vis := r.visibility(viewerId, hidden)
+	roots, err := r.dao.FindRoots(ctx, articleId, cursor, limit, vis)
+	if err != nil {
+		return nil, err
+	}
+	rootIds := make([]int64, 0, len(roots))
+	for _, c := range roots {
+		rootIds = append(rootIds, c.ID)
+	}
+
+	first, err := r.dao.FindFirstReplies(ctx, rootIds, replies, vis)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := r.dao.CountReplies(ctx, rootIds, vis)
+	if err != nil {
+		return nil, err
+	}
+
+	byRoot := make(map[int64][]domain.Comment, len(roots))
+	for _, c := range first {
+		byRoot[c.RootId] = append(byRoot[c.RootId], r.toDomain(c))
+	}
+	res := make([]domain.CommentThread, 0, len(roots))
+	for _, c := range roots {
+		res = append(res, domain.CommentThread{
+			Root:       r.toDomain(c),
+			Replies:    byRoot[c.ID],
+			ReplyCount: counts[c.ID],
+		})
+	}
+	return res, nil
+}
+
+// FindReplies returns up to limit replies of a thread after cursor, oldest
+// first, leaving out those of the hidden authors.
+func (r *CommentRepository) FindReplies(ctx context.Context, rootId, viewerId, cursor int64, limit int,
+	hidden []int64) ([]domain.Comment, error) {
+	cs, err := r.dao.FindReplies(ctx, rootId, cursor, limit, r.visibility(viewerId, hidden))
+	if err != nil {
+		return nil, err
+	}
+	return r.toDomains(cs), nil
+}
+
+// FindPendingForAuthor returns comments held for review on the articles of
+// authorId, oldest first.
+func (r *CommentRepository) FindPendingForAuthor(ctx context.Context, authorId, cursor int64, limit int) ([]domain.Comment, error) {
+	cs, err := r.dao.FindByArticleAuthor(ctx, authorId, uint8(domain.CommentStatusPending), cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return r.toDomains(cs), nil
+}
+
+// CountVisible returns how many visible comments each article has, keyed by
+// article ID.
+func (r *CommentRepository) CountVisible(ctx context.Context, articleIds []int64) (map[int64]int64, error) {
+	return r.dao.CountByArticles(ctx, articleIds, uint8(domain.CommentStatusVisible))
+}
+
+// visibility shows visible and deleted comments to everybody, and comments
+// held for review to their authors only.
+func (r *CommentRepository) visibility(viewerId int64, hidden []int64) dao.CommentVisibility {
+	return dao.CommentVisibility{
+		Public:        []uint8{uint8(domain.CommentStatusVisible), uint8(domain.CommentStatusDeleted)},
+		OwnStatus:     uint8(domain.CommentStatusPending),
+		ViewerId:      viewerId,
+		HiddenAuthors: hidden,
+	}
+}
+
+func (r *CommentRepository) notFound(err error) error {
+	if errors.Is(err, dao.ErrRecordNotFound) {
+		return ErrCommentNotFound
+	}
+	return err
+}
+
+func (r *CommentRepository) toModel(c domain.Comment) dao.CommentModel {
+	return dao.CommentModel{
+		ID:        c.ID,
+		ArticleId: c.ArticleID,
+		RootId:    c.RootID,
+		ParentId:  c.ParentID,
+		Depth:     uint8(c.Depth),
+		AuthorId:  c.Author.ID,
+		Content:   c.Content,
+		Status:    uint8(c.Status),
+	}
+}
+
+func (r *CommentRepository) toDomains(cs []dao.CommentModel) []domain.Comment {
+	res := make([]domain.Comment, 0, len(cs))
+	for _, c := range cs {
+		res = append(res, r.toDomain(c))
+	}
+	return res
+}
+
+func (r *CommentRepository) toDomain(c dao.CommentModel) domain.Comment {
+	return domain.Comment{
+		ID:        c.ID,
+		ArticleID: c.ArticleId,
+		RootID:    c.RootId,
+		ParentID:  c.ParentId,
+		Depth:     int(c.Depth),
+		Author:    domain.Author{ID: c.AuthorId},
+		Content:   c.Content,
+		Status:    domain.CommentStatus(c.Status),
+		Ctime:     time.UnixMilli(c.CreatedAt),
+		Utime:     time.UnixMilli(c.UpdatedAt),
+	}
+}
@@ -0,0 +1,261 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ArticleModel is the author's working copy of an article.
+type ArticleModel struct {
+	ID      int64  `gorm:"primaryKey;autoIncrement"`
+	Title   string `gorm:"type:varchar(256)"`
+	Content string `gorm:"type:mediumtext"`
+	// ContentHTML caches Content rendered by markup pipeline HTMLVersion.
+	ContentHTML string `gorm:"type:mediumtext"`
+	HTMLVersion int
+	AuthorId    int64 `gorm:"index:idx_article_author_updated,priority:1"`
+	Status      uint8
+	// PublishAt is when the scheduler publishes the working copy, 0 when the
+	// article is not scheduled.
+	PublishAt int64 `gorm:"index"`
+	CreatedAt int64
+	UpdatedAt int64 `gorm:"index:idx_article_author_updated,priority:2"`
+}
+
+// PublishedArticleModel is the copy readers see. It shares its ID with the
+// working copy and is only written when the author publishes.
+type PublishedArticleModel struct {
+	ID          int64  `gorm:"primaryKey;autoIncrement:false"`
+	Title       string `gorm:"type:varchar(256)"`
+	Content     string `gorm:"type:mediumtext"`
+	ContentHTML string `gorm:"type:mediumtext"`
+	HTMLVersion int
+	AuthorId    int64 `gorm:"index:idx_published_author_created,priority:1"`
+	Status      uint8 `gorm:"index:idx_published_status_updated,priority:1;index:idx_published_status_created,priority:1"`
+	// CreatedAt is when the article was first published.
+	CreatedAt int64 `gorm:"index:idx_published_author_created,priority:2;index:idx_published_status_created,priority:2"`
+	UpdatedAt int64 `gorm:"index:idx_published_status_updated,priority:2"`
+}
+
+type ArticleDAO struct {
+	db *gorm.DB
+}
+
+func NewArticleDAO(db *gorm.DB) *ArticleDAO {
+	return &ArticleDAO{db: db}
+}
+
+// Insert creates the working copy together with its first revision.
+func (d *ArticleDAO) Insert(ctx context.Context, art ArticleModel) (int64, error) {
+	now := time.Now().UnixMilli()
+	art.CreatedAt = now
+	art.UpdatedAt = now
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&art).Error; err != nil {
+			return err
+		}
+		return addRevision(tx, art, now)
+	})
+	return art.ID, err
+}
+
+// UpdateById saves the working copy and records a revision. Only the author can update it; for
+// anybody else, or a missing article, it returns ErrRecordNotFound.
+func (d *ArticleDAO) UpdateById(ctx context.Context, art ArticleModel) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := updateArticle(tx, art); err != nil {
+			return err
+		}
+		return addRevision(tx, art, time.Now().UnixMilli())
+	})
+}
+
+// updateArticle writes the working copy. A zero status keeps the current one,
+// so editing a published article does not turn it back into a draft.
+func updateArticle(db *gorm.DB, art ArticleModel) error {
+	columns := map[string]any{
+		"title":        art.Title,
+		"content":      art.Content,
+		"content_html": art.ContentHTML,
+		"html_version": art.HTMLVersion,
+		"updated_at":   time.Now().UnixMilli(),
+	}
+	if art.Status != 0 {
+		columns["status"] = art.Status
+	}
+	res := db.Model(&ArticleModel{}).
+		Where("id = ? AND author_id = ?", art.ID, art.AuthorId).
+		Updates(columns)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Sync saves the working copy, records a revision and copies it to the
+// published table in one transaction, creating the article if it has no ID yet.
+func (d *ArticleDAO) Sync(ctx context.Context, art ArticleModel) (int64, error) {
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UnixMilli()
+		if art.ID > 0 {
+			if err := updateArticle(tx, art); err != nil {
+				return err
+			}
+		} else {
+			art.CreatedAt = now
+			art.UpdatedAt = now
+			if err := tx.Create(&art).Error; err != nil {
+				return err
+			}
+		}
+		if err := addRevision(tx, art, now); err != nil {
+			return err
+		}
+		// Publishing by hand replaces any scheduled publish.
+		if err := tx.Model(&ArticleModel{}).Where("id = ?", art.ID).UpdateColumn("publish_at", 0).Error; err != nil {
+			return err
+		}
+
+		return upsertPublished(tx, art, now)
+	})
+	return art.ID, err
+}
+
+// upsertPublished copies the working copy to the published table.
+func upsertPublished(tx *gorm.DB, art ArticleModel, now int64) error {
+	pub := PublishedArticleModel{
+		ID:          art.ID,
+		Title:       art.Title,
+		Content:     art.Content,
+		ContentHTML: art.ContentHTML,
+		HTMLVersion: art.HTMLVersion,
+		AuthorId:    art.AuthorId,
+		Status:      art.Status,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"title", "content", "content_html", "html_version", "status", "updated_at"}),
+	}).Create(&pub).Error
+}
+
+// SyncStatus sets the status of both copies, e.g. to take an article down.
+// Like Sync, it cancels any scheduled publish, which would otherwise put the
+// article back up. It returns ErrRecordNotFound unless authorId wrote the
+// article.
+func (d *ArticleDAO) SyncStatus(ctx context.Context, id, authorId int64, status uint8) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UnixMilli()
+		res := tx.Model(&ArticleModel{}).
+			Where("id = ? AND author_id = ?", id, authorId).
+			Updates(map[string]any{
+				"status":     status,
+				"publish_at": 0,
+				"updated_at": now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+		return tx.Model(&PublishedArticleModel{}).
+			Where("id = ?", id).
+			Updates(map[string]any{
+				"status":     status,
+				"updated_at": now,
+			}).Error
+	})
+}
+
+func (d *ArticleDAO) FindById(ctx context.Context, id int64) (ArticleModel, error) {
+	var art ArticleModel
+	err := d.db.WithContext(ctx).Where("id = ?", id).First(&art).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ArticleModel{}, ErrRecordNotFound
+		}
+		return ArticleModel{}, err
+	}
+	return art, nil
+}
+
+// FindByAuthor returns one page of an author's working copies, most recently
+// edited first.
+func (d *ArticleDAO) FindByAuthor(ctx context.Context, authorId int64, offset, limit int) ([]ArticleModel, error) {
+	var arts []ArticleModel
+	err := d.db.WithContext(ctx).
+		Where("author_id = ?", authorId).
+		Order("updated_at DESC, id DESC").
+		Offset(offset).Limit(limit).
+		Find(&arts).Error
+	return arts, err
+}
+
+func (d *ArticleDAO) FindPublishedById(ctx context.Context, id int64) (PublishedArticleModel, error) {
+	var art PublishedArticleModel
+	err := d.db.WithContext(ctx).Where("id = ?", id).First(&art).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return PublishedArticleModel{}, ErrRecordNotFound
+		}
+		return PublishedArticleModel{}, err
+	}
+	return art, nil
+}
+
+// FindPublished returns one page of the articles with the given status, most
+// recently published first.
+func (d *ArticleDAO) FindPublished(ctx context.Context, status uint8, offset, limit int) ([]PublishedArticleModel, error) {
+	var arts []PublishedArticleModel
+	err := d.db.WithContext(ctx).
+		Where("status = ?", status).
+		Order("updated_at DESC, id DESC").
+		Offset(offset).Limit(limit).
+		Find(&arts).Error
+	return arts, err
+}
+
+// FindPublishedByIds returns the articles among ids that have the given
+// status, in no particular order.
+func (d *ArticleDAO) FindPublishedByIds(ctx context.Context, ids []int64, status uint8) ([]PublishedArticleModel, error) {
+	var arts []PublishedArticleModel
+	err := d.db.WithContext(ctx).
+		Where("id IN ? AND status = ?", ids, status).
+		Find(&arts).Error
+	return arts, err
+}
+
+// FindPublishedSince returns up to limit articles with the given status first
+// published at or after since, with IDs above cursor, in ID order.
+func (d *ArticleDAO) FindPublishedSince(ctx context.Context, status uint8, since, cursor int64, limit int) ([]PublishedArticleModel, error) {
+	var arts []PublishedArticleModel
+	err := d.db.WithContext(ctx).
+		Where("status = ? AND created_at >= ? AND id > ?", status, since, cursor).
+		Order("id").
+		Limit(limit).
+		Find(&arts).Error
+	return arts, err
+}
+
+// FindPublishedByAuthors returns up to limit articles of the given authors
+// with the given status, first published before the cursor, newest first.
+func (d *ArticleDAO) FindPublishedByAuthors(ctx context.Context, authorIds []int64, status uint8,
+	cursor FeedCursor, limit int) ([]PublishedArticleModel, error) {
+	var arts []PublishedArticleModel
+	err := d.db.WithContext(ctx).
+		Where("author_id IN ? AND status = ?", authorIds, status).
+		Scopes(cursor.scope("created_at", "id")).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&arts).Error
+	return arts, err
+}
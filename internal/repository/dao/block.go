@@ -0,0 +1,89 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BlockModel records that UserId blocked or muted TargetId. The unique key
+// serves a user's own lists, the target index the "who blocked me" lookups.
+type BlockModel struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement"`
+	UserId    int64 `gorm:"uniqueIndex:idx_block_user_target,priority:1"`
+	TargetId  int64 `gorm:"uniqueIndex:idx_block_user_target,priority:3;index:idx_block_target,priority:1"`
+	Kind      uint8 `gorm:"uniqueIndex:idx_block_user_target,priority:2;index:idx_block_target,priority:2"`
+	CreatedAt int64
+}
+
+type BlockDAO struct {
+	db *gorm.DB
+}
+
+func NewBlockDAO(db *gorm.DB) *BlockDAO {
+	return &BlockDAO{db: db}
+}
+
+// Insert blocks or mutes a user. Doing it twice is a no-op that reports
+// false.
+func (d *BlockDAO) Insert(ctx context.Context, userId, targetId int64, kind uint8) (bool, error) {
+	res := d.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&BlockModel{
+		UserId:    userId,
+		TargetId:  targetId,
+		Kind:      kind,
+		CreatedAt: time.Now().UnixMilli(),
+	})
+	return res.RowsAffected > 0, res.Error
+}
+
+// Delete lifts a block or mute. It reports false when there was none.
+func (d *BlockDAO) Delete(ctx context.Context, userId, targetId int64, kind uint8) (bool, error) {
+	res := d.db.WithContext(ctx).
+		Where("user_id = ? AND target_id = ? AND kind = ?", userId, targetId, kind).
+		Delete(&BlockModel{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// ExistsBetween reports whether either user has a block or mute of the
+// given kind on the other.
+func (d *BlockDAO) ExistsBetween(ctx context.Context, a, b int64, kind uint8) (bool, error) {
+	var n int64
+	err := d.db.WithContext(ctx).Model(&BlockModel{}).
+		Where("kind = ? AND ((user_id = ? AND target_id = ?) OR (user_id = ? AND target_id = ?))", kind, a, b, b, a).
+		Count(&n).Error
+	return n > 0, err
+}
+
+// FindByUser returns up to limit blocks or mutes of a user older than the
+// one with ID cursor, newest first. cursor is 0 for the newest.
+func (d *BlockDAO) FindByUser(ctx context.Context, userId int64, kind uint8, cursor int64, limit int) ([]BlockModel, error) {
+	q := d.db.WithContext(ctx).Where("user_id = ? AND kind = ?", userId, kind)
+	if cursor > 0 {
+		q = q.Where("id < ?", cursor)
+	}
+	var bs []BlockModel
+	err := q.Order("id DESC").Limit(limit).Find(&bs).Error
+	return bs, err
+}
+
+// FindTargetIds returns the IDs of all users a user has blocked or muted
+// with one of the given kinds.
+func (d *BlockDAO) FindTargetIds(ctx context.Context, userId int64, kinds []uint8) ([]int64, error) {
+	var ids []int64
+	err := d.db.WithContext(ctx).Model(&BlockModel{}).
+		Where("user_id = ? AND kind IN ?", userId, inList(kinds)).
+		Pluck("target_id", &ids).Error
+	return ids, err
+}
+
+// FindUserIds returns the IDs of all users who blocked or muted targetId
+// with the given kind.
+func (d *BlockDAO) FindUserIds(ctx context.Context, targetId int64, kind uint8) ([]int64, error) {
+	var ids []int64
+	err := d.db.WithContext(ctx).Model(&BlockModel{}).
+		Where("target_id = ? AND kind = ?", targetId, kind).
+		Pluck("user_id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,225 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CommentModel is a comment on an article. Root comments have RootId and
+// ParentId 0; replies point at the comment they answer and at the root of
+// their thread, so a whole thread can be loaded by RootId.
+type CommentModel struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement"`
+	ArticleId int64 `gorm:"index:idx_comment_article_root,priority:1"`
+	RootId    int64 `gorm:"index:idx_comment_article_root,priority:2;index:idx_comment_root"`
+	ParentId  int64
+	Depth     uint8
+	AuthorId  int64  `gorm:"index"`
+	Content   string `gorm:"type:text"`
+	Status    uint8
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+type CommentDAO struct {
+	db *gorm.DB
+}
+
+func NewCommentDAO(db *gorm.DB) *CommentDAO {
+	return &CommentDAO{db: db}
+}
+
+func (d *CommentDAO) Insert(ctx context.Context, c CommentModel) (int64, error) {
+	now := time.Now().UnixMilli()
+	c.CreatedAt = now
+	c.UpdatedAt = now
+	err := d.db.WithContext(ctx).Create(&c).Error
+	return c.ID, err
+}
+
+func (d *CommentDAO) FindById(ctx context.Context, id int64) (CommentModel, error) {
+	var c CommentModel
+	err := d.db.WithContext(ctx).Where("id = ?", id).First(&c).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return CommentModel{}, ErrRecordNotFound
+		}
+		return CommentModel{}, err
+	}
+	return c, nil
+}
+
+// UpdateContent replaces the content and status of a comment, unless its
+// status changed since it was read. It returns ErrRecordNotFound otherwise.
+func (d *CommentDAO) UpdateContent(ctx context.Context, id int64, oldStatus uint8, content string, status uint8) error {
+	res := d.db.WithContext(ctx).Model(&CommentModel{}).
+		Where("id = ? AND status = ?", id, oldStatus).
+		Updates(map[string]any{
+			"content":    content,
+			"status":     status,
+			"updated_at": time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// UpdateStatus moves a comment from one of the statuses in from to status,
+// returning ErrRecordNotFound when it is in none of them.
+func (d *CommentDAO) UpdateStatus(ctx context.Context, id int64, from []uint8, status uint8) error {
+	res := d.db.WithContext(ctx).Model(&CommentModel{}).
+		Where("id = ? AND status IN ?", id, inList(from)).
+		Updates(map[string]any{
+			"status":     status,
+			"updated_at": time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// CommentVisibility selects the comments a viewer may see: those in one of
+// the public statuses, plus the viewer's own comments in OwnStatus, e.g.
+// comments held for review. ViewerId is 0 for anonymous viewers.
+type CommentVisibility struct {
+	Public    []uint8
+	OwnStatus uint8
+	ViewerId  int64
+	// HiddenAuthors are left out whatever the status of their comments.
+	HiddenAuthors []int64
+}
+
+func (v CommentVisibility) scope(db *gorm.DB) *gorm.DB {
+	if len(v.HiddenAuthors) > 0 {
+		db = db.Where("author_id NOT IN ?", v.HiddenAuthors)
+	}
+	if v.ViewerId == 0 {
+		return db.Where("status IN ?", inList(v.Public))
+	}
+	return db.Where("status IN ? OR (status = ? AND author_id = ?)", inList(v.Public), v.OwnStatus, v.ViewerId)
+}
+
+// inList converts statuses for an IN clause; a []uint8 would be bound as a
+// single binary value.
+func inList(statuses []uint8) []int {
+	res := make([]int, 0, len(statuses))
+	for _, s := range statuses {
+		res = append(res, int(s))
+	}
+	return res
+}
+
+// FindRoots returns up to limit root comments of an article older than
+// cursor, newest first. A cursor of 0 starts from the newest.
+func (d *CommentDAO) FindRoots(ctx context.Context, articleId, cursor int64, limit int, vis CommentVisibility) ([]CommentModel, error) {
+	q := d.db.WithContext(ctx).Where("article_id = ? AND root_id = 0", articleId)
+	if cursor > 0 {
+		q = q.Where("id < ?", cursor)
+	}
+	var cs []CommentModel
+	err := q.Scopes(vis.scope).Order("id DESC").Limit(limit).Find(&cs).Error
+	return cs, err
+}
+
+// FindFirstReplies returns the first n replies of each thread, oldest first,
+// in a single query.
+func (d *CommentDAO) FindFirstReplies(ctx context.Context, rootIds []int64, n int, vis CommentVisibility) ([]CommentModel, error) {
+	if len(rootIds) == 0 {
+		return nil, nil
+	}
+	inner := d.db.Model(&CommentModel{}).
+		Select("*, ROW_NUMBER() OVER (PARTITION BY root_id ORDER BY id) AS rn").
+		Where("root_id IN ?", rootIds).
+		Scopes(vis.scope)
+	var cs []CommentModel
+	err := d.db.WithContext(ctx).Table("(?) AS t", inner).
+		Where("rn <= ?", n).
+		Order("root_id, id").
+		Find(&cs).Error
+	return cs, err
+}
+
+// FindReplies returns up to limit replies of a thread newer than cursor,
+// oldest first.
+func (d *CommentDAO) FindReplies(ctx context.Context, rootId, cursor int64, limit int, vis CommentVisibility) ([]CommentModel, error) {
+	var cs []CommentModel
+	err := d.db.WithContext(ctx).
+		Where("root_id = ? AND id > ?", rootId, cursor).
+		Scopes(vis.scope).
+		Order("id").Limit(limit).
+		Find(&cs).Error
+	return cs, err
+}
+
+// CountReplies returns how many replies each thread has, keyed by root ID.
+func (d *CommentDAO) CountReplies(ctx context.Context, rootIds []int64, vis CommentVisibility) (map[int64]int64, error) {
+	type count struct {
+		RootId int64
+		Cnt    int64
+	}
+	var counts []count
+	if len(rootIds) > 0 {
+		err := d.db.WithContext(ctx).Model(&CommentModel{}).
+			Select("root_id, COUNT(*) AS cnt").
+			Where("root_id IN ?", rootIds).
+			Scopes(vis.scope).
+			Group("root_id").
+			Scan(&counts).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	res := make(map[int64]int64, len(counts))
+	for _, c := range counts {
+		res[c.RootId] = c.Cnt
+	}
+	return res, nil
+}
+
+// CountByArticles returns how many comments in status each article has, keyed
+// by article ID.
+func (d *CommentDAO) CountByArticles(ctx context.Context, articleIds []int64, status uint8) (map[int64]int64, error) {
+	type count struct {
+		ArticleId int64
+		Cnt       int64
+	}
+	var counts []count
+	if len(articleIds) > 0 {
+		err := d.db.WithContext(ctx).Model(&CommentModel{}).
+			Select("article_id, COUNT(*) AS cnt").
+			Where("article_id IN ? AND status = ?", articleIds, status).
+			Group("article_id").
+			Scan(&counts).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	res := make(map[int64]int64, len(counts))
+	for _, c := range counts {
+		res[c.ArticleId] = c.Cnt
+	}
+	return res, nil
+}
+
+// FindByArticleAuthor returns up to limit comments in status on the articles
+// of one author, oldest first, for the author to review.
+func (d *CommentDAO) FindByArticleAuthor(ctx context.Context, authorId int64, status uint8, cursor int64, limit int) ([]CommentModel, error) {
+	var cs []CommentModel
+	err := d.db.WithContext(ctx).
+		Where("status = ? AND id > ?", status, cursor).
+		Where("article_id IN (?)", d.db.Model(&ArticleModel{}).Select("id").Where("author_id = ?", authorId)).
+		Order("id").Limit(limit).
+		Find(&cs).Error
+	return cs, err
+}
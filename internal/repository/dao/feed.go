@@ -0,0 +1,73 @@
+package dao
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FeedItemModel is an article pushed into the feed inbox of a follower of
+// its author. PublishedAt copies the first publish time of the article, so
+// that pushed and pulled articles sort the same way.
+type FeedItemModel struct {
+	ID          int64 `gorm:"primaryKey;autoIncrement"`
+	UserId      int64 `gorm:"uniqueIndex:idx_feed_user_article,priority:1;index:idx_feed_user_published,priority:1;index:idx_feed_user_author,priority:1"`
+	ArticleId   int64 `gorm:"uniqueIndex:idx_feed_user_article,priority:2;index:idx_feed_user_published,priority:3"`
+	AuthorId    int64 `gorm:"index:idx_feed_user_author,priority:2"`
+	PublishedAt int64 `gorm:"index:idx_feed_user_published,priority:2"`
+	CreatedAt   int64
+}
+
+type FeedDAO struct {
+	db *gorm.DB
+}
+
+func NewFeedDAO(db *gorm.DB) *FeedDAO {
+	return &FeedDAO{db: db}
+}
+
+// InsertItems adds articles to feed inboxes, skipping those already there.
+func (d *FeedDAO) InsertItems(ctx context.Context, items []FeedItemModel) error {
+	if len(items) == 0 {
+		return nil
+	}
+	return d.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&items).Error
+}
+
+// DeleteByAuthor removes the articles of one author from a user's inbox.
+func (d *FeedDAO) DeleteByAuthor(ctx context.Context, userId, authorId int64) error {
+	return d.db.WithContext(ctx).
+		Where("user_id = ? AND author_id = ?", userId, authorId).
+		Delete(&FeedItemModel{}).Error
+}
+
+// FindItems returns up to limit items of a user's inbox published before the
+// cursor, newest first. A zero cursor starts from the newest.
+func (d *FeedDAO) FindItems(ctx context.Context, userId int64, cursor FeedCursor, limit int) ([]FeedItemModel, error) {
+	var items []FeedItemModel
+	err := d.db.WithContext(ctx).
+		Where("user_id = ?", userId).
+		Scopes(cursor.scope("published_at", "article_id")).
+		Order("published_at DESC, article_id DESC").
+		Limit(limit).
+		Find(&items).Error
+	return items, err
+}
+
+// FeedCursor is the position in a feed: the publish time and ID of the last
+// article shown. The zero value is the start of the feed.
+type FeedCursor struct {
+	PublishedAt int64
+	ArticleId   int64
+}
+
+func (c FeedCursor) scope(timeColumn, idColumn string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if c.PublishedAt == 0 {
+			return db
+		}
+		return db.Where(timeColumn+" < ? OR ("+timeColumn+" = ? AND "+idColumn+" < ?)",
+			c.PublishedAt, c.PublishedAt, c.ArticleId)
+	}
+}
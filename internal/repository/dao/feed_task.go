@@ -0,0 +1,90 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrFeedTaskClaimed is returned when another instance claimed a feed task,
+// or finished it, since it was read.
+var ErrFeedTaskClaimed = errors.New("feed task claimed")
+
+// FeedTaskModel is queued inbox work. See domain.FeedTask.
+type FeedTaskModel struct {
+	ID         int64 `gorm:"primaryKey;autoIncrement"`
+	Kind       uint8
+	ArticleId  int64
+	AuthorId   int64
+	FollowerId int64
+	Cursor     int64
+	Attempts   int
+	RunAt      int64 `gorm:"index"`
+	CreatedAt  int64
+	UpdatedAt  int64
+}
+
+func (d *FeedDAO) InsertTask(ctx context.Context, task FeedTaskModel) error {
+	now := time.Now().UnixMilli()
+	task.CreatedAt = now
+	task.UpdatedAt = now
+	return d.db.WithContext(ctx).Create(&task).Error
+}
+
+// FindDueTasks returns up to limit tasks due by now, oldest first.
+func (d *FeedDAO) FindDueTasks(ctx context.Context, now int64, limit int) ([]FeedTaskModel, error) {
+	var tasks []FeedTaskModel
+	err := d.db.WithContext(ctx).
+		Where("run_at <= ?", now).
+		Order("run_at ASC, id ASC").
+		Limit(limit).
+		Find(&tasks).Error
+	return tasks, err
+}
+
+// ClaimTask moves a due task to until, so other instances skip it while it
+// runs. It only succeeds while run_at still holds the time that was read;
+// otherwise another instance got there first and it returns
+// ErrFeedTaskClaimed.
+func (d *FeedDAO) ClaimTask(ctx context.Context, id, runAt, until int64) error {
+	res := d.db.WithContext(ctx).Model(&FeedTaskModel{}).
+		Where("id = ? AND run_at = ?", id, runAt).
+		Updates(map[string]any{
+			"run_at":     until,
+			"updated_at": time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrFeedTaskClaimed
+	}
+	return nil
+}
+
+// UpdateTaskCursor records the progress of a running task and extends its
+// claim to until.
+func (d *FeedDAO) UpdateTaskCursor(ctx context.Context, id, cursor, until int64) error {
+	return d.db.WithContext(ctx).Model(&FeedTaskModel{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"cursor":     cursor,
+			"run_at":     until,
+			"updated_at": time.Now().UnixMilli(),
+		}).Error
+}
+
+// RetryTask makes a failed task due again at runAt.
+func (d *FeedDAO) RetryTask(ctx context.Context, id int64, attempts int, runAt int64) error {
+	return d.db.WithContext(ctx).Model(&FeedTaskModel{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"attempts":   attempts,
+			"run_at":     runAt,
+			"updated_at": time.Now().UnixMilli(),
+		}).Error
+}
+
+func (d *FeedDAO) DeleteTask(ctx context.Context, id int64) error {
+	return d.db.WithContext(ctx).Where("id = ?", id).Delete(&FeedTaskModel{}).Error
+}
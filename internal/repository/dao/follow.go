@@ -0,0 +1,159 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FollowModel records that FollowerId follows FolloweeId. The unique key
+// serves the following lists and the "is following" lookups, the followee
+// index the follower lists.
+type FollowModel struct {
+	ID         int64 `gorm:"primaryKey;autoIncrement"`
+	FollowerId int64 `gorm:"uniqueIndex:idx_follow_follower_followee,priority:1"`
+	FolloweeId int64 `gorm:"uniqueIndex:idx_follow_follower_followee,priority:2;index"`
+	CreatedAt  int64
+}
+
+// FollowStatsModel holds the follow counters of a user, kept apart from the
+// user table so that popular accounts do not lock their profile row.
+type FollowStatsModel struct {
+	ID           int64 `gorm:"primaryKey;autoIncrement"`
+	UserId       int64 `gorm:"unique"`
+	FollowerCnt  int64
+	FollowingCnt int64
+	CreatedAt    int64
+	UpdatedAt    int64
+}
+
+type FollowDAO struct {
+	db *gorm.DB
+}
+
+func NewFollowDAO(db *gorm.DB) *FollowDAO {
+	return &FollowDAO{db: db}
+}
+
+// Insert follows a user and bumps both counters. Following twice is a no-op
+// that reports false.
+func (d *FollowDAO) Insert(ctx context.Context, followerId, followeeId int64) (bool, error) {
+	created := false
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&FollowModel{
+			FollowerId: followerId,
+			FolloweeId: followeeId,
+			CreatedAt:  time.Now().UnixMilli(),
+		})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		created = true
+		return incrFollowCounters(tx, followerId, followeeId, 1)
+	})
+	return created, err
+}
+
+// Delete unfollows a user and decrements both counters. It reports false when
+// there was nothing to unfollow.
+func (d *FollowDAO) Delete(ctx context.Context, followerId, followeeId int64) (bool, error) {
+	deleted := false
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("follower_id = ? AND followee_id = ?", followerId, followeeId).Delete(&FollowModel{})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		deleted = true
+		return incrFollowCounters(tx, followerId, followeeId, -1)
+	})
+	return deleted, err
+}
+
+// incrFollowCounters adds delta to the following count of the follower and
+// the follower count of the followee. The rows are updated in user ID order
+// so that two users following each other at the same time cannot deadlock.
+func incrFollowCounters(db *gorm.DB, followerId, followeeId, delta int64) error {
+	if followerId < followeeId {
+		if err := incrFollowCounter(db, followerId, "following_cnt", delta); err != nil {
+			return err
+		}
+		return incrFollowCounter(db, followeeId, "follower_cnt", delta)
+	}
+	if err := incrFollowCounter(db, followeeId, "follower_cnt", delta); err != nil {
+		return err
+	}
+	return incrFollowCounter(db, followerId, "following_cnt", delta)
+}
+
+// incrFollowCounter adds delta to one counter, creating the row on first use.
+func incrFollowCounter(db *gorm.DB, userId int64, column string, delta int64) error {
+	now := time.Now().UnixMilli()
+	row := FollowStatsModel{UserId: userId, CreatedAt: now, UpdatedAt: now}
+	switch column {
+	case "follower_cnt":
+		row.FollowerCnt = max(delta, 0)
+	case "following_cnt":
+		row.FollowingCnt = max(delta, 0)
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			column:       gorm.Expr(column+" + ?", delta),
+			"updated_at": now,
+		}),
+	}).Create(&row).Error
+}
+
+// FindFollowers returns up to limit follows of a user older than cursor,
+// newest first. A cursor of 0 starts from the newest.
+func (d *FollowDAO) FindFollowers(ctx context.Context, followeeId, cursor int64, limit int) ([]FollowModel, error) {
+	q := d.db.WithContext(ctx).Where("followee_id = ?", followeeId)
+	if cursor > 0 {
+		q = q.Where("id < ?", cursor)
+	}
+	var fs []FollowModel
+	err := q.Order("id DESC").Limit(limit).Find(&fs).Error
+	return fs, err
+}
+
+// FindFollowing returns up to limit users followed by a user, older than
+// cursor, newest first.
+func (d *FollowDAO) FindFollowing(ctx context.Context, followerId, cursor int64, limit int) ([]FollowModel, error) {
+	q := d.db.WithContext(ctx).Where("follower_id = ?", followerId)
+	if cursor > 0 {
+		q = q.Where("id < ?", cursor)
+	}
+	var fs []FollowModel
+	err := q.Order("id DESC").Limit(limit).Find(&fs).Error
+	return fs, err
+}
+
+// FindFollowees returns which of the given users the follower follows.
+func (d *FollowDAO) FindFollowees(ctx context.Context, followerId int64, followeeIds []int64) ([]int64, error) {
+	var ids []int64
+	err := d.db.WithContext(ctx).Model(&FollowModel{}).
+		Where("follower_id = ? AND followee_id IN ?", followerId, followeeIds).
+		Pluck("followee_id", &ids).Error
+	return ids, err
+}
+
+// FindFolloweesWithFollowers returns the users followerId follows that have
+// more than minFollowers followers.
+func (d *FollowDAO) FindFolloweesWithFollowers(ctx context.Context, followerId, minFollowers int64) ([]int64, error) {
+	var ids []int64
+	err := d.db.WithContext(ctx).Model(&FollowModel{}).
+		Joins("JOIN follow_stats_models s ON s.user_id = follow_models.followee_id").
+		Where("follow_models.follower_id = ? AND s.follower_cnt > ?", followerId, minFollowers).
+		Pluck("follow_models.followee_id", &ids).Error
+	return ids, err
+}
+
+// FindStats returns the counters of the given users. Users who never followed
+// anybody nor were followed have no row.
+func (d *FollowDAO) FindStats(ctx context.Context, userIds []int64) ([]FollowStatsModel, error) {
+	var rows []FollowStatsModel
+	err := d.db.WithContext(ctx).Where("user_id IN ?", userIds).Find(&rows).Error
+	return rows, err
+}
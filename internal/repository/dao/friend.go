@@ -0,0 +1,167 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FriendRequestModel is a friend request. The unique key keeps one row per
+// requester and addressee.
+type FriendRequestModel struct {
+	ID          int64 `gorm:"primaryKey;autoIncrement"`
+	RequesterId int64 `gorm:"uniqueIndex:idx_friend_request_pair,priority:1"`
+	AddresseeId int64 `gorm:"uniqueIndex:idx_friend_request_pair,priority:2;index:idx_friend_request_addressee,priority:1"`
+	Status      uint8 `gorm:"index:idx_friend_request_addressee,priority:2"`
+	CreatedAt   int64
+	UpdatedAt   int64
+}
+
+// FriendshipModel is one direction of a friendship. Both directions are
+// stored, so that listing the friends of a user reads a single index range.
+type FriendshipModel struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement"`
+	UserId    int64 `gorm:"uniqueIndex:idx_friendship_user_friend,priority:1"`
+	FriendId  int64 `gorm:"uniqueIndex:idx_friendship_user_friend,priority:2"`
+	CreatedAt int64
+}
+
+type FriendDAO struct {
+	db *gorm.DB
+}
+
+func NewFriendDAO(db *gorm.DB) *FriendDAO {
+	return &FriendDAO{db: db}
+}
+
+// InsertRequest creates a pending request from requesterId to addresseeId.
+// An answered request between them is replaced, so that the new one gets a
+// fresh ID and sorts as the newest. A request that is still pending is kept.
+func (d *FriendDAO) InsertRequest(ctx context.Context, requesterId, addresseeId int64, pending uint8) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("requester_id = ? AND addressee_id = ? AND status <> ?", requesterId, addresseeId, pending).
+			Delete(&FriendRequestModel{}).Error
+		if err != nil {
+			return err
+		}
+		now := time.Now().UnixMilli()
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&FriendRequestModel{
+			RequesterId: requesterId,
+			AddresseeId: addresseeId,
+			Status:      pending,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}).Error
+	})
+}
+
+func (d *FriendDAO) FindRequestById(ctx context.Context, id int64) (FriendRequestModel, error) {
+	var r FriendRequestModel
+	err := d.db.WithContext(ctx).Where("id = ?", id).First(&r).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return FriendRequestModel{}, ErrRecordNotFound
+	}
+	return r, err
+}
+
+func (d *FriendDAO) FindRequest(ctx context.Context, requesterId, addresseeId int64) (FriendRequestModel, error) {
+	var r FriendRequestModel
+	err := d.db.WithContext(ctx).
+		Where("requester_id = ? AND addressee_id = ?", requesterId, addresseeId).
+		First(&r).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return FriendRequestModel{}, ErrRecordNotFound
+	}
+	return r, err
+}
+
+// UpdateRequestStatus moves a request from one status to another, returning
+// ErrRecordNotFound when it is no longer in from.
+func (d *FriendDAO) UpdateRequestStatus(ctx context.Context, id int64, from, to uint8) error {
+	return updateRequestStatus(d.db.WithContext(ctx), id, from, to)
+}
+
+func updateRequestStatus(db *gorm.DB, id int64, from, to uint8) error {
+	res := db.Model(&FriendRequestModel{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(map[string]any{
+			"status":     to,
+			"updated_at": time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// AcceptRequest moves a request from pending to accepted and makes both
+// users friends in one transaction.
+func (d *FriendDAO) AcceptRequest(ctx context.Context, r FriendRequestModel, pending, accepted uint8) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := updateRequestStatus(tx, r.ID, pending, accepted); err != nil {
+			return err
+		}
+		now := time.Now().UnixMilli()
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&[]FriendshipModel{
+			{UserId: r.RequesterId, FriendId: r.AddresseeId, CreatedAt: now},
+			{UserId: r.AddresseeId, FriendId: r.RequesterId, CreatedAt: now},
+		}).Error
+	})
+}
+
+// DeleteFriendship removes both directions of a friendship. It reports false
+// when the users were not friends.
+func (d *FriendDAO) DeleteFriendship(ctx context.Context, userId, friendId int64) (bool, error) {
+	res := d.db.WithContext(ctx).
+		Where("(user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)", userId, friendId, friendId, userId).
+		Delete(&FriendshipModel{})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (d *FriendDAO) IsFriend(ctx context.Context, userId, friendId int64) (bool, error) {
+	var n int64
+	err := d.db.WithContext(ctx).Model(&FriendshipModel{}).
+		Where("user_id = ? AND friend_id = ?", userId, friendId).
+		Count(&n).Error
+	return n > 0, err
+}
+
+// FindFriends returns up to limit friendships of a user older than cursor,
+// newest first. A cursor of 0 starts from the newest.
+func (d *FriendDAO) FindFriends(ctx context.Context, userId, cursor int64, limit int) ([]FriendshipModel, error) {
+	q := d.db.WithContext(ctx).Where("user_id = ?", userId)
+	if cursor > 0 {
+		q = q.Where("id < ?", cursor)
+	}
+	var fs []FriendshipModel
+	err := q.Order("id DESC").Limit(limit).Find(&fs).Error
+	return fs, err
+}
+
+// FindIncoming returns up to limit requests to a user in status, older than
+// cursor, newest first.
+func (d *FriendDAO) FindIncoming(ctx context.Context, addresseeId int64, status uint8, cursor int64, limit int) ([]FriendRequestModel, error) {
+	return d.findRequests(ctx, "addressee_id", addresseeId, status, cursor, limit)
+}
+
+// FindOutgoing returns up to limit requests from a user in status, older
+// than cursor, newest first.
+func (d *FriendDAO) FindOutgoing(ctx context.Context, requesterId int64, status uint8, cursor int64, limit int) ([]FriendRequestModel, error) {
+	return d.findRequests(ctx, "requester_id", requesterId, status, cursor, limit)
+}
+
+func (d *FriendDAO) findRequests(ctx context.Context, column string, userId int64, status uint8, cursor int64, limit int) ([]FriendRequestModel, error) {
+	q := d.db.WithContext(ctx).Where(column+" = ? AND status = ?", userId, status)
+	if cursor > 0 {
+		q = q.Where("id < ?", cursor)
+	}
+	var rs []FriendRequestModel
+	err := q.Order("id DESC").Limit(limit).Find(&rs).Error
+	return rs, err
+}
@@ -0,0 +1,399 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GroupModel struct {
+	ID          int64  `gorm:"primaryKey;autoIncrement"`
+	Name        string `gorm:"type:varchar(64)"`
+	Description string `gorm:"type:varchar(512)"`
+	OwnerId     int64
+	Visibility  string `gorm:"type:varchar(16)"`
+	JoinPolicy  string `gorm:"type:varchar(16)"`
+	PostPolicy  string `gorm:"type:varchar(16)"`
+	// MemberCnt is kept in step with the members, so that groups can be
+	// listed without counting them.
+	MemberCnt int64
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+// GroupMemberModel is a user's membership. Its ID orders members by when
+// they joined.
+type GroupMemberModel struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement"`
+	GroupId   int64 `gorm:"uniqueIndex:idx_group_member,priority:1"`
+	UserId    int64 `gorm:"uniqueIndex:idx_group_member,priority:2;index"`
+	Role      uint8
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+// GroupPendingModel is a join request or an invite. The unique key keeps at
+// most one of them per user and group.
+type GroupPendingModel struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement"`
+	GroupId   int64 `gorm:"uniqueIndex:idx_group_pending,priority:1"`
+	UserId    int64 `gorm:"uniqueIndex:idx_group_pending,priority:2;index:idx_group_pending_user,priority:1"`
+	Kind      uint8 `gorm:"index:idx_group_pending_user,priority:2"`
+	InviterId int64
+	CreatedAt int64
+}
+
+type GroupBanModel struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement"`
+	GroupId   int64 `gorm:"uniqueIndex:idx_group_ban,priority:1"`
+	UserId    int64 `gorm:"uniqueIndex:idx_group_ban,priority:2"`
+	BannedBy  int64
+	CreatedAt int64
+}
+
+// GroupPostModel is a post in a group. Posts are read newest first by ID
+// within a group, which the index serves as a range scan.
+type GroupPostModel struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement;index:idx_group_post,priority:2"`
+	GroupId   int64 `gorm:"index:idx_group_post,priority:1"`
+	AuthorId  int64
+	Content   string `gorm:"type:text"`
+	CreatedAt int64
+}
+
+type GroupDAO struct {
+	db *gorm.DB
+}
+
+func NewGroupDAO(db *gorm.DB) *GroupDAO {
+	return &GroupDAO{db: db}
+}
+
+// InsertGroup creates a group with its owner as the only member.
+func (d *GroupDAO) InsertGroup(ctx context.Context, g GroupModel, ownerRole uint8) (int64, error) {
+	now := time.Now().UnixMilli()
+	g.MemberCnt, g.CreatedAt, g.UpdatedAt = 1, now, now
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&g).Error; err != nil {
+			return err
+		}
+		return tx.Create(&GroupMemberModel{
+			GroupId:   g.ID,
+			UserId:    g.OwnerId,
+			Role:      ownerRole,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}).Error
+	})
+	return g.ID, err
+}
+
+func (d *GroupDAO) FindGroupById(ctx context.Context, id int64) (GroupModel, error) {
+	var g GroupModel
+	err := d.db.WithContext(ctx).Where("id = ?", id).First(&g).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return GroupModel{}, ErrRecordNotFound
+	}
+	return g, err
+}
+
+func (d *GroupDAO) FindGroupsByIds(ctx context.Context, ids []int64) ([]GroupModel, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var gs []GroupModel
+	err := d.db.WithContext(ctx).Where("id IN ?", ids).Find(&gs).Error
+	return gs, err
+}
+
+// UpdateGroup changes the name, description and settings of a group.
+func (d *GroupDAO) UpdateGroup(ctx context.Context, g GroupModel) error {
+	return d.db.WithContext(ctx).Model(&GroupModel{}).Where("id = ?", g.ID).UpdateColumns(map[string]any{
+		"name":        g.Name,
+		"description": g.Description,
+		"visibility":  g.Visibility,
+		"join_policy": g.JoinPolicy,
+		"post_policy": g.PostPolicy,
+		"updated_at":  time.Now().UnixMilli(),
+	}).Error
+}
+
+// DeleteGroup deletes a group with its members, posts, bans and pending
+// requests and invites.
+func (d *GroupDAO) DeleteGroup(ctx context.Context, id int64) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, m := range []any{&GroupMemberModel{}, &GroupPendingModel{}, &GroupBanModel{}, &GroupPostModel{}} {
+			if err := tx.Where("group_id = ?", id).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("id = ?", id).Delete(&GroupModel{}).Error
+	})
+}
+
+func (d *GroupDAO) FindMember(ctx context.Context, groupId, userId int64) (GroupMemberModel, error) {
+	var m GroupMemberModel
+	err := d.db.WithContext(ctx).Where("group_id = ? AND user_id = ?", groupId, userId).First(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return GroupMemberModel{}, ErrRecordNotFound
+	}
+	return m, err
+}
+
+// FindMembers returns up to limit members of a group who joined after the
+// member with ID cursor, in the order they joined.
+func (d *GroupDAO) FindMembers(ctx context.Context, groupId, cursor int64, limit int) ([]GroupMemberModel, error) {
+	var ms []GroupMemberModel
+	err := d.db.WithContext(ctx).
+		Where("group_id = ? AND id > ?", groupId, cursor).
+		Order("id").Limit(limit).Find(&ms).Error
+	return ms, err
+}
+
+// FindMembershipsByUser returns up to limit memberships of a user older than
+// the membership with ID cursor, most recent first. cursor is 0 for the
+// newest.
+func (d *GroupDAO) FindMembershipsByUser(ctx context.Context, userId, cursor int64, limit int) ([]GroupMemberModel, error) {
+	q := d.db.WithContext(ctx).Where("user_id = ?", userId)
+	if cursor > 0 {
+		q = q.Where("id < ?", cursor)
+	}
+	var ms []GroupMemberModel
+	err := q.Order("id DESC").Limit(limit).Find(&ms).Error
+	return ms, err
+}
+
+// InsertMember adds a user to a group and removes their pending request or
+// invite. Adding a member twice does nothing.
+func (d *GroupDAO) InsertMember(ctx context.Context, groupId, userId int64, role uint8) error {
+	now := time.Now().UnixMilli()
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("group_id = ? AND user_id = ?", groupId, userId).Delete(&GroupPendingModel{}).Error
+		if err != nil {
+			return err
+		}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&GroupMemberModel{
+			GroupId:   groupId,
+			UserId:    userId,
+			Role:      role,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return tx.Model(&GroupModel{}).Where("id = ?", groupId).
+			UpdateColumn("member_cnt", gorm.Expr("member_cnt + 1")).Error
+	})
+}
+
+// DeleteMember removes a user from a group. It returns ErrRecordNotFound if
+// the user is not a member.
+func (d *GroupDAO) DeleteMember(ctx context.Context, groupId, userId int64) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return deleteGroupMember(tx, groupId, userId)
+	})
+}
+
+func deleteGroupMember(tx *gorm.DB, groupId, userId int64) error {
+	res := tx.Where("group_id = ? AND user_id = ?", groupId, userId).Delete(&GroupMemberModel{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return tx.Model(&GroupModel{}).Where("id = ?", groupId).
+		UpdateColumn("member_cnt", gorm.Expr("member_cnt - 1")).Error
+}
+
+// UpdateMemberRole changes the role of a member from one role to another. It
+// returns ErrRecordNotFound if the user is no longer a member with role from.
+func (d *GroupDAO) UpdateMemberRole(ctx context.Context, groupId, userId int64, from, to uint8) error {
+	res := d.db.WithContext(ctx).Model(&GroupMemberModel{}).
+		Where("group_id = ? AND user_id = ? AND role = ?", groupId, userId, from).
+		UpdateColumns(map[string]any{
+			"role":       to,
+			"updated_at": time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// TransferOwnership makes the member toId the owner of a group, and the
+// current owner fromId an admin. It returns ErrRecordNotFound if fromId is no
+// longer the owner or toId is no longer a member.
+func (d *GroupDAO) TransferOwnership(ctx context.Context, groupId, fromId, toId int64, ownerRole, adminRole uint8) error {
+	now := time.Now().UnixMilli()
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&GroupModel{}).Where("id = ? AND owner_id = ?", groupId, fromId).
+			UpdateColumns(map[string]any{"owner_id": toId, "updated_at": now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+		res = tx.Model(&GroupMemberModel{}).Where("group_id = ? AND user_id = ?", groupId, toId).
+			UpdateColumns(map[string]any{"role": ownerRole, "updated_at": now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+		return tx.Model(&GroupMemberModel{}).Where("group_id = ? AND user_id = ?", groupId, fromId).
+			UpdateColumns(map[string]any{"role": adminRole, "updated_at": now}).Error
+	})
+}
+
+// InsertPending adds a join request or an invite unless the user already has
+// one for the group.
+func (d *GroupDAO) InsertPending(ctx context.Context, p GroupPendingModel) error {
+	p.CreatedAt = time.Now().UnixMilli()
+	return d.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&p).Error
+}
+
+func (d *GroupDAO) FindPending(ctx context.Context, groupId, userId int64) (GroupPendingModel, error) {
+	var p GroupPendingModel
+	err := d.db.WithContext(ctx).Where("group_id = ? AND user_id = ?", groupId, userId).First(&p).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return GroupPendingModel{}, ErrRecordNotFound
+	}
+	return p, err
+}
+
+// FindPendingByGroup returns up to limit requests or invites of a group
+// older than the one with ID cursor, newest first. cursor is 0 for the
+// newest.
+func (d *GroupDAO) FindPendingByGroup(ctx context.Context, groupId int64, kind uint8, cursor int64,
+	limit int) ([]GroupPendingModel, error) {
+	q := d.db.WithContext(ctx).Where("group_id = ? AND kind = ?", groupId, kind)
+	if cursor > 0 {
+		q = q.Where("id < ?", cursor)
+	}
+	var ps []GroupPendingModel
+	err := q.Order("id DESC").Limit(limit).Find(&ps).Error
+	return ps, err
+}
+
+// FindPendingByUser is FindPendingByGroup for the requests or invites of a
+// user.
+func (d *GroupDAO) FindPendingByUser(ctx context.Context, userId int64, kind uint8, cursor int64,
+	limit int) ([]GroupPendingModel, error) {
+	q := d.db.WithContext(ctx).Where("user_id = ? AND kind = ?", userId, kind)
+	if cursor > 0 {
+		q = q.Where("id < ?", cursor)
+	}
+	var ps []GroupPendingModel
+	err := q.Order("id DESC").Limit(limit).Find(&ps).Error
+	return ps, err
+}
+
+// DeletePending removes a request or invite of the given kind. It returns
+// ErrRecordNotFound if there is none.
+func (d *GroupDAO) DeletePending(ctx context.Context, groupId, userId int64, kind uint8) error {
+	res := d.db.WithContext(ctx).
+		Where("group_id = ? AND user_id = ? AND kind = ?", groupId, userId, kind).
+		Delete(&GroupPendingModel{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// InsertBan bans a user from a group, removing their membership and any
+// pending request or invite.
+func (d *GroupDAO) InsertBan(ctx context.Context, groupId, userId, bannedBy int64) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := deleteGroupMember(tx, groupId, userId)
+		if err != nil && !errors.Is(err, ErrRecordNotFound) {
+			return err
+		}
+		err = tx.Where("group_id = ? AND user_id = ?", groupId, userId).Delete(&GroupPendingModel{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&GroupBanModel{
+			GroupId:   groupId,
+			UserId:    userId,
+			BannedBy:  bannedBy,
+			CreatedAt: time.Now().UnixMilli(),
+		}).Error
+	})
+}
+
+// DeleteBan lifts a ban. It returns ErrRecordNotFound if the user is not
+// banned.
+func (d *GroupDAO) DeleteBan(ctx context.Context, groupId, userId int64) error {
+	res := d.db.WithContext(ctx).Where("group_id = ? AND user_id = ?", groupId, userId).Delete(&GroupBanModel{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (d *GroupDAO) IsBanned(ctx context.Context, groupId, userId int64) (bool, error) {
+	var n int64
+	err := d.db.WithContext(ctx).Model(&GroupBanModel{}).
+		Where("group_id = ? AND user_id = ?", groupId, userId).
+		Count(&n).Error
+	return n > 0, err
+}
+
+// FindBans returns up to limit bans of a group older than the one with ID
+// cursor, newest first. cursor is 0 for the newest.
+func (d *GroupDAO) FindBans(ctx context.Context, groupId, cursor int64, limit int) ([]GroupBanModel, error) {
+	q := d.db.WithContext(ctx).Where("group_id = ?", groupId)
+	if cursor > 0 {
+		q = q.Where("id < ?", cursor)
+	}
+	var bs []GroupBanModel
+	err := q.Order("id DESC").Limit(limit).Find(&bs).Error
+	return bs, err
+}
+
+func (d *GroupDAO) InsertPost(ctx context.Context, p GroupPostModel) (GroupPostModel, error) {
+	p.CreatedAt = time.Now().UnixMilli()
+	err := d.db.WithContext(ctx).Create(&p).Error
+	return p, err
+}
+
+func (d *GroupDAO) FindPostById(ctx context.Context, id int64) (GroupPostModel, error) {
+	var p GroupPostModel
+	err := d.db.WithContext(ctx).Where("id = ?", id).First(&p).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return GroupPostModel{}, ErrRecordNotFound
+	}
+	return p, err
+}
+
+// FindPosts returns up to limit posts of a group older than before, newest
+// first. before is 0 for the newest posts.
+func (d *GroupDAO) FindPosts(ctx context.Context, groupId, before int64, limit int) ([]GroupPostModel, error) {
+	q := d.db.WithContext(ctx).Where("group_id = ?", groupId)
+	if before > 0 {
+		q = q.Where("id < ?", before)
+	}
+	var ps []GroupPostModel
+	err := q.Order("id DESC").Limit(limit).Find(&ps).Error
+	return ps, err
+}
+
+func (d *GroupDAO) DeletePost(ctx context.Context, id int64) error {
+	return d.db.WithContext(ctx).Where("id = ?", id).Delete(&GroupPostModel{}).Error
+}
@@ -0,0 +1,116 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HandleHistoryModel remembers handles users have moved away from, so links
+// to the old handle keep working.
+type HandleHistoryModel struct {
+	ID          int64  `gorm:"primaryKey;autoIncrement"`
+	HandleLower string `gorm:"type:varchar(32);unique"`
+	UserId      int64  `gorm:"index"`
+	ReleasedAt  int64
+}
+
+func (u *UserDAO) FindByHandle(ctx context.Context, handleLower string) (UserModel, error) {
+	var user UserModel
+	err := u.db.WithContext(ctx).Where("handle_lower = ?", handleLower).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return UserModel{}, ErrRecordNotFound
+		}
+		return UserModel{}, err
+	}
+	return user, nil
+}
+
+func (u *UserDAO) FindHandleHistory(ctx context.Context, handleLower string) (HandleHistoryModel, error) {
+	var h HandleHistoryModel
+	err := u.db.WithContext(ctx).Where("handle_lower = ?", handleLower).First(&h).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return HandleHistoryModel{}, ErrRecordNotFound
+		}
+		return HandleHistoryModel{}, err
+	}
+	return h, nil
+}
+
+// ChangeHandle sets a user's handle and keeps the previous one in the history.
+//
+// The update only applies if handle_changed_at still equals lastChangedAt, so
+// two concurrent changes cannot both pass the cooldown; the loser gets
+// ErrRecordNotFound. A handle released by another user after heldSince can
+// not be claimed yet and yields ErrDuplicateHandle. A change of case only
+// leaves handle_changed_at alone.
+func (u *UserDAO) ChangeHandle(ctx context.Context, id int64, handle, handleLower string,
+	lastChangedAt, heldSince int64) error {
+	now := time.Now().UnixMilli()
+	return u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var held HandleHistoryModel
+		err := tx.Where("handle_lower = ?", handleLower).First(&held).Error
+		switch {
+		case err == nil:
+			if held.UserId != id && held.ReleasedAt >= heldSince {
+				return ErrDuplicateHandle
+			}
+			if err = tx.Delete(&held).Error; err != nil {
+				return err
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		var user UserModel
+		err = tx.Select("id", "handle_lower").Where("id = ?", id).First(&user).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRecordNotFound
+			}
+			return err
+		}
+
+		// Changing only the case of a handle releases nothing and does not
+		// start a new cooldown.
+		caseOnly := user.HandleLower.Valid && user.HandleLower.String == handleLower
+		updates := map[string]any{
+			"handle":       sql.NullString{String: handle, Valid: true},
+			"handle_lower": sql.NullString{String: handleLower, Valid: true},
+			"updated_at":   now,
+		}
+		if !caseOnly {
+			updates["handle_changed_at"] = now
+		}
+		res := tx.Model(&UserModel{}).
+			Where("id = ? AND handle_changed_at = ?", id, lastChangedAt).
+			Updates(updates)
+		if res.Error != nil {
+			if isDuplicateEntry(res.Error) {
+				return ErrDuplicateHandle
+			}
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+
+		if !user.HandleLower.Valid || caseOnly {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "handle_lower"}},
+			DoUpdates: clause.AssignmentColumns([]string{"user_id", "released_at"}),
+		}).Create(&HandleHistoryModel{
+			HandleLower: user.HandleLower.String,
+			UserId:      id,
+			ReleasedAt:  now,
+		}).Error
+	})
+}
@@ -0,0 +1,85 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserIdentityModel links a user to an account at a third-party identity
+// provider. A provider account belongs to at most one user.
+type UserIdentityModel struct {
+	ID        int64  `gorm:"primaryKey;autoIncrement"`
+	UserId    int64  `gorm:"index"`
+	Provider  string `gorm:"type:varchar(32);uniqueIndex:idx_identity_provider_subject,priority:1"`
+	Subject   string `gorm:"type:varchar(255);uniqueIndex:idx_identity_provider_subject,priority:2"`
+	CreatedAt int64
+}
+
+// ErrDuplicateIdentity is returned when the provider account is already linked
+// to a user.
+var ErrDuplicateIdentity = errors.New("identity already linked")
+
+// FindByIdentity returns the user linked to the provider account.
+func (u *UserDAO) FindByIdentity(ctx context.Context, provider, subject string) (UserModel, error) {
+	var user UserModel
+	err := u.db.WithContext(ctx).
+		Joins("JOIN user_identity_models ON user_identity_models.user_id = user_models.id").
+		Where("user_identity_models.provider = ? AND user_identity_models.subject = ?", provider, subject).
+		First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return UserModel{}, ErrRecordNotFound
+		}
+		return UserModel{}, err
+	}
+	return user, nil
+}
+
+// InsertWithIdentity creates a user and links the provider account to it in
+// one transaction.
+func (u *UserDAO) InsertWithIdentity(ctx context.Context, user UserModel, identity UserIdentityModel) (int64, error) {
+	now := time.Now().UnixMilli()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	user.LastActiveAt = now
+	err := u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			if isDuplicateEntry(err) {
+				return duplicateUserError(err)
+			}
+			return err
+		}
+		identity.UserId = user.ID
+		return insertIdentity(tx, identity)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// UpgradeGuestWithIdentity upgrades a guest like UpgradeGuest and links the
+// provider account to it in one transaction.
+func (u *UserDAO) UpgradeGuestWithIdentity(ctx context.Context, user UserModel, identity UserIdentityModel) error {
+	return u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := upgradeGuest(tx, user); err != nil {
+			return err
+		}
+		identity.UserId = user.ID
+		return insertIdentity(tx, identity)
+	})
+}
+
+func insertIdentity(tx *gorm.DB, identity UserIdentityModel) error {
+	identity.CreatedAt = time.Now().UnixMilli()
+	if err := tx.Create(&identity).Error; err != nil {
+		if isDuplicateEntry(err) {
+			return ErrDuplicateIdentity
+		}
+		return err
+	}
+	return nil
+}
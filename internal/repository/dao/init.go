@@ -15,7 +15,43 @@ func InitDB() *gorm.DB {
 		panic(err)
 	}
 
-	err = db.AutoMigrate(&UserModel{})
+	err = db.AutoMigrate(
+		&UserModel{},
+		&UserIdentityModel{},
+		&OAuthClientModel{},
+		&OAuthCodeModel{},
+		&OAuthConsentModel{},
+		&OAuthSigningKeyModel{},
+		&ScimTenantModel{},
+		&PolicyModel{},
+		&PolicyConsentModel{},
+		&SignupScreeningModel{},
+		&HandleHistoryModel{},
+		&ArticleModel{},
+		&PublishedArticleModel{},
+		&ArticleRevisionModel{},
+		&ArticleInteractionModel{},
+		&UserLikeModel{},
+		&UserBookmarkModel{},
+		&CommentModel{},
+		&FollowModel{},
+		&FollowStatsModel{},
+		&FriendRequestModel{},
+		&FriendshipModel{},
+		&FeedItemModel{},
+		&FeedTaskModel{},
+		&NotificationModel{},
+		&NotificationActorModel{},
+		&ConversationModel{},
+		&ConversationMemberModel{},
+		&MessageModel{},
+		&GroupModel{},
+		&GroupMemberModel{},
+		&GroupPendingModel{},
+		&GroupBanModel{},
+		&GroupPostModel{},
+		&BlockModel{},
+	)
 	if err != nil {
 		fmt.Println("Failed to migrate database:", err)
 		panic(err)
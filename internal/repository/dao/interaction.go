@@ -0,0 +1,162 @@
+package dao
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ArticleInteractionModel holds the counters of an article. It is kept apart
+// from the article tables so that busy counters do not lock the content rows.
+type ArticleInteractionModel struct {
+	ID          int64 `gorm:"primaryKey;autoIncrement"`
+	ArticleId   int64 `gorm:"unique"`
+	LikeCnt     int64
+	BookmarkCnt int64
+	ViewCnt     int64
+	CreatedAt   int64
+	UpdatedAt   int64
+}
+
+// UserLikeModel records that a user liked an article.
+type UserLikeModel struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement"`
+	UserId    int64 `gorm:"uniqueIndex:idx_like_user_article,priority:1"`
+	ArticleId int64 `gorm:"uniqueIndex:idx_like_user_article,priority:2"`
+	CreatedAt int64
+}
+
+// UserBookmarkModel records that a user bookmarked an article.
+type UserBookmarkModel struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement"`
+	UserId    int64 `gorm:"uniqueIndex:idx_bookmark_user_article,priority:1"`
+	ArticleId int64 `gorm:"uniqueIndex:idx_bookmark_user_article,priority:2"`
+	CreatedAt int64
+}
+
+type InteractionDAO struct {
+	db *gorm.DB
+}
+
+func NewInteractionDAO(db *gorm.DB) *InteractionDAO {
+	return &InteractionDAO{db: db}
+}
+
+// InsertLike likes an article and bumps its counter. Liking twice is a no-op
+// that reports false.
+func (d *InteractionDAO) InsertLike(ctx context.Context, userId, articleId int64) (bool, error) {
+	return d.insertMark(ctx, &UserLikeModel{UserId: userId, ArticleId: articleId, CreatedAt: time.Now().UnixMilli()}, articleId, "like_cnt")
+}
+
+// DeleteLike removes a like and decrements the counter. It reports false when
+// the user had not liked the article.
+func (d *InteractionDAO) DeleteLike(ctx context.Context, userId, articleId int64) (bool, error) {
+	return d.deleteMark(ctx, &UserLikeModel{}, userId, articleId, "like_cnt")
+}
+
+func (d *InteractionDAO) InsertBookmark(ctx context.Context, userId, articleId int64) (bool, error) {
+	return d.insertMark(ctx, &UserBookmarkModel{UserId: userId, ArticleId: articleId, CreatedAt: time.Now().UnixMilli()}, articleId, "bookmark_cnt")
+}
+
+func (d *InteractionDAO) DeleteBookmark(ctx context.Context, userId, articleId int64) (bool, error) {
+	return d.deleteMark(ctx, &UserBookmarkModel{}, userId, articleId, "bookmark_cnt")
+}
+
+// IncrViews adds buffered view counts, keyed by article ID, in one
+// transaction. Rows are updated in ID order so that instances flushing at
+// the same time cannot deadlock, and since every statement only adds to the
+// stored value, concurrent flushes never overwrite each other.
+func (d *InteractionDAO) IncrViews(ctx context.Context, deltas map[int64]int64) error {
+	ids := make([]int64, 0, len(deltas))
+	for id := range deltas {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, id := range ids {
+			if err := incrCounter(tx, id, "view_cnt", deltas[id]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// insertMark stores a per-user like or bookmark and increments the matching
+// counter in the same transaction, so the counter always equals the number
+// of rows.
+func (d *InteractionDAO) insertMark(ctx context.Context, mark any, articleId int64, column string) (bool, error) {
+	created := false
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(mark)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		created = true
+		return incrCounter(tx, articleId, column, 1)
+	})
+	return created, err
+}
+
+func (d *InteractionDAO) deleteMark(ctx context.Context, model any, userId, articleId int64, column string) (bool, error) {
+	deleted := false
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("user_id = ? AND article_id = ?", userId, articleId).Delete(model)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		deleted = true
+		return incrCounter(tx, articleId, column, -1)
+	})
+	return deleted, err
+}
+
+// incrCounter adds delta to one counter, creating the row on first use.
+func incrCounter(db *gorm.DB, articleId int64, column string, delta int64) error {
+	now := time.Now().UnixMilli()
+	row := ArticleInteractionModel{ArticleId: articleId, CreatedAt: now, UpdatedAt: now}
+	switch column {
+	case "like_cnt":
+		row.LikeCnt = max(delta, 0)
+	case "bookmark_cnt":
+		row.BookmarkCnt = max(delta, 0)
+	case "view_cnt":
+		row.ViewCnt = max(delta, 0)
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "article_id"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			column:       gorm.Expr(column+" + ?", delta),
+			"updated_at": now,
+		}),
+	}).Create(&row).Error
+}
+
+// FindCounters returns the counters of the given articles. Articles nobody
+// has interacted with yet have no row.
+func (d *InteractionDAO) FindCounters(ctx context.Context, articleIds []int64) ([]ArticleInteractionModel, error) {
+	var rows []ArticleInteractionModel
+	err := d.db.WithContext(ctx).Where("article_id IN ?", articleIds).Find(&rows).Error
+	return rows, err
+}
+
+// FindLiked returns which of the given articles the user liked.
+func (d *InteractionDAO) FindLiked(ctx context.Context, userId int64, articleIds []int64) ([]int64, error) {
+	var ids []int64
+	err := d.db.WithContext(ctx).Model(&UserLikeModel{}).
+		Where("user_id = ? AND article_id IN ?", userId, articleIds).
+		Pluck("article_id", &ids).Error
+	return ids, err
+}
+
+// FindBookmarked returns which of the given articles the user bookmarked.
+func (d *InteractionDAO) FindBookmarked(ctx context.Context, userId int64, articleIds []int64) ([]int64, error) {
+	var ids []int64
+	err := d.db.WithContext(ctx).Model(&UserBookmarkModel{}).
+		Where("user_id = ? AND article_id IN ?", userId, articleIds).
+		Pluck("article_id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,232 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ConversationModel is a private conversation. UserLow is the smaller user
+// ID, so that the unique key holds one conversation per pair of users.
+type ConversationModel struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement"`
+	UserLow   int64 `gorm:"uniqueIndex:idx_conversation_pair,priority:1"`
+	UserHigh  int64 `gorm:"uniqueIndex:idx_conversation_pair,priority:2"`
+	CreatedAt int64
+}
+
+// ConversationMemberModel is one user's side of a conversation. Keeping the
+// state each user needs on their own row lets conversation lists and unread
+// counts read a single index range, however long the conversations are.
+type ConversationMemberModel struct {
+	ID             int64 `gorm:"primaryKey;autoIncrement"`
+	ConversationId int64 `gorm:"uniqueIndex:idx_conversation_member,priority:1"`
+	UserId         int64 `gorm:"uniqueIndex:idx_conversation_member,priority:2;index:idx_conversation_member_user,priority:1"`
+	PeerId         int64
+	// LastMessageId is the newest message of the conversation; it is 0 while
+	// there is none.
+	LastMessageId int64
+	// LastReadId is the newest message the user has read, and LastSentId the
+	// newest one they sent.
+	LastReadId int64
+	LastSentId int64
+	// Unread counts the peer's messages after LastReadId.
+	Unread    int64
+	CreatedAt int64
+	// UpdatedAt is when the last message was sent, or the conversation was
+	// started.
+	UpdatedAt int64 `gorm:"index:idx_conversation_member_user,priority:2"`
+}
+
+// MessageModel is a message. History is read newest first by ID within a
+// conversation, which the index serves as a range scan.
+type MessageModel struct {
+	ID             int64 `gorm:"primaryKey;autoIncrement;index:idx_message_conversation,priority:2"`
+	ConversationId int64 `gorm:"index:idx_message_conversation,priority:1"`
+	SenderId       int64
+	Content        string `gorm:"type:text"`
+	CreatedAt      int64
+}
+
+type MessageDAO struct {
+	db *gorm.DB
+}
+
+func NewMessageDAO(db *gorm.DB) *MessageDAO {
+	return &MessageDAO{db: db}
+}
+
+// FindConversationId returns the conversation between two users.
+func (d *MessageDAO) FindConversationId(ctx context.Context, userId, peerId int64) (int64, error) {
+	low, high := min(userId, peerId), max(userId, peerId)
+	var c ConversationModel
+	err := d.db.WithContext(ctx).Where("user_low = ? AND user_high = ?", low, high).First(&c).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrRecordNotFound
+	}
+	return c.ID, err
+}
+
+// InsertConversation returns the conversation between two users, creating it
+// if there is none.
+func (d *MessageDAO) InsertConversation(ctx context.Context, userId, peerId int64) (int64, error) {
+	now := time.Now().UnixMilli()
+	low, high := min(userId, peerId), max(userId, peerId)
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		c := ConversationModel{UserLow: low, UserHigh: high, CreatedAt: now}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&c)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return tx.Create([]ConversationMemberModel{
+			{ConversationId: c.ID, UserId: low, PeerId: high, CreatedAt: now, UpdatedAt: now},
+			{ConversationId: c.ID, UserId: high, PeerId: low, CreatedAt: now, UpdatedAt: now},
+		}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return d.FindConversationId(ctx, userId, peerId)
+}
+
+// FindMember returns userId's side of a conversation. It returns
+// ErrRecordNotFound unless the user takes part in it.
+func (d *MessageDAO) FindMember(ctx context.Context, conversationId, userId int64) (ConversationMemberModel, error) {
+	var m ConversationMemberModel
+	err := d.db.WithContext(ctx).
+		Where("conversation_id = ? AND user_id = ?", conversationId, userId).
+		First(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ConversationMemberModel{}, ErrRecordNotFound
+	}
+	return m, err
+}
+
+// ConversationCursor is the position in a conversation list: the update time
+// and conversation ID of the last conversation shown. The zero value is the
+// start.
+type ConversationCursor struct {
+	UpdatedAt      int64
+	ConversationId int64
+}
+
+// FindMembersByUser returns up to limit of the user's sides of conversations
+// with messages, updated before the cursor, most recently updated first.
+func (d *MessageDAO) FindMembersByUser(ctx context.Context, userId int64, cursor ConversationCursor,
+	limit int) ([]ConversationMemberModel, error) {
+	q := d.db.WithContext(ctx).Where("user_id = ? AND last_message_id > 0", userId)
+	if cursor.UpdatedAt > 0 {
+		q = q.Where("updated_at < ? OR (updated_at = ? AND conversation_id < ?)",
+			cursor.UpdatedAt, cursor.UpdatedAt, cursor.ConversationId)
+	}
+	var ms []ConversationMemberModel
+	err := q.Order("updated_at DESC, conversation_id DESC").Limit(limit).Find(&ms).Error
+	return ms, err
+}
+
+// FindMembers returns both sides of each of the given conversations.
+func (d *MessageDAO) FindMembers(ctx context.Context, conversationIds []int64) ([]ConversationMemberModel, error) {
+	if len(conversationIds) == 0 {
+		return nil, nil
+	}
+	var ms []ConversationMemberModel
+	err := d.db.WithContext(ctx).Where("conversation_id IN ?", conversationIds).Find(&ms).Error
+	return ms, err
+}
+
+// InsertMessage adds a message from senderId to recipientId and updates both
+// sides of the conversation. The sender has read their own message; the
+// recipient gets one more unread one.
+func (d *MessageDAO) InsertMessage(ctx context.Context, msg MessageModel, recipientId int64) (MessageModel, error) {
+	now := time.Now().UnixMilli()
+	msg.CreatedAt = now
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&msg).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&ConversationMemberModel{}).
+			Where("conversation_id = ? AND user_id = ?", msg.ConversationId, msg.SenderId).
+			UpdateColumns(map[string]any{
+				"last_message_id": msg.ID,
+				"last_read_id":    msg.ID,
+				"last_sent_id":    msg.ID,
+				"unread":          0,
+				"updated_at":      now,
+			}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&ConversationMemberModel{}).
+			Where("conversation_id = ? AND user_id = ?", msg.ConversationId, recipientId).
+			UpdateColumns(map[string]any{
+				"last_message_id": msg.ID,
+				"unread":          gorm.Expr("unread + 1"),
+				"updated_at":      now,
+			}).Error
+	})
+	return msg, err
+}
+
+// FindMessages returns up to limit messages of a conversation older than
+// before, newest first. before is 0 for the newest messages.
+func (d *MessageDAO) FindMessages(ctx context.Context, conversationId, before int64, limit int) ([]MessageModel, error) {
+	q := d.db.WithContext(ctx).Where("conversation_id = ?", conversationId)
+	if before > 0 {
+		q = q.Where("id < ?", before)
+	}
+	var ms []MessageModel
+	err := q.Order("id DESC").Limit(limit).Find(&ms).Error
+	return ms, err
+}
+
+func (d *MessageDAO) FindMessagesByIds(ctx context.Context, ids []int64) ([]MessageModel, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var ms []MessageModel
+	err := d.db.WithContext(ctx).Where("id IN ?", ids).Find(&ms).Error
+	return ms, err
+}
+
+// MarkRead moves userId's read cursor forward to upTo and recounts the
+// peer's messages after it. It reports whether the cursor moved.
+func (d *MessageDAO) MarkRead(ctx context.Context, conversationId, userId, peerId, upTo int64) (bool, error) {
+	var moved bool
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locking the row holds back messages sent meanwhile, which would
+		// otherwise be missing from the count.
+		var m ConversationMemberModel
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("conversation_id = ? AND user_id = ?", conversationId, userId).
+			First(&m).Error
+		if err != nil || m.LastReadId >= upTo {
+			return err
+		}
+		var unread int64
+		err = tx.Model(&MessageModel{}).
+			Where("conversation_id = ? AND id > ? AND sender_id = ?", conversationId, upTo, peerId).
+			Count(&unread).Error
+		if err != nil {
+			return err
+		}
+		moved = true
+		return tx.Model(&m).UpdateColumns(map[string]any{
+			"last_read_id": upTo,
+			"unread":       unread,
+		}).Error
+	})
+	return moved, err
+}
+
+// SumUnread counts the unread messages of a user across all conversations.
+func (d *MessageDAO) SumUnread(ctx context.Context, userId int64) (int64, error) {
+	var n int64
+	err := d.db.WithContext(ctx).Model(&ConversationMemberModel{}).
+		Where("user_id = ? AND unread > 0", userId).
+		Select("COALESCE(SUM(unread), 0)").
+		Scan(&n).Error
+	return n, err
+}
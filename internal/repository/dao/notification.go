@@ -0,0 +1,174 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NotificationModel is a notification in a user's inbox. OpenGroup equals
+// GroupKey while the notification is unread and is NULL otherwise; its
+// unique key makes concurrent events of one group merge into a single unread
+// notification.
+type NotificationModel struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement"`
+	UserId    int64 `gorm:"index:idx_notification_user_updated,priority:1;uniqueIndex:idx_notification_user_open,priority:1;index:idx_notification_user_read,priority:1"`
+	Type      uint8
+	GroupKey  string  `gorm:"type:varchar(64)"`
+	OpenGroup *string `gorm:"type:varchar(64);uniqueIndex:idx_notification_user_open,priority:2"`
+	ArticleId int64
+	CommentId int64
+	Cnt       int64
+	Detail    string `gorm:"type:varchar(256)"`
+	// ReadAt is 0 while unread.
+	ReadAt    int64 `gorm:"index:idx_notification_user_read,priority:2"`
+	CreatedAt int64
+	UpdatedAt int64 `gorm:"index:idx_notification_user_updated,priority:2"`
+}
+
+// NotificationActorModel records a user who took part in a notification.
+type NotificationActorModel struct {
+	ID             int64 `gorm:"primaryKey;autoIncrement"`
+	NotificationId int64 `gorm:"uniqueIndex:idx_notification_actor,priority:1"`
+	ActorId        int64 `gorm:"uniqueIndex:idx_notification_actor,priority:2"`
+	CreatedAt      int64
+}
+
+type NotificationDAO struct {
+	db *gorm.DB
+}
+
+func NewNotificationDAO(db *gorm.DB) *NotificationDAO {
+	return &NotificationDAO{db: db}
+}
+
+// Upsert adds a notification, or merges it into the unread notification of
+// the same group, and returns its ID. actorId is 0 for events without an
+// actor, which are counted every time; an actor is only counted once per
+// notification, and the ID is 0 if the actor was already counted.
+func (d *NotificationDAO) Upsert(ctx context.Context, n NotificationModel, actorId int64) (int64, error) {
+	now := time.Now().UnixMilli()
+	n.Cnt, n.ReadAt, n.CreatedAt, n.UpdatedAt = 1, 0, now, now
+	n.OpenGroup = nil
+	if n.GroupKey != "" {
+		n.OpenGroup = &n.GroupKey
+	}
+	var id int64
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&n)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 1 {
+			id = n.ID
+			return insertNotificationActor(tx, n.ID, actorId, now)
+		}
+
+		var open NotificationModel
+		err := tx.Where("user_id = ? AND open_group = ?", n.UserId, n.GroupKey).First(&open).Error
+		if err != nil {
+			return err
+		}
+		if actorId != 0 {
+			res = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&NotificationActorModel{
+				NotificationId: open.ID,
+				ActorId:        actorId,
+				CreatedAt:      now,
+			})
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+		}
+		id = open.ID
+		return tx.Model(&NotificationModel{}).Where("id = ?", open.ID).UpdateColumns(map[string]any{
+			"cnt":        gorm.Expr("cnt + 1"),
+			"detail":     n.Detail,
+			"updated_at": now,
+		}).Error
+	})
+	return id, err
+}
+
+func insertNotificationActor(tx *gorm.DB, notificationId, actorId, now int64) error {
+	if actorId == 0 {
+		return nil
+	}
+	return tx.Create(&NotificationActorModel{
+		NotificationId: notificationId,
+		ActorId:        actorId,
+		CreatedAt:      now,
+	}).Error
+}
+
+// NotificationCursor is the position in an inbox: the update time and ID of
+// the last notification shown. The zero value is the start.
+type NotificationCursor struct {
+	UpdatedAt int64
+	ID        int64
+}
+
+// FindByUser returns up to limit notifications of a user updated before the
+// cursor, most recently updated first.
+func (d *NotificationDAO) FindByUser(ctx context.Context, userId int64, cursor NotificationCursor,
+	limit int, unreadOnly bool) ([]NotificationModel, error) {
+	q := d.db.WithContext(ctx).Where("user_id = ?", userId)
+	if cursor.UpdatedAt > 0 {
+		q = q.Where("updated_at < ? OR (updated_at = ? AND id < ?)", cursor.UpdatedAt, cursor.UpdatedAt, cursor.ID)
+	}
+	if unreadOnly {
+		q = q.Where("read_at = 0")
+	}
+	var ns []NotificationModel
+	err := q.Order("updated_at DESC, id DESC").Limit(limit).Find(&ns).Error
+	return ns, err
+}
+
+// FindLatestActors returns the n most recent actors of each notification,
+// most recent first, in a single query.
+func (d *NotificationDAO) FindLatestActors(ctx context.Context, notificationIds []int64, n int) ([]NotificationActorModel, error) {
+	if len(notificationIds) == 0 {
+		return nil, nil
+	}
+	inner := d.db.Model(&NotificationActorModel{}).
+		Select("*, ROW_NUMBER() OVER (PARTITION BY notification_id ORDER BY id DESC) AS rn").
+		Where("notification_id IN ?", notificationIds)
+	var as []NotificationActorModel
+	err := d.db.WithContext(ctx).Table("(?) AS t", inner).
+		Where("rn <= ?", n).
+		Order("notification_id, id DESC").
+		Find(&as).Error
+	return as, err
+}
+
+// MarkRead marks the given notifications of a user read. It returns how many
+// were unread.
+func (d *NotificationDAO) MarkRead(ctx context.Context, userId int64, ids []int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	return d.markRead(d.db.WithContext(ctx).Where("user_id = ? AND id IN ? AND read_at = 0", userId, ids))
+}
+
+// MarkAllRead marks every notification of a user read.
+func (d *NotificationDAO) MarkAllRead(ctx context.Context, userId int64) (int64, error) {
+	return d.markRead(d.db.WithContext(ctx).Where("user_id = ? AND read_at = 0", userId))
+}
+
+func (d *NotificationDAO) markRead(q *gorm.DB) (int64, error) {
+	// Closing the group makes the next event of it start a new notification.
+	res := q.Model(&NotificationModel{}).UpdateColumns(map[string]any{
+		"read_at":    time.Now().UnixMilli(),
+		"open_group": nil,
+	})
+	return res.RowsAffected, res.Error
+}
+
+func (d *NotificationDAO) CountUnread(ctx context.Context, userId int64) (int64, error) {
+	var n int64
+	err := d.db.WithContext(ctx).Model(&NotificationModel{}).
+		Where("user_id = ? AND read_at = 0", userId).
+		Count(&n).Error
+	return n, err
+}
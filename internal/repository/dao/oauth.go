@@ -0,0 +1,165 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OAuthClientModel struct {
+	ID           int64    `gorm:"primaryKey;autoIncrement"`
+	ClientID     string   `gorm:"type:varchar(64);unique"`
+	SecretHash   string   `gorm:"type:varchar(128)"`
+	Name         string   `gorm:"type:varchar(128)"`
+	RedirectURIs []string `gorm:"type:text;serializer:json"`
+	Public       bool
+	OwnerId      int64 `gorm:"index"`
+	CreatedAt    int64
+	UpdatedAt    int64
+}
+
+type OAuthCodeModel struct {
+	ID                  int64  `gorm:"primaryKey;autoIncrement"`
+	CodeHash            string `gorm:"type:varchar(64);unique"`
+	ClientID            string `gorm:"type:varchar(64)"`
+	UserId              int64
+	RedirectURI         string   `gorm:"type:varchar(512)"`
+	Scopes              []string `gorm:"type:varchar(512);serializer:json"`
+	Nonce               string   `gorm:"type:varchar(256)"`
+	CodeChallenge       string   `gorm:"type:varchar(128)"`
+	CodeChallengeMethod string   `gorm:"type:varchar(16)"`
+	AuthTime            int64
+	ExpiresAt           int64
+	// UsedAt is set when the code is redeemed; a non-zero value means the code is spent.
+	UsedAt    int64
+	CreatedAt int64
+}
+
+type OAuthConsentModel struct {
+	ID        int64    `gorm:"primaryKey;autoIncrement"`
+	UserId    int64    `gorm:"uniqueIndex:uk_user_client"`
+	ClientID  string   `gorm:"type:varchar(64);uniqueIndex:uk_user_client"`
+	Scopes    []string `gorm:"type:varchar(512);serializer:json"`
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+type OAuthSigningKeyModel struct {
+	ID         int64  `gorm:"primaryKey;autoIncrement"`
+	KID        string `gorm:"type:varchar(64);unique"`
+	PrivateKey string `gorm:"type:text"`
+	CreatedAt  int64  `gorm:"index"`
+}
+
+type OAuthDAO struct {
+	db *gorm.DB
+}
+
+func NewOAuthDAO(db *gorm.DB) *OAuthDAO {
+	return &OAuthDAO{db: db}
+}
+
+func (d *OAuthDAO) InsertClient(ctx context.Context, client OAuthClientModel) (int64, error) {
+	now := time.Now().UnixMilli()
+	client.CreatedAt = now
+	client.UpdatedAt = now
+	err := d.db.WithContext(ctx).Create(&client).Error
+	return client.ID, err
+}
+
+func (d *OAuthDAO) FindClientByClientID(ctx context.Context, clientID string) (OAuthClientModel, error) {
+	var client OAuthClientModel
+	err := d.db.WithContext(ctx).Where("client_id = ?", clientID).First(&client).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return OAuthClientModel{}, ErrRecordNotFound
+		}
+		return OAuthClientModel{}, err
+	}
+	return client, nil
+}
+
+func (d *OAuthDAO) FindClientsByOwner(ctx context.Context, ownerId int64) ([]OAuthClientModel, error) {
+	var clients []OAuthClientModel
+	err := d.db.WithContext(ctx).Where("owner_id = ?", ownerId).Order("id DESC").Find(&clients).Error
+	return clients, err
+}
+
+func (d *OAuthDAO) InsertCode(ctx context.Context, code OAuthCodeModel) error {
+	code.CreatedAt = time.Now().UnixMilli()
+	return d.db.WithContext(ctx).Create(&code).Error
+}
+
+// RedeemCode marks an unexpired, unused code as spent and returns it.
+// The conditional update guarantees a code can be redeemed only once, even
+// when two token requests race each other.
+func (d *OAuthDAO) RedeemCode(ctx context.Context, codeHash string) (OAuthCodeModel, error) {
+	var code OAuthCodeModel
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UnixMilli()
+		res := tx.Model(&OAuthCodeModel{}).
+			Where("code_hash = ? AND used_at = 0 AND expires_at > ?", codeHash, now).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+		return tx.Where("code_hash = ?", codeHash).First(&code).Error
+	})
+	return code, err
+}
+
+// UpsertConsent stores the scopes granted by a user to a client, replacing any
+// earlier grant.
+func (d *OAuthDAO) UpsertConsent(ctx context.Context, consent OAuthConsentModel) error {
+	now := time.Now().UnixMilli()
+	consent.CreatedAt = now
+	consent.UpdatedAt = now
+	return d.db.WithContext(ctx).Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"scopes", "updated_at"}),
+	}).Create(&consent).Error
+}
+
+func (d *OAuthDAO) FindConsent(ctx context.Context, userId int64, clientID string) (OAuthConsentModel, error) {
+	var consent OAuthConsentModel
+	err := d.db.WithContext(ctx).Where("user_id = ? AND client_id = ?", userId, clientID).First(&consent).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return OAuthConsentModel{}, ErrRecordNotFound
+		}
+		return OAuthConsentModel{}, err
+	}
+	return consent, nil
+}
+
+func (d *OAuthDAO) FindConsentsByUser(ctx context.Context, userId int64) ([]OAuthConsentModel, error) {
+	var consents []OAuthConsentModel
+	err := d.db.WithContext(ctx).Where("user_id = ?", userId).Order("updated_at DESC").Find(&consents).Error
+	return consents, err
+}
+
+func (d *OAuthDAO) DeleteConsent(ctx context.Context, userId int64, clientID string) error {
+	return d.db.WithContext(ctx).Where("user_id = ? AND client_id = ?", userId, clientID).
+		Delete(&OAuthConsentModel{}).Error
+}
+
+func (d *OAuthDAO) InsertSigningKey(ctx context.Context, key OAuthSigningKeyModel) error {
+	key.CreatedAt = time.Now().UnixMilli()
+	return d.db.WithContext(ctx).Create(&key).Error
+}
+
+// FindSigningKeysSince returns keys created after the given time, newest first.
+func (d *OAuthDAO) FindSigningKeysSince(ctx context.Context, since int64) ([]OAuthSigningKeyModel, error) {
+	var keys []OAuthSigningKeyModel
+	err := d.db.WithContext(ctx).Where("created_at > ?", since).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+func (d *OAuthDAO) DeleteSigningKeysBefore(ctx context.Context, before int64) error {
+	return d.db.WithContext(ctx).Where("created_at < ?", before).Delete(&OAuthSigningKeyModel{}).Error
+}
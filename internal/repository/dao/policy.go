@@ -0,0 +1,123 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrDuplicatePolicy is returned when a policy kind and version is published twice
+var ErrDuplicatePolicy = errors.New("policy version already exists")
+
+type PolicyModel struct {
+	ID          int64  `gorm:"primaryKey;autoIncrement"`
+	Kind        string `gorm:"type:varchar(32);uniqueIndex:uk_kind_version"`
+	Version     string `gorm:"type:varchar(32);uniqueIndex:uk_kind_version"`
+	Title       string `gorm:"type:varchar(255)"`
+	Content     string `gorm:"type:longtext"`
+	PublishedAt int64  `gorm:"index"`
+	CreatedAt   int64
+}
+
+// PolicyConsentModel is an append-only record of a user accepting a policy.
+type PolicyConsentModel struct {
+	ID        int64  `gorm:"primaryKey;autoIncrement"`
+	UserId    int64  `gorm:"uniqueIndex:uk_user_policy"`
+	PolicyId  int64  `gorm:"uniqueIndex:uk_user_policy"`
+	IP        string `gorm:"type:varchar(64)"`
+	UserAgent string `gorm:"type:varchar(512)"`
+	CreatedAt int64
+}
+
+// PolicyConsentRecord is a consent joined with the policy it refers to.
+type PolicyConsentRecord struct {
+	PolicyConsentModel
+	Kind    string
+	Version string
+}
+
+type PolicyDAO struct {
+	db *gorm.DB
+}
+
+func NewPolicyDAO(db *gorm.DB) *PolicyDAO {
+	return &PolicyDAO{db: db}
+}
+
+func (d *PolicyDAO) Insert(ctx context.Context, policy PolicyModel) (int64, error) {
+	policy.CreatedAt = time.Now().UnixMilli()
+	err := d.db.WithContext(ctx).Create(&policy).Error
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return 0, ErrDuplicatePolicy
+		}
+		return 0, err
+	}
+	return policy.ID, nil
+}
+
+func (d *PolicyDAO) FindByID(ctx context.Context, id int64) (PolicyModel, error) {
+	var policy PolicyModel
+	err := d.db.WithContext(ctx).Where("id = ?", id).First(&policy).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return PolicyModel{}, ErrRecordNotFound
+		}
+		return PolicyModel{}, err
+	}
+	return policy, nil
+}
+
+// FindLatest returns, for every kind, the most recently published version
+// whose publication time has passed. Content is not loaded.
+func (d *PolicyDAO) FindLatest(ctx context.Context, now int64) ([]PolicyModel, error) {
+	latest := d.db.Model(&PolicyModel{}).
+		Select("kind, MAX(published_at) AS published_at").
+		Where("published_at <= ?", now).
+		Group("kind")
+
+	var policies []PolicyModel
+	err := d.db.WithContext(ctx).
+		Select("p.id, p.kind, p.version, p.title, p.published_at, p.created_at").
+		Table("policy_models AS p").
+		Joins("JOIN (?) AS l ON l.kind = p.kind AND l.published_at = p.published_at", latest).
+		Order("p.kind").
+		Find(&policies).Error
+	return policies, err
+}
+
+// InsertConsents records acceptances, ignoring policies the user already accepted.
+func (d *PolicyDAO) InsertConsents(ctx context.Context, consents []PolicyConsentModel) error {
+	if len(consents) == 0 {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	for i := range consents {
+		consents[i].CreatedAt = now
+	}
+	return d.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&consents).Error
+}
+
+// FindAcceptedPolicyIds returns which of the given policies the user accepted.
+func (d *PolicyDAO) FindAcceptedPolicyIds(ctx context.Context, userId int64, policyIds []int64) ([]int64, error) {
+	var ids []int64
+	err := d.db.WithContext(ctx).Model(&PolicyConsentModel{}).
+		Where("user_id = ? AND policy_id IN ?", userId, policyIds).
+		Pluck("policy_id", &ids).Error
+	return ids, err
+}
+
+func (d *PolicyDAO) FindConsentsByUser(ctx context.Context, userId int64) ([]PolicyConsentRecord, error) {
+	var records []PolicyConsentRecord
+	err := d.db.WithContext(ctx).
+		Select("c.*, p.kind, p.version").
+		Table("policy_consent_models AS c").
+		Joins("JOIN policy_models AS p ON p.id = c.policy_id").
+		Where("c.user_id = ?", userId).
+		Order("c.created_at DESC").
+		Find(&records).Error
+	return records, err
+}
@@ -0,0 +1,74 @@
+package dao
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ArticleRevisionModel is an immutable snapshot of the working copy, written
+// every time the author saves it.
+type ArticleRevisionModel struct {
+	ID        int64 `gorm:"primaryKey;autoIncrement"`
+	ArticleId int64 `gorm:"index:idx_revision_article_id,priority:1"`
+	AuthorId  int64
+	Title     string `gorm:"type:varchar(256)"`
+	Content   string `gorm:"type:mediumtext"`
+	CreatedAt int64
+}
+
+// addRevision records the saved working copy in the same transaction as the
+// save, so every version the author saw is kept.
+func addRevision(tx *gorm.DB, art ArticleModel, now int64) error {
+	return tx.Create(&ArticleRevisionModel{
+		ArticleId: art.ID,
+		AuthorId:  art.AuthorId,
+		Title:     art.Title,
+		Content:   art.Content,
+		CreatedAt: now,
+	}).Error
+}
+
+// FindRevisions returns one page of an article's revisions without their
+// content, newest first.
+func (d *ArticleDAO) FindRevisions(ctx context.Context, articleId int64, offset, limit int) ([]ArticleRevisionModel, error) {
+	var revs []ArticleRevisionModel
+	err := d.db.WithContext(ctx).
+		Select("id", "article_id", "author_id", "title", "created_at").
+		Where("article_id = ?", articleId).
+		Order("id DESC").
+		Offset(offset).Limit(limit).
+		Find(&revs).Error
+	return revs, err
+}
+
+func (d *ArticleDAO) FindRevision(ctx context.Context, articleId, id int64) (ArticleRevisionModel, error) {
+	var rev ArticleRevisionModel
+	err := d.db.WithContext(ctx).Where("id = ? AND article_id = ?", id, articleId).First(&rev).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ArticleRevisionModel{}, ErrRecordNotFound
+		}
+		return ArticleRevisionModel{}, err
+	}
+	return rev, nil
+}
+
+// PruneRevisions deletes all but the newest keep revisions of an article and
+// returns how many were deleted.
+func (d *ArticleDAO) PruneRevisions(ctx context.Context, articleId int64, keep int) (int64, error) {
+	var oldest []int64
+	err := d.db.WithContext(ctx).Model(&ArticleRevisionModel{}).
+		Where("article_id = ?", articleId).
+		Order("id DESC").
+		Offset(keep-1).Limit(1).
+		Pluck("id", &oldest).Error
+	if err != nil || len(oldest) == 0 {
+		return 0, err
+	}
+	res := d.db.WithContext(ctx).
+		Where("article_id = ? AND id < ?", articleId, oldest[0]).
+		Delete(&ArticleRevisionModel{})
+	return res.RowsAffected, res.Error
+}
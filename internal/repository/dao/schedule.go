@@ -0,0 +1,91 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrScheduleChanged is returned when a scheduled publish was claimed by
+// another instance, rescheduled or cancelled since it was read.
+var ErrScheduleChanged = errors.New("schedule changed")
+
+// SetPublishAt schedules the working copy for publishing, or cancels the
+// schedule when publishAt is 0. It returns ErrRecordNotFound unless authorId
+// wrote the article.
+func (d *ArticleDAO) SetPublishAt(ctx context.Context, id, authorId, publishAt int64) error {
+	res := d.db.WithContext(ctx).Model(&ArticleModel{}).
+		Where("id = ? AND author_id = ?", id, authorId).
+		Updates(map[string]any{
+			"publish_at": publishAt,
+			"updated_at": time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// FindScheduledByAuthor returns one page of an author's scheduled articles,
+// the next to be published first.
+func (d *ArticleDAO) FindScheduledByAuthor(ctx context.Context, authorId int64, offset, limit int) ([]ArticleModel, error) {
+	var arts []ArticleModel
+	err := d.db.WithContext(ctx).
+		Where("author_id = ? AND publish_at > 0", authorId).
+		Order("publish_at ASC, id ASC").
+		Offset(offset).Limit(limit).
+		Find(&arts).Error
+	return arts, err
+}
+
+// FindDue returns up to limit articles whose scheduled time has passed,
+// oldest first.
+func (d *ArticleDAO) FindDue(ctx context.Context, now int64, limit int) ([]ArticleModel, error) {
+	var arts []ArticleModel
+	err := d.db.WithContext(ctx).
+		Where("publish_at > 0 AND publish_at <= ?", now).
+		Order("publish_at ASC, id ASC").
+		Limit(limit).
+		Find(&arts).Error
+	return arts, err
+}
+
+// PublishScheduled publishes a due article exactly once. Clearing publish_at
+// only succeeds while it still holds the time that was read, so when several
+// instances pick up the same article only one of them publishes it; the
+// others get ErrScheduleChanged. Claiming and publishing share a transaction,
+// so a failed publish leaves the article scheduled for the next run.
+func (d *ArticleDAO) PublishScheduled(ctx context.Context, id, publishAt int64, status uint8) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UnixMilli()
+		res := tx.Model(&ArticleModel{}).
+			Where("id = ? AND publish_at = ?", id, publishAt).
+			Updates(map[string]any{
+				"publish_at": 0,
+				"status":     status,
+				"updated_at": now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrScheduleChanged
+		}
+
+		// Publish the working copy as it is now, not as it was when scheduled,
+		// and record it like every other publish.
+		var art ArticleModel
+		if err := tx.Where("id = ?", id).First(&art).Error; err != nil {
+			return err
+		}
+		if err := addRevision(tx, art, now); err != nil {
+			return err
+		}
+		return upsertPublished(tx, art, now)
+	})
+}
@@ -0,0 +1,47 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ScimTenantModel is an enterprise customer whose directory provisions users
+// over SCIM. Only a hash of the bearer token is stored.
+type ScimTenantModel struct {
+	ID        int64  `gorm:"primaryKey;autoIncrement"`
+	Name      string `gorm:"type:varchar(128)"`
+	TokenHash string `gorm:"type:varchar(64);unique"`
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+type ScimTenantDAO struct {
+	db *gorm.DB
+}
+
+func NewScimTenantDAO(db *gorm.DB) *ScimTenantDAO {
+	return &ScimTenantDAO{db: db}
+}
+
+func (d *ScimTenantDAO) Insert(ctx context.Context, tenant ScimTenantModel) (int64, error) {
+	now := time.Now().UnixMilli()
+	tenant.CreatedAt = now
+	tenant.UpdatedAt = now
+	err := d.db.WithContext(ctx).Create(&tenant).Error
+	return tenant.ID, err
+}
+
+func (d *ScimTenantDAO) FindByTokenHash(ctx context.Context, tokenHash string) (ScimTenantModel, error) {
+	var tenant ScimTenantModel
+	err := d.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&tenant).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ScimTenantModel{}, ErrRecordNotFound
+		}
+		return ScimTenantModel{}, err
+	}
+	return tenant, nil
+}
@@ -0,0 +1,52 @@
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SignupScreeningModel records every screening decision, allowed or not, so
+// abuse waves can be reviewed later. It also backs the velocity limits.
+type SignupScreeningModel struct {
+	ID        int64  `gorm:"primaryKey;autoIncrement"`
+	Email     string `gorm:"type:varchar(255)"`
+	IP        string `gorm:"type:varchar(64);index:idx_screening_ip_created,priority:1"`
+	Subnet    string `gorm:"type:varchar(64);index:idx_screening_subnet_created,priority:1"`
+	Reason    string `gorm:"type:varchar(32)"`
+	Detail    string `gorm:"type:varchar(255)"`
+	CreatedAt int64  `gorm:"index:idx_screening_ip_created,priority:2;index:idx_screening_subnet_created,priority:2"`
+}
+
+type ScreeningDAO struct {
+	db *gorm.DB
+}
+
+func NewScreeningDAO(db *gorm.DB) *ScreeningDAO {
+	return &ScreeningDAO{db: db}
+}
+
+func (d *ScreeningDAO) Insert(ctx context.Context, m SignupScreeningModel) (int64, error) {
+	m.CreatedAt = time.Now().UnixMilli()
+	err := d.db.WithContext(ctx).Create(&m).Error
+	return m.ID, err
+}
+
+// CountByIPSince counts the attempts made from ip since the given time.
+func (d *ScreeningDAO) CountByIPSince(ctx context.Context, ip string, since int64) (int64, error) {
+	var n int64
+	err := d.db.WithContext(ctx).Model(&SignupScreeningModel{}).
+		Where("ip = ? AND created_at >= ?", ip, since).
+		Count(&n).Error
+	return n, err
+}
+
+// CountBySubnetSince counts the attempts made from subnet since the given time.
+func (d *ScreeningDAO) CountBySubnetSince(ctx context.Context, subnet string, since int64) (int64, error) {
+	var n int64
+	err := d.db.WithContext(ctx).Model(&SignupScreeningModel{}).
+		Where("subnet = ? AND created_at >= ?", subnet, since).
+		Count(&n).Error
+	return n, err
+}
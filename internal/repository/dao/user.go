@@ -2,7 +2,11 @@ package dao
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
@@ -10,19 +14,66 @@ import (
 )
 
 type UserModel struct {
-	ID        int64  `gorm:"primaryKey;autoIncrement"`
-	Email     string `gorm:"unique"`
-	Password  string
-	Nickname  string
-	Intro     string
-	CreatedAt int64
-	UpdatedAt int64
+	ID int64 `gorm:"primaryKey;autoIncrement"`
+	// Email is NULL for guest accounts; the unique index ignores NULLs.
+	Email sql.NullString `gorm:"unique"`
+	// Phone is NULL unless the user signed up with their phone number.
+	Phone    sql.NullString `gorm:"type:varchar(20);unique"`
+	Password string
+	Nickname string
+	Intro    string
+	// IntroHTML caches Intro rendered by the markup pipeline version in
+	// IntroHTMLVersion.
+	IntroHTML        string `gorm:"type:text"`
+	IntroHTMLVersion int
+	// Birthday is stored as YYYY-MM-DD, empty when unset.
+	Birthday  string   `gorm:"type:varchar(10)"`
+	Location  string   `gorm:"type:varchar(64)"`
+	Websites  []string `gorm:"serializer:json;type:varchar(1024)"`
+	Gender    string   `gorm:"type:varchar(16)"`
+	AvatarURL string   `gorm:"type:varchar(512)"`
+	// Handle keeps the case the user chose; HandleLower enforces uniqueness
+	// case-insensitively. Both are NULL until a handle is claimed.
+	Handle          sql.NullString `gorm:"type:varchar(32)"`
+	HandleLower     sql.NullString `gorm:"type:varchar(32);unique"`
+	HandleChangedAt int64
+	// Privacy settings. The zero values are the defaults, so existing rows
+	// need no backfill: empty audiences mean everyone.
+	ProfileVisibility string `gorm:"type:varchar(16)"`
+	HiddenFromSearch  bool
+	MessagePermission string `gorm:"type:varchar(16)"`
+	// Guest accounts are anonymous until upgraded by signing up.
+	Guest        bool
+	LastActiveAt int64 `gorm:"index"`
+	// TenantId is set for users provisioned by an enterprise directory over SCIM.
+	TenantId   int64  `gorm:"index"`
+	ExternalId string `gorm:"type:varchar(255)"`
+	// DeactivatedAt is non-zero once the account has been deactivated.
+	DeactivatedAt int64
+	CreatedAt     int64
+	UpdatedAt     int64
+}
+
+// UserCondition is a single WHERE condition on the users table.
+// Conditions passed together are ANDed.
+type UserCondition struct {
+	Column string
+	// Op is one of eq, ne, co (contains), sw (starts with), ew (ends with)
+	// and pr (present, i.e. not empty).
+	Op    string
+	Value any
 }
 
 var (
 	// ErrDuplicateEmail is returned when the email already exists in the database
 	ErrDuplicateEmail = errors.New("email already exists")
 
+	// ErrDuplicatePhone is returned when the phone number belongs to another user
+	ErrDuplicatePhone = errors.New("phone already exists")
+
+	// ErrDuplicateHandle is returned when the handle is taken by another user
+	ErrDuplicateHandle = errors.New("handle already exists")
+
 	// ErrRecordNotFound is returned when a record is not found in the database
 	ErrRecordNotFound = errors.New("record not found")
 )
@@ -39,27 +90,23 @@ func NewUserDAO(db *gorm.DB) *UserDAO {
 	return &UserDAO{db: db}
 }
 
-func (u *UserDAO) Insert(ctx context.Context, user UserModel) error {
+func (u *UserDAO) Insert(ctx context.Context, user UserModel) (int64, error) {
 	now := time.Now().UnixMilli()
 	user.CreatedAt = now
 	user.UpdatedAt = now
+	user.LastActiveAt = now
 
 	err := u.db.WithContext(ctx).Create(&user).Error
 
 	if err != nil {
-		// Use errors.As to check if the error is a MySQL driver error.
-		// It unwraps the error if it was wrapped by other layers (like GORM).
-		var mysqlErr *mysql.MySQLError
-		// 1062 is the MySQL error code for "Duplicate entry"
-		// This happens when a unique constraint (like the email) is violated.
-		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntryErrCode {
-			return ErrDuplicateEmail
+		if isDuplicateEntry(err) {
+			return 0, duplicateUserError(err)
 		}
 		// If it's not a duplicate email error, return the original error (e.g., db connection lost)
 		// We must return the error so the caller knows something went wrong.
-		return err
+		return 0, err
 	}
-	return nil
+	return user.ID, nil
 }
 
 func (u *UserDAO) FindByEmail(ctx context.Context, email string) (UserModel, error) {
@@ -74,6 +121,18 @@ func (u *UserDAO) FindByEmail(ctx context.Context, email string) (UserModel, err
 	return user, nil
 }
 
+func (u *UserDAO) FindByPhone(ctx context.Context, phone string) (UserModel, error) {
+	var user UserModel
+	err := u.db.WithContext(ctx).Where("phone = ?", phone).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return UserModel{}, ErrRecordNotFound
+		}
+		return UserModel{}, err
+	}
+	return user, nil
+}
+
 func (u *UserDAO) FindByID(ctx context.Context, id int64) (UserModel, error) {
 	var user UserModel
 	err := u.db.WithContext(ctx).Where("id = ?", id).First(&user).Error
@@ -86,11 +145,221 @@ func (u *UserDAO) FindByID(ctx context.Context, id int64) (UserModel, error) {
 	return user, nil
 }
 
-func (u *UserDAO) UpdateById(ctx context.Context, user UserModel) error {
-	return u.db.WithContext(ctx).Model(&user).Where("id = ?", user.ID).
+func (u *UserDAO) FindByIDs(ctx context.Context, ids []int64) ([]UserModel, error) {
+	var users []UserModel
+	err := u.db.WithContext(ctx).Where("id IN ?", ids).Find(&users).Error
+	return users, err
+}
+
+// UpdateById writes only the given columns of user, so fields missing from a
+// partial update keep their values. Zero values in those columns are written.
+func (u *UserDAO) UpdateById(ctx context.Context, user UserModel, columns []string) error {
+	user.UpdatedAt = time.Now().UnixMilli()
+	res := u.db.WithContext(ctx).Model(&UserModel{}).Where("id = ?", user.ID).
+		Select(append(columns, "updated_at")).Updates(&user)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Search returns users whose handle or nickname starts with prefix, skipping
+// users without a handle, guests, deactivated users and users hidden from search.
+func (u *UserDAO) Search(ctx context.Context, prefix string, limit int) ([]UserModel, error) {
+	var users []UserModel
+	pattern := escapeLike(prefix) + "%"
+	err := u.db.WithContext(ctx).
+		Where("handle_lower LIKE ? OR nickname LIKE ?", strings.ToLower(pattern), pattern).
+		Where("handle_lower IS NOT NULL AND guest = ? AND deactivated_at = ? AND hidden_from_search = ?",
+			false, 0, false).
+		Order("id").
+		Limit(limit).
+		Find(&users).Error
+	return users, err
+}
+
+// FindByTenant returns one page of the users provisioned by a tenant that match
+// all conditions, together with the total number of matches.
+func (u *UserDAO) FindByTenant(ctx context.Context, tenantId int64, conds []UserCondition,
+	offset, limit int) ([]UserModel, int64, error) {
+	query := u.db.WithContext(ctx).Model(&UserModel{}).Where("tenant_id = ?", tenantId)
+	for _, cond := range conds {
+		switch cond.Op {
+		case "eq":
+			query = query.Where(cond.Column+" = ?", cond.Value)
+		case "ne":
+			query = query.Where(cond.Column+" <> ?", cond.Value)
+		case "co":
+			query = query.Where(cond.Column+" LIKE ?", "%"+escapeLike(cond.Value)+"%")
+		case "sw":
+			query = query.Where(cond.Column+" LIKE ?", escapeLike(cond.Value)+"%")
+		case "ew":
+			query = query.Where(cond.Column+" LIKE ?", "%"+escapeLike(cond.Value))
+		case "pr":
+			query = query.Where(cond.Column + " <> ''")
+		default:
+			return nil, 0, fmt.Errorf("unsupported operator %q", cond.Op)
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var users []UserModel
+	err := query.Order("id ASC").Offset(offset).Limit(limit).Find(&users).Error
+	return users, total, err
+}
+
+func (u *UserDAO) FindByTenantAndID(ctx context.Context, tenantId, id int64) (UserModel, error) {
+	var user UserModel
+	err := u.db.WithContext(ctx).Where("id = ? AND tenant_id = ?", id, tenantId).First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return UserModel{}, ErrRecordNotFound
+		}
+		return UserModel{}, err
+	}
+	return user, nil
+}
+
+// UpdateProvisioned overwrites the attributes a directory manages for a
+// tenant-owned user. A user who is already deactivated keeps the time they
+// were deactivated at.
+func (u *UserDAO) UpdateProvisioned(ctx context.Context, user UserModel) error {
+	var deactivatedAt any = int64(0)
+	if user.DeactivatedAt != 0 {
+		deactivatedAt = gorm.Expr("CASE WHEN deactivated_at = 0 THEN ? ELSE deactivated_at END", user.DeactivatedAt)
+	}
+	res := u.db.WithContext(ctx).Model(&UserModel{}).
+		Where("id = ? AND tenant_id = ?", user.ID, user.TenantId).
 		Updates(map[string]any{
-			"nickname":   user.Nickname,
-			"intro":      user.Intro,
-			"updated_at": time.Now().UnixMilli(),
-		}).Error
+			"email":          user.Email,
+			"nickname":       user.Nickname,
+			"external_id":    user.ExternalId,
+			"deactivated_at": deactivatedAt,
+			"updated_at":     time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		if isDuplicateEntry(res.Error) {
+			return ErrDuplicateEmail
+		}
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// isDuplicateEntry reports whether err is a MySQL unique constraint violation.
+func isDuplicateEntry(err error) bool {
+	// Use errors.As to check if the error is a MySQL driver error.
+	// It unwraps the error if it was wrapped by other layers (like GORM).
+	var mysqlErr *mysql.MySQLError
+	// 1062 is the MySQL error code for "Duplicate entry"
+	// This happens when a unique constraint (like the email) is violated.
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntryErrCode
+}
+
+// duplicateUserError tells which unique column of the users table a duplicate
+// entry error is about. MySQL names the violated key in the message.
+func duplicateUserError(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && strings.Contains(mysqlErr.Message, "phone") {
+		return ErrDuplicatePhone
+	}
+	return ErrDuplicateEmail
+}
+
+func escapeLike(v any) string {
+	s := fmt.Sprint(v)
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// UpgradeGuest turns a guest row into a regular account in place, keeping its
+// ID and everything that references it. The nickname is only written when
+// set, since guests cannot choose one.
+func (u *UserDAO) UpgradeGuest(ctx context.Context, user UserModel) error {
+	return upgradeGuest(u.db.WithContext(ctx), user)
+}
+
+func upgradeGuest(db *gorm.DB, user UserModel) error {
+	now := time.Now().UnixMilli()
+	updates := map[string]any{
+		"email":          user.Email,
+		"phone":          user.Phone,
+		"password":       user.Password,
+		"guest":          false,
+		"last_active_at": now,
+		"updated_at":     now,
+	}
+	if user.Nickname != "" {
+		updates["nickname"] = user.Nickname
+	}
+	res := db.Model(&UserModel{}).
+		Where("id = ? AND guest = ?", user.ID, true).
+		Updates(updates)
+	if res.Error != nil {
+		if isDuplicateEntry(res.Error) {
+			return duplicateUserError(res.Error)
+		}
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (u *UserDAO) UpdateLastActive(ctx context.Context, id int64, lastActiveAt int64) error {
+	return u.db.WithContext(ctx).Model(&UserModel{}).Where("id = ?", id).
+		Update("last_active_at", lastActiveAt).Error
+}
+
+// DeleteInactiveGuests deletes up to limit guests not seen since before,
+// together with their policy consents, and returns how many were deleted.
+func (u *UserDAO) DeleteInactiveGuests(ctx context.Context, before int64, limit int) (int64, error) {
+	var ids []int64
+	err := u.db.WithContext(ctx).Model(&UserModel{}).
+		Where("guest = ? AND last_active_at < ?", true, before).
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	var deleted int64
+	err = u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Re-check the conditions: a guest may have been upgraded or become
+		// active since the select.
+		res := tx.Where("id IN ? AND guest = ? AND last_active_at < ?", ids, true, before).
+			Delete(&UserModel{})
+		if res.Error != nil {
+			return res.Error
+		}
+		deleted = res.RowsAffected
+		if deleted == 0 {
+			return nil
+		}
+		// Guests accept policies too. Only drop the consents of the rows that
+		// are gone, not of guests that were kept by the re-check.
+		var kept []int64
+		if err := tx.Model(&UserModel{}).Where("id IN ?", ids).Pluck("id", &kept).Error; err != nil {
+			return err
+		}
+		gone := make([]int64, 0, len(ids))
+		for _, id := range ids {
+			if !slices.Contains(kept, id) {
+				gone = append(gone, id)
+			}
+		}
+		return tx.Where("user_id IN ?", gone).Delete(&PolicyConsentModel{}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
 }
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+)
+
+type FeedRepository struct {
+	dao *dao.FeedDAO
+}
+
+func NewFeedRepository(dao *dao.FeedDAO) *FeedRepository {
+	return &FeedRepository{dao: dao}
+}
+
+// AddItems pushes articles into feed inboxes. Items already there are kept.
+func (r *FeedRepository) AddItems(ctx context.Context, items []domain.FeedItem) error {
+	now := time.Now().UnixMilli()
+	models := make([]dao.FeedItemModel, 0, len(items))
+	for _, it := range items {
+		models = append(models, dao.FeedItemModel{
+			UserId:      it.UserID,
+			ArticleId:   it.ArticleID,
+			AuthorId:    it.AuthorID,
+			PublishedAt: it.PublishedAt.UnixMilli(),
+			CreatedAt:   now,
+		})
+	}
+	return r.dao.InsertItems(ctx, models)
+}
+
+// RemoveAuthor takes the articles of an author out of a user's inbox.
+func (r *FeedRepository) RemoveAuthor(ctx context.Context, userId, authorId int64) error {
+	return r.dao.DeleteByAuthor(ctx, userId, authorId)
+}
+
+// FindItems returns up to limit items of a user's inbox after cursor,
+// newest first.
+func (r *FeedRepository) FindItems(ctx context.Context, userId int64, cursor domain.FeedCursor, limit int) ([]domain.FeedItem, error) {
+	items, err := r.dao.FindItems(ctx, userId, toFeedCursor(cursor), limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.FeedItem, 0, len(items))
+	for _, it := range items {
+		res = append(res, domain.FeedItem{
+			UserID:      it.UserId,
+			ArticleID:   it.ArticleId,
+			AuthorID:    it.AuthorId,
+			PublishedAt: time.UnixMilli(it.PublishedAt),
+		})
+	}
+	return res, nil
+}
+
+func toFeedCursor(c domain.FeedCursor) dao.FeedCursor {
+	if c.IsZero() {
+		return dao.FeedCursor{}
+	}
+	return dao.FeedCursor{PublishedAt: c.PublishedAt.UnixMilli(), ArticleId: c.ArticleID}
+}
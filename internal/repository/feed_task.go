@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+)
+
+var ErrFeedTaskClaimed = dao.ErrFeedTaskClaimed
+
+// AddTask queues inbox work, due at task.RunAt.
+func (r *FeedRepository) AddTask(ctx context.Context, task domain.FeedTask) error {
+	return r.dao.InsertTask(ctx, dao.FeedTaskModel{
+		Kind:       uint8(task.Kind),
+		ArticleId:  task.ArticleID,
+		AuthorId:   task.AuthorID,
+		FollowerId: task.FollowerID,
+		Cursor:     task.Cursor,
+		Attempts:   task.Attempts,
+		RunAt:      task.RunAt.UnixMilli(),
+	})
+}
+
+// FindDueTasks returns up to limit tasks whose time has come.
+func (r *FeedRepository) FindDueTasks(ctx context.Context, now time.Time, limit int) ([]domain.FeedTask, error) {
+	tasks, err := r.dao.FindDueTasks(ctx, now.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.FeedTask, 0, len(tasks))
+	for _, t := range tasks {
+		res = append(res, domain.FeedTask{
+			ID:         t.ID,
+			Kind:       domain.FeedTaskKind(t.Kind),
+			ArticleID:  t.ArticleId,
+			AuthorID:   t.AuthorId,
+			FollowerID: t.FollowerId,
+			Cursor:     t.Cursor,
+			Attempts:   t.Attempts,
+			RunAt:      time.UnixMilli(t.RunAt),
+		})
+	}
+	return res, nil
+}
+
+// ClaimTask hides a task read by FindDueTasks from other instances until
+// until. It returns ErrFeedTaskClaimed if another instance claimed it first.
+func (r *FeedRepository) ClaimTask(ctx context.Context, task domain.FeedTask, until time.Time) error {
+	return r.dao.ClaimTask(ctx, task.ID, task.RunAt.UnixMilli(), until.UnixMilli())
+}
+
+// SaveTaskCursor records how far a task got and extends its claim.
+func (r *FeedRepository) SaveTaskCursor(ctx context.Context, id, cursor int64, until time.Time) error {
+	return r.dao.UpdateTaskCursor(ctx, id, cursor, until.UnixMilli())
+}
+
+// RetryTask makes a failed task due again at runAt.
+func (r *FeedRepository) RetryTask(ctx context.Context, id int64, attempts int, runAt time.Time) error {
+	return r.dao.RetryTask(ctx, id, attempts, runAt.UnixMilli())
+}
+
+func (r *FeedRepository) DeleteTask(ctx context.Context, id int64) error {
+	return r.dao.DeleteTask(ctx, id)
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+)
+
+type FollowRepository struct {
+	dao *dao.FollowDAO
+}
+
+func NewFollowRepository(dao *dao.FollowDAO) *FollowRepository {
+	return &FollowRepository{dao: dao}
+}
+
+func (r *FollowRepository) Follow(ctx context.Context, followerId, followeeId int64) (bool, error) {
+	return r.dao.Insert(ctx, followerId, followeeId)
+}
+
+func (r *FollowRepository) Unfollow(ctx context.Context, followerId, followeeId int64) (bool, error) {
+	return r.dao.Delete(ctx, followerId, followeeId)
+}
+
+func (r *FollowRepository) FindFollowers(ctx context.Context, userId, cursor int64, limit int) ([]domain.Follow, error) {
+	fs, err := r.dao.FindFollowers(ctx, userId, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return r.toDomains(fs), nil
+}
+
+func (r *FollowRepository) FindFollowing(ctx context.Context, userId, cursor int64, limit int) ([]domain.Follow, error) {
+	fs, err := r.dao.FindFollowing(ctx, userId, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return r.toDomains(fs), nil
+}
+
+// FindFollowees returns which of the given users the follower follows, as a
+// set of user IDs.
+func (r *FollowRepository) FindFollowees(ctx context.Context, followerId int64, userIds []int64) (map[int64]bool, error) {
+	res := make(map[int64]bool, len(userIds))
+	if len(userIds) == 0 {
+		return res, nil
+	}
+	ids, err := r.dao.FindFollowees(ctx, followerId, userIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		res[id] = true
+	}
+	return res, nil
+}
+
+// FindFolloweesWithFollowers returns the users followerId follows that have
+// more than minFollowers followers.
+func (r *FollowRepository) FindFolloweesWithFollowers(ctx context.Context, followerId, minFollowers int64) ([]int64, error) {
+	return r.dao.FindFolloweesWithFollowers(ctx, followerId, minFollowers)
+}
+
+// FindStats returns the counters of every given user, keyed by user ID.
+// Users without any follows get zero counters.
+func (r *FollowRepository) FindStats(ctx context.Context, userIds []int64) (map[int64]domain.FollowStats, error) {
+	res := make(map[int64]domain.FollowStats, len(userIds))
+	if len(userIds) == 0 {
+		return res, nil
+	}
+	for _, id := range userIds {
+		res[id] = domain.FollowStats{UserID: id}
+	}
+	rows, err := r.dao.FindStats(ctx, userIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		res[row.UserId] = domain.FollowStats{
+			UserID:    row.UserId,
+			Followers: row.FollowerCnt,
+			Following: row.FollowingCnt,
+		}
+	}
+	return res, nil
+}
+
+func (r *FollowRepository) toDomains(fs []dao.FollowModel) []domain.Follow {
+	res := make([]domain.Follow, 0, len(fs))
+	for _, f := range fs {
+		res = append(res, domain.Follow{
+			ID:         f.ID,
+			FollowerID: f.FollowerId,
+			FolloweeID: f.FolloweeId,
+			Ctime:      time.UnixMilli(f.CreatedAt),
+		})
+	}
+	return res
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+)
+
+var ErrFriendRequestNotFound = errors.New("friend request not found")
+
+type FriendRepository struct {
+	dao *dao.FriendDAO
+}
+
+func NewFriendRepository(dao *dao.FriendDAO) *FriendRepository {
+	return &FriendRepository{dao: dao}
+}
+
+// CreateRequest makes the request from requesterId to addresseeId pending and
+// returns it.
+func (r *FriendRepository) CreateRequest(ctx context.Context, requesterId, addresseeId int64) (domain.FriendRequest, error) {
+	err := r.dao.InsertRequest(ctx, requesterId, addresseeId, uint8(domain.FriendRequestStatusPending))
+	if err != nil {
+		return domain.FriendRequest{}, err
+	}
+	return r.FindRequest(ctx, requesterId, addresseeId)
+}
+
+func (r *FriendRepository) FindRequestById(ctx context.Context, id int64) (domain.FriendRequest, error) {
+	req, err := r.dao.FindRequestById(ctx, id)
+	if err != nil {
+		return domain.FriendRequest{}, r.notFound(err)
+	}
+	return r.toDomain(req), nil
+}
+
+func (r *FriendRepository) FindRequest(ctx context.Context, requesterId, addresseeId int64) (domain.FriendRequest, error) {
+	req, err := r.dao.FindRequest(ctx, requesterId, addresseeId)
+	if err != nil {
+		return domain.FriendRequest{}, r.notFound(err)
+	}
+	return r.toDomain(req), nil
+}
+
+// UpdateRequestStatus moves a request from one status to another. It returns
+// ErrFriendRequestNotFound when the request is no longer in from.
+func (r *FriendRepository) UpdateRequestStatus(ctx context.Context, id int64, from, to domain.FriendRequestStatus) error {
+	return r.notFound(r.dao.UpdateRequestStatus(ctx, id, uint8(from), uint8(to)))
+}
+
+// Accept accepts a pending request and makes both users friends.
+func (r *FriendRepository) Accept(ctx context.Context, req domain.FriendRequest) error {
+	return r.notFound(r.dao.AcceptRequest(ctx, dao.FriendRequestModel{
+		ID:          req.ID,
+		RequesterId: req.RequesterID,
+		AddresseeId: req.AddresseeID,
+	}, uint8(domain.FriendRequestStatusPending), uint8(domain.FriendRequestStatusAccepted)))
+}
+
+func (r *FriendRepository) Unfriend(ctx context.Context, userId, friendId int64) (bool, error) {
+	return r.dao.DeleteFriendship(ctx, userId, friendId)
+}
+
+func (r *FriendRepository) IsFriend(ctx context.Context, userId, friendId int64) (bool, error) {
+	return r.dao.IsFriend(ctx, userId, friendId)
+}
+
+func (r *FriendRepository) FindFriends(ctx context.Context, userId, cursor int64, limit int) ([]domain.Friendship, error) {
+	fs, err := r.dao.FindFriends(ctx, userId, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Friendship, 0, len(fs))
+	for _, f := range fs {
+		res = append(res, domain.Friendship{
+			ID:       f.ID,
+			UserID:   f.UserId,
+			FriendID: f.FriendId,
+			Ctime:    time.UnixMilli(f.CreatedAt),
+		})
+	}
+	return res, nil
+}
+
+// FindPendingIncoming returns pending requests sent to a user, newest first.
+func (r *FriendRepository) FindPendingIncoming(ctx context.Context, addresseeId, cursor int64, limit int) ([]domain.FriendRequest, error) {
+	rs, err := r.dao.FindIncoming(ctx, addresseeId, uint8(domain.FriendRequestStatusPending), cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return r.toDomains(rs), nil
+}
+
+// FindPendingOutgoing returns pending requests a user sent, newest first.
+func (r *FriendRepository) FindPendingOutgoing(ctx context.Context, requesterId, cursor int64, limit int) ([]domain.FriendRequest, error) {
+	rs, err := r.dao.FindOutgoing(ctx, requesterId, uint8(domain.FriendRequestStatusPending), cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return r.toDomains(rs), nil
+}
+
+func (r *FriendRepository) notFound(err error) error {
+	if errors.Is(err, dao.ErrRecordNotFound) {
+		return ErrFriendRequestNotFound
+	}
+	return err
+}
+
+func (r *FriendRepository) toDomains(rs []dao.FriendRequestModel) []domain.FriendRequest {
+	res := make([]domain.FriendRequest, 0, len(rs))
+	for _, req := range rs {
+		res = append(res, r.toDomain(req))
+	}
+	return res
+}
+
+func (r *FriendRepository) toDomain(req dao.FriendRequestModel) domain.FriendRequest {
+	return domain.FriendRequest{
+		ID:          req.ID,
+		RequesterID: req.RequesterId,
+		AddresseeID: req.AddresseeId,
+		Status:      domain.FriendRequestStatus(req.Status),
+		Ctime:       time.UnixMilli(req.CreatedAt),
+		Utime:       time.UnixMilli(req.UpdatedAt),
+	}
+}
@@ -0,0 +1,333 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+)
+
+var (
+	ErrGroupNotFound        = errors.New("group not found")
+	ErrGroupMemberNotFound  = errors.New("group member not found")
+	ErrGroupPendingNotFound = errors.New("group request or invite not found")
+	ErrGroupBanNotFound     = errors.New("group ban not found")
+	ErrGroupPostNotFound    = errors.New("group post not found")
+)
+
+type GroupRepository struct {
+	dao *dao.GroupDAO
+}
+
+func NewGroupRepository(dao *dao.GroupDAO) *GroupRepository {
+	return &GroupRepository{dao: dao}
+}
+
+// Create creates a group owned by g.OwnerID and returns its ID.
+func (r *GroupRepository) Create(ctx context.Context, g domain.Group) (int64, error) {
+	return r.dao.InsertGroup(ctx, r.toModel(g), uint8(domain.GroupRoleOwner))
+}
+
+func (r *GroupRepository) FindByID(ctx context.Context, id int64) (domain.Group, error) {
+	g, err := r.dao.FindGroupById(ctx, id)
+	if err != nil {
+		return domain.Group{}, notFoundAs(err, ErrGroupNotFound)
+	}
+	return r.toDomain(g), nil
+}
+
+// FindByIDs returns the groups with the given IDs that exist, by ID.
+func (r *GroupRepository) FindByIDs(ctx context.Context, ids []int64) (map[int64]domain.Group, error) {
+	gs, err := r.dao.FindGroupsByIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]domain.Group, len(gs))
+	for _, g := range gs {
+		res[g.ID] = r.toDomain(g)
+	}
+	return res, nil
+}
+
+// Update changes the name, description and settings of a group.
+func (r *GroupRepository) Update(ctx context.Context, g domain.Group) error {
+	return r.dao.UpdateGroup(ctx, r.toModel(g))
+}
+
+func (r *GroupRepository) Delete(ctx context.Context, id int64) error {
+	return r.dao.DeleteGroup(ctx, id)
+}
+
+// FindMember returns a user's membership of a group.
+func (r *GroupRepository) FindMember(ctx context.Context, groupId, userId int64) (domain.GroupMember, error) {
+	m, err := r.dao.FindMember(ctx, groupId, userId)
+	if err != nil {
+		return domain.GroupMember{}, notFoundAs(err, ErrGroupMemberNotFound)
+	}
+	return r.toMember(m), nil
+}
+
+// FindMembers returns up to limit members of a group who joined after the
+// member with ID cursor, in the order they joined.
+func (r *GroupRepository) FindMembers(ctx context.Context, groupId, cursor int64, limit int) ([]domain.GroupMember, error) {
+	ms, err := r.dao.FindMembers(ctx, groupId, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.GroupMember, 0, len(ms))
+	for _, m := range ms {
+		res = append(res, r.toMember(m))
+	}
+	return res, nil
+}
+
+// FindByMember returns up to limit groups of a user, most recently joined
+// first, with the user's memberships. cursor is the membership ID of the
+// last group shown, or 0 for the start.
+func (r *GroupRepository) FindByMember(ctx context.Context, userId, cursor int64,
+	limit int) ([]domain.Group, []domain.GroupMember, error) {
+	ms, err := r.dao.FindMembershipsByUser(ctx, userId, cursor, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make([]int64, 0, len(ms))
+	for _, m := range ms {
+		ids = append(ids, m.GroupId)
+	}
+	byId, err := r.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	groups := make([]domain.Group, 0, len(ms))
+	members := make([]domain.GroupMember, 0, len(ms))
+	for _, m := range ms {
+		g, ok := byId[m.GroupId]
+		if !ok {
+			continue
+		}
+		groups = append(groups, g)
+		members = append(members, r.toMember(m))
+	}
+	return groups, members, nil
+}
+
+// AddMember adds a user to a group, which ends their pending request or
+// invite.
+func (r *GroupRepository) AddMember(ctx context.Context, groupId, userId int64, role domain.GroupRole) error {
+	return r.dao.InsertMember(ctx, groupId, userId, uint8(role))
+}
+
+func (r *GroupRepository) RemoveMember(ctx context.Context, groupId, userId int64) error {
+	return notFoundAs(r.dao.DeleteMember(ctx, groupId, userId), ErrGroupMemberNotFound)
+}
+
+// UpdateRole changes a member's role from one to another. It returns
+// ErrGroupMemberNotFound if the member no longer has role from.
+func (r *GroupRepository) UpdateRole(ctx context.Context, groupId, userId int64, from, to domain.GroupRole) error {
+	return notFoundAs(r.dao.UpdateMemberRole(ctx, groupId, userId, uint8(from), uint8(to)), ErrGroupMemberNotFound)
+}
+
+// TransferOwnership makes member toId the owner and the owner fromId an
+// admin.
+func (r *GroupRepository) TransferOwnership(ctx context.Context, groupId, fromId, toId int64) error {
+	err := r.dao.TransferOwnership(ctx, groupId, fromId, toId,
+		uint8(domain.GroupRoleOwner), uint8(domain.GroupRoleAdmin))
+	return notFoundAs(err, ErrGroupMemberNotFound)
+}
+
+// AddPending adds a join request or invite unless the user already has one
+// for the group.
+func (r *GroupRepository) AddPending(ctx context.Context, p domain.GroupPending) error {
+	return r.dao.InsertPending(ctx, dao.GroupPendingModel{
+		GroupId:   p.GroupID,
+		UserId:    p.User.ID,
+		Kind:      uint8(p.Kind),
+		InviterId: p.InviterID,
+	})
+}
+
+// FindPending returns the request or invite of a user for a group.
+func (r *GroupRepository) FindPending(ctx context.Context, groupId, userId int64) (domain.GroupPending, error) {
+	p, err := r.dao.FindPending(ctx, groupId, userId)
+	if err != nil {
+		return domain.GroupPending{}, notFoundAs(err, ErrGroupPendingNotFound)
+	}
+	return r.toPending(p), nil
+}
+
+// FindPendingByGroup returns up to limit requests or invites of a group
+// older than the one with ID cursor, newest first.
+func (r *GroupRepository) FindPendingByGroup(ctx context.Context, groupId int64, kind domain.GroupPendingKind,
+	cursor int64, limit int) ([]domain.GroupPending, error) {
+	ps, err := r.dao.FindPendingByGroup(ctx, groupId, uint8(kind), cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return r.toPendings(ps), nil
+}
+
+// FindPendingByUser returns up to limit requests or invites of a user older
+// than the one with ID cursor, newest first.
+func (r *GroupRepository) FindPendingByUser(ctx context.Context, userId int64, kind domain.GroupPendingKind,
+	cursor int64, limit int) ([]domain.GroupPending, error) {
+	ps, err := r.dao.FindPendingByUser(ctx, userId, uint8(kind), cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return r.toPendings(ps), nil
+}
+
+// RemovePending removes a request or invite of the given kind.
+func (r *GroupRepository) RemovePending(ctx context.Context, groupId, userId int64, kind domain.GroupPendingKind) error {
+	return notFoundAs(r.dao.DeletePending(ctx, groupId, userId, uint8(kind)), ErrGroupPendingNotFound)
+}
+
+// Ban bans a user from a group, removing their membership and any pending
+// request or invite.
+func (r *GroupRepository) Ban(ctx context.Context, groupId, userId, bannedBy int64) error {
+	return r.dao.InsertBan(ctx, groupId, userId, bannedBy)
+}
+
+func (r *GroupRepository) Unban(ctx context.Context, groupId, userId int64) error {
+	return notFoundAs(r.dao.DeleteBan(ctx, groupId, userId), ErrGroupBanNotFound)
+}
+
+func (r *GroupRepository) IsBanned(ctx context.Context, groupId, userId int64) (bool, error) {
+	return r.dao.IsBanned(ctx, groupId, userId)
+}
+
+// FindBans returns up to limit bans of a group older than the one with ID
+// cursor, newest first.
+func (r *GroupRepository) FindBans(ctx context.Context, groupId, cursor int64, limit int) ([]domain.GroupBan, error) {
+	bs, err := r.dao.FindBans(ctx, groupId, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.GroupBan, 0, len(bs))
+	for _, b := range bs {
+		res = append(res, domain.GroupBan{
+			ID:       b.ID,
+			GroupID:  b.GroupId,
+			User:     domain.User{ID: b.UserId},
+			BannedBy: b.BannedBy,
+			Ctime:    time.UnixMilli(b.CreatedAt),
+		})
+	}
+	return res, nil
+}
+
+func (r *GroupRepository) AddPost(ctx context.Context, p domain.GroupPost) (domain.GroupPost, error) {
+	m, err := r.dao.InsertPost(ctx, dao.GroupPostModel{
+		GroupId:  p.GroupID,
+		AuthorId: p.Author.ID,
+		Content:  p.Content,
+	})
+	if err != nil {
+		return domain.GroupPost{}, err
+	}
+	return r.toPost(m), nil
+}
+
+func (r *GroupRepository) FindPost(ctx context.Context, id int64) (domain.GroupPost, error) {
+	p, err := r.dao.FindPostById(ctx, id)
+	if err != nil {
+		return domain.GroupPost{}, notFoundAs(err, ErrGroupPostNotFound)
+	}
+	return r.toPost(p), nil
+}
+
+// FindPosts returns up to limit posts of a group older than before, newest
+// first. before is 0 for the newest posts.
+func (r *GroupRepository) FindPosts(ctx context.Context, groupId, before int64, limit int) ([]domain.GroupPost, error) {
+	ps, err := r.dao.FindPosts(ctx, groupId, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.GroupPost, 0, len(ps))
+	for _, p := range ps {
+		res = append(res, r.toPost(p))
+	}
+	return res, nil
+}
+
+func (r *GroupRepository) DeletePost(ctx context.Context, id int64) error {
+	return r.dao.DeletePost(ctx, id)
+}
+
+func (r *GroupRepository) toModel(g domain.Group) dao.GroupModel {
+	return dao.GroupModel{
+		ID:          g.ID,
+		Name:        g.Name,
+		Description: g.Description,
+		OwnerId:     g.OwnerID,
+		Visibility:  string(g.Settings.Visibility),
+		JoinPolicy:  string(g.Settings.JoinPolicy),
+		PostPolicy:  string(g.Settings.PostPolicy),
+	}
+}
+
+func (r *GroupRepository) toDomain(g dao.GroupModel) domain.Group {
+	return domain.Group{
+		ID:          g.ID,
+		Name:        g.Name,
+		Description: g.Description,
+		OwnerID:     g.OwnerId,
+		Settings: domain.GroupSettings{
+			Visibility: domain.GroupVisibility(g.Visibility),
+			JoinPolicy: domain.GroupJoinPolicy(g.JoinPolicy),
+			PostPolicy: domain.GroupPostPolicy(g.PostPolicy),
+		},
+		MemberCount: g.MemberCnt,
+		Ctime:       time.UnixMilli(g.CreatedAt),
+		Utime:       time.UnixMilli(g.UpdatedAt),
+	}
+}
+
+func (r *GroupRepository) toMember(m dao.GroupMemberModel) domain.GroupMember {
+	return domain.GroupMember{
+		ID:      m.ID,
+		GroupID: m.GroupId,
+		User:    domain.User{ID: m.UserId},
+		Role:    domain.GroupRole(m.Role),
+		Ctime:   time.UnixMilli(m.CreatedAt),
+	}
+}
+
+func (r *GroupRepository) toPendings(ps []dao.GroupPendingModel) []domain.GroupPending {
+	res := make([]domain.GroupPending, 0, len(ps))
+	for _, p := range ps {
+		res = append(res, r.toPending(p))
+	}
+	return res
+}
+
+func (r *GroupRepository) toPending(p dao.GroupPendingModel) domain.GroupPending {
+	return domain.GroupPending{
+		ID:        p.ID,
+		GroupID:   p.GroupId,
+		User:      domain.User{ID: p.UserId},
+		Kind:      domain.GroupPendingKind(p.Kind),
+		InviterID: p.InviterId,
+		Ctime:     time.UnixMilli(p.CreatedAt),
+	}
+}
+
+func (r *GroupRepository) toPost(p dao.GroupPostModel) domain.GroupPost {
+	return domain.GroupPost{
+		ID:      p.ID,
+		GroupID: p.GroupId,
+		Author:  domain.User{ID: p.AuthorId},
+		Content: p.Content,
+		Ctime:   time.UnixMilli(p.CreatedAt),
+	}
+}
+
+// notFoundAs turns a missing record into the given repository error.
+func notFoundAs(err, notFound error) error {
+	if errors.Is(err, dao.ErrRecordNotFound) {
+		return notFound
+	}
+	return err
+}
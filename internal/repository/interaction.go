@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+)
+
+type InteractionRepository struct {
+	dao *dao.InteractionDAO
+}
+
+func NewInteractionRepository(dao *dao.InteractionDAO) *InteractionRepository {
+	return &InteractionRepository{dao: dao}
+}
+
+func (r *InteractionRepository) Like(ctx context.Context, userId, articleId int64) (bool, error) {
+	return r.dao.InsertLike(ctx, userId, articleId)
+}
+
+func (r *InteractionRepository) Unlike(ctx context.Context, userId, articleId int64) (bool, error) {
+	return r.dao.DeleteLike(ctx, userId, articleId)
+}
+
+func (r *InteractionRepository) Bookmark(ctx context.Context, userId, articleId int64) (bool, error) {
+	return r.dao.InsertBookmark(ctx, userId, articleId)
+}
+
+func (r *InteractionRepository) Unbookmark(ctx context.Context, userId, articleId int64) (bool, error) {
+	return r.dao.DeleteBookmark(ctx, userId, articleId)
+}
+
+// IncrViews adds view counts, keyed by article ID, in a single batch.
+func (r *InteractionRepository) IncrViews(ctx context.Context, deltas map[int64]int64) error {
+	return r.dao.IncrViews(ctx, deltas)
+}
+
+// Find returns the interactions of every given article, keyed by article ID.
+// Articles without any interaction get zero counters. The per-user state is
+// only looked up when userId is not 0.
+func (r *InteractionRepository) Find(ctx context.Context, userId int64, articleIds []int64) (map[int64]domain.Interaction, error) {
+	res := make(map[int64]domain.Interaction, len(articleIds))
+	if len(articleIds) == 0 {
+		return res, nil
+	}
+	for _, id := range articleIds {
+		res[id] = domain.Interaction{ArticleID: id}
+	}
+
+	rows, err := r.dao.FindCounters(ctx, articleIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		res[row.ArticleId] = domain.Interaction{
+			ArticleID: row.ArticleId,
+			Likes:     row.LikeCnt,
+			Bookmarks: row.BookmarkCnt,
+			Views:     row.ViewCnt,
+		}
+	}
+	if userId == 0 {
+		return res, nil
+	}
+
+	liked, err := r.dao.FindLiked(ctx, userId, articleIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range liked {
+		in := res[id]
+		in.Liked = true
+		res[id] = in
+	}
+	bookmarked, err := r.dao.FindBookmarked(ctx, userId, articleIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range bookmarked {
+		in := res[id]
+		in.Bookmarked = true
+		res[id] = in
+	}
+	return res, nil
+}
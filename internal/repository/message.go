@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+)
+
+var ErrConversationNotFound = errors.New("conversation not found")
+
+type MessageRepository struct {
+	dao *dao.MessageDAO
+}
+
+func NewMessageRepository(dao *dao.MessageDAO) *MessageRepository {
+	return &MessageRepository{dao: dao}
+}
+
+// FindConversationID returns the conversation between two users.
+func (r *MessageRepository) FindConversationID(ctx context.Context, userId, peerId int64) (int64, error) {
+	id, err := r.dao.FindConversationId(ctx, userId, peerId)
+	return id, r.notFound(err)
+}
+
+// CreateConversation returns the conversation between two users, creating it
+// if there is none.
+func (r *MessageRepository) CreateConversation(ctx context.Context, userId, peerId int64) (int64, error) {
+	return r.dao.InsertConversation(ctx, userId, peerId)
+}
+
+// FindConversation returns a conversation as seen by userId, with the ID of
+// the peer and the last message. It returns ErrConversationNotFound unless
+// the user takes part in it.
+func (r *MessageRepository) FindConversation(ctx context.Context, id, userId int64) (domain.Conversation, error) {
+	m, err := r.dao.FindMember(ctx, id, userId)
+	if err != nil {
+		return domain.Conversation{}, r.notFound(err)
+	}
+	cs, err := r.toConversations(ctx, []dao.ConversationMemberModel{m})
+	if err != nil {
+		return domain.Conversation{}, err
+	}
+	return cs[0], nil
+}
+
+// FindConversations returns up to limit conversations of a user with
+// messages, after cursor, most recently active first.
+func (r *MessageRepository) FindConversations(ctx context.Context, userId int64, cursor domain.ConversationCursor,
+	limit int) ([]domain.Conversation, error) {
+	var c dao.ConversationCursor
+	if !cursor.IsZero() {
+		c = dao.ConversationCursor{UpdatedAt: cursor.Utime.UnixMilli(), ConversationId: cursor.ID}
+	}
+	ms, err := r.dao.FindMembersByUser(ctx, userId, c, limit)
+	if err != nil {
+		return nil, err
+	}
+	return r.toConversations(ctx, ms)
+}
+
+// toConversations loads the peers' sides and the last messages of the given
+// sides of conversations.
+func (r *MessageRepository) toConversations(ctx context.Context, ms []dao.ConversationMemberModel) ([]domain.Conversation, error) {
+	ids := make([]int64, 0, len(ms))
+	msgIds := make([]int64, 0, len(ms))
+	for _, m := range ms {
+		ids = append(ids, m.ConversationId)
+		if m.LastMessageId > 0 {
+			msgIds = append(msgIds, m.LastMessageId)
+		}
+	}
+	members, err := r.dao.FindMembers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	type side struct{ conversationId, userId int64 }
+	sides := make(map[side]dao.ConversationMemberModel, len(members))
+	for _, p := range members {
+		sides[side{p.ConversationId, p.UserId}] = p
+	}
+	msgs, err := r.dao.FindMessagesByIds(ctx, msgIds)
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[int64]dao.MessageModel, len(msgs))
+	for _, msg := range msgs {
+		byId[msg.ID] = msg
+	}
+
+	res := make([]domain.Conversation, 0, len(ms))
+	for _, m := range ms {
+		peer := sides[side{m.ConversationId, m.PeerId}]
+		c := domain.Conversation{
+			ID:             m.ConversationId,
+			Peer:           domain.User{ID: m.PeerId},
+			Unread:         m.Unread,
+			LastReadID:     m.LastReadId,
+			PeerLastReadID: peer.LastReadId,
+			PeerSent:       peer.LastSentId > 0,
+			Ctime:          time.UnixMilli(m.CreatedAt),
+			Utime:          time.UnixMilli(m.UpdatedAt),
+		}
+		if msg, ok := byId[m.LastMessageId]; ok {
+			c.LastMessage = r.toMessage(msg)
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+// AddMessage stores a message from senderId to recipientId.
+func (r *MessageRepository) AddMessage(ctx context.Context, conversationId, senderId, recipientId int64,
+	content string) (domain.Message, error) {
+	msg, err := r.dao.InsertMessage(ctx, dao.MessageModel{
+		ConversationId: conversationId,
+		SenderId:       senderId,
+		Content:        content,
+	}, recipientId)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	return r.toMessage(msg), nil
+}
+
+// FindMessages returns up to limit messages of a conversation older than
+// before, newest first. before is 0 for the newest messages.
+func (r *MessageRepository) FindMessages(ctx context.Context, conversationId, before int64, limit int) ([]domain.Message, error) {
+	msgs, err := r.dao.FindMessages(ctx, conversationId, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		res = append(res, r.toMessage(msg))
+	}
+	return res, nil
+}
+
+// MarkRead moves userId's read cursor forward to upTo. It reports whether the
+// cursor moved.
+func (r *MessageRepository) MarkRead(ctx context.Context, conversationId, userId, peerId, upTo int64) (bool, error) {
+	return r.dao.MarkRead(ctx, conversationId, userId, peerId, upTo)
+}
+
+// CountUnread counts the unread messages of a user across all conversations.
+func (r *MessageRepository) CountUnread(ctx context.Context, userId int64) (int64, error) {
+	return r.dao.SumUnread(ctx, userId)
+}
+
+func (r *MessageRepository) toMessage(msg dao.MessageModel) domain.Message {
+	return domain.Message{
+		ID:             msg.ID,
+		ConversationID: msg.ConversationId,
+		SenderID:       msg.SenderId,
+		Content:        msg.Content,
+		Ctime:          time.UnixMilli(msg.CreatedAt),
+	}
+}
+
+func (r *MessageRepository) notFound(err error) error {
+	if errors.Is(err, dao.ErrRecordNotFound) {
+		return ErrConversationNotFound
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+)
+
+type NotificationRepository struct {
+	dao *dao.NotificationDAO
+}
+
+func NewNotificationRepository(dao *dao.NotificationDAO) *NotificationRepository {
+	return &NotificationRepository{dao: dao}
+}
+
+// Add stores a notification, merging it into the unread notification of the
+// same group if there is one, and returns its ID. actorId is 0 for events
+// without an actor. The ID is 0 if nothing changed because the actor was
+// already counted.
+func (r *NotificationRepository) Add(ctx context.Context, n domain.Notification, actorId int64) (int64, error) {
+	return r.dao.Upsert(ctx, dao.NotificationModel{
+		UserId:    n.UserID,
+		Type:      uint8(n.Type),
+		GroupKey:  n.GroupKey,
+		ArticleId: n.ArticleID,
+		CommentId: n.CommentID,
+		Detail:    n.Detail,
+	}, actorId)
+}
+
+// FindByUser returns up to limit notifications of a user after cursor, most
+// recently updated first. Each comes with the IDs of up to actors of its most
+// recent actors.
+func (r *NotificationRepository) FindByUser(ctx context.Context, userId int64, cursor domain.NotificationCursor,
+	limit int, unreadOnly bool, actors int) ([]domain.Notification, error) {
+	var c dao.NotificationCursor
+	if !cursor.IsZero() {
+		c = dao.NotificationCursor{UpdatedAt: cursor.Utime.UnixMilli(), ID: cursor.ID}
+	}
+	ns, err := r.dao.FindByUser(ctx, userId, c, limit, unreadOnly)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(ns))
+	for _, n := range ns {
+		ids = append(ids, n.ID)
+	}
+	as, err := r.dao.FindLatestActors(ctx, ids, actors)
+	if err != nil {
+		return nil, err
+	}
+	byNotification := make(map[int64][]domain.User, len(ns))
+	for _, a := range as {
+		byNotification[a.NotificationId] = append(byNotification[a.NotificationId], domain.User{ID: a.ActorId})
+	}
+
+	res := make([]domain.Notification, 0, len(ns))
+	for _, n := range ns {
+		res = append(res, domain.Notification{
+			ID:        n.ID,
+			UserID:    n.UserId,
+			Type:      domain.NotificationType(n.Type),
+			GroupKey:  n.GroupKey,
+			ArticleID: n.ArticleId,
+			CommentID: n.CommentId,
+			Count:     n.Cnt,
+			Actors:    byNotification[n.ID],
+			Detail:    n.Detail,
+			Read:      n.ReadAt > 0,
+			Ctime:     time.UnixMilli(n.CreatedAt),
+			Utime:     time.UnixMilli(n.UpdatedAt),
+		})
+	}
+	return res, nil
+}
+
+func (r *NotificationRepository) MarkRead(ctx context.Context, userId int64, ids []int64) (int64, error) {
+	return r.dao.MarkRead(ctx, userId, ids)
+}
+
+func (r *NotificationRepository) MarkAllRead(ctx context.Context, userId int64) (int64, error) {
+	return r.dao.MarkAllRead(ctx, userId)
+}
+
+func (r *NotificationRepository) CountUnread(ctx context.Context, userId int64) (int64, error) {
+	return r.dao.CountUnread(ctx, userId)
+}
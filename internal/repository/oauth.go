@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+)
+
+var (
+	ErrOAuthClientNotFound  = dao.ErrRecordNotFound
+	ErrOAuthCodeNotFound    = dao.ErrRecordNotFound
+	ErrOAuthConsentNotFound = dao.ErrRecordNotFound
+)
+
+type OAuthRepository struct {
+	oauthDAO *dao.OAuthDAO
+}
+
+func NewOAuthRepository(oauthDAO *dao.OAuthDAO) *OAuthRepository {
+	return &OAuthRepository{oauthDAO: oauthDAO}
+}
+
+func (r *OAuthRepository) CreateClient(ctx context.Context, client domain.OAuthClient) (int64, error) {
+	return r.oauthDAO.InsertClient(ctx, dao.OAuthClientModel{
+		ClientID:     client.ClientID,
+		SecretHash:   client.SecretHash,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIs,
+		Public:       client.Public,
+		OwnerId:      client.OwnerId,
+	})
+}
+
+func (r *OAuthRepository) FindClient(ctx context.Context, clientID string) (domain.OAuthClient, error) {
+	c, err := r.oauthDAO.FindClientByClientID(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return domain.OAuthClient{}, ErrOAuthClientNotFound
+		}
+		return domain.OAuthClient{}, err
+	}
+	return r.clientToDomain(c), nil
+}
+
+func (r *OAuthRepository) FindClientsByOwner(ctx context.Context, ownerId int64) ([]domain.OAuthClient, error) {
+	cs, err := r.oauthDAO.FindClientsByOwner(ctx, ownerId)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.OAuthClient, 0, len(cs))
+	for _, c := range cs {
+		res = append(res, r.clientToDomain(c))
+	}
+	return res, nil
+}
+
+func (r *OAuthRepository) CreateCode(ctx context.Context, code domain.AuthorizationCode) error {
+	return r.oauthDAO.InsertCode(ctx, dao.OAuthCodeModel{
+		CodeHash:            code.CodeHash,
+		ClientID:            code.ClientID,
+		UserId:              code.UserId,
+		RedirectURI:         code.RedirectURI,
+		Scopes:              code.Scopes,
+		Nonce:               code.Nonce,
+		CodeChallenge:       code.CodeChallenge,
+		CodeChallengeMethod: code.CodeChallengeMethod,
+		AuthTime:            code.AuthTime.UnixMilli(),
+		ExpiresAt:           code.ExpiresAt.UnixMilli(),
+	})
+}
+
+func (r *OAuthRepository) RedeemCode(ctx context.Context, codeHash string) (domain.AuthorizationCode, error) {
+	c, err := r.oauthDAO.RedeemCode(ctx, codeHash)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return domain.AuthorizationCode{}, ErrOAuthCodeNotFound
+		}
+		return domain.AuthorizationCode{}, err
+	}
+	return domain.AuthorizationCode{
+		CodeHash:            c.CodeHash,
+		ClientID:            c.ClientID,
+		UserId:              c.UserId,
+		RedirectURI:         c.RedirectURI,
+		Scopes:              c.Scopes,
+		Nonce:               c.Nonce,
+		CodeChallenge:       c.CodeChallenge,
+		CodeChallengeMethod: c.CodeChallengeMethod,
+		AuthTime:            time.UnixMilli(c.AuthTime),
+		ExpiresAt:           time.UnixMilli(c.ExpiresAt),
+	}, nil
+}
+
+func (r *OAuthRepository) SaveConsent(ctx context.Context, consent domain.OAuthConsent) error {
+	return r.oauthDAO.UpsertConsent(ctx, dao.OAuthConsentModel{
+		UserId:   consent.UserId,
+		ClientID: consent.ClientID,
+		Scopes:   consent.Scopes,
+	})
+}
+
+func (r *OAuthRepository) FindConsent(ctx context.Context, userId int64, clientID string) (domain.OAuthConsent, error) {
+	c, err := r.oauthDAO.FindConsent(ctx, userId, clientID)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return domain.OAuthConsent{}, ErrOAuthConsentNotFound
+		}
+		return domain.OAuthConsent{}, err
+	}
+	return r.consentToDomain(c), nil
+}
+
+func (r *OAuthRepository) FindConsentsByUser(ctx context.Context, userId int64) ([]domain.OAuthConsent, error) {
+	cs, err := r.oauthDAO.FindConsentsByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.OAuthConsent, 0, len(cs))
+	for _, c := range cs {
+		res = append(res, r.consentToDomain(c))
+	}
+	return res, nil
+}
+
+func (r *OAuthRepository) DeleteConsent(ctx context.Context, userId int64, clientID string) error {
+	return r.oauthDAO.DeleteConsent(ctx, userId, clientID)
+}
+
+func (r *OAuthRepository) CreateSigningKey(ctx context.Context, key domain.SigningKey) error {
+	der := x509.MarshalPKCS1PrivateKey(key.PrivateKey)
+	return r.oauthDAO.InsertSigningKey(ctx, dao.OAuthSigningKeyModel{
+		KID:        key.KID,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der})),
+	})
+}
+
+// FindSigningKeysSince returns the signing keys created after the given time,
+// newest first.
+func (r *OAuthRepository) FindSigningKeysSince(ctx context.Context, since time.Time) ([]domain.SigningKey, error) {
+	ks, err := r.oauthDAO.FindSigningKeysSince(ctx, since.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.SigningKey, 0, len(ks))
+	for _, k := range ks {
+		block, _ := pem.Decode([]byte(k.PrivateKey))
+		if block == nil {
+			return nil, errors.New("invalid signing key PEM")
+		}
+		var pk *rsa.PrivateKey
+		pk, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, domain.SigningKey{
+			KID:        k.KID,
+			PrivateKey: pk,
+			Ctime:      time.UnixMilli(k.CreatedAt),
+		})
+	}
+	return res, nil
+}
+
+func (r *OAuthRepository) DeleteSigningKeysBefore(ctx context.Context, before time.Time) error {
+	return r.oauthDAO.DeleteSigningKeysBefore(ctx, before.UnixMilli())
+}
+
+func (r *OAuthRepository) clientToDomain(c dao.OAuthClientModel) domain.OAuthClient {
+	return domain.OAuthClient{
+		ID:           c.ID,
+		ClientID:     c.ClientID,
+		SecretHash:   c.SecretHash,
+		Name:         c.Name,
+		RedirectURIs: c.RedirectURIs,
+		Public:       c.Public,
+		OwnerId:      c.OwnerId,
+		Ctime:        time.UnixMilli(c.CreatedAt),
+	}
+}
+
+func (r *OAuthRepository) consentToDomain(c dao.OAuthConsentModel) domain.OAuthConsent {
+	return domain.OAuthConsent{
+		UserId:   c.UserId,
+		ClientID: c.ClientID,
+		Scopes:   c.Scopes,
+		Ctime:    time.UnixMilli(c.CreatedAt),
+		Utime:    time.UnixMilli(c.UpdatedAt),
+	}
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+)
+
+var (
+	ErrDuplicatePolicy = dao.ErrDuplicatePolicy
+	ErrPolicyNotFound  = dao.ErrRecordNotFound
+)
+
+type PolicyRepository struct {
+	policyDAO *dao.PolicyDAO
+}
+
+func NewPolicyRepository(policyDAO *dao.PolicyDAO) *PolicyRepository {
+	return &PolicyRepository{policyDAO: policyDAO}
+}
+
+func (r *PolicyRepository) Create(ctx context.Context, policy domain.Policy) (int64, error) {
+	return r.policyDAO.Insert(ctx, dao.PolicyModel{
+		Kind:        policy.Kind,
+		Version:     policy.Version,
+		Title:       policy.Title,
+		Content:     policy.Content,
+		PublishedAt: policy.PublishedAt.UnixMilli(),
+	})
+}
+
+func (r *PolicyRepository) FindByID(ctx context.Context, id int64) (domain.Policy, error) {
+	p, err := r.policyDAO.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return domain.Policy{}, ErrPolicyNotFound
+		}
+		return domain.Policy{}, err
+	}
+	return r.toDomain(p), nil
+}
+
+// FindLatest returns the current version of every policy kind, without content.
+func (r *PolicyRepository) FindLatest(ctx context.Context, now time.Time) ([]domain.Policy, error) {
+	ps, err := r.policyDAO.FindLatest(ctx, now.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Policy, 0, len(ps))
+	for _, p := range ps {
+		res = append(res, r.toDomain(p))
+	}
+	return res, nil
+}
+
+func (r *PolicyRepository) CreateConsents(ctx context.Context, consents []domain.PolicyConsent) error {
+	ms := make([]dao.PolicyConsentModel, 0, len(consents))
+	for _, c := range consents {
+		ms = append(ms, dao.PolicyConsentModel{
+			UserId:    c.UserId,
+			PolicyId:  c.PolicyId,
+			IP:        c.IP,
+			UserAgent: c.UserAgent,
+		})
+	}
+	return r.policyDAO.InsertConsents(ctx, ms)
+}
+
+func (r *PolicyRepository) FindAcceptedPolicyIds(ctx context.Context, userId int64, policyIds []int64) ([]int64, error) {
+	return r.policyDAO.FindAcceptedPolicyIds(ctx, userId, policyIds)
+}
+
+func (r *PolicyRepository) FindConsentsByUser(ctx context.Context, userId int64) ([]domain.PolicyConsent, error) {
+	cs, err := r.policyDAO.FindConsentsByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.PolicyConsent, 0, len(cs))
+	for _, c := range cs {
+		res = append(res, domain.PolicyConsent{
+			UserId:     c.UserId,
+			PolicyId:   c.PolicyId,
+			Kind:       c.Kind,
+			Version:    c.Version,
+			IP:         c.IP,
+			UserAgent:  c.UserAgent,
+			AcceptedAt: time.UnixMilli(c.CreatedAt),
+		})
+	}
+	return res, nil
+}
+
+func (r *PolicyRepository) toDomain(p dao.PolicyModel) domain.Policy {
+	return domain.Policy{
+		ID:          p.ID,
+		Kind:        p.Kind,
+		Version:     p.Version,
+		Title:       p.Title,
+		Content:     p.Content,
+		PublishedAt: time.UnixMilli(p.PublishedAt),
+	}
+}
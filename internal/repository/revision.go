@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// FindRevisions returns one page of an article's revisions, newest first.
+// The content is left empty; fetch a single revision to read it.
+func (r *ArticleRepository) FindRevisions(ctx context.Context, articleId int64, offset, limit int) ([]domain.ArticleRevision, error) {
+	revs, err := r.dao.FindRevisions(ctx, articleId, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.ArticleRevision, 0, len(revs))
+	for _, rev := range revs {
+		res = append(res, r.toRevision(rev))
+	}
+	return res, nil
+}
+
+func (r *ArticleRepository) FindRevision(ctx context.Context, articleId, id int64) (domain.ArticleRevision, error) {
+	rev, err := r.dao.FindRevision(ctx, articleId, id)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return domain.ArticleRevision{}, ErrRevisionNotFound
+		}
+		return domain.ArticleRevision{}, err
+	}
+	return r.toRevision(rev), nil
+}
+
+func (r *ArticleRepository) PruneRevisions(ctx context.Context, articleId int64, keep int) (int64, error) {
+	return r.dao.PruneRevisions(ctx, articleId, keep)
+}
+
+func (r *ArticleRepository) toRevision(rev dao.ArticleRevisionModel) domain.ArticleRevision {
+	return domain.ArticleRevision{
+		ID:        rev.ID,
+		ArticleID: rev.ArticleId,
+		AuthorID:  rev.AuthorId,
+		Title:     rev.Title,
+		Content:   rev.Content,
+		Ctime:     time.UnixMilli(rev.CreatedAt),
+	}
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+)
+
+var ErrScheduleChanged = dao.ErrScheduleChanged
+
+// SetPublishAt schedules the article, or cancels the schedule for the zero time.
+func (r *ArticleRepository) SetPublishAt(ctx context.Context, id, authorId int64, publishAt time.Time) error {
+	var ms int64
+	if !publishAt.IsZero() {
+		ms = publishAt.UnixMilli()
+	}
+	return r.notFound(r.dao.SetPublishAt(ctx, id, authorId, ms))
+}
+
+func (r *ArticleRepository) FindScheduledByAuthor(ctx context.Context, authorId int64, offset, limit int) ([]domain.Article, error) {
+	arts, err := r.dao.FindScheduledByAuthor(ctx, authorId, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return r.toDomains(arts), nil
+}
+
+// FindDue returns up to limit scheduled articles whose time has come.
+func (r *ArticleRepository) FindDue(ctx context.Context, now time.Time, limit int) ([]domain.Article, error) {
+	arts, err := r.dao.FindDue(ctx, now.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return r.toDomains(arts), nil
+}
+
+// PublishScheduled publishes a due article unless its schedule changed since
+// art was read, in which case it returns ErrScheduleChanged.
+func (r *ArticleRepository) PublishScheduled(ctx context.Context, art domain.Article) error {
+	return r.dao.PublishScheduled(ctx, art.ID, art.PublishAt.UnixMilli(), uint8(domain.ArticleStatusPublished))
+}
+
+func (r *ArticleRepository) toDomains(arts []dao.ArticleModel) []domain.Article {
+	res := make([]domain.Article, 0, len(arts))
+	for _, art := range arts {
+		res = append(res, r.toDomain(art))
+	}
+	return res
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+)
+
+var ErrScimTenantNotFound = dao.ErrRecordNotFound
+
+type ScimTenantRepository struct {
+	tenantDAO *dao.ScimTenantDAO
+}
+
+func NewScimTenantRepository(tenantDAO *dao.ScimTenantDAO) *ScimTenantRepository {
+	return &ScimTenantRepository{tenantDAO: tenantDAO}
+}
+
+func (r *ScimTenantRepository) Create(ctx context.Context, name, tokenHash string) (int64, error) {
+	return r.tenantDAO.Insert(ctx, dao.ScimTenantModel{
+		Name:      name,
+		TokenHash: tokenHash,
+	})
+}
+
+func (r *ScimTenantRepository) FindByTokenHash(ctx context.Context, tokenHash string) (domain.ScimTenant, error) {
+	t, err := r.tenantDAO.FindByTokenHash(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return domain.ScimTenant{}, ErrScimTenantNotFound
+		}
+		return domain.ScimTenant{}, err
+	}
+	return domain.ScimTenant{
+		ID:   t.ID,
+		Name: t.Name,
+	}, nil
+}
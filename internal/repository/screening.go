@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository/dao"
+)
+
+type ScreeningRepository struct {
+	dao *dao.ScreeningDAO
+}
+
+func NewScreeningRepository(dao *dao.ScreeningDAO) *ScreeningRepository {
+	return &ScreeningRepository{dao: dao}
+}
+
+func (r *ScreeningRepository) Record(ctx context.Context, d domain.ScreeningDecision) (int64, error) {
+	return r.dao.Insert(ctx, dao.SignupScreeningModel{
+		Email:  d.Email,
+		IP:     d.IP,
+		Subnet: d.Subnet,
+		Reason: string(d.Reason),
+		Detail: d.Detail,
+	})
+}
+
+func (r *ScreeningRepository) CountByIPSince(ctx context.Context, ip string, since time.Time) (int64, error) {
+	return r.dao.CountByIPSince(ctx, ip, since.UnixMilli())
+}
+
+func (r *ScreeningRepository) CountBySubnetSince(ctx context.Context, subnet string, since time.Time) (int64, error) {
+	return r.dao.CountBySubnetSince(ctx, subnet, since.UnixMilli())
+}
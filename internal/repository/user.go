@@ -2,15 +2,26 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/markup"
 	"github.com/ktsoator/connectify/internal/repository/dao"
 )
 
 var (
-	ErrDuplicateEmail = dao.ErrDuplicateEmail
-	ErrUserNotFound   = dao.ErrRecordNotFound
+	ErrDuplicateEmail    = dao.ErrDuplicateEmail
+	ErrDuplicatePhone    = dao.ErrDuplicatePhone
+	ErrDuplicateHandle   = dao.ErrDuplicateHandle
+	ErrDuplicateIdentity = dao.ErrDuplicateIdentity
+	ErrUserNotFound      = dao.ErrRecordNotFound
+	// ErrUnsupportedFilter means a user filter names a field or operator
+	// that cannot be searched.
+	ErrUnsupportedFilter = errors.New("unsupported user filter")
 )
 
 type UserRepository struct {
@@ -21,20 +32,15 @@ func NewUserRepository(userDAO *dao.UserDAO) *UserRepository {
 	return &UserRepository{userDAO: userDAO}
 }
 
-func (r *UserRepository) Create(ctx context.Context, user domain.User) error {
-	err := r.userDAO.Insert(ctx, dao.UserModel{
-		Email:    user.Email,
-		Password: user.Password,
-		Nickname: user.Nickname,
-		Intro:    user.Intro,
-	})
+func (r *UserRepository) Create(ctx context.Context, user domain.User) (int64, error) {
+	id, err := r.userDAO.Insert(ctx, r.toModel(user))
 	if err != nil {
 		if errors.Is(err, ErrDuplicateEmail) {
-			return ErrDuplicateEmail
+			return 0, ErrDuplicateEmail
 		}
-		return err
+		return 0, err
 	}
-	return nil
+	return id, nil
 }
 
 func (r *UserRepository) FindByEmail(ctx context.Context, email string) (domain.User, error) {
@@ -45,13 +51,37 @@ func (r *UserRepository) FindByEmail(ctx context.Context, email string) (domain.
 		}
 		return domain.User{}, err
 	}
-	return domain.User{
-		ID:       u.ID,
-		Email:    u.Email,
-		Password: u.Password,
-		Nickname: u.Nickname,
-		Intro:    u.Intro,
-	}, nil
+	return r.toDomain(u), nil
+}
+
+func (r *UserRepository) FindByPhone(ctx context.Context, phone string) (domain.User, error) {
+	u, err := r.userDAO.FindByPhone(ctx, phone)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return domain.User{}, ErrUserNotFound
+		}
+		return domain.User{}, err
+	}
+	return r.toDomain(u), nil
+}
+
+// FindByIdentity finds the user linked to the third-party account.
+func (r *UserRepository) FindByIdentity(ctx context.Context, identity domain.ExternalIdentity) (domain.User, error) {
+	u, err := r.userDAO.FindByIdentity(ctx, identity.Provider, identity.Subject)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return domain.User{}, ErrUserNotFound
+		}
+		return domain.User{}, err
+	}
+	return r.toDomain(u), nil
+}
+
+// CreateWithIdentity creates a user signed up with a third-party account and
+// links the account to it.
+func (r *UserRepository) CreateWithIdentity(ctx context.Context, user domain.User,
+	identity domain.ExternalIdentity) (int64, error) {
+	return r.userDAO.InsertWithIdentity(ctx, r.toModel(user), toIdentityModel(identity))
 }
 
 func (r *UserRepository) FindByID(ctx context.Context, id int64) (domain.User, error) {
@@ -62,19 +92,355 @@ func (r *UserRepository) FindByID(ctx context.Context, id int64) (domain.User, e
 		}
 		return domain.User{}, err
 	}
+	return r.toDomain(u), nil
+}
+
+// FindByIDs returns the users that exist among ids, keyed by ID.
+func (r *UserRepository) FindByIDs(ctx context.Context, ids []int64) (map[int64]domain.User, error) {
+	res := make(map[int64]domain.User, len(ids))
+	if len(ids) == 0 {
+		return res, nil
+	}
+	users, err := r.userDAO.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		res[u.ID] = r.toDomain(u)
+	}
+	return res, nil
+}
+
+// Update applies a partial profile update; only the fields set in patch are written.
+func (r *UserRepository) Update(ctx context.Context, id int64, patch domain.UserProfilePatch) error {
+	m := dao.UserModel{ID: id}
+	var columns []string
+	if patch.Nickname != nil {
+		m.Nickname = *patch.Nickname
+		columns = append(columns, "nickname")
+	}
+	if patch.Intro != nil {
+		m.Intro = *patch.Intro
+		m.IntroHTML, m.IntroHTMLVersion = markup.Render(m.Intro), markup.Version
+		columns = append(columns, "intro", "intro_html", "intro_html_version")
+	}
+	if patch.Birthday != nil {
+		m.Birthday = formatBirthday(*patch.Birthday)
+		columns = append(columns, "birthday")
+	}
+	if patch.Location != nil {
+		m.Location = *patch.Location
+		columns = append(columns, "location")
+	}
+	if patch.Websites != nil {
+		m.Websites = *patch.Websites
+		columns = append(columns, "websites")
+	}
+	if patch.Gender != nil {
+		m.Gender = *patch.Gender
+		columns = append(columns, "gender")
+	}
+	if patch.AvatarURL != nil {
+		m.AvatarURL = *patch.AvatarURL
+		columns = append(columns, "avatar_url")
+	}
+
+	err := r.userDAO.UpdateById(ctx, m, columns)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// FindByTenant returns one page of a tenant's provisioned users matching all
+// filters, and the total number of matches.
+func (r *UserRepository) FindByTenant(ctx context.Context, tenantId int64, filters []domain.UserFilter,
+	offset, limit int) ([]domain.User, int64, error) {
+	conds := make([]dao.UserCondition, 0, len(filters))
+	for _, f := range filters {
+		cond, err := r.toCondition(f)
+		if err != nil {
+			return nil, 0, err
+		}
+		conds = append(conds, cond)
+	}
+
+	us, total, err := r.userDAO.FindByTenant(ctx, tenantId, conds, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	res := make([]domain.User, 0, len(us))
+	for _, u := range us {
+		res = append(res, r.toDomain(u))
+	}
+	return res, total, nil
+}
+
+func (r *UserRepository) FindByTenantAndID(ctx context.Context, tenantId, id int64) (domain.User, error) {
+	u, err := r.userDAO.FindByTenantAndID(ctx, tenantId, id)
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return domain.User{}, ErrUserNotFound
+		}
+		return domain.User{}, err
+	}
+	return r.toDomain(u), nil
+}
+
+// UpdateProvisioned saves the directory-managed attributes of a tenant user.
+func (r *UserRepository) UpdateProvisioned(ctx context.Context, user domain.User) error {
+	err := r.userDAO.UpdateProvisioned(ctx, r.toModel(user))
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// UpgradeGuest stores the credentials of a guest who signed up. It returns
+// ErrUserNotFound if the user does not exist or is not a guest anymore.
+func (r *UserRepository) UpgradeGuest(ctx context.Context, user domain.User) error {
+	err := r.userDAO.UpgradeGuest(ctx, r.toModel(user))
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// UpgradeGuestWithIdentity upgrades a guest like UpgradeGuest and links the
+// third-party account it signed up with.
+func (r *UserRepository) UpgradeGuestWithIdentity(ctx context.Context, user domain.User,
+	identity domain.ExternalIdentity) error {
+	err := r.userDAO.UpgradeGuestWithIdentity(ctx, r.toModel(user), toIdentityModel(identity))
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *UserRepository) UpdateLastActive(ctx context.Context, id int64, t time.Time) error {
+	return r.userDAO.UpdateLastActive(ctx, id, t.UnixMilli())
+}
+
+func (r *UserRepository) DeleteInactiveGuests(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return r.userDAO.DeleteInactiveGuests(ctx, before.UnixMilli(), limit)
+}
+
+// FindByHandle finds the user currently holding handle, ignoring case.
+func (r *UserRepository) FindByHandle(ctx context.Context, handle string) (domain.User, error) {
+	u, err := r.userDAO.FindByHandle(ctx, strings.ToLower(handle))
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return domain.User{}, ErrUserNotFound
+		}
+		return domain.User{}, err
+	}
+	return r.toDomain(u), nil
+}
+
+// FindPreviousHandleOwner returns the ID of the user who used to hold handle.
+func (r *UserRepository) FindPreviousHandleOwner(ctx context.Context, handle string) (int64, error) {
+	h, err := r.userDAO.FindHandleHistory(ctx, strings.ToLower(handle))
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return 0, ErrUserNotFound
+		}
+		return 0, err
+	}
+	return h.UserId, nil
+}
+
+// ChangeHandle sets the user's handle if it has not changed since
+// lastChangedAt. Handles released by other users after heldSince are still
+// reserved for their redirects.
+func (r *UserRepository) ChangeHandle(ctx context.Context, id int64, handle string,
+	lastChangedAt, heldSince time.Time) error {
+	var last int64
+	if !lastChangedAt.IsZero() {
+		last = lastChangedAt.UnixMilli()
+	}
+	err := r.userDAO.ChangeHandle(ctx, id, handle, strings.ToLower(handle), last, heldSince.UnixMilli())
+	if err != nil {
+		switch {
+		case errors.Is(err, dao.ErrDuplicateHandle):
+			return ErrDuplicateHandle
+		case errors.Is(err, dao.ErrRecordNotFound):
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// UpdatePrivacy replaces the user's privacy settings.
+func (r *UserRepository) UpdatePrivacy(ctx context.Context, id int64, settings domain.PrivacySettings) error {
+	m := r.toModel(domain.User{ID: id, Privacy: settings})
+	err := r.userDAO.UpdateById(ctx, m, []string{"profile_visibility", "hidden_from_search", "message_permission"})
+	if err != nil {
+		if errors.Is(err, dao.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Search finds searchable users by handle or nickname prefix.
+func (r *UserRepository) Search(ctx context.Context, prefix string, limit int) ([]domain.User, error) {
+	users, err := r.userDAO.Search(ctx, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.User, 0, len(users))
+	for _, u := range users {
+		res = append(res, r.toDomain(u))
+	}
+	return res, nil
+}
+
+func (r *UserRepository) toCondition(f domain.UserFilter) (dao.UserCondition, error) {
+	switch f.Field {
+	case domain.UserFieldEmail:
+		return dao.UserCondition{Column: "email", Op: f.Op, Value: f.Value}, nil
+	case domain.UserFieldNickname:
+		return dao.UserCondition{Column: "nickname", Op: f.Op, Value: f.Value}, nil
+	case domain.UserFieldExternalId:
+		return dao.UserCondition{Column: "external_id", Op: f.Op, Value: f.Value}, nil
+	case domain.UserFieldActive:
+		// Activity is stored as a deactivation timestamp, so "active eq true"
+		// becomes "deactivated_at = 0" and the operator flips for false.
+		if f.Op != "eq" && f.Op != "ne" {
+			return dao.UserCondition{}, fmt.Errorf("%w: operator %q for active", ErrUnsupportedFilter, f.Op)
+		}
+		active := f.Value == "true"
+		if f.Op == "ne" {
+			active = !active
+		}
+		if active {
+			return dao.UserCondition{Column: "deactivated_at", Op: "eq", Value: 0}, nil
+		}
+		return dao.UserCondition{Column: "deactivated_at", Op: "ne", Value: 0}, nil
+	}
+	return dao.UserCondition{}, fmt.Errorf("%w: field %q", ErrUnsupportedFilter, f.Field)
+}
+
+func (r *UserRepository) toModel(user domain.User) dao.UserModel {
+	privacy := user.Privacy
+	if privacy == (domain.PrivacySettings{}) {
+		// Users created without explicit settings get the defaults.
+		privacy = domain.DefaultPrivacySettings()
+	}
+	m := dao.UserModel{
+		ID: user.ID,
+		Email: sql.NullString{
+			String: user.Email,
+			Valid:  user.Email != "",
+		},
+		Phone: sql.NullString{
+			String: user.Phone,
+			Valid:  user.Phone != "",
+		},
+		Password:         user.Password,
+		Nickname:         user.Nickname,
+		Intro:            user.Intro,
+		IntroHTML:        markup.Render(user.Intro),
+		IntroHTMLVersion: markup.Version,
+		Birthday:         formatBirthday(user.Birthday),
+		Location:         user.Location,
+		Websites:         user.Websites,
+		Gender:           user.Gender,
+		AvatarURL:        user.AvatarURL,
+		Guest:            user.Guest,
+		TenantId:         user.TenantId,
+		ExternalId:       user.ExternalId,
+		// Defaults are stored as zero values, see dao.UserModel.
+		ProfileVisibility: audienceColumn(privacy.ProfileVisibility),
+		HiddenFromSearch:  !privacy.Searchable,
+		MessagePermission: audienceColumn(privacy.MessagePermission),
+	}
+	if user.Deactivated {
+		m.DeactivatedAt = time.Now().UnixMilli()
+	}
+	return m
+}
+
+func (r *UserRepository) toDomain(u dao.UserModel) domain.User {
+	// Rows are only written through formatBirthday, so a parse error means unset.
+	birthday, _ := time.Parse(time.DateOnly, u.Birthday)
+	var handleChangedAt time.Time
+	if u.HandleChangedAt > 0 {
+		handleChangedAt = time.UnixMilli(u.HandleChangedAt)
+	}
+	introHTML := u.IntroHTML
+	if !markup.Fresh(u.IntroHTMLVersion) {
+		// Rendered by an older pipeline, or before intros were rendered at all.
+		// The cache is rewritten the next time the intro is saved.
+		introHTML = markup.Render(u.Intro)
+	}
 	return domain.User{
-		ID:       u.ID,
-		Email:    u.Email,
-		Password: u.Password,
-		Nickname: u.Nickname,
-		Intro:    u.Intro,
-	}, nil
-}
-
-func (r *UserRepository) Update(ctx context.Context, user domain.User) error {
-	return r.userDAO.UpdateById(ctx, dao.UserModel{
-		ID:       user.ID,
-		Nickname: user.Nickname,
-		Intro:    user.Intro,
-	})
+		ID:              u.ID,
+		Email:           u.Email.String,
+		Phone:           u.Phone.String,
+		Password:        u.Password,
+		Nickname:        u.Nickname,
+		Intro:           u.Intro,
+		IntroHTML:       introHTML,
+		Birthday:        birthday,
+		Location:        u.Location,
+		Websites:        u.Websites,
+		Gender:          u.Gender,
+		AvatarURL:       u.AvatarURL,
+		Handle:          u.Handle.String,
+		HandleChangedAt: handleChangedAt,
+		Privacy: domain.PrivacySettings{
+			ProfileVisibility: audienceFromColumn(u.ProfileVisibility),
+			Searchable:        !u.HiddenFromSearch,
+			MessagePermission: audienceFromColumn(u.MessagePermission),
+		},
+		Guest:       u.Guest,
+		TenantId:    u.TenantId,
+		ExternalId:  u.ExternalId,
+		Deactivated: u.DeactivatedAt > 0,
+		Ctime:       time.UnixMilli(u.CreatedAt),
+		Utime:       time.UnixMilli(u.UpdatedAt),
+	}
+}
+
+func toIdentityModel(identity domain.ExternalIdentity) dao.UserIdentityModel {
+	return dao.UserIdentityModel{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+	}
+}
+
+func formatBirthday(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.DateOnly)
+}
+
+func audienceColumn(a domain.Audience) string {
+	if a == domain.AudienceEveryone {
+		return ""
+	}
+	return string(a)
+}
+
+func audienceFromColumn(s string) domain.Audience {
+	if s == "" {
+		return domain.AudienceEveryone
+	}
+	return domain.Audience(s)
 }
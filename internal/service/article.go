@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/event"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+var (
+	ErrArticleNotFound     = repository.ErrArticleNotFound
+	ErrInvalidArticle      = errors.New("invalid article")
+	ErrArticleNotPublished = errors.New("article is not published")
+)
+
+const (
+	maxTitleLength   = 128
+	maxContentLength = 100_000
+)
+
+// ArticleService manages articles. Authors work on a private working copy;
+// publishing copies it to the published copy that readers see, so later edits
+// stay invisible until the next publish.
+//
+// Every save also records a revision; only the newest maxRevisions are kept
+// per article.
+type ArticleService struct {
+	repo         *repository.ArticleRepository
+	userRepo     *repository.UserRepository
+	maxRevisions int
+	events       event.Publisher
+}
+
+func NewArticleService(repo *repository.ArticleRepository, userRepo *repository.UserRepository,
+	maxRevisions int, events event.Publisher) *ArticleService {
+	return &ArticleService{
+		repo:         repo,
+		userRepo:     userRepo,
+		maxRevisions: max(maxRevisions, 1),
+		events:       events,
+	}
+}
+
+// Save creates or updates the author's working copy without publishing it.
+// Only the author may update an article; for anybody else it does not exist.
+func (s *ArticleService) Save(ctx context.Context, art domain.Article) (int64, error) {
+	if err := validateArticle(art, false); err != nil {
+		return 0, err
+	}
+	id := art.ID
+	var err error
+	if id > 0 {
+		// Keep the status: a published article stays published while edited.
+		art.Status = domain.ArticleStatusUnknown
+		err = s.repo.Update(ctx, art)
+	} else {
+		art.Status = domain.ArticleStatusDraft
+		id, err = s.repo.Create(ctx, art)
+	}
+	if err != nil {
+		return 0, err
+	}
+	s.pruneRevisions(ctx, id)
+	return id, nil
+}
+
+// Publish saves the working copy and publishes it, creating the article if
+// it has no ID yet.
+func (s *ArticleService) Publish(ctx context.Context, art domain.Article) (int64, error) {
+	if err := validateArticle(art, true); err != nil {
+		return 0, err
+	}
+	art.Status = domain.ArticleStatusPublished
+	id, err := s.repo.Sync(ctx, art)
+	if err != nil {
+		return 0, err
+	}
+	s.pruneRevisions(ctx, id)
+	s.events.Publish(ctx, event.ArticlePublished{ArticleID: id, AuthorID: art.Author.ID})
+	return id, nil
+}
+
+// Unpublish takes a published article down. The author keeps the working
+// copy and can publish it again.
+func (s *ArticleService) Unpublish(ctx context.Context, id, authorId int64) error {
+	art, err := s.Draft(ctx, id, authorId)
+	if err != nil {
+		return err
+	}
+	if art.Status != domain.ArticleStatusPublished {
+		return ErrArticleNotPublished
+	}
+	return s.repo.SyncStatus(ctx, id, authorId, domain.ArticleStatusUnpublished)
+}
+
+// Draft returns the author's working copy.
+func (s *ArticleService) Draft(ctx context.Context, id, authorId int64) (domain.Article, error) {
+	art, err := s.repo.FindById(ctx, id)
+	if err != nil {
+		return domain.Article{}, err
+	}
+	if art.Author.ID != authorId {
+		return domain.Article{}, ErrArticleNotFound
+	}
+	return art, nil
+}
+
+// Drafts returns one page of the author's working copies.
+func (s *ArticleService) Drafts(ctx context.Context, authorId int64, offset, limit int) ([]domain.Article, error) {
+	return s.repo.FindByAuthor(ctx, authorId, offset, limit)
+}
+
+// Published returns the published copy of an article for readers.
+func (s *ArticleService) Published(ctx context.Context, id int64) (domain.Article, error) {
+	art, err := s.repo.FindPublishedById(ctx, id)
+	if err != nil {
+		return domain.Article{}, err
+	}
+	if art.Status != domain.ArticleStatusPublished {
+		return domain.Article{}, ErrArticleNotFound
+	}
+	arts, err := s.withAuthors(ctx, []domain.Article{art})
+	if err != nil {
+		return domain.Article{}, err
+	}
+	return arts[0], nil
+}
+
+// ListPublished returns one page of published articles, newest first.
+func (s *ArticleService) ListPublished(ctx context.Context, offset, limit int) ([]domain.Article, error) {
+	arts, err := s.repo.FindPublished(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	return s.withAuthors(ctx, arts)
+}
+
+func (s *ArticleService) withAuthors(ctx context.Context, arts []domain.Article) ([]domain.Article, error) {
+	return withArticleAuthors(ctx, s.userRepo, arts)
+}
+
+// withArticleAuthors fills in the authors' handles and nicknames.
+func withArticleAuthors(ctx context.Context, userRepo UserFinder, arts []domain.Article) ([]domain.Article, error) {
+	ids := make([]int64, 0, len(arts))
+	for _, art := range arts {
+		ids = append(ids, art.Author.ID)
+	}
+	users, err := userRepo.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range arts {
+		u := users[arts[i].Author.ID]
+		arts[i].Author.Handle = u.Handle
+		arts[i].Author.Nickname = u.Nickname
+	}
+	return arts, nil
+}
+
+func validateArticle(art domain.Article, publishing bool) error {
+	if publishing && strings.TrimSpace(art.Title) == "" {
+		return fmt.Errorf("%w: a title is required to publish", ErrInvalidArticle)
+	}
+	if utf8.RuneCountInString(art.Title) > maxTitleLength {
+		return fmt.Errorf("%w: title must be at most %d characters", ErrInvalidArticle, maxTitleLength)
+	}
+	if utf8.RuneCountInString(art.Content) > maxContentLength {
+		return fmt.Errorf("%w: content must be at most %d characters", ErrInvalidArticle, maxContentLength)
+	}
+	return nil
+}
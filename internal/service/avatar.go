@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/storage"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrAvatarTooLarge   = errors.New("avatar file is too large")
+	ErrAvatarDimensions = errors.New("avatar dimensions are too large")
+	ErrUnsupportedImage = errors.New("unsupported image format")
+)
+
+// AvatarConfig limits uploads and lists the thumbnail sizes to produce.
+type AvatarConfig struct {
+	MaxBytes int64
+	// MaxPixels bounds width*height, so a small file that decodes into a huge
+	// image cannot exhaust memory.
+	MaxPixels int
+	// Sizes are the edge lengths of the square thumbnails, largest first. The
+	// largest one becomes the user's avatar URL.
+	Sizes []int
+}
+
+// AvatarService turns uploaded images into square avatar thumbnails and
+// stores them.
+type AvatarService struct {
+	userSvc *UserService
+	storage storage.ObjectStorage
+	cfg     AvatarConfig
+}
+
+func NewAvatarService(userSvc *UserService, storage storage.ObjectStorage, cfg AvatarConfig) *AvatarService {
+	return &AvatarService{
+		userSvc: userSvc,
+		storage: storage,
+		cfg:     cfg,
+	}
+}
+
+// Upload processes an image and sets it as the user's avatar. It returns the
+// thumbnail URLs by size. Re-encoding the pixels drops EXIF and any other
+// metadata, after the EXIF orientation has been applied.
+func (s *AvatarService) Upload(ctx context.Context, uid int64, r io.Reader) (map[int]string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, s.cfg.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.cfg.MaxBytes {
+		return nil, ErrAvatarTooLarge
+	}
+
+	contentType, ok := sniffImageType(data)
+	if !ok {
+		return nil, ErrUnsupportedImage
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, ErrUnsupportedImage
+	}
+	if cfg.Width*cfg.Height > s.cfg.MaxPixels {
+		return nil, ErrAvatarDimensions
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if contentType == imageJPEG {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	// Photos stay JPEG; everything else may be transparent and becomes PNG.
+	ext, outType := ".png", imagePNG
+	if contentType == imageJPEG {
+		ext, outType = ".jpg", imageJPEG
+	}
+
+	// A fresh version in every key lets caches keep objects forever.
+	version, err := randomToken(8)
+	if err != nil {
+		return nil, err
+	}
+	urls := make(map[int]string, len(s.cfg.Sizes))
+	for _, size := range s.cfg.Sizes {
+		var buf bytes.Buffer
+		thumb := squareThumbnail(img, size)
+		if outType == imageJPEG {
+			err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, thumb)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		key := fmt.Sprintf("avatars/%d/%s_%d%s", uid, version, size, ext)
+		if err = s.storage.Put(ctx, key, &buf, int64(buf.Len()), outType); err != nil {
+			return nil, err
+		}
+		urls[size] = s.storage.URL(key)
+	}
+
+	avatarURL := urls[s.cfg.Sizes[0]]
+	err = s.userSvc.Update(ctx, uid, domain.UserProfilePatch{AvatarURL: &avatarURL})
+	if err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
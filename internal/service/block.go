@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/event"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+var (
+	// ErrBlocked means one of two users blocked the other, so they may not
+	// interact.
+	ErrBlocked         = errors.New("user is blocked")
+	ErrCannotBlockSelf = errors.New("cannot block or mute yourself")
+)
+
+// BlockService manages blocks and mutes.
+//
+// A block works both ways: the two users can no longer follow, befriend,
+// message or comment on each other, and are hidden from each other's search
+// results, feeds and comment threads. Blocking also undoes the follows and
+// friendship between them. Every such path asks Check, so that there is one
+// place deciding whether two users may interact.
+//
+// A mute only hides the muted user's articles and comments from the user
+// who muted them.
+type BlockService struct {
+	repo     *repository.BlockRepository
+	userRepo *repository.UserRepository
+	events   event.Publisher
+}
+
+func NewBlockService(repo *repository.BlockRepository, userRepo *repository.UserRepository,
+	events event.Publisher) *BlockService {
+	return &BlockService{
+		repo:     repo,
+		userRepo: userRepo,
+		events:   events,
+	}
+}
+
+// Block makes userId and targetId invisible to each other. Blocking someone
+// again is not an error.
+func (s *BlockService) Block(ctx context.Context, userId, targetId int64) error {
+	created, err := s.add(ctx, userId, targetId, domain.BlockKindBlock)
+	if err != nil {
+		return err
+	}
+	if created {
+		s.events.Publish(ctx, event.UserBlocked{BlockerID: userId, BlockedID: targetId})
+	}
+	return nil
+}
+
+// Unblock undoes Block. Follows and friendships it removed stay removed.
+func (s *BlockService) Unblock(ctx context.Context, userId, targetId int64) error {
+	_, err := s.repo.Remove(ctx, userId, targetId, domain.BlockKindBlock)
+	return err
+}
+
+// Mute hides the content of targetId from userId. Muting someone again is
+// not an error.
+func (s *BlockService) Mute(ctx context.Context, userId, targetId int64) error {
+	_, err := s.add(ctx, userId, targetId, domain.BlockKindMute)
+	return err
+}
+
+// Unmute undoes Mute.
+func (s *BlockService) Unmute(ctx context.Context, userId, targetId int64) error {
+	_, err := s.repo.Remove(ctx, userId, targetId, domain.BlockKindMute)
+	return err
+}
+
+func (s *BlockService) add(ctx context.Context, userId, targetId int64, kind domain.BlockKind) (bool, error) {
+	if userId == targetId {
+		return false, ErrCannotBlockSelf
+	}
+	if _, err := s.userRepo.FindByID(ctx, targetId); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return false, ErrUserNotFound
+		}
+		return false, err
+	}
+	return s.repo.Add(ctx, userId, targetId, kind)
+}
+
+// Blocked returns up to limit users blocked by userId, most recent first,
+// and the cursor of the next page, which is 0 on the last page.
+func (s *BlockService) Blocked(ctx context.Context, userId, cursor int64, limit int) ([]domain.Block, int64, error) {
+	return s.list(ctx, userId, domain.BlockKindBlock, cursor, limit)
+}
+
+// Muted returns up to limit users muted by userId, most recent first, and
+// the cursor of the next page.
+func (s *BlockService) Muted(ctx context.Context, userId, cursor int64, limit int) ([]domain.Block, int64, error) {
+	return s.list(ctx, userId, domain.BlockKindMute, cursor, limit)
+}
+
+func (s *BlockService) list(ctx context.Context, userId int64, kind domain.BlockKind,
+	cursor int64, limit int) ([]domain.Block, int64, error) {
+	bs, err := s.repo.FindByUser(ctx, userId, kind, cursor, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]int64, 0, len(bs))
+	for _, b := range bs {
+		ids = append(ids, b.Target.ID)
+	}
+	users, err := s.userRepo.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range bs {
+		if u, ok := users[bs[i].Target.ID]; ok {
+			bs[i].Target = u
+		}
+	}
+	var next int64
+	if len(bs) == limit {
+		next = bs[len(bs)-1].ID
+	}
+	return bs, next, nil
+}
+
+// Check returns ErrBlocked if either user blocked the other. Anonymous
+// visitors, whose ID is 0, are never blocked.
+func (s *BlockService) Check(ctx context.Context, a, b int64) error {
+	if a == 0 || b == 0 || a == b {
+		return nil
+	}
+	blocked, err := s.repo.IsBlocked(ctx, a, b)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrBlocked
+	}
+	return nil
+}
+
+// Invisible returns the users viewerId blocked or was blocked by, who must
+// not show up for them at all.
+func (s *BlockService) Invisible(ctx context.Context, viewerId int64) (map[int64]bool, error) {
+	if viewerId == 0 {
+		return nil, nil
+	}
+	return s.repo.FindHidden(ctx, viewerId, false)
+}
+
+// Hidden returns the users whose content viewerId must not see: the
+// invisible ones and those viewerId muted.
+func (s *BlockService) Hidden(ctx context.Context, viewerId int64) (map[int64]bool, error) {
+	if viewerId == 0 {
+		return nil, nil
+	}
+	return s.repo.FindHidden(ctx, viewerId, true)
+}
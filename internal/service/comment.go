@@ -0,0 +1,436 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/event"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+var (
+	ErrCommentNotFound    = repository.ErrCommentNotFound
+	ErrInvalidComment     = errors.New("invalid comment")
+	ErrCommentEditExpired = errors.New("comment can no longer be edited")
+)
+
+const (
+	maxCommentLength = 2000
+	// maxCommentDepth is the deepest reply level. Deeper replies still point
+	// at the comment they answer but are shown at this level.
+	maxCommentDepth = 3
+	// maxMentions bounds how many users one comment can notify.
+	maxMentions = 10
+)
+
+// mentionPattern matches "@handle" unless it is part of a word, e.g. an
+// email address.
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_@])@([A-Za-z0-9_]{3,20})\b`)
+
+type ModerationDecision uint8
+
+const (
+	ModerationAllow ModerationDecision = iota
+	// ModerationHold keeps the comment from other readers until the author of
+	// the article approves it.
+	ModerationHold
+)
+
+// CommentModerator inspects new and edited comments before they are shown.
+type CommentModerator interface {
+	Moderate(ctx context.Context, c domain.Comment) (ModerationDecision, error)
+}
+
+// KeywordModerator holds comments that contain a blocked word or too many
+// links, the usual signs of spam.
+type KeywordModerator struct {
+	words    []string
+	maxLinks int
+}
+
+func NewKeywordModerator(words []string, maxLinks int) *KeywordModerator {
+	lower := make([]string, 0, len(words))
+	for _, w := range words {
+		lower = append(lower, strings.ToLower(w))
+	}
+	return &KeywordModerator{
+		words:    lower,
+		maxLinks: maxLinks,
+	}
+}
+
+func (m *KeywordModerator) Moderate(_ context.Context, c domain.Comment) (ModerationDecision, error) {
+	content := strings.ToLower(c.Content)
+	for _, w := range m.words {
+		if strings.Contains(content, w) {
+			return ModerationHold, nil
+		}
+	}
+	if strings.Count(content, "http://")+strings.Count(content, "https://") > m.maxLinks {
+		return ModerationHold, nil
+	}
+	return ModerationAllow, nil
+}
+
+// CommentService manages threaded comments on published articles.
+type CommentService struct {
+	repo        *repository.CommentRepository
+	articleRepo *repository.ArticleRepository
+	userRepo    *repository.UserRepository
+	blocks      *BlockService
+	moderator   CommentModerator
+	// editWindow is how long after posting a comment can be edited.
+	editWindow time.Duration
+	events     event.Publisher
+}
+
+func NewCommentService(repo *repository.CommentRepository, articleRepo *repository.ArticleRepository,
+	userRepo *repository.UserRepository, blocks *BlockService, moderator CommentModerator,
+	editWindow time.Duration, events event.Publisher) *CommentService {
+	return &CommentService{
+		repo:        repo,
+		articleRepo: articleRepo,
+		userRepo:    userRepo,
+		blocks:      blocks,
+		moderator:   moderator,
+		editWindow:  editWindow,
+		events:      events,
+	}
+}
+
+// Post adds a root comment, or a reply when c.ParentID is set. The comment
+// may be held for review, see CommentModerator. Users may not comment on the
+// articles or reply to the comments of users they blocked or were blocked
+// by.
+func (s *CommentService) Post(ctx context.Context, c domain.Comment) (domain.Comment, error) {
+	if err := validateComment(c.Content); err != nil {
+		return domain.Comment{}, err
+	}
+	art, err := s.published(ctx, c.ArticleID)
+	if err != nil {
+		return domain.Comment{}, err
+	}
+	if err = s.blocks.Check(ctx, c.Author.ID, art.Author.ID); err != nil {
+		return domain.Comment{}, err
+	}
+
+	c.RootID, c.Depth = 0, 0
+	if c.ParentID > 0 {
+		parent, err := s.repo.FindById(ctx, c.ParentID)
+		if err != nil {
+			return domain.Comment{}, err
+		}
+		if parent.ArticleID != c.ArticleID || parent.Status != domain.CommentStatusVisible {
+			return domain.Comment{}, ErrCommentNotFound
+		}
+		if err = s.blocks.Check(ctx, c.Author.ID, parent.Author.ID); err != nil {
+			return domain.Comment{}, err
+		}
+		c.RootID = parent.RootID
+		if c.RootID == 0 {
+			c.RootID = parent.ID
+		}
+		c.Depth = min(parent.Depth+1, maxCommentDepth)
+	}
+	c.Status = s.moderate(ctx, c)
+
+	id, err := s.repo.Create(ctx, c)
+	if err != nil {
+		return domain.Comment{}, err
+	}
+	c, err = s.repo.FindById(ctx, id)
+	if err != nil {
+		return domain.Comment{}, err
+	}
+	if c.Status == domain.CommentStatusVisible {
+		s.announce(ctx, c, art.Author.ID)
+	}
+	return c, nil
+}
+
+// Edit changes the content of the author's comment within the edit window.
+// The new content is moderated again.
+func (s *CommentService) Edit(ctx context.Context, id, authorId int64, content string) (domain.Comment, error) {
+	if err := validateComment(content); err != nil {
+		return domain.Comment{}, err
+	}
+	c, err := s.ownComment(ctx, id, authorId)
+	if err != nil {
+		return domain.Comment{}, err
+	}
+	if time.Since(c.Ctime) > s.editWindow {
+		return domain.Comment{}, ErrCommentEditExpired
+	}
+
+	old := c.Status
+	c.Content = content
+	c.Status = s.moderate(ctx, c)
+	if err = s.repo.UpdateContent(ctx, c, old); err != nil {
+		return domain.Comment{}, err
+	}
+	return s.repo.FindById(ctx, id)
+}
+
+// Delete soft deletes the author's comment. Its replies stay in place.
+func (s *CommentService) Delete(ctx context.Context, id, authorId int64) error {
+	c, err := s.ownComment(ctx, id, authorId)
+	if err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, c)
+}
+
+// Threads returns up to limit threads of an article older than cursor,
+// newest first, each with its first replies replies. viewerId is 0 for
+// anonymous readers. Comments of users hidden from the viewer are left out.
+func (s *CommentService) Threads(ctx context.Context, articleId, viewerId, cursor int64, limit, replies int) ([]domain.CommentThread, error) {
+	if _, err := s.published(ctx, articleId); err != nil {
+		return nil, err
+	}
+	hidden, err := s.hidden(ctx, viewerId)
+	if err != nil {
+		return nil, err
+	}
+	threads, err := s.repo.FindThreads(ctx, articleId, viewerId, cursor, limit, replies, hidden)
+	if err != nil {
+		return nil, err
+	}
+
+	var all []*domain.Comment
+	for i := range threads {
+		all = append(all, &threads[i].Root)
+		for j := range threads[i].Replies {
+			all = append(all, &threads[i].Replies[j])
+		}
+	}
+	return threads, s.withAuthors(ctx, all)
+}
+
+// Replies returns up to limit further replies of a thread after cursor,
+// oldest first.
+func (s *CommentService) Replies(ctx context.Context, rootId, viewerId, cursor int64, limit int) ([]domain.Comment, error) {
+	root, err := s.repo.FindById(ctx, rootId)
+	if err != nil {
+		return nil, err
+	}
+	if root.RootID != 0 {
+		return nil, ErrCommentNotFound
+	}
+	if _, err = s.published(ctx, root.ArticleID); err != nil {
+		return nil, err
+	}
+
+	hidden, err := s.hidden(ctx, viewerId)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := s.repo.FindReplies(ctx, rootId, viewerId, cursor, limit, hidden)
+	if err != nil {
+		return nil, err
+	}
+	all := make([]*domain.Comment, 0, len(cs))
+	for i := range cs {
+		all = append(all, &cs[i])
+	}
+	return cs, s.withAuthors(ctx, all)
+}
+
+// Pending returns the comments held for review on the author's articles,
+// oldest first.
+func (s *CommentService) Pending(ctx context.Context, authorId, cursor int64, limit int) ([]domain.Comment, error) {
+	cs, err := s.repo.FindPendingForAuthor(ctx, authorId, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	all := make([]*domain.Comment, 0, len(cs))
+	for i := range cs {
+		all = append(all, &cs[i])
+	}
+	return cs, s.withAuthors(ctx, all)
+}
+
+// Approve shows a held comment. Only the author of the article may review it.
+func (s *CommentService) Approve(ctx context.Context, id, articleAuthorId int64) error {
+	return s.review(ctx, id, articleAuthorId, domain.CommentStatusVisible)
+}
+
+// Reject hides a held comment for good.
+func (s *CommentService) Reject(ctx context.Context, id, articleAuthorId int64) error {
+	return s.review(ctx, id, articleAuthorId, domain.CommentStatusRejected)
+}
+
+func (s *CommentService) review(ctx context.Context, id, articleAuthorId int64, status domain.CommentStatus) error {
+	c, err := s.repo.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	art, err := s.articleRepo.FindById(ctx, c.ArticleID)
+	if err != nil {
+		if errors.Is(err, repository.ErrArticleNotFound) {
+			return ErrCommentNotFound
+		}
+		return err
+	}
+	if art.Author.ID != articleAuthorId {
+		return ErrCommentNotFound
+	}
+	err = s.repo.UpdateStatus(ctx, id, []domain.CommentStatus{domain.CommentStatusPending}, status)
+	if err != nil {
+		return err
+	}
+	if status == domain.CommentStatusVisible {
+		s.announce(ctx, c, art.Author.ID)
+	}
+	return nil
+}
+
+// announce tells the article author, the author of the parent comment and
+// the mentioned users about a comment that just became visible. Failing to
+// do so does not fail the comment.
+func (s *CommentService) announce(ctx context.Context, c domain.Comment, articleAuthorId int64) {
+	posted := event.CommentPosted{
+		CommentID:       c.ID,
+		ArticleID:       c.ArticleID,
+		ArticleAuthorID: articleAuthorId,
+		ParentID:        c.ParentID,
+		AuthorID:        c.Author.ID,
+	}
+	if c.ParentID > 0 {
+		parent, err := s.repo.FindById(ctx, c.ParentID)
+		if err != nil {
+			log.Printf("find parent of comment %d: %v", c.ID, err)
+		}
+		posted.ParentAuthorID = parent.Author.ID
+	}
+	s.events.Publish(ctx, posted)
+
+	for _, handle := range mentions(c.Content) {
+		u, err := s.userRepo.FindByHandle(ctx, handle)
+		if err != nil {
+			if !errors.Is(err, repository.ErrUserNotFound) {
+				log.Printf("find user mentioned in comment %d: %v", c.ID, err)
+			}
+			continue
+		}
+		if u.Deactivated || u.ID == c.Author.ID {
+			continue
+		}
+		if err = s.blocks.Check(ctx, c.Author.ID, u.ID); err != nil {
+			if !errors.Is(err, ErrBlocked) {
+				log.Printf("check block of user mentioned in comment %d: %v", c.ID, err)
+			}
+			continue
+		}
+		s.events.Publish(ctx, event.UserMentioned{
+			CommentID:   c.ID,
+			ArticleID:   c.ArticleID,
+			AuthorID:    c.Author.ID,
+			MentionedID: u.ID,
+		})
+	}
+}
+
+// mentions returns the distinct handles mentioned in content, at most
+// maxMentions of them.
+func mentions(content string) []string {
+	var res []string
+	seen := make(map[string]bool)
+	for _, m := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		handle := strings.ToLower(m[1])
+		if seen[handle] {
+			continue
+		}
+		seen[handle] = true
+		res = append(res, m[1])
+		if len(res) == maxMentions {
+			break
+		}
+	}
+	return res
+}
+
+// ownComment returns a comment of authorId that can still be changed.
+func (s *CommentService) ownComment(ctx context.Context, id, authorId int64) (domain.Comment, error) {
+	c, err := s.repo.FindById(ctx, id)
+	if err != nil {
+		return domain.Comment{}, err
+	}
+	if c.Author.ID != authorId {
+		return domain.Comment{}, ErrCommentNotFound
+	}
+	if c.Status != domain.CommentStatusVisible && c.Status != domain.CommentStatusPending {
+		return domain.Comment{}, ErrCommentNotFound
+	}
+	return c, nil
+}
+
+// moderate returns the status a new or edited comment gets. When the
+// moderator fails the comment is held rather than shown unchecked.
+func (s *CommentService) moderate(ctx context.Context, c domain.Comment) domain.CommentStatus {
+	decision, err := s.moderator.Moderate(ctx, c)
+	if err != nil {
+		log.Printf("moderate comment on article %d: %v", c.ArticleID, err)
+		return domain.CommentStatusPending
+	}
+	if decision == ModerationHold {
+		return domain.CommentStatusPending
+	}
+	return domain.CommentStatusVisible
+}
+
+// hidden returns the users whose comments viewerId must not see.
+func (s *CommentService) hidden(ctx context.Context, viewerId int64) ([]int64, error) {
+	hidden, err := s.blocks.Hidden(ctx, viewerId)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Collect(maps.Keys(hidden)), nil
+}
+
+func (s *CommentService) published(ctx context.Context, articleId int64) (domain.Article, error) {
+	art, err := s.articleRepo.FindPublishedById(ctx, articleId)
+	if err != nil {
+		return domain.Article{}, err
+	}
+	if art.Status != domain.ArticleStatusPublished {
+		return domain.Article{}, ErrArticleNotFound
+	}
+	return art, nil
+}
+
+// withAuthors fills in the handles and nicknames of the comment authors.
+func (s *CommentService) withAuthors(ctx context.Context, cs []*domain.Comment) error {
+	ids := make([]int64, 0, len(cs))
+	for _, c := range cs {
+		ids = append(ids, c.Author.ID)
+	}
+	users, err := s.userRepo.FindByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, c := range cs {
+		u := users[c.Author.ID]
+		c.Author.Handle = u.Handle
+		c.Author.Nickname = u.Nickname
+	}
+	return nil
+}
+
+func validateComment(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return fmt.Errorf("%w: content is required", ErrInvalidComment)
+	}
+	if utf8.RuneCountInString(content) > maxCommentLength {
+		return fmt.Errorf("%w: content must be at most %d characters", ErrInvalidComment, maxCommentLength)
+	}
+	return nil
+}
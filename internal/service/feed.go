@@ -0,0 +1,405 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/event"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+type FeedConfig struct {
+	// FanoutThreshold is the most followers an author may have for new
+	// articles to be pushed into their followers' inboxes. Articles of more
+	// followed authors are pulled when a feed is read instead.
+	FanoutThreshold int64
+	// FanoutBatch is how many inbox items are written at once.
+	FanoutBatch int
+	// Backfill is how many recent articles of a pushed author are added to
+	// the inbox of a new follower.
+	Backfill int
+	// TaskLease is how long other instances leave a running fan-out or
+	// backfill alone. It is extended after every batch, so it only has to
+	// cover one batch; a task whose instance died runs again after it.
+	TaskLease time.Duration
+	// RetryDelay is how long a failed task waits before its first retry.
+	// The wait grows by RetryDelay with every attempt.
+	RetryDelay time.Duration
+	// MaxAttempts is how often a task is tried before it is dropped.
+	MaxAttempts int
+}
+
+// FeedService builds home timelines: the articles of the users someone
+// follows, and their own, newest first.
+//
+// Articles of authors with few followers are pushed into an inbox per
+// follower when published, so reading a feed is one indexed query. Pushing
+// the articles of popular authors would write millions of rows per article,
+// so those are pulled from the articles table at read time and merged in.
+//
+// An author whose follower count drops to the threshold switches to push
+// mode; their articles published before then only show up for followers who
+// still have them in their inbox.
+//
+// Pushing happens in the background: events only queue a task, which
+// RunTasks works off later. A fan-out records the last follower it reached
+// after every batch, so a failed one resumes where it stopped.
+type FeedService struct {
+	repo        FeedStore
+	followRepo  FollowerFinder
+	articleRepo PublishedArticleFinder
+	userRepo    UserFinder
+	blocks      HiddenUserFinder
+	cfg         FeedConfig
+}
+
+// FeedStore keeps the feed inboxes. *repository.FeedRepository implements
+// it.
+type FeedStore interface {
+	// AddItems keeps items that are already in an inbox.
+	AddItems(ctx context.Context, items []domain.FeedItem) error
+	RemoveAuthor(ctx context.Context, userId, authorId int64) error
+	FindItems(ctx context.Context, userId int64, cursor domain.FeedCursor, limit int) ([]domain.FeedItem, error)
+
+	AddTask(ctx context.Context, task domain.FeedTask) error
+	FindDueTasks(ctx context.Context, now time.Time, limit int) ([]domain.FeedTask, error)
+	// ClaimTask returns repository.ErrFeedTaskClaimed if another instance
+	// claimed the task first.
+	ClaimTask(ctx context.Context, task domain.FeedTask, until time.Time) error
+	SaveTaskCursor(ctx context.Context, id, cursor int64, until time.Time) error
+	RetryTask(ctx context.Context, id int64, attempts int, runAt time.Time) error
+	DeleteTask(ctx context.Context, id int64) error
+}
+
+// FollowerFinder is the part of the follow graph feeds need.
+// *repository.FollowRepository implements it.
+type FollowerFinder interface {
+	FindFollowers(ctx context.Context, userId, cursor int64, limit int) ([]domain.Follow, error)
+	FindFollowees(ctx context.Context, followerId int64, userIds []int64) (map[int64]bool, error)
+	FindFolloweesWithFollowers(ctx context.Context, followerId, minFollowers int64) ([]int64, error)
+	FindStats(ctx context.Context, userIds []int64) (map[int64]domain.FollowStats, error)
+}
+
+// PublishedArticleFinder looks up the articles readers can see.
+// *repository.ArticleRepository implements it.
+type PublishedArticleFinder interface {
+	FindPublishedById(ctx context.Context, id int64) (domain.Article, error)
+	FindPublishedByIds(ctx context.Context, ids []int64) (map[int64]domain.Article, error)
+	FindPublishedByAuthors(ctx context.Context, authorIds []int64,
+		cursor domain.FeedCursor, limit int) ([]domain.Article, error)
+}
+
+// HiddenUserFinder returns the users whose content a viewer must not see.
+// *BlockService implements it.
+type HiddenUserFinder interface {
+	Hidden(ctx context.Context, viewerId int64) (map[int64]bool, error)
+}
+
+func NewFeedService(repo FeedStore, followRepo FollowerFinder,
+	articleRepo PublishedArticleFinder, userRepo UserFinder, blocks HiddenUserFinder,
+	cfg FeedConfig) *FeedService {
+	cfg.FanoutBatch = max(cfg.FanoutBatch, 1)
+	cfg.MaxAttempts = max(cfg.MaxAttempts, 1)
+	return &FeedService{
+		repo:        repo,
+		followRepo:  followRepo,
+		articleRepo: articleRepo,
+		userRepo:    userRepo,
+		blocks:      blocks,
+		cfg:         cfg,
+	}
+}
+
+// Subscribe keeps the inboxes up to date as articles are published and users
+// follow or unfollow each other.
+func (s *FeedService) Subscribe(bus *event.Bus) {
+	bus.Subscribe(event.TopicArticlePublished, func(ctx context.Context, e event.Event) error {
+		ev := e.(event.ArticlePublished)
+		return s.enqueue(ctx, domain.FeedTask{
+			Kind:      domain.FeedTaskFanout,
+			ArticleID: ev.ArticleID,
+			AuthorID:  ev.AuthorID,
+		})
+	})
+	bus.Subscribe(event.TopicUserFollowed, func(ctx context.Context, e event.Event) error {
+		ev := e.(event.UserFollowed)
+		if s.cfg.Backfill <= 0 {
+			return nil
+		}
+		return s.enqueue(ctx, domain.FeedTask{
+			Kind:       domain.FeedTaskBackfill,
+			AuthorID:   ev.FolloweeID,
+			FollowerID: ev.FollowerID,
+		})
+	})
+	bus.Subscribe(event.TopicUserUnfollowed, func(ctx context.Context, e event.Event) error {
+		ev := e.(event.UserUnfollowed)
+		return s.repo.RemoveAuthor(ctx, ev.FollowerID, ev.FolloweeID)
+	})
+}
+
+// maxTimelineRounds bounds how many pages Timeline reads to fill one page
+// when most entries are skipped.
+const maxTimelineRounds = 5
+
+// Timeline returns up to limit articles of a user's feed after cursor, and
+// the cursor of the next page, which is zero on the last page.
+//
+// Entries of hidden authors and of articles taken down are skipped, so more
+// entries are read until the page is full. After maxTimelineRounds reads the
+// page is returned short; the cursor still points past everything read.
+func (s *FeedService) Timeline(ctx context.Context, userId int64, cursor domain.FeedCursor,
+	limit int) ([]domain.Article, domain.FeedCursor, error) {
+	authors, err := s.followRepo.FindFolloweesWithFollowers(ctx, userId, s.cfg.FanoutThreshold)
+	if err != nil {
+		return nil, domain.FeedCursor{}, err
+	}
+	// Users see their own articles without pushing to themselves.
+	authors = append(authors, userId)
+	// Muted authors stay followed, so their articles are filtered here.
+	hidden, err := s.blocks.Hidden(ctx, userId)
+	if err != nil {
+		return nil, domain.FeedCursor{}, err
+	}
+	authors = slices.DeleteFunc(authors, func(id int64) bool { return hidden[id] })
+
+	res := make([]domain.Article, 0, limit)
+	for round := 1; ; round++ {
+		keys, arts, err := s.timelinePage(ctx, userId, authors, cursor, limit)
+		if err != nil {
+			return nil, domain.FeedCursor{}, err
+		}
+		scanned := 0
+		for _, k := range keys {
+			scanned++
+			cursor = k
+			if art, ok := arts[k.ArticleID]; ok && !hidden[art.Author.ID] {
+				res = append(res, art)
+				if len(res) == limit {
+					break
+				}
+			}
+		}
+		if len(keys) < limit && scanned == len(keys) {
+			// Both sources ran out.
+			cursor = domain.FeedCursor{}
+			break
+		}
+		if len(res) == limit || round == maxTimelineRounds {
+			break
+		}
+	}
+	res, err = withArticleAuthors(ctx, s.userRepo, res)
+	if err != nil {
+		return nil, domain.FeedCursor{}, err
+	}
+	return res, cursor, nil
+}
+
+// timelinePage returns the keys of the first limit feed entries after cursor
+// and the published articles among them. Entries whose article is missing
+// were taken down since they were pushed.
+func (s *FeedService) timelinePage(ctx context.Context, userId int64, authors []int64,
+	cursor domain.FeedCursor, limit int) ([]domain.FeedCursor, map[int64]domain.Article, error) {
+	items, err := s.repo.FindItems(ctx, userId, cursor, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	pulled, err := s.articleRepo.FindPublishedByAuthors(ctx, authors, cursor, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Each source returned its first limit entries after cursor, so the first
+	// limit entries of both together are exactly the page.
+	keys := make([]domain.FeedCursor, 0, len(items)+len(pulled))
+	ids := make([]int64, 0, len(items))
+	for _, it := range items {
+		keys = append(keys, domain.FeedCursor{PublishedAt: it.PublishedAt, ArticleID: it.ArticleID})
+		ids = append(ids, it.ArticleID)
+	}
+	for _, art := range pulled {
+		keys = append(keys, domain.FeedCursor{PublishedAt: art.Ctime, ArticleID: art.ID})
+	}
+	slices.SortFunc(keys, func(a, b domain.FeedCursor) int {
+		switch {
+		case a.Before(b):
+			return -1
+		case b.Before(a):
+			return 1
+		}
+		return 0
+	})
+	// An article pulled and still in the inbox, e.g. because its author
+	// crossed the threshold, has the same key twice.
+	keys = slices.CompactFunc(keys, func(a, b domain.FeedCursor) bool {
+		return !a.Before(b) && !b.Before(a)
+	})
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	arts, err := s.articleRepo.FindPublishedByIds(ctx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, art := range pulled {
+		arts[art.ID] = art
+	}
+	return keys, arts, nil
+}
+
+// enqueue queues a task to run right away. Events are published from
+// request handlers, and a client hanging up must not lose the task.
+func (s *FeedService) enqueue(ctx context.Context, task domain.FeedTask) error {
+	task.RunAt = time.Now()
+	return s.repo.AddTask(context.WithoutCancel(ctx), task)
+}
+
+// RunTasks works off up to batch due fan-outs and backfills and returns how
+// many it finished. It is safe to run on several instances at once: each
+// task is claimed by one of them. A failed task is retried later, up to
+// MaxAttempts times; the failures are returned together once the batch is
+// done.
+func (s *FeedService) RunTasks(ctx context.Context, now time.Time, batch int) (int, error) {
+	tasks, err := s.repo.FindDueTasks(ctx, now, batch)
+	if err != nil {
+		return 0, err
+	}
+
+	done := 0
+	var errs []error
+	for _, task := range tasks {
+		err = s.repo.ClaimTask(ctx, task, time.Now().Add(s.cfg.TaskLease))
+		if errors.Is(err, repository.ErrFeedTaskClaimed) {
+			continue
+		}
+		if err == nil {
+			err = s.runTask(ctx, task)
+		}
+		if err == nil {
+			err = s.repo.DeleteTask(ctx, task.ID)
+		}
+		if err == nil {
+			done++
+			continue
+		}
+		errs = append(errs, fmt.Errorf("feed task %d: %w", task.ID, err))
+		if err = s.retry(ctx, task); err != nil {
+			errs = append(errs, fmt.Errorf("feed task %d: %w", task.ID, err))
+		}
+	}
+	return done, errors.Join(errs...)
+}
+
+// retry makes a failed task due again, or drops it once it used up its
+// attempts. A task that could not even be rescheduled runs again once its
+// claim expires.
+func (s *FeedService) retry(ctx context.Context, task domain.FeedTask) error {
+	attempts := task.Attempts + 1
+	if attempts >= s.cfg.MaxAttempts {
+		log.Printf("drop feed task %d of kind %d after %d attempts", task.ID, task.Kind, attempts)
+		return s.repo.DeleteTask(ctx, task.ID)
+	}
+	return s.repo.RetryTask(ctx, task.ID, attempts, time.Now().Add(time.Duration(attempts)*s.cfg.RetryDelay))
+}
+
+func (s *FeedService) runTask(ctx context.Context, task domain.FeedTask) error {
+	switch task.Kind {
+	case domain.FeedTaskFanout:
+		return s.fanout(ctx, task)
+	case domain.FeedTaskBackfill:
+		return s.backfill(ctx, task.FollowerID, task.AuthorID)
+	}
+	log.Printf("drop feed task %d of unknown kind %d", task.ID, task.Kind)
+	return nil
+}
+
+// fanout pushes a newly published article into the inboxes of the author's
+// followers, unless the author has too many of them. It starts after the
+// follower the task reached last time.
+func (s *FeedService) fanout(ctx context.Context, task domain.FeedTask) error {
+	push, err := s.pushes(ctx, task.AuthorID)
+	if err != nil || !push {
+		return err
+	}
+	art, err := s.articleRepo.FindPublishedById(ctx, task.ArticleID)
+	if err != nil {
+		if errors.Is(err, repository.ErrArticleNotFound) {
+			return nil
+		}
+		return err
+	}
+	if art.Status != domain.ArticleStatusPublished {
+		return nil
+	}
+
+	cursor := task.Cursor
+	for {
+		fs, err := s.followRepo.FindFollowers(ctx, task.AuthorID, cursor, s.cfg.FanoutBatch)
+		if err != nil {
+			return err
+		}
+		items := make([]domain.FeedItem, 0, len(fs))
+		for _, f := range fs {
+			items = append(items, domain.FeedItem{
+				UserID:      f.FollowerID,
+				ArticleID:   art.ID,
+				AuthorID:    task.AuthorID,
+				PublishedAt: art.Ctime,
+			})
+		}
+		if err = s.repo.AddItems(ctx, items); err != nil {
+			return err
+		}
+		if len(fs) < s.cfg.FanoutBatch {
+			return nil
+		}
+		cursor = fs[len(fs)-1].ID
+		if err = s.repo.SaveTaskCursor(ctx, task.ID, cursor, time.Now().Add(s.cfg.TaskLease)); err != nil {
+			return err
+		}
+	}
+}
+
+// backfill gives a new follower the recent articles of an author in push
+// mode, so that following someone does not start with an empty feed.
+func (s *FeedService) backfill(ctx context.Context, followerId, authorId int64) error {
+	push, err := s.pushes(ctx, authorId)
+	if err != nil || !push || s.cfg.Backfill <= 0 {
+		return err
+	}
+	// The follower may have unfollowed again before the task ran.
+	follows, err := s.followRepo.FindFollowees(ctx, followerId, []int64{authorId})
+	if err != nil || !follows[authorId] {
+		return err
+	}
+	arts, err := s.articleRepo.FindPublishedByAuthors(ctx, []int64{authorId}, domain.FeedCursor{}, s.cfg.Backfill)
+	if err != nil {
+		return err
+	}
+	items := make([]domain.FeedItem, 0, len(arts))
+	for _, art := range arts {
+		items = append(items, domain.FeedItem{
+			UserID:      followerId,
+			ArticleID:   art.ID,
+			AuthorID:    authorId,
+			PublishedAt: art.Ctime,
+		})
+	}
+	return s.repo.AddItems(ctx, items)
+}
+
+// pushes reports whether the articles of an author are pushed to followers.
+func (s *FeedService) pushes(ctx context.Context, authorId int64) (bool, error) {
+	stats, err := s.followRepo.FindStats(ctx, []int64{authorId})
+	if err != nil {
+		return false, err
+	}
+	return stats[authorId].Followers <= s.cfg.FanoutThreshold, nil
+}
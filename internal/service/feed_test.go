@@ -0,0 +1,709 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/event"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+// memFeed keeps inboxes, follows and articles in memory with the semantics
+// of the feed, follow and article repositories.
+type memFeed struct {
+	mu       sync.Mutex
+	items    []domain.FeedItem
+	follows  []domain.Follow
+	nextId   int64
+	articles map[int64]domain.Article
+	tasks    []domain.FeedTask
+	// addCalls counts AddItems calls, to see fan-out batching. The call
+	// numbered failAdd fails.
+	addCalls int
+	failAdd  int
+}
+
+func newMemFeed() *memFeed {
+	return &memFeed{articles: make(map[int64]domain.Article)}
+}
+
+func (m *memFeed) AddItems(_ context.Context, items []domain.FeedItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addCalls++
+	if m.addCalls == m.failAdd {
+		return errors.New("add items failed")
+	}
+	for _, it := range items {
+		if !slices.ContainsFunc(m.items, func(old domain.FeedItem) bool {
+			return old.UserID == it.UserID && old.ArticleID == it.ArticleID
+		}) {
+			m.items = append(m.items, it)
+		}
+	}
+	return nil
+}
+
+func (m *memFeed) RemoveAuthor(_ context.Context, userId, authorId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items = slices.DeleteFunc(m.items, func(it domain.FeedItem) bool {
+		return it.UserID == userId && it.AuthorID == authorId
+	})
+	return nil
+}
+
+func (m *memFeed) FindItems(_ context.Context, userId int64, cursor domain.FeedCursor, limit int) ([]domain.FeedItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []domain.FeedItem
+	for _, it := range m.items {
+		if it.UserID == userId && afterCursor(domain.FeedCursor{PublishedAt: it.PublishedAt, ArticleID: it.ArticleID}, cursor) {
+			res = append(res, it)
+		}
+	}
+	slices.SortFunc(res, func(a, b domain.FeedItem) int {
+		return compareFeed(domain.FeedCursor{PublishedAt: a.PublishedAt, ArticleID: a.ArticleID},
+			domain.FeedCursor{PublishedAt: b.PublishedAt, ArticleID: b.ArticleID})
+	})
+	return res[:min(len(res), limit)], nil
+}
+
+func (m *memFeed) FindFollowers(_ context.Context, userId, cursor int64, limit int) ([]domain.Follow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []domain.Follow
+	for _, f := range slices.Backward(m.follows) {
+		if f.FolloweeID == userId && (cursor == 0 || f.ID < cursor) && len(res) < limit {
+			res = append(res, f)
+		}
+	}
+	return res, nil
+}
+
+func (m *memFeed) FindFollowees(_ context.Context, followerId int64, userIds []int64) (map[int64]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make(map[int64]bool)
+	for _, f := range m.follows {
+		if f.FollowerID == followerId && slices.Contains(userIds, f.FolloweeID) {
+			res[f.FolloweeID] = true
+		}
+	}
+	return res, nil
+}
+
+func (m *memFeed) FindFolloweesWithFollowers(_ context.Context, followerId, minFollowers int64) ([]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []int64
+	for _, f := range m.follows {
+		if f.FollowerID == followerId && m.followers(f.FolloweeID) > minFollowers {
+			res = append(res, f.FolloweeID)
+		}
+	}
+	return res, nil
+}
+
+func (m *memFeed) FindStats(_ context.Context, userIds []int64) (map[int64]domain.FollowStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make(map[int64]domain.FollowStats, len(userIds))
+	for _, id := range userIds {
+		res[id] = domain.FollowStats{UserID: id, Followers: m.followers(id)}
+	}
+	return res, nil
+}
+
+func (m *memFeed) FindPublishedById(_ context.Context, id int64) (domain.Article, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	art, ok := m.articles[id]
+	if !ok {
+		return domain.Article{}, repository.ErrArticleNotFound
+	}
+	return art, nil
+}
+
+func (m *memFeed) FindPublishedByIds(_ context.Context, ids []int64) (map[int64]domain.Article, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make(map[int64]domain.Article, len(ids))
+	for _, id := range ids {
+		if art, ok := m.articles[id]; ok && art.Status == domain.ArticleStatusPublished {
+			res[id] = art
+		}
+	}
+	return res, nil
+}
+
+func (m *memFeed) FindPublishedByAuthors(_ context.Context, authorIds []int64,
+	cursor domain.FeedCursor, limit int) ([]domain.Article, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []domain.Article
+	for _, art := range m.articles {
+		if art.Status == domain.ArticleStatusPublished && slices.Contains(authorIds, art.Author.ID) &&
+			afterCursor(domain.FeedCursor{PublishedAt: art.Ctime, ArticleID: art.ID}, cursor) {
+			res = append(res, art)
+		}
+	}
+	slices.SortFunc(res, func(a, b domain.Article) int {
+		return compareFeed(domain.FeedCursor{PublishedAt: a.Ctime, ArticleID: a.ID},
+			domain.FeedCursor{PublishedAt: b.Ctime, ArticleID: b.ID})
+	})
+	return res[:min(len(res), limit)], nil
+}
+
+// AddTask fails for a cancelled context, like a database write would.
+func (m *memFeed) AddTask(ctx context.Context, task domain.FeedTask) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextId++
+	task.ID = m.nextId
+	m.tasks = append(m.tasks, task)
+	return nil
+}
+
+func (m *memFeed) FindDueTasks(_ context.Context, now time.Time, limit int) ([]domain.FeedTask, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []domain.FeedTask
+	for _, t := range m.tasks {
+		if !t.RunAt.After(now) && len(res) < limit {
+			res = append(res, t)
+		}
+	}
+	return res, nil
+}
+
+func (m *memFeed) ClaimTask(_ context.Context, task domain.FeedTask, until time.Time) error {
+	return m.updateTask(task.ID, func(t *domain.FeedTask) error {
+		if !t.RunAt.Equal(task.RunAt) {
+			return repository.ErrFeedTaskClaimed
+		}
+		t.RunAt = until
+		return nil
+	})
+}
+
+func (m *memFeed) SaveTaskCursor(_ context.Context, id, cursor int64, until time.Time) error {
+	return m.updateTask(id, func(t *domain.FeedTask) error {
+		t.Cursor, t.RunAt = cursor, until
+		return nil
+	})
+}
+
+func (m *memFeed) RetryTask(_ context.Context, id int64, attempts int, runAt time.Time) error {
+	return m.updateTask(id, func(t *domain.FeedTask) error {
+		t.Attempts, t.RunAt = attempts, runAt
+		return nil
+	})
+}
+
+func (m *memFeed) DeleteTask(_ context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tasks = slices.DeleteFunc(m.tasks, func(t domain.FeedTask) bool { return t.ID == id })
+	return nil
+}
+
+func (m *memFeed) updateTask(id int64, update func(t *domain.FeedTask) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.tasks, func(t domain.FeedTask) bool { return t.ID == id })
+	if i < 0 {
+		return repository.ErrFeedTaskClaimed
+	}
+	return update(&m.tasks[i])
+}
+
+func (m *memFeed) followers(userId int64) int64 {
+	var n int64
+	for _, f := range m.follows {
+		if f.FolloweeID == userId {
+			n++
+		}
+	}
+	return n
+}
+
+func afterCursor(c, cursor domain.FeedCursor) bool {
+	return cursor.IsZero() || cursor.Before(c)
+}
+
+func compareFeed(a, b domain.FeedCursor) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case b.Before(a):
+		return 1
+	}
+	return 0
+}
+
+// hiddenUsers hides the same users from every viewer.
+type hiddenUsers map[int64]bool
+
+func (h hiddenUsers) Hidden(context.Context, int64) (map[int64]bool, error) {
+	return h, nil
+}
+
+// feedFixture wires a FeedService to memFeed through the event bus, the way
+// main does, and runs the queued tasks after every event.
+type feedFixture struct {
+	t      *testing.T
+	svc    *FeedService
+	store  *memFeed
+	bus    *event.Bus
+	hidden hiddenUsers
+	now    time.Time
+}
+
+func newFeedFixture(t *testing.T, cfg FeedConfig) *feedFixture {
+	store := newMemFeed()
+	hidden := hiddenUsers{}
+	svc := NewFeedService(store, store, store, memUsers{}, hidden, cfg)
+	bus := event.NewBus()
+	svc.Subscribe(bus)
+	return &feedFixture{t: t, svc: svc, store: store, bus: bus, hidden: hidden,
+		now: time.UnixMilli(1_700_000_000_000)}
+}
+
+func (f *feedFixture) follow(followerId, followeeId int64) {
+	f.store.mu.Lock()
+	f.store.nextId++
+	f.store.follows = append(f.store.follows, domain.Follow{ID: f.store.nextId, FollowerID: followerId, FolloweeID: followeeId})
+	f.store.mu.Unlock()
+	f.publishEvent(event.UserFollowed{FollowerID: followerId, FolloweeID: followeeId})
+}
+
+func (f *feedFixture) unfollow(followerId, followeeId int64) {
+	f.store.mu.Lock()
+	f.store.follows = slices.DeleteFunc(f.store.follows, func(fl domain.Follow) bool {
+		return fl.FollowerID == followerId && fl.FolloweeID == followeeId
+	})
+	f.store.mu.Unlock()
+	f.publishEvent(event.UserUnfollowed{FollowerID: followerId, FolloweeID: followeeId})
+}
+
+// publish publishes a new article a second after the previous one.
+func (f *feedFixture) publish(authorId int64) int64 {
+	f.store.mu.Lock()
+	f.store.nextId++
+	id := f.store.nextId
+	f.now = f.now.Add(time.Second)
+	f.store.articles[id] = domain.Article{
+		ID:     id,
+		Author: domain.Author{ID: authorId},
+		Status: domain.ArticleStatusPublished,
+		Ctime:  f.now,
+	}
+	f.store.mu.Unlock()
+	f.publishEvent(event.ArticlePublished{ArticleID: id, AuthorID: authorId})
+	return id
+}
+
+// publishEvent publishes e and works off the tasks it queued.
+func (f *feedFixture) publishEvent(e event.Event) {
+	f.t.Helper()
+	f.bus.Publish(context.Background(), e)
+	if _, err := f.svc.RunTasks(context.Background(), time.Now(), 100); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// inbox returns the IDs of the articles pushed to a user, newest first.
+func (f *feedFixture) inbox(userId int64) []int64 {
+	f.t.Helper()
+	items, err := f.store.FindItems(context.Background(), userId, domain.FeedCursor{}, 100)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	ids := make([]int64, 0, len(items))
+	for _, it := range items {
+		ids = append(ids, it.ArticleID)
+	}
+	return ids
+}
+
+// timeline returns the IDs of a user's whole feed, read in pages of limit.
+func (f *feedFixture) timeline(userId int64, limit int) []int64 {
+	f.t.Helper()
+	var ids []int64
+	for _, page := range f.pages(userId, limit) {
+		ids = append(ids, page...)
+	}
+	return ids
+}
+
+// pages returns the IDs of a user's whole feed, page by page.
+func (f *feedFixture) pages(userId int64, limit int) [][]int64 {
+	f.t.Helper()
+	var pages [][]int64
+	var cursor domain.FeedCursor
+	for {
+		arts, next, err := f.svc.Timeline(context.Background(), userId, cursor, limit)
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		ids := make([]int64, 0, len(arts))
+		for _, art := range arts {
+			ids = append(ids, art.ID)
+		}
+		pages = append(pages, ids)
+		if next.IsZero() {
+			return pages
+		}
+		cursor = next
+	}
+}
+
+func TestFeedFanoutThreshold(t *testing.T) {
+	const threshold = 3
+	tests := []struct {
+		followers int64
+		push      bool
+	}{
+		{0, true},
+		{1, true},
+		{threshold - 1, true},
+		{threshold, true},
+		{threshold + 1, false},
+		{threshold + 5, false},
+	}
+	for _, tc := range tests {
+		f := newFeedFixture(t, FeedConfig{FanoutThreshold: threshold, FanoutBatch: 2})
+		const author = 1000
+		for i := range tc.followers {
+			f.follow(i+1, author)
+		}
+		art := f.publish(author)
+
+		var wantInbox []int64
+		if tc.push {
+			wantInbox = []int64{art}
+		}
+		for i := range tc.followers {
+			if inbox := f.inbox(i + 1); !slices.Equal(inbox, wantInbox) {
+				t.Errorf("%d followers: follower %d inbox = %v, want %v", tc.followers, i+1, inbox, wantInbox)
+			}
+			// Pushed or pulled, every follower sees the article.
+			if got := f.timeline(i+1, 10); !slices.Equal(got, []int64{art}) {
+				t.Errorf("%d followers: follower %d timeline = %v, want [%d]", tc.followers, i+1, got, art)
+			}
+		}
+		// Authors are never pushed to themselves but see their own articles.
+		if inbox := f.inbox(author); len(inbox) != 0 {
+			t.Errorf("%d followers: author inbox = %v, want empty", tc.followers, inbox)
+		}
+		if got := f.timeline(author, 10); !slices.Equal(got, []int64{art}) {
+			t.Errorf("%d followers: author timeline = %v, want [%d]", tc.followers, got, art)
+		}
+	}
+}
+
+func TestFeedFanoutBatches(t *testing.T) {
+	f := newFeedFixture(t, FeedConfig{FanoutThreshold: 10, FanoutBatch: 2})
+	const author = 1000
+	for i := int64(1); i <= 5; i++ {
+		f.follow(i, author)
+	}
+	f.store.addCalls = 0
+	art := f.publish(author)
+
+	for i := int64(1); i <= 5; i++ {
+		if inbox := f.inbox(i); !slices.Equal(inbox, []int64{art}) {
+			t.Errorf("follower %d inbox = %v, want [%d]", i, inbox, art)
+		}
+	}
+	// 2 + 2 + 1 followers.
+	if f.store.addCalls != 3 {
+		t.Errorf("AddItems called %d times, want 3", f.store.addCalls)
+	}
+}
+
+func TestFeedFanoutSkipsUnpublished(t *testing.T) {
+	f := newFeedFixture(t, FeedConfig{FanoutThreshold: 10, FanoutBatch: 10})
+	const author = 1000
+	f.follow(1, author)
+
+	// The article was taken down before the event was handled.
+	f.store.articles[50] = domain.Article{ID: 50, Author: domain.Author{ID: author},
+		Status: domain.ArticleStatusUnpublished, Ctime: f.now}
+	f.publishEvent(event.ArticlePublished{ArticleID: 50, AuthorID: author})
+	// The article is gone entirely.
+	f.publishEvent(event.ArticlePublished{ArticleID: 51, AuthorID: author})
+
+	if inbox := f.inbox(1); len(inbox) != 0 {
+		t.Errorf("inbox = %v, want empty", inbox)
+	}
+}
+
+func TestFeedBackfillOnFollow(t *testing.T) {
+	const author = 1000
+	f := newFeedFixture(t, FeedConfig{FanoutThreshold: 2, FanoutBatch: 10, Backfill: 2})
+	old := f.publish(author)
+	recent := []int64{f.publish(author), f.publish(author)}
+	slices.Reverse(recent)
+
+	f.follow(1, author)
+	if inbox := f.inbox(1); !slices.Equal(inbox, recent) {
+		t.Errorf("inbox after follow = %v, want the %d newest %v", inbox, 2, recent)
+	}
+	// Following again, e.g. after a lost unfollow event, adds nothing twice.
+	f.publishEvent(event.UserFollowed{FollowerID: 1, FolloweeID: author})
+	if inbox := f.inbox(1); !slices.Equal(inbox, recent) {
+		t.Errorf("inbox after repeated follow = %v, want %v", inbox, recent)
+	}
+	// The author is in push mode, so articles older than the backfill are
+	// not in the feed.
+	if got := f.timeline(1, 10); !slices.Equal(got, recent) || slices.Contains(got, old) {
+		t.Errorf("timeline = %v, want %v", got, recent)
+	}
+
+	// The follow that makes the author popular is not backfilled; their
+	// articles are pulled instead.
+	f.follow(2, author)
+	f.follow(3, author)
+	if inbox := f.inbox(3); len(inbox) != 0 {
+		t.Errorf("inbox of follower past the threshold = %v, want empty", inbox)
+	}
+	all := append([]int64{}, recent...)
+	all = append(all, old)
+	if got := f.timeline(3, 2); !slices.Equal(got, all) {
+		t.Errorf("timeline of follower past the threshold = %v, want %v", got, all)
+	}
+}
+
+func TestFeedBackfillDisabled(t *testing.T) {
+	const author = 1000
+	f := newFeedFixture(t, FeedConfig{FanoutThreshold: 2, FanoutBatch: 10})
+	f.publish(author)
+
+	f.follow(1, author)
+	if inbox := f.inbox(1); len(inbox) != 0 {
+		t.Errorf("inbox = %v, want empty without backfill", inbox)
+	}
+}
+
+func TestFeedUnfollowRemovesAuthor(t *testing.T) {
+	const author, other = 1000, 2000
+	f := newFeedFixture(t, FeedConfig{FanoutThreshold: 5, FanoutBatch: 10})
+	f.follow(1, author)
+	f.follow(1, other)
+	f.follow(2, author)
+	a1 := f.publish(author)
+	o1 := f.publish(other)
+	a2 := f.publish(author)
+	if inbox := f.inbox(1); !slices.Equal(inbox, []int64{a2, o1, a1}) {
+		t.Fatalf("inbox = %v", inbox)
+	}
+
+	f.unfollow(1, author)
+	if inbox := f.inbox(1); !slices.Equal(inbox, []int64{o1}) {
+		t.Errorf("inbox after unfollow = %v, want [%d]", inbox, o1)
+	}
+	if got := f.timeline(1, 10); !slices.Equal(got, []int64{o1}) {
+		t.Errorf("timeline after unfollow = %v, want [%d]", got, o1)
+	}
+	// Other followers keep the author's articles.
+	if inbox := f.inbox(2); !slices.Equal(inbox, []int64{a2, a1}) {
+		t.Errorf("inbox of another follower = %v, want [%d %d]", inbox, a2, a1)
+	}
+	// New articles are no longer pushed.
+	f.publish(author)
+	if inbox := f.inbox(1); !slices.Equal(inbox, []int64{o1}) {
+		t.Errorf("inbox after the next article = %v, want [%d]", inbox, o1)
+	}
+}
+
+func TestFeedTimelineMergesPushedAndPulled(t *testing.T) {
+	const small, popular, reader = 1000, 2000, 1
+	f := newFeedFixture(t, FeedConfig{FanoutThreshold: 1, FanoutBatch: 10})
+	f.follow(reader, small)
+	f.follow(reader, popular)
+	f.follow(2, popular)
+
+	var want []int64
+	for i := 0; i < 3; i++ {
+		want = append(want, f.publish(small), f.publish(popular), f.publish(reader))
+	}
+	slices.Reverse(want)
+
+	if inbox := f.inbox(reader); len(inbox) != 3 {
+		t.Errorf("inbox = %v, want only the 3 articles of the small author", inbox)
+	}
+	for _, limit := range []int{1, 2, 4, 9, 20} {
+		if got := f.timeline(reader, limit); !slices.Equal(got, want) {
+			t.Errorf("timeline in pages of %d = %v, want %v", limit, got, want)
+		}
+	}
+
+	// Once the small author is popular too, their pushed articles are also
+	// pulled, and still show up once.
+	f.follow(2, small)
+	for _, limit := range []int{1, 4, 20} {
+		if got := f.timeline(reader, limit); !slices.Equal(got, want) {
+			t.Errorf("timeline in pages of %d after crossing the threshold = %v, want %v", limit, got, want)
+		}
+	}
+}
+
+func TestFeedTimelineSkipsHiddenAuthors(t *testing.T) {
+	const small, muted, popular, reader = 1000, 2000, 3000, 1
+	f := newFeedFixture(t, FeedConfig{FanoutThreshold: 1, FanoutBatch: 10})
+	f.follow(reader, small)
+	f.follow(reader, muted)
+	f.follow(reader, popular)
+	f.follow(2, popular)
+
+	// Articles of the muted author are pushed to the inbox and outnumber
+	// the visible ones.
+	var want []int64
+	for i := 0; i < 4; i++ {
+		f.publish(muted)
+		f.publish(muted)
+		want = append(want, f.publish(small))
+		f.publish(muted)
+		want = append(want, f.publish(popular))
+	}
+	slices.Reverse(want)
+	f.hidden[muted] = true
+
+	for _, limit := range []int{1, 2, 3, 8} {
+		pages := f.pages(reader, limit)
+		var got []int64
+		for i, page := range pages {
+			// Pages are filled up despite the hidden entries.
+			if i < len(pages)-1 && len(page) != limit {
+				t.Errorf("pages of %d: page %d = %v, want %d articles", limit, i, page, limit)
+			}
+			got = append(got, page...)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("timeline in pages of %d = %v, want %v", limit, got, want)
+		}
+	}
+}
+
+func TestFeedTimelineBoundsRounds(t *testing.T) {
+	const small, muted, reader = 1000, 2000, 1
+	f := newFeedFixture(t, FeedConfig{FanoutThreshold: 10, FanoutBatch: 10})
+	f.follow(reader, small)
+	f.follow(reader, muted)
+	old := f.publish(small)
+	for i := 0; i < 2*maxTimelineRounds; i++ {
+		f.publish(muted)
+	}
+	f.hidden[muted] = true
+
+	// The first page reads maxTimelineRounds pages of hidden articles and
+	// comes back empty, but the cursor still moves past them.
+	arts, next, err := f.svc.Timeline(context.Background(), reader, domain.FeedCursor{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(arts) != 0 || next.IsZero() {
+		t.Fatalf("first page = %d articles, next %v, want none and a cursor", len(arts), next)
+	}
+	if got := f.timeline(reader, 1); !slices.Equal(got, []int64{old}) {
+		t.Errorf("timeline = %v, want [%d]", got, old)
+	}
+}
+
+func TestFeedFanoutResumesAfterFailure(t *testing.T) {
+	const author = 1000
+	f := newFeedFixture(t, FeedConfig{FanoutThreshold: 10, FanoutBatch: 2, RetryDelay: time.Minute, MaxAttempts: 3})
+	for i := int64(1); i <= 5; i++ {
+		f.follow(i, author)
+	}
+	f.store.nextId++
+	art := f.store.nextId
+	f.store.articles[art] = domain.Article{ID: art, Author: domain.Author{ID: author},
+		Status: domain.ArticleStatusPublished, Ctime: f.now}
+
+	// The second batch fails: followers 5 and 4 have the article, the
+	// others not yet.
+	f.store.addCalls = 0
+	f.store.failAdd = 2
+	f.bus.Publish(context.Background(), event.ArticlePublished{ArticleID: art, AuthorID: author})
+	if _, err := f.svc.RunTasks(context.Background(), time.Now(), 100); err == nil {
+		t.Fatal("RunTasks succeeded despite the failed batch")
+	}
+	for i := int64(1); i <= 5; i++ {
+		want := 0
+		if i >= 4 {
+			want = 1
+		}
+		if got := len(f.inbox(i)); got != want {
+			t.Errorf("follower %d inbox has %d articles after the failure, want %d", i, got, want)
+		}
+	}
+	// The retry waits for RetryDelay.
+	if n, _ := f.svc.RunTasks(context.Background(), time.Now(), 100); n != 0 {
+		t.Errorf("RunTasks before the retry delay finished %d tasks, want 0", n)
+	}
+
+	n, err := f.svc.RunTasks(context.Background(), time.Now().Add(time.Hour), 100)
+	if err != nil || n != 1 {
+		t.Fatalf("retry = %d, %v, want 1 task finished", n, err)
+	}
+	for i := int64(1); i <= 5; i++ {
+		if inbox := f.inbox(i); !slices.Equal(inbox, []int64{art}) {
+			t.Errorf("follower %d inbox = %v, want [%d]", i, inbox, art)
+		}
+	}
+	// The retry resumed after the first batch: 2 calls before, 2 after.
+	if f.store.addCalls != 4 {
+		t.Errorf("AddItems called %d times, want 4", f.store.addCalls)
+	}
+	if len(f.store.tasks) != 0 {
+		t.Errorf("tasks left = %v, want none", f.store.tasks)
+	}
+}
+
+func TestFeedTaskSurvivesCancelledRequest(t *testing.T) {
+	const author = 1000
+	f := newFeedFixture(t, FeedConfig{FanoutThreshold: 10, FanoutBatch: 10})
+	f.follow(1, author)
+	f.store.nextId++
+	art := f.store.nextId
+	f.store.articles[art] = domain.Article{ID: art, Author: domain.Author{ID: author},
+		Status: domain.ArticleStatusPublished, Ctime: f.now}
+
+	// The client hung up right after publishing.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f.bus.Publish(ctx, event.ArticlePublished{ArticleID: art, AuthorID: author})
+	if _, err := f.svc.RunTasks(context.Background(), time.Now(), 100); err != nil {
+		t.Fatal(err)
+	}
+	if inbox := f.inbox(1); !slices.Equal(inbox, []int64{art}) {
+		t.Errorf("inbox = %v, want [%d]", inbox, art)
+	}
+}
+
+func TestFeedBackfillSkipsUnfollowed(t *testing.T) {
+	const author = 1000
+	f := newFeedFixture(t, FeedConfig{FanoutThreshold: 10, FanoutBatch: 10, Backfill: 5})
+	f.publish(author)
+
+	// The follower unfollows before the backfill runs.
+	f.store.nextId++
+	f.store.follows = append(f.store.follows, domain.Follow{ID: f.store.nextId, FollowerID: 1, FolloweeID: author})
+	f.bus.Publish(context.Background(), event.UserFollowed{FollowerID: 1, FolloweeID: author})
+	f.unfollow(1, author)
+
+	if inbox := f.inbox(1); len(inbox) != 0 {
+		t.Errorf("inbox = %v, want empty", inbox)
+	}
+}
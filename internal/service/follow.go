@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/event"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+var ErrCannotFollowSelf = errors.New("cannot follow yourself")
+
+// FollowService manages the follow graph. It is the FollowChecker of the
+// privacy rules.
+type FollowService struct {
+	repo     *repository.FollowRepository
+	userRepo *repository.UserRepository
+	blocks   *BlockService
+	events   event.Publisher
+}
+
+func NewFollowService(repo *repository.FollowRepository, userRepo *repository.UserRepository,
+	blocks *BlockService, events event.Publisher) *FollowService {
+	return &FollowService{
+		repo:     repo,
+		userRepo: userRepo,
+		blocks:   blocks,
+		events:   events,
+	}
+}
+
+// Subscribe undoes the follows between two users when one blocks the other.
+func (s *FollowService) Subscribe(bus *event.Bus) {
+	bus.Subscribe(event.TopicUserBlocked, func(ctx context.Context, e event.Event) error {
+		ev := e.(event.UserBlocked)
+		if err := s.Unfollow(ctx, ev.BlockerID, ev.BlockedID); err != nil {
+			return err
+		}
+		return s.Unfollow(ctx, ev.BlockedID, ev.BlockerID)
+	})
+}
+
+// Follow makes followerId follow followeeId. Following someone again is not
+// an error.
+func (s *FollowService) Follow(ctx context.Context, followerId, followeeId int64) error {
+	if followerId == followeeId {
+		return ErrCannotFollowSelf
+	}
+	followee, err := s.userRepo.FindByID(ctx, followeeId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if followee.Deactivated {
+		return ErrUserNotFound
+	}
+	if err = s.blocks.Check(ctx, followerId, followeeId); err != nil {
+		return err
+	}
+	created, err := s.repo.Follow(ctx, followerId, followeeId)
+	if err != nil {
+		return err
+	}
+	if created {
+		s.events.Publish(ctx, event.UserFollowed{FollowerID: followerId, FolloweeID: followeeId})
+	}
+	return nil
+}
+
+// Unfollow undoes Follow. Unfollowing someone not followed is not an error.
+func (s *FollowService) Unfollow(ctx context.Context, followerId, followeeId int64) error {
+	deleted, err := s.repo.Unfollow(ctx, followerId, followeeId)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		s.events.Publish(ctx, event.UserUnfollowed{FollowerID: followerId, FolloweeID: followeeId})
+	}
+	return nil
+}
+
+func (s *FollowService) IsFollowing(ctx context.Context, followerId, followeeId int64) (bool, error) {
+	following, err := s.repo.FindFollowees(ctx, followerId, []int64{followeeId})
+	if err != nil {
+		return false, err
+	}
+	return following[followeeId], nil
+}
+
+// Relationship returns whether viewerId and userId follow each other.
+func (s *FollowService) Relationship(ctx context.Context, viewerId, userId int64) (domain.Relationship, error) {
+	following, err := s.IsFollowing(ctx, viewerId, userId)
+	if err != nil {
+		return domain.Relationship{}, err
+	}
+	followedBy, err := s.IsFollowing(ctx, userId, viewerId)
+	if err != nil {
+		return domain.Relationship{}, err
+	}
+	return domain.Relationship{Following: following, FollowedBy: followedBy}, nil
+}
+
+// FollowingAmong returns which of the given users followerId follows, for
+// marking users in lists.
+func (s *FollowService) FollowingAmong(ctx context.Context, followerId int64, userIds []int64) (map[int64]bool, error) {
+	return s.repo.FindFollowees(ctx, followerId, userIds)
+}
+
+func (s *FollowService) Stats(ctx context.Context, userId int64) (domain.FollowStats, error) {
+	stats, err := s.repo.FindStats(ctx, []int64{userId})
+	if err != nil {
+		return domain.FollowStats{}, err
+	}
+	return stats[userId], nil
+}
+
+// StatsOf returns the counters of several users, keyed by user ID.
+func (s *FollowService) StatsOf(ctx context.Context, userIds []int64) (map[int64]domain.FollowStats, error) {
+	return s.repo.FindStats(ctx, userIds)
+}
+
+// FollowListEntry is a user in a follower or following list.
+type FollowListEntry struct {
+	Follow domain.Follow
+	User   domain.User
+}
+
+// Followers returns up to limit followers of a user, most recent first, and
+// the cursor of the next page, which is 0 on the last page.
+func (s *FollowService) Followers(ctx context.Context, userId, cursor int64, limit int) ([]FollowListEntry, int64, error) {
+	follows, err := s.repo.FindFollowers(ctx, userId, cursor, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.entries(ctx, follows, limit, func(f domain.Follow) int64 { return f.FollowerID })
+}
+
+// Following returns up to limit users followed by a user, most recent first,
+// and the cursor of the next page.
+func (s *FollowService) Following(ctx context.Context, userId, cursor int64, limit int) ([]FollowListEntry, int64, error) {
+	follows, err := s.repo.FindFollowing(ctx, userId, cursor, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.entries(ctx, follows, limit, func(f domain.Follow) int64 { return f.FolloweeID })
+}
+
+// entries loads the users on the other end of follows. Users that no longer
+// exist or are deactivated are left out, which can make a page shorter than
+// limit, so the next cursor is taken from the follows rather than the users.
+func (s *FollowService) entries(ctx context.Context, follows []domain.Follow, limit int,
+	other func(domain.Follow) int64) ([]FollowListEntry, int64, error) {
+	ids := make([]int64, 0, len(follows))
+	for _, f := range follows {
+		ids = append(ids, other(f))
+	}
+	users, err := s.userRepo.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res := make([]FollowListEntry, 0, len(follows))
+	for _, f := range follows {
+		u, ok := users[other(f)]
+		if !ok || u.Deactivated {
+			continue
+		}
+		res = append(res, FollowListEntry{Follow: f, User: u})
+	}
+	var next int64
+	if len(follows) == limit {
+		next = follows[len(follows)-1].ID
+	}
+	return res, next, nil
+}
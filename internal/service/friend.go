@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/event"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+var (
+	ErrFriendRequestNotFound = repository.ErrFriendRequestNotFound
+	ErrFriendRequestClosed   = errors.New("friend request was already answered")
+	ErrAlreadyFriends        = errors.New("already friends")
+	ErrCannotFriendSelf      = errors.New("cannot befriend yourself")
+)
+
+// FriendService manages mutual friendships. Unlike follows, a friendship
+// needs both users to agree: one sends a request, the other accepts it.
+//
+// A request is pending until it is answered. Only the addressee may accept
+// or decline it, and only the requester may cancel it; every answer is final,
+// but the requester may send a new request afterwards.
+type FriendService struct {
+	repo     FriendStore
+	userRepo UserFinder
+	blocks   BlockChecker
+	events   event.Publisher
+}
+
+// FriendStore keeps friend requests and friendships.
+// *repository.FriendRepository implements it.
+type FriendStore interface {
+	// CreateRequest makes the request pending and returns it. A request that
+	// is already pending is returned as is; an answered one is replaced.
+	CreateRequest(ctx context.Context, requesterId, addresseeId int64) (domain.FriendRequest, error)
+	FindRequestById(ctx context.Context, id int64) (domain.FriendRequest, error)
+	FindRequest(ctx context.Context, requesterId, addresseeId int64) (domain.FriendRequest, error)
+	// UpdateRequestStatus returns ErrFriendRequestNotFound when the request
+	// is no longer in from.
+	UpdateRequestStatus(ctx context.Context, id int64, from, to domain.FriendRequestStatus) error
+	Accept(ctx context.Context, req domain.FriendRequest) error
+	Unfriend(ctx context.Context, userId, friendId int64) (bool, error)
+	IsFriend(ctx context.Context, userId, friendId int64) (bool, error)
+	FindFriends(ctx context.Context, userId, cursor int64, limit int) ([]domain.Friendship, error)
+	FindPendingIncoming(ctx context.Context, addresseeId, cursor int64, limit int) ([]domain.FriendRequest, error)
+	FindPendingOutgoing(ctx context.Context, requesterId, cursor int64, limit int) ([]domain.FriendRequest, error)
+}
+
+// UserFinder looks up users by ID. *repository.UserRepository implements it.
+type UserFinder interface {
+	FindByID(ctx context.Context, id int64) (domain.User, error)
+	FindByIDs(ctx context.Context, ids []int64) (map[int64]domain.User, error)
+}
+
+// BlockChecker decides whether two users may interact. *BlockService
+// implements it.
+type BlockChecker interface {
+	Check(ctx context.Context, a, b int64) error
+}
+
+func NewFriendService(repo FriendStore, userRepo UserFinder,
+	blocks BlockChecker, events event.Publisher) *FriendService {
+	return &FriendService{
+		repo:     repo,
+		userRepo: userRepo,
+		blocks:   blocks,
+		events:   events,
+	}
+}
+
+// Subscribe ends the friendship of two users when one blocks the other and
+// withdraws the requests still pending between them.
+func (s *FriendService) Subscribe(bus *event.Bus) {
+	bus.Subscribe(event.TopicUserBlocked, func(ctx context.Context, e event.Event) error {
+		ev := e.(event.UserBlocked)
+		if err := s.Unfriend(ctx, ev.BlockerID, ev.BlockedID); err != nil {
+			return err
+		}
+		if err := s.withdraw(ctx, ev.BlockerID, ev.BlockedID); err != nil {
+			return err
+		}
+		return s.withdraw(ctx, ev.BlockedID, ev.BlockerID)
+	})
+}
+
+// Send asks addresseeId to become friends with requesterId. Sending the same
+// request again returns the pending one. If the addressee already asked the
+// requester, that request is accepted instead.
+func (s *FriendService) Send(ctx context.Context, requesterId, addresseeId int64) (domain.FriendRequest, error) {
+	if requesterId == addresseeId {
+		return domain.FriendRequest{}, ErrCannotFriendSelf
+	}
+	addressee, err := s.userRepo.FindByID(ctx, addresseeId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return domain.FriendRequest{}, ErrUserNotFound
+		}
+		return domain.FriendRequest{}, err
+	}
+	if addressee.Deactivated {
+		return domain.FriendRequest{}, ErrUserNotFound
+	}
+	if err = s.blocks.Check(ctx, requesterId, addresseeId); err != nil {
+		return domain.FriendRequest{}, err
+	}
+	friends, err := s.repo.IsFriend(ctx, requesterId, addresseeId)
+	if err != nil {
+		return domain.FriendRequest{}, err
+	}
+	if friends {
+		return domain.FriendRequest{}, ErrAlreadyFriends
+	}
+
+	reverse, err := s.repo.FindRequest(ctx, addresseeId, requesterId)
+	switch {
+	case err == nil && reverse.Status == domain.FriendRequestStatusPending:
+		return s.Accept(ctx, reverse.ID, requesterId)
+	case err != nil && !errors.Is(err, repository.ErrFriendRequestNotFound):
+		return domain.FriendRequest{}, err
+	}
+	return s.repo.CreateRequest(ctx, requesterId, addresseeId)
+}
+
+// Accept accepts a pending request sent to addresseeId. Both users become
+// friends and the requester is notified.
+func (s *FriendService) Accept(ctx context.Context, id, addresseeId int64) (domain.FriendRequest, error) {
+	req, err := s.pending(ctx, id, func(r domain.FriendRequest) bool { return r.AddresseeID == addresseeId })
+	if err != nil {
+		return domain.FriendRequest{}, err
+	}
+	// The request may predate a block between the two.
+	if err = s.blocks.Check(ctx, req.RequesterID, addresseeId); err != nil {
+		return domain.FriendRequest{}, err
+	}
+	if err = s.repo.Accept(ctx, req); err != nil {
+		return domain.FriendRequest{}, s.closed(err)
+	}
+	s.events.Publish(ctx, event.FriendRequestAccepted{
+		RequestID:   req.ID,
+		RequesterID: req.RequesterID,
+		AddresseeID: req.AddresseeID,
+	})
+	return s.repo.FindRequestById(ctx, id)
+}
+
+// Decline turns down a pending request sent to addresseeId. The requester is
+// not told.
+func (s *FriendService) Decline(ctx context.Context, id, addresseeId int64) error {
+	req, err := s.pending(ctx, id, func(r domain.FriendRequest) bool { return r.AddresseeID == addresseeId })
+	if err != nil {
+		return err
+	}
+	return s.closed(s.repo.UpdateRequestStatus(ctx, req.ID,
+		domain.FriendRequestStatusPending, domain.FriendRequestStatusDeclined))
+}
+
+// Cancel withdraws a pending request requesterId sent.
+func (s *FriendService) Cancel(ctx context.Context, id, requesterId int64) error {
+	req, err := s.pending(ctx, id, func(r domain.FriendRequest) bool { return r.RequesterID == requesterId })
+	if err != nil {
+		return err
+	}
+	return s.closed(s.repo.UpdateRequestStatus(ctx, req.ID,
+		domain.FriendRequestStatusPending, domain.FriendRequestStatusCancelled))
+}
+
+// Unfriend ends a friendship for both users. Unfriending someone who is not
+// a friend is not an error.
+func (s *FriendService) Unfriend(ctx context.Context, userId, friendId int64) error {
+	_, err := s.repo.Unfriend(ctx, userId, friendId)
+	return err
+}
+
+func (s *FriendService) IsFriend(ctx context.Context, userId, friendId int64) (bool, error) {
+	return s.repo.IsFriend(ctx, userId, friendId)
+}
+
+// FriendListEntry is a friend in a friend list.
+type FriendListEntry struct {
+	Friendship domain.Friendship
+	User       domain.User
+}
+
+// Friends returns up to limit friends of a user, most recent first, and the
+// cursor of the next page, which is 0 on the last page.
+func (s *FriendService) Friends(ctx context.Context, userId, cursor int64, limit int) ([]FriendListEntry, int64, error) {
+	fs, err := s.repo.FindFriends(ctx, userId, cursor, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]int64, 0, len(fs))
+	for _, f := range fs {
+		ids = append(ids, f.FriendID)
+	}
+	users, err := s.userRepo.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res := make([]FriendListEntry, 0, len(fs))
+	for _, f := range fs {
+		if u, ok := users[f.FriendID]; ok && !u.Deactivated {
+			res = append(res, FriendListEntry{Friendship: f, User: u})
+		}
+	}
+	var next int64
+	if len(fs) == limit {
+		next = fs[len(fs)-1].ID
+	}
+	return res, next, nil
+}
+
+// FriendRequestEntry is a pending request together with the user on the other
+// side: the requester for incoming requests, the addressee for outgoing ones.
+type FriendRequestEntry struct {
+	Request domain.FriendRequest
+	User    domain.User
+}
+
+// Incoming returns the pending requests sent to a user, newest first, and
+// the cursor of the next page.
+func (s *FriendService) Incoming(ctx context.Context, userId, cursor int64, limit int) ([]FriendRequestEntry, int64, error) {
+	rs, err := s.repo.FindPendingIncoming(ctx, userId, cursor, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.requestEntries(ctx, rs, limit, func(r domain.FriendRequest) int64 { return r.RequesterID })
+}
+
+// Outgoing returns the pending requests a user sent, newest first, and the
+// cursor of the next page.
+func (s *FriendService) Outgoing(ctx context.Context, userId, cursor int64, limit int) ([]FriendRequestEntry, int64, error) {
+	rs, err := s.repo.FindPendingOutgoing(ctx, userId, cursor, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.requestEntries(ctx, rs, limit, func(r domain.FriendRequest) int64 { return r.AddresseeID })
+}
+
+func (s *FriendService) requestEntries(ctx context.Context, rs []domain.FriendRequest, limit int,
+	other func(domain.FriendRequest) int64) ([]FriendRequestEntry, int64, error) {
+	ids := make([]int64, 0, len(rs))
+	for _, r := range rs {
+		ids = append(ids, other(r))
+	}
+	users, err := s.userRepo.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res := make([]FriendRequestEntry, 0, len(rs))
+	for _, r := range rs {
+		if u, ok := users[other(r)]; ok && !u.Deactivated {
+			res = append(res, FriendRequestEntry{Request: r, User: u})
+		}
+	}
+	var next int64
+	if len(rs) == limit {
+		next = rs[len(rs)-1].ID
+	}
+	return res, next, nil
+}
+
+// pending returns a request the caller may answer. Requests of other users
+// are reported as not found, answered ones as closed.
+func (s *FriendService) pending(ctx context.Context, id int64, mayAnswer func(domain.FriendRequest) bool) (domain.FriendRequest, error) {
+	req, err := s.repo.FindRequestById(ctx, id)
+	if err != nil {
+		return domain.FriendRequest{}, err
+	}
+	if !mayAnswer(req) {
+		return domain.FriendRequest{}, ErrFriendRequestNotFound
+	}
+	if req.Status != domain.FriendRequestStatusPending {
+		return domain.FriendRequest{}, ErrFriendRequestClosed
+	}
+	return req, nil
+}
+
+// withdraw cancels the pending request requesterId sent to addresseeId, if
+// there is one.
+func (s *FriendService) withdraw(ctx context.Context, requesterId, addresseeId int64) error {
+	req, err := s.repo.FindRequest(ctx, requesterId, addresseeId)
+	if errors.Is(err, repository.ErrFriendRequestNotFound) {
+		return nil
+	}
+	if err != nil || req.Status != domain.FriendRequestStatusPending {
+		return err
+	}
+	err = s.repo.UpdateRequestStatus(ctx, req.ID, domain.FriendRequestStatusPending, domain.FriendRequestStatusCancelled)
+	if errors.Is(err, repository.ErrFriendRequestNotFound) {
+		return nil
+	}
+	return err
+}
+
+// closed reports a request answered concurrently, which the repository sees
+// as no longer pending, as closed.
+func (s *FriendService) closed(err error) error {
+	if errors.Is(err, repository.ErrFriendRequestNotFound) {
+		return ErrFriendRequestClosed
+	}
+	return err
+}
@@ -0,0 +1,536 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/event"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+// memFriendStore keeps requests and friendships in memory, with the same
+// rules as the friend DAO: one request per requester and addressee, and
+// status changes only from the expected status.
+type memFriendStore struct {
+	mu       sync.Mutex
+	nextId   int64
+	requests map[int64]domain.FriendRequest
+	friends  map[[2]int64]bool
+}
+
+func newMemFriendStore() *memFriendStore {
+	return &memFriendStore{
+		requests: make(map[int64]domain.FriendRequest),
+		friends:  make(map[[2]int64]bool),
+	}
+}
+
+func (m *memFriendStore) CreateRequest(_ context.Context, requesterId, addresseeId int64) (domain.FriendRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r, ok := m.find(requesterId, addresseeId); ok {
+		if r.Status == domain.FriendRequestStatusPending {
+			return r, nil
+		}
+		delete(m.requests, r.ID)
+	}
+	m.nextId++
+	r := domain.FriendRequest{
+		ID:          m.nextId,
+		RequesterID: requesterId,
+		AddresseeID: addresseeId,
+		Status:      domain.FriendRequestStatusPending,
+	}
+	m.requests[r.ID] = r
+	return r, nil
+}
+
+func (m *memFriendStore) FindRequestById(_ context.Context, id int64) (domain.FriendRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.requests[id]
+	if !ok {
+		return domain.FriendRequest{}, repository.ErrFriendRequestNotFound
+	}
+	return r, nil
+}
+
+func (m *memFriendStore) FindRequest(_ context.Context, requesterId, addresseeId int64) (domain.FriendRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.find(requesterId, addresseeId)
+	if !ok {
+		return domain.FriendRequest{}, repository.ErrFriendRequestNotFound
+	}
+	return r, nil
+}
+
+func (m *memFriendStore) UpdateRequestStatus(_ context.Context, id int64, from, to domain.FriendRequestStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.update(id, from, to)
+}
+
+func (m *memFriendStore) Accept(_ context.Context, req domain.FriendRequest) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err := m.update(req.ID, domain.FriendRequestStatusPending, domain.FriendRequestStatusAccepted)
+	if err != nil {
+		return err
+	}
+	m.friends[[2]int64{req.RequesterID, req.AddresseeID}] = true
+	m.friends[[2]int64{req.AddresseeID, req.RequesterID}] = true
+	return nil
+}
+
+func (m *memFriendStore) Unfriend(_ context.Context, userId, friendId int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existed := m.friends[[2]int64{userId, friendId}]
+	delete(m.friends, [2]int64{userId, friendId})
+	delete(m.friends, [2]int64{friendId, userId})
+	return existed, nil
+}
+
+func (m *memFriendStore) IsFriend(_ context.Context, userId, friendId int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.friends[[2]int64{userId, friendId}], nil
+}
+
+func (m *memFriendStore) FindFriends(context.Context, int64, int64, int) ([]domain.Friendship, error) {
+	return nil, nil
+}
+
+func (m *memFriendStore) FindPendingIncoming(context.Context, int64, int64, int) ([]domain.FriendRequest, error) {
+	return nil, nil
+}
+
+func (m *memFriendStore) FindPendingOutgoing(context.Context, int64, int64, int) ([]domain.FriendRequest, error) {
+	return nil, nil
+}
+
+func (m *memFriendStore) find(requesterId, addresseeId int64) (domain.FriendRequest, bool) {
+	for _, r := range m.requests {
+		if r.RequesterID == requesterId && r.AddresseeID == addresseeId {
+			return r, true
+		}
+	}
+	return domain.FriendRequest{}, false
+}
+
+func (m *memFriendStore) update(id int64, from, to domain.FriendRequestStatus) error {
+	r, ok := m.requests[id]
+	if !ok || r.Status != from {
+		return repository.ErrFriendRequestNotFound
+	}
+	r.Status = to
+	m.requests[id] = r
+	return nil
+}
+
+type memUsers map[int64]domain.User
+
+func (m memUsers) FindByID(_ context.Context, id int64) (domain.User, error) {
+	u, ok := m[id]
+	if !ok {
+		return domain.User{}, repository.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (m memUsers) FindByIDs(_ context.Context, ids []int64) (map[int64]domain.User, error) {
+	res := make(map[int64]domain.User, len(ids))
+	for _, id := range ids {
+		if u, ok := m[id]; ok {
+			res[id] = u
+		}
+	}
+	return res, nil
+}
+
+// memBlocks blocks the pairs it holds, in both directions like BlockService.
+type memBlocks map[[2]int64]bool
+
+func (m memBlocks) Check(_ context.Context, a, b int64) error {
+	if m[[2]int64{a, b}] || m[[2]int64{b, a}] {
+		return ErrBlocked
+	}
+	return nil
+}
+
+type recordedEvents struct {
+	mu     sync.Mutex
+	events []event.Event
+}
+
+func (r *recordedEvents) Publish(_ context.Context, e event.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+const (
+	alice int64 = iota + 1
+	bob
+	carol
+	gone
+)
+
+func newTestFriendService() (*FriendService, *memFriendStore, memBlocks, *recordedEvents) {
+	store := newMemFriendStore()
+	users := memUsers{
+		alice: {ID: alice},
+		bob:   {ID: bob},
+		carol: {ID: carol},
+		gone:  {ID: gone, Deactivated: true},
+	}
+	blocks := memBlocks{}
+	events := &recordedEvents{}
+	return NewFriendService(store, users, blocks, events), store, blocks, events
+}
+
+func assertFriends(t *testing.T, s *FriendService, a, b int64, want bool) {
+	t.Helper()
+	for _, pair := range [][2]int64{{a, b}, {b, a}} {
+		got, err := s.IsFriend(context.Background(), pair[0], pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("IsFriend(%d, %d) = %v, want %v", pair[0], pair[1], got, want)
+		}
+	}
+}
+
+func assertStatus(t *testing.T, store *memFriendStore, id int64, want domain.FriendRequestStatus) {
+	t.Helper()
+	r, err := store.FindRequestById(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != want {
+		t.Fatalf("request %d is %s, want %s", id, r.Status, want)
+	}
+}
+
+func TestFriendRequestAccept(t *testing.T) {
+	ctx := context.Background()
+	s, _, _, events := newTestFriendService()
+
+	req, err := s.Send(ctx, alice, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.RequesterID != alice || req.AddresseeID != bob || req.Status != domain.FriendRequestStatusPending {
+		t.Fatalf("Send = %+v", req)
+	}
+	assertFriends(t, s, alice, bob, false)
+
+	// Only the addressee may accept.
+	if _, err = s.Accept(ctx, req.ID, alice); !errors.Is(err, ErrFriendRequestNotFound) {
+		t.Errorf("Accept by requester error = %v, want ErrFriendRequestNotFound", err)
+	}
+	if _, err = s.Accept(ctx, req.ID, carol); !errors.Is(err, ErrFriendRequestNotFound) {
+		t.Errorf("Accept by stranger error = %v, want ErrFriendRequestNotFound", err)
+	}
+	if len(events.events) != 0 {
+		t.Fatalf("events = %+v before accepting", events.events)
+	}
+
+	accepted, err := s.Accept(ctx, req.ID, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accepted.Status != domain.FriendRequestStatusAccepted {
+		t.Errorf("accepted request is %s", accepted.Status)
+	}
+	assertFriends(t, s, alice, bob, true)
+	want := event.FriendRequestAccepted{RequestID: req.ID, RequesterID: alice, AddresseeID: bob}
+	if len(events.events) != 1 || events.events[0] != want {
+		t.Errorf("events = %+v, want %+v", events.events, want)
+	}
+
+	// Every answer is final.
+	if _, err = s.Accept(ctx, req.ID, bob); !errors.Is(err, ErrFriendRequestClosed) {
+		t.Errorf("second Accept error = %v, want ErrFriendRequestClosed", err)
+	}
+	if err = s.Decline(ctx, req.ID, bob); !errors.Is(err, ErrFriendRequestClosed) {
+		t.Errorf("Decline after Accept error = %v, want ErrFriendRequestClosed", err)
+	}
+	if err = s.Cancel(ctx, req.ID, alice); !errors.Is(err, ErrFriendRequestClosed) {
+		t.Errorf("Cancel after Accept error = %v, want ErrFriendRequestClosed", err)
+	}
+	for _, pair := range [][2]int64{{alice, bob}, {bob, alice}} {
+		if _, err = s.Send(ctx, pair[0], pair[1]); !errors.Is(err, ErrAlreadyFriends) {
+			t.Errorf("Send(%d, %d) between friends error = %v, want ErrAlreadyFriends", pair[0], pair[1], err)
+		}
+	}
+	if len(events.events) != 1 {
+		t.Errorf("events = %+v, want only the first acceptance", events.events)
+	}
+}
+
+func TestFriendRequestDecline(t *testing.T) {
+	ctx := context.Background()
+	s, store, _, events := newTestFriendService()
+
+	req, err := s.Send(ctx, alice, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Decline(ctx, req.ID, alice); !errors.Is(err, ErrFriendRequestNotFound) {
+		t.Errorf("Decline by requester error = %v, want ErrFriendRequestNotFound", err)
+	}
+	if err = s.Decline(ctx, req.ID, bob); err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, store, req.ID, domain.FriendRequestStatusDeclined)
+	assertFriends(t, s, alice, bob, false)
+	if len(events.events) != 0 {
+		t.Errorf("declining published %+v", events.events)
+	}
+
+	if err = s.Decline(ctx, req.ID, bob); !errors.Is(err, ErrFriendRequestClosed) {
+		t.Errorf("second Decline error = %v, want ErrFriendRequestClosed", err)
+	}
+	if _, err = s.Accept(ctx, req.ID, bob); !errors.Is(err, ErrFriendRequestClosed) {
+		t.Errorf("Accept after Decline error = %v, want ErrFriendRequestClosed", err)
+	}
+	if err = s.Cancel(ctx, req.ID, alice); !errors.Is(err, ErrFriendRequestClosed) {
+		t.Errorf("Cancel after Decline error = %v, want ErrFriendRequestClosed", err)
+	}
+}
+
+func TestFriendRequestCancel(t *testing.T) {
+	ctx := context.Background()
+	s, store, _, _ := newTestFriendService()
+
+	req, err := s.Send(ctx, alice, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Cancel(ctx, req.ID, bob); !errors.Is(err, ErrFriendRequestNotFound) {
+		t.Errorf("Cancel by addressee error = %v, want ErrFriendRequestNotFound", err)
+	}
+	if err = s.Cancel(ctx, req.ID, alice); err != nil {
+		t.Fatal(err)
+	}
+	assertStatus(t, store, req.ID, domain.FriendRequestStatusCancelled)
+
+	if err = s.Cancel(ctx, req.ID, alice); !errors.Is(err, ErrFriendRequestClosed) {
+		t.Errorf("second Cancel error = %v, want ErrFriendRequestClosed", err)
+	}
+	if _, err = s.Accept(ctx, req.ID, bob); !errors.Is(err, ErrFriendRequestClosed) {
+		t.Errorf("Accept after Cancel error = %v, want ErrFriendRequestClosed", err)
+	}
+	assertFriends(t, s, alice, bob, false)
+}
+
+func TestFriendRequestReRequest(t *testing.T) {
+	ctx := context.Background()
+	s, store, _, _ := newTestFriendService()
+
+	for _, answer := range []struct {
+		name string
+		fn   func(id int64) error
+	}{
+		{"declined", func(id int64) error { return s.Decline(ctx, id, bob) }},
+		{"cancelled", func(id int64) error { return s.Cancel(ctx, id, alice) }},
+	} {
+		t.Run(answer.name, func(t *testing.T) {
+			old, err := s.Send(ctx, alice, bob)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = answer.fn(old.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			again, err := s.Send(ctx, alice, bob)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again.ID == old.ID || again.Status != domain.FriendRequestStatusPending {
+				t.Fatalf("re-request = %+v, want a new pending request replacing %d", again, old.ID)
+			}
+			if _, err = store.FindRequestById(ctx, old.ID); !errors.Is(err, ErrFriendRequestNotFound) {
+				t.Errorf("old request lookup error = %v, want it replaced", err)
+			}
+			// The answer to the old request does not carry over.
+			if _, err = s.Accept(ctx, old.ID, bob); !errors.Is(err, ErrFriendRequestNotFound) {
+				t.Errorf("Accept of replaced request error = %v, want ErrFriendRequestNotFound", err)
+			}
+			if err = s.Cancel(ctx, again.ID, alice); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	req, err := s.Send(ctx, alice, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Accept(ctx, req.ID, bob); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Unfriend(ctx, bob, alice); err != nil {
+		t.Fatal(err)
+	}
+	assertFriends(t, s, alice, bob, false)
+	// Unfriending ends the friendship, and either side may ask again.
+	req, err = s.Send(ctx, alice, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Accept(ctx, req.ID, bob); err != nil {
+		t.Fatal(err)
+	}
+	assertFriends(t, s, alice, bob, true)
+}
+
+func TestFriendRequestDuplicate(t *testing.T) {
+	ctx := context.Background()
+	s, store, _, _ := newTestFriendService()
+
+	first, err := s.Send(ctx, alice, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Send(ctx, alice, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Errorf("second Send = %+v, want the pending %+v", second, first)
+	}
+	if len(store.requests) != 1 {
+		t.Errorf("%d requests stored, want 1", len(store.requests))
+	}
+}
+
+func TestFriendRequestCrossingAccepts(t *testing.T) {
+	ctx := context.Background()
+	s, store, _, events := newTestFriendService()
+
+	req, err := s.Send(ctx, alice, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Bob asking Alice back answers her request instead of opening his own.
+	got, err := s.Send(ctx, bob, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != req.ID || got.Status != domain.FriendRequestStatusAccepted {
+		t.Errorf("crossing Send = %+v, want request %d accepted", got, req.ID)
+	}
+	assertFriends(t, s, alice, bob, true)
+	if _, err = store.FindRequest(ctx, bob, alice); !errors.Is(err, ErrFriendRequestNotFound) {
+		t.Errorf("reverse request lookup error = %v, want none created", err)
+	}
+	if len(events.events) != 1 {
+		t.Errorf("events = %+v, want one acceptance", events.events)
+	}
+}
+
+func TestFriendRequestInvalidUsers(t *testing.T) {
+	ctx := context.Background()
+	s, store, _, _ := newTestFriendService()
+
+	if _, err := s.Send(ctx, alice, alice); !errors.Is(err, ErrCannotFriendSelf) {
+		t.Errorf("Send to self error = %v, want ErrCannotFriendSelf", err)
+	}
+	if _, err := s.Send(ctx, alice, 99); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Send to missing user error = %v, want ErrUserNotFound", err)
+	}
+	if _, err := s.Send(ctx, alice, gone); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Send to deactivated user error = %v, want ErrUserNotFound", err)
+	}
+	if _, err := s.Accept(ctx, 42, bob); !errors.Is(err, ErrFriendRequestNotFound) {
+		t.Errorf("Accept of missing request error = %v, want ErrFriendRequestNotFound", err)
+	}
+	if len(store.requests) != 0 {
+		t.Errorf("%d requests stored, want none", len(store.requests))
+	}
+}
+
+func TestFriendRequestBlocked(t *testing.T) {
+	ctx := context.Background()
+	s, store, blocks, events := newTestFriendService()
+
+	req, err := s.Send(ctx, alice, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks[[2]int64{bob, alice}] = true
+
+	// The block works both ways.
+	for _, pair := range [][2]int64{{alice, bob}, {bob, alice}} {
+		if _, err = s.Send(ctx, pair[0], pair[1]); !errors.Is(err, ErrBlocked) {
+			t.Errorf("Send(%d, %d) error = %v, want ErrBlocked", pair[0], pair[1], err)
+		}
+	}
+	// A request sent before the block cannot be accepted after it.
+	if _, err = s.Accept(ctx, req.ID, bob); !errors.Is(err, ErrBlocked) {
+		t.Errorf("Accept error = %v, want ErrBlocked", err)
+	}
+	assertStatus(t, store, req.ID, domain.FriendRequestStatusPending)
+	assertFriends(t, s, alice, bob, false)
+	if len(events.events) != 0 {
+		t.Errorf("events = %+v, want none", events.events)
+	}
+	// Declining stays possible.
+	if err = s.Decline(ctx, req.ID, bob); err != nil {
+		t.Errorf("Decline error = %v", err)
+	}
+
+	// Carol is not involved.
+	if _, err = s.Send(ctx, carol, alice); err != nil {
+		t.Errorf("Send from a third user error = %v", err)
+	}
+}
+
+func TestFriendServiceBlockEndsFriendship(t *testing.T) {
+	ctx := context.Background()
+	s, store, _, _ := newTestFriendService()
+	bus := event.NewBus()
+	s.Subscribe(bus)
+
+	req, err := s.Send(ctx, alice, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Accept(ctx, req.ID, bob); err != nil {
+		t.Fatal(err)
+	}
+	toCarol, err := s.Send(ctx, bob, carol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Send would accept the crossing request, so store the one from Carol
+	// directly, as if both were sent at the same time.
+	fromCarol, err := store.CreateRequest(ctx, carol, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unrelated, err := s.Send(ctx, alice, carol)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus.Publish(ctx, event.UserBlocked{BlockerID: bob, BlockedID: alice})
+	assertFriends(t, s, alice, bob, false)
+	assertStatus(t, store, toCarol.ID, domain.FriendRequestStatusPending)
+
+	bus.Publish(ctx, event.UserBlocked{BlockerID: carol, BlockedID: bob})
+	assertStatus(t, store, toCarol.ID, domain.FriendRequestStatusCancelled)
+	assertStatus(t, store, fromCarol.ID, domain.FriendRequestStatusCancelled)
+	assertStatus(t, store, unrelated.ID, domain.FriendRequestStatusPending)
+
+	// Blocking someone with nothing between you is not an error.
+	bus.Publish(ctx, event.UserBlocked{BlockerID: alice, BlockedID: gone})
+}
@@ -0,0 +1,635 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+var (
+	ErrGroupNotFound       = repository.ErrGroupNotFound
+	ErrGroupMemberNotFound = repository.ErrGroupMemberNotFound
+	// ErrGroupPendingNotFound means there is no join request or invite to
+	// answer.
+	ErrGroupPendingNotFound = repository.ErrGroupPendingNotFound
+	ErrGroupBanNotFound     = repository.ErrGroupBanNotFound
+	ErrGroupPostNotFound    = repository.ErrGroupPostNotFound
+	ErrInvalidGroup         = errors.New("invalid group")
+	ErrInvalidGroupPost     = errors.New("invalid group post")
+	// ErrGroupPermissionDenied means the user's role in the group does not
+	// allow the action.
+	ErrGroupPermissionDenied = errors.New("not allowed in this group")
+	ErrAlreadyGroupMember    = errors.New("already a member of the group")
+	ErrGroupInviteOnly       = errors.New("group can only be joined by invite")
+	ErrGroupBanned           = errors.New("banned from the group")
+	ErrGroupOwnerCannotLeave = errors.New("group owner cannot leave; transfer ownership first")
+)
+
+const (
+	maxGroupNameLength        = 64
+	maxGroupDescriptionLength = 512
+	maxGroupPostLength        = 5000
+)
+
+// defaultGroupSettings apply to settings a new group leaves out.
+var defaultGroupSettings = domain.GroupSettings{
+	Visibility: domain.GroupVisibilityPublic,
+	JoinPolicy: domain.GroupJoinRequest,
+	PostPolicy: domain.GroupPostMembers,
+}
+
+// GroupService manages groups, their members and posts. Every permission is
+// checked here against the actor's role in the group:
+//
+//   - members read and, unless only admins may, write posts;
+//   - admins also answer join requests, invite, kick and ban users, and edit
+//     the group;
+//   - the owner also changes roles, transfers ownership and deletes the group.
+//
+// Kicking and banning only work on users of a lower role than the actor.
+type GroupService struct {
+	repo     *repository.GroupRepository
+	userRepo *repository.UserRepository
+}
+
+func NewGroupService(repo *repository.GroupRepository, userRepo *repository.UserRepository) *GroupService {
+	return &GroupService{
+		repo:     repo,
+		userRepo: userRepo,
+	}
+}
+
+// Create creates a group owned by ownerId. Settings left empty take their
+// defaults.
+func (s *GroupService) Create(ctx context.Context, ownerId int64, g domain.Group) (domain.Group, error) {
+	g.OwnerID = ownerId
+	g.Settings = withDefaults(g.Settings, defaultGroupSettings)
+	if err := validateGroup(g); err != nil {
+		return domain.Group{}, err
+	}
+	id, err := s.repo.Create(ctx, g)
+	if err != nil {
+		return domain.Group{}, err
+	}
+	return s.repo.FindByID(ctx, id)
+}
+
+// Group returns a group and the role of viewerId in it. The name and
+// description of a group are visible to everyone.
+func (s *GroupService) Group(ctx context.Context, viewerId, id int64) (domain.Group, domain.GroupRole, error) {
+	return s.access(ctx, id, viewerId)
+}
+
+// Update changes the name, description and settings of a group. Settings
+// left empty keep their current value.
+func (s *GroupService) Update(ctx context.Context, actorId int64, g domain.Group) (domain.Group, error) {
+	cur, role, err := s.access(ctx, g.ID, actorId)
+	if err != nil {
+		return domain.Group{}, err
+	}
+	if role < domain.GroupRoleAdmin {
+		return domain.Group{}, ErrGroupPermissionDenied
+	}
+	g.Settings = withDefaults(g.Settings, cur.Settings)
+	if err = validateGroup(g); err != nil {
+		return domain.Group{}, err
+	}
+	if err = s.repo.Update(ctx, g); err != nil {
+		return domain.Group{}, err
+	}
+	return s.repo.FindByID(ctx, g.ID)
+}
+
+// Delete deletes a group with everything in it.
+func (s *GroupService) Delete(ctx context.Context, actorId, id int64) error {
+	if _, err := s.require(ctx, id, actorId, domain.GroupRoleOwner); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+// Groups returns up to limit groups of a user, most recently joined first,
+// with the user's membership of each. cursor is the membership ID of the
+// last group shown, or 0 for the start.
+func (s *GroupService) Groups(ctx context.Context, userId, cursor int64,
+	limit int) ([]domain.Group, []domain.GroupMember, error) {
+	return s.repo.FindByMember(ctx, userId, cursor, limit)
+}
+
+// Members returns up to limit members of a group who joined after the member
+// with ID cursor, in the order they joined. Only members see the members of
+// a private group.
+func (s *GroupService) Members(ctx context.Context, viewerId, groupId, cursor int64,
+	limit int) ([]domain.GroupMember, error) {
+	if err := s.canView(ctx, groupId, viewerId); err != nil {
+		return nil, err
+	}
+	ms, err := s.repo.FindMembers(ctx, groupId, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.users(ctx, len(ms), func(i int) int64 { return ms[i].User.ID })
+	if err != nil {
+		return nil, err
+	}
+	for i := range ms {
+		ms[i].User = users[ms[i].User.ID]
+	}
+	return ms, nil
+}
+
+// Join lets userId into a group. It accepts a pending invite, or else asks
+// to join, which an admin has to approve. It reports whether the user is a
+// member now.
+func (s *GroupService) Join(ctx context.Context, userId, groupId int64) (bool, error) {
+	g, role, err := s.access(ctx, groupId, userId)
+	if err != nil {
+		return false, err
+	}
+	if role != domain.GroupRoleNone {
+		return false, ErrAlreadyGroupMember
+	}
+	if err = s.checkNotBanned(ctx, groupId, userId); err != nil {
+		return false, err
+	}
+	p, err := s.repo.FindPending(ctx, groupId, userId)
+	switch {
+	case err == nil && p.Kind == domain.GroupPendingInvite:
+		return true, s.repo.AddMember(ctx, groupId, userId, domain.GroupRoleMember)
+	case err == nil:
+		// Asking again leaves the pending request as it is.
+		return false, nil
+	case !errors.Is(err, repository.ErrGroupPendingNotFound):
+		return false, err
+	}
+	if g.Settings.JoinPolicy == domain.GroupJoinInvite {
+		return false, ErrGroupInviteOnly
+	}
+	return false, s.repo.AddPending(ctx, domain.GroupPending{
+		GroupID: groupId,
+		User:    domain.User{ID: userId},
+		Kind:    domain.GroupPendingRequest,
+	})
+}
+
+// CancelRequest withdraws the join request of userId.
+func (s *GroupService) CancelRequest(ctx context.Context, userId, groupId int64) error {
+	return s.repo.RemovePending(ctx, groupId, userId, domain.GroupPendingRequest)
+}
+
+// Leave removes userId from a group. The owner has to hand the group over
+// before leaving it.
+func (s *GroupService) Leave(ctx context.Context, userId, groupId int64) error {
+	_, role, err := s.access(ctx, groupId, userId)
+	if err != nil {
+		return err
+	}
+	switch role {
+	case domain.GroupRoleNone:
+		return ErrGroupMemberNotFound
+	case domain.GroupRoleOwner:
+		return ErrGroupOwnerCannotLeave
+	}
+	return s.repo.RemoveMember(ctx, groupId, userId)
+}
+
+// Requests returns up to limit pending join requests of a group older than
+// the one with ID cursor, newest first.
+func (s *GroupService) Requests(ctx context.Context, actorId, groupId, cursor int64,
+	limit int) ([]domain.GroupPending, error) {
+	return s.pendingOfGroup(ctx, actorId, groupId, domain.GroupPendingRequest, cursor, limit)
+}
+
+// Invites returns up to limit unanswered invites of a group older than the
+// one with ID cursor, newest first.
+func (s *GroupService) Invites(ctx context.Context, actorId, groupId, cursor int64,
+	limit int) ([]domain.GroupPending, error) {
+	return s.pendingOfGroup(ctx, actorId, groupId, domain.GroupPendingInvite, cursor, limit)
+}
+
+func (s *GroupService) pendingOfGroup(ctx context.Context, actorId, groupId int64, kind domain.GroupPendingKind,
+	cursor int64, limit int) ([]domain.GroupPending, error) {
+	if _, err := s.require(ctx, groupId, actorId, domain.GroupRoleAdmin); err != nil {
+		return nil, err
+	}
+	ps, err := s.repo.FindPendingByGroup(ctx, groupId, kind, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.users(ctx, len(ps), func(i int) int64 { return ps[i].User.ID })
+	if err != nil {
+		return nil, err
+	}
+	for i := range ps {
+		ps[i].User = users[ps[i].User.ID]
+	}
+	return ps, nil
+}
+
+// Approve lets the user with a pending join request into a group.
+func (s *GroupService) Approve(ctx context.Context, actorId, groupId, userId int64) error {
+	if _, err := s.require(ctx, groupId, actorId, domain.GroupRoleAdmin); err != nil {
+		return err
+	}
+	p, err := s.repo.FindPending(ctx, groupId, userId)
+	if err != nil {
+		return err
+	}
+	if p.Kind != domain.GroupPendingRequest {
+		return ErrGroupPendingNotFound
+	}
+	return s.repo.AddMember(ctx, groupId, userId, domain.GroupRoleMember)
+}
+
+// Decline turns down a pending join request.
+func (s *GroupService) Decline(ctx context.Context, actorId, groupId, userId int64) error {
+	if _, err := s.require(ctx, groupId, actorId, domain.GroupRoleAdmin); err != nil {
+		return err
+	}
+	return s.repo.RemovePending(ctx, groupId, userId, domain.GroupPendingRequest)
+}
+
+// Invite invites userId to a group. If the user already asked to join, the
+// request is approved instead. It reports whether the user is a member now.
+func (s *GroupService) Invite(ctx context.Context, actorId, groupId, userId int64) (bool, error) {
+	if _, err := s.require(ctx, groupId, actorId, domain.GroupRoleAdmin); err != nil {
+		return false, err
+	}
+	if err := s.checkUser(ctx, userId); err != nil {
+		return false, err
+	}
+	if _, err := s.repo.FindMember(ctx, groupId, userId); err == nil {
+		return false, ErrAlreadyGroupMember
+	} else if !errors.Is(err, repository.ErrGroupMemberNotFound) {
+		return false, err
+	}
+	if err := s.checkNotBanned(ctx, groupId, userId); err != nil {
+		return false, err
+	}
+	p, err := s.repo.FindPending(ctx, groupId, userId)
+	switch {
+	case err == nil && p.Kind == domain.GroupPendingRequest:
+		return true, s.repo.AddMember(ctx, groupId, userId, domain.GroupRoleMember)
+	case err == nil:
+		return false, nil
+	case !errors.Is(err, repository.ErrGroupPendingNotFound):
+		return false, err
+	}
+	return false, s.repo.AddPending(ctx, domain.GroupPending{
+		GroupID:   groupId,
+		User:      domain.User{ID: userId},
+		Kind:      domain.GroupPendingInvite,
+		InviterID: actorId,
+	})
+}
+
+// RevokeInvite withdraws an unanswered invite.
+func (s *GroupService) RevokeInvite(ctx context.Context, actorId, groupId, userId int64) error {
+	if _, err := s.require(ctx, groupId, actorId, domain.GroupRoleAdmin); err != nil {
+		return err
+	}
+	return s.repo.RemovePending(ctx, groupId, userId, domain.GroupPendingInvite)
+}
+
+// MyInvites returns up to limit unanswered invites of userId older than the
+// one with ID cursor, newest first, with the groups they are for.
+func (s *GroupService) MyInvites(ctx context.Context, userId, cursor int64,
+	limit int) ([]domain.GroupPending, map[int64]domain.Group, error) {
+	ps, err := s.repo.FindPendingByUser(ctx, userId, domain.GroupPendingInvite, cursor, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make([]int64, 0, len(ps))
+	for _, p := range ps {
+		ids = append(ids, p.GroupID)
+	}
+	groups, err := s.repo.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ps, groups, nil
+}
+
+// AcceptInvite makes the invited userId a member of a group.
+func (s *GroupService) AcceptInvite(ctx context.Context, userId, groupId int64) error {
+	p, err := s.repo.FindPending(ctx, groupId, userId)
+	if err != nil {
+		return err
+	}
+	if p.Kind != domain.GroupPendingInvite {
+		return ErrGroupPendingNotFound
+	}
+	return s.repo.AddMember(ctx, groupId, userId, domain.GroupRoleMember)
+}
+
+// DeclineInvite turns down an invite of userId.
+func (s *GroupService) DeclineInvite(ctx context.Context, userId, groupId int64) error {
+	return s.repo.RemovePending(ctx, groupId, userId, domain.GroupPendingInvite)
+}
+
+// Kick removes a member of a lower role than the actor from a group. Kicked
+// users may join again.
+func (s *GroupService) Kick(ctx context.Context, actorId, groupId, userId int64) error {
+	role, err := s.require(ctx, groupId, actorId, domain.GroupRoleAdmin)
+	if err != nil {
+		return err
+	}
+	m, err := s.repo.FindMember(ctx, groupId, userId)
+	if err != nil {
+		return err
+	}
+	if m.Role >= role {
+		return ErrGroupPermissionDenied
+	}
+	return s.repo.RemoveMember(ctx, groupId, userId)
+}
+
+// Ban removes a user from a group and keeps them from joining again. Members
+// can only be banned by users of a higher role.
+func (s *GroupService) Ban(ctx context.Context, actorId, groupId, userId int64) error {
+	role, err := s.require(ctx, groupId, actorId, domain.GroupRoleAdmin)
+	if err != nil {
+		return err
+	}
+	if err = s.checkUser(ctx, userId); err != nil {
+		return err
+	}
+	m, err := s.repo.FindMember(ctx, groupId, userId)
+	switch {
+	case err == nil && m.Role >= role:
+		return ErrGroupPermissionDenied
+	case err != nil && !errors.Is(err, repository.ErrGroupMemberNotFound):
+		return err
+	}
+	return s.repo.Ban(ctx, groupId, userId, actorId)
+}
+
+// Unban lets a banned user join a group again.
+func (s *GroupService) Unban(ctx context.Context, actorId, groupId, userId int64) error {
+	if _, err := s.require(ctx, groupId, actorId, domain.GroupRoleAdmin); err != nil {
+		return err
+	}
+	return s.repo.Unban(ctx, groupId, userId)
+}
+
+// Bans returns up to limit bans of a group older than the one with ID
+// cursor, newest first.
+func (s *GroupService) Bans(ctx context.Context, actorId, groupId, cursor int64, limit int) ([]domain.GroupBan, error) {
+	if _, err := s.require(ctx, groupId, actorId, domain.GroupRoleAdmin); err != nil {
+		return nil, err
+	}
+	bs, err := s.repo.FindBans(ctx, groupId, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.users(ctx, len(bs), func(i int) int64 { return bs[i].User.ID })
+	if err != nil {
+		return nil, err
+	}
+	for i := range bs {
+		bs[i].User = users[bs[i].User.ID]
+	}
+	return bs, nil
+}
+
+// SetRole makes a member an admin or a plain member again.
+func (s *GroupService) SetRole(ctx context.Context, actorId, groupId, userId int64, role domain.GroupRole) error {
+	if role != domain.GroupRoleMember && role != domain.GroupRoleAdmin {
+		return fmt.Errorf("%w: role must be member or admin", ErrInvalidGroup)
+	}
+	if _, err := s.require(ctx, groupId, actorId, domain.GroupRoleOwner); err != nil {
+		return err
+	}
+	m, err := s.repo.FindMember(ctx, groupId, userId)
+	if err != nil {
+		return err
+	}
+	if m.Role == domain.GroupRoleOwner {
+		return ErrGroupPermissionDenied
+	}
+	if m.Role == role {
+		return nil
+	}
+	return s.repo.UpdateRole(ctx, groupId, userId, m.Role, role)
+}
+
+// TransferOwnership hands a group over to one of its members. The previous
+// owner stays on as an admin.
+func (s *GroupService) TransferOwnership(ctx context.Context, actorId, groupId, userId int64) error {
+	if actorId == userId {
+		return nil
+	}
+	if _, err := s.require(ctx, groupId, actorId, domain.GroupRoleOwner); err != nil {
+		return err
+	}
+	if _, err := s.repo.FindMember(ctx, groupId, userId); err != nil {
+		return err
+	}
+	return s.repo.TransferOwnership(ctx, groupId, actorId, userId)
+}
+
+// Post writes a post in a group and returns it.
+func (s *GroupService) Post(ctx context.Context, authorId, groupId int64, content string) (domain.GroupPost, error) {
+	if err := validateGroupPost(content); err != nil {
+		return domain.GroupPost{}, err
+	}
+	g, role, err := s.access(ctx, groupId, authorId)
+	if err != nil {
+		return domain.GroupPost{}, err
+	}
+	minRole := domain.GroupRoleMember
+	if g.Settings.PostPolicy == domain.GroupPostAdmins {
+		minRole = domain.GroupRoleAdmin
+	}
+	if role < minRole {
+		return domain.GroupPost{}, ErrGroupPermissionDenied
+	}
+	p, err := s.repo.AddPost(ctx, domain.GroupPost{
+		GroupID: groupId,
+		Author:  domain.User{ID: authorId},
+		Content: content,
+	})
+	if err != nil {
+		return domain.GroupPost{}, err
+	}
+	users, err := s.users(ctx, 1, func(int) int64 { return authorId })
+	if err != nil {
+		return domain.GroupPost{}, err
+	}
+	p.Author = users[authorId]
+	return p, nil
+}
+
+// Posts returns up to limit posts of a group older than before, newest
+// first. before is 0 for the newest posts. Only members see the posts of a
+// private group.
+func (s *GroupService) Posts(ctx context.Context, viewerId, groupId, before int64, limit int) ([]domain.GroupPost, error) {
+	if err := s.canView(ctx, groupId, viewerId); err != nil {
+		return nil, err
+	}
+	ps, err := s.repo.FindPosts(ctx, groupId, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.users(ctx, len(ps), func(i int) int64 { return ps[i].Author.ID })
+	if err != nil {
+		return nil, err
+	}
+	for i := range ps {
+		ps[i].Author = users[ps[i].Author.ID]
+	}
+	return ps, nil
+}
+
+// DeletePost deletes a post of a group. Authors delete their own posts;
+// admins delete any.
+func (s *GroupService) DeletePost(ctx context.Context, actorId, groupId, postId int64) error {
+	p, err := s.repo.FindPost(ctx, postId)
+	if err != nil {
+		return err
+	}
+	if p.GroupID != groupId {
+		return ErrGroupPostNotFound
+	}
+	_, role, err := s.access(ctx, groupId, actorId)
+	if err != nil {
+		return err
+	}
+	if p.Author.ID != actorId && role < domain.GroupRoleAdmin {
+		return ErrGroupPermissionDenied
+	}
+	return s.repo.DeletePost(ctx, postId)
+}
+
+// access returns a group and the role of userId in it, which is
+// GroupRoleNone for non-members.
+func (s *GroupService) access(ctx context.Context, groupId, userId int64) (domain.Group, domain.GroupRole, error) {
+	g, err := s.repo.FindByID(ctx, groupId)
+	if err != nil {
+		return domain.Group{}, domain.GroupRoleNone, err
+	}
+	m, err := s.repo.FindMember(ctx, groupId, userId)
+	switch {
+	case errors.Is(err, repository.ErrGroupMemberNotFound):
+		return g, domain.GroupRoleNone, nil
+	case err != nil:
+		return domain.Group{}, domain.GroupRoleNone, err
+	}
+	return g, m.Role, nil
+}
+
+// require returns the role of userId in a group, or ErrGroupPermissionDenied
+// if it is below min.
+func (s *GroupService) require(ctx context.Context, groupId, userId int64, min domain.GroupRole) (domain.GroupRole, error) {
+	_, role, err := s.access(ctx, groupId, userId)
+	if err != nil {
+		return domain.GroupRoleNone, err
+	}
+	if role < min {
+		return domain.GroupRoleNone, ErrGroupPermissionDenied
+	}
+	return role, nil
+}
+
+// canView reports whether viewerId may see the members and posts of a group.
+func (s *GroupService) canView(ctx context.Context, groupId, viewerId int64) error {
+	g, role, err := s.access(ctx, groupId, viewerId)
+	if err != nil {
+		return err
+	}
+	if g.Settings.Visibility == domain.GroupVisibilityPrivate && role == domain.GroupRoleNone {
+		return ErrGroupPermissionDenied
+	}
+	return nil
+}
+
+func (s *GroupService) checkNotBanned(ctx context.Context, groupId, userId int64) error {
+	banned, err := s.repo.IsBanned(ctx, groupId, userId)
+	if err != nil {
+		return err
+	}
+	if banned {
+		return ErrGroupBanned
+	}
+	return nil
+}
+
+// checkUser checks that a user invited or banned by an admin exists.
+func (s *GroupService) checkUser(ctx context.Context, userId int64) error {
+	u, err := s.userRepo.FindByID(ctx, userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if u.Deactivated || u.Guest {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// users loads the n users whose IDs id returns.
+func (s *GroupService) users(ctx context.Context, n int, id func(i int) int64) (map[int64]domain.User, error) {
+	ids := make([]int64, 0, n)
+	for i := range n {
+		ids = append(ids, id(i))
+	}
+	users, err := s.userRepo.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	// Users who are gone keep their ID.
+	for _, uid := range ids {
+		if _, ok := users[uid]; !ok {
+			users[uid] = domain.User{ID: uid}
+		}
+	}
+	return users, nil
+}
+
+// withDefaults fills the settings left empty in s from def.
+func withDefaults(s, def domain.GroupSettings) domain.GroupSettings {
+	if s.Visibility == "" {
+		s.Visibility = def.Visibility
+	}
+	if s.JoinPolicy == "" {
+		s.JoinPolicy = def.JoinPolicy
+	}
+	if s.PostPolicy == "" {
+		s.PostPolicy = def.PostPolicy
+	}
+	return s
+}
+
+func validateGroup(g domain.Group) error {
+	name := strings.TrimSpace(g.Name)
+	if name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidGroup)
+	}
+	if utf8.RuneCountInString(name) > maxGroupNameLength {
+		return fmt.Errorf("%w: name must be at most %d characters", ErrInvalidGroup, maxGroupNameLength)
+	}
+	if utf8.RuneCountInString(g.Description) > maxGroupDescriptionLength {
+		return fmt.Errorf("%w: description must be at most %d characters", ErrInvalidGroup, maxGroupDescriptionLength)
+	}
+	if !g.Settings.Valid() {
+		return fmt.Errorf("%w: unknown settings", ErrInvalidGroup)
+	}
+	return nil
+}
+
+func validateGroupPost(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return fmt.Errorf("%w: content is required", ErrInvalidGroupPost)
+	}
+	if utf8.RuneCountInString(content) > maxGroupPostLength {
+		return fmt.Errorf("%w: content must be at most %d characters", ErrInvalidGroupPost, maxGroupPostLength)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/event"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+var (
+	ErrInvalidHandle     = errors.New("invalid handle")
+	ErrReservedHandle    = errors.New("handle is reserved")
+	ErrHandleClaimed     = errors.New("user already has a handle")
+	ErrNoHandle          = errors.New("user has no handle yet")
+	ErrHandleCooldown    = errors.New("handle was changed too recently")
+	ErrHandleUnavailable = errors.New("handle is not available")
+)
+
+const (
+	// handleChangeCooldown is how long a user must wait between handle changes.
+	handleChangeCooldown = 30 * 24 * time.Hour
+	// releasedHandleHold is how long a released handle keeps redirecting to
+	// its previous owner before someone else may claim it.
+	releasedHandleHold = 90 * 24 * time.Hour
+)
+
+// handlePattern allows 3-20 letters, digits and underscores.
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,20}$`)
+
+// reservedHandles are names that could be mistaken for the site itself or
+// collide with routes.
+var reservedHandles = map[string]struct{}{
+	"admin": {}, "administrator": {}, "root": {}, "system": {}, "support": {},
+	"help": {}, "about": {}, "api": {}, "oauth": {}, "oauth2": {}, "scim": {},
+	"user": {}, "users": {}, "u": {}, "me": {}, "settings": {}, "login": {},
+	"logout": {}, "signup": {}, "guest": {}, "policies": {}, "terms": {},
+	"privacy": {}, "security": {}, "official": {}, "staff": {}, "moderator": {},
+	"connectify": {}, "null": {}, "undefined": {},
+}
+
+// ValidateHandle checks the format and reserved words. It does not check
+// whether the handle is taken.
+func ValidateHandle(handle string) error {
+	if !handlePattern.MatchString(handle) {
+		return ErrInvalidHandle
+	}
+	// All-digit handles would be confused with user IDs.
+	if strings.Trim(handle, "0123456789") == "" {
+		return ErrInvalidHandle
+	}
+	if _, ok := reservedHandles[strings.ToLower(handle)]; ok {
+		return ErrReservedHandle
+	}
+	return nil
+}
+
+// ClaimHandle gives a user without a handle their first one.
+func (s *UserService) ClaimHandle(ctx context.Context, uid int64, handle string) (domain.User, error) {
+	user, err := s.Profile(ctx, uid)
+	if err != nil {
+		return domain.User{}, err
+	}
+	if user.Handle != "" {
+		return domain.User{}, ErrHandleClaimed
+	}
+	return s.setHandle(ctx, user, handle)
+}
+
+// ChangeHandle replaces the user's handle. Users may change it once per
+// cooldown; the old handle keeps redirecting to them.
+func (s *UserService) ChangeHandle(ctx context.Context, uid int64, handle string) (domain.User, error) {
+	user, err := s.Profile(ctx, uid)
+	if err != nil {
+		return domain.User{}, err
+	}
+	if user.Handle == "" {
+		return domain.User{}, ErrNoHandle
+	}
+	if user.Handle == handle {
+		return user, nil
+	}
+	// Fixing the case of one's own handle is always allowed and does not
+	// restart the cooldown.
+	if !strings.EqualFold(user.Handle, handle) && time.Since(user.HandleChangedAt) < handleChangeCooldown {
+		return domain.User{}, ErrHandleCooldown
+	}
+	updated, err := s.setHandle(ctx, user, handle)
+	if err != nil {
+		return domain.User{}, err
+	}
+	s.events.Publish(ctx, event.HandleChanged{UserID: uid, OldHandle: user.Handle, NewHandle: updated.Handle})
+	return updated, nil
+}
+
+// HandleChangeAllowedAt returns when the user may next change their handle.
+func (s *UserService) HandleChangeAllowedAt(user domain.User) time.Time {
+	if user.HandleChangedAt.IsZero() {
+		return time.Time{}
+	}
+	return user.HandleChangedAt.Add(handleChangeCooldown)
+}
+
+func (s *UserService) setHandle(ctx context.Context, user domain.User, handle string) (domain.User, error) {
+	if err := ValidateHandle(handle); err != nil {
+		return domain.User{}, err
+	}
+	err := s.repo.ChangeHandle(ctx, user.ID, handle, user.HandleChangedAt, time.Now().Add(-releasedHandleHold))
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrDuplicateHandle):
+			return domain.User{}, ErrHandleUnavailable
+		case errors.Is(err, repository.ErrUserNotFound):
+			// The handle was changed concurrently, which starts a new cooldown.
+			return domain.User{}, ErrHandleCooldown
+		}
+		return domain.User{}, err
+	}
+	return s.Profile(ctx, user.ID)
+}
+
+// FindByHandle returns the public owner of handle. For a handle the owner has
+// moved away from, it returns the owner with their current handle, so callers
+// can redirect. Guests and deactivated users are not found.
+func (s *UserService) FindByHandle(ctx context.Context, handle string) (domain.User, error) {
+	user, err := s.repo.FindByHandle(ctx, handle)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		var uid int64
+		uid, err = s.repo.FindPreviousHandleOwner(ctx, handle)
+		if err == nil {
+			user, err = s.repo.FindByID(ctx, uid)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return domain.User{}, ErrUserNotFound
+		}
+		return domain.User{}, err
+	}
+	if user.Guest || user.Deactivated || user.Handle == "" {
+		return domain.User{}, ErrUserNotFound
+	}
+	return user, nil
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository"
+	"github.com/redis/go-redis/v9"
+)
+
+// HotCache stores the latest trending list.
+type HotCache interface {
+	Set(ctx context.Context, arts []domain.HotArticle) error
+	// Get returns the stored list, which is empty before the first Set.
+	Get(ctx context.Context) ([]domain.HotArticle, error)
+}
+
+// RedisHotCache shares the list between all server instances, so it only
+// has to be computed by one of them.
+type RedisHotCache struct {
+	client redis.Cmdable
+	ttl    time.Duration
+}
+
+// NewRedisHotCache keeps a list for ttl, so that an outdated list does not
+// outlive the instances computing it.
+func NewRedisHotCache(client redis.Cmdable, ttl time.Duration) *RedisHotCache {
+	return &RedisHotCache{client: client, ttl: ttl}
+}
+
+const hotCacheKey = "article:hot"
+
+func (c *RedisHotCache) Set(ctx context.Context, arts []domain.HotArticle) error {
+	val, err := json.Marshal(arts)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, hotCacheKey, val, c.ttl).Err()
+}
+
+func (c *RedisHotCache) Get(ctx context.Context) ([]domain.HotArticle, error) {
+	val, err := c.client.Get(ctx, hotCacheKey).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var arts []domain.HotArticle
+	err = json.Unmarshal(val, &arts)
+	return arts, err
+}
+
+// LocalHotCache keeps the list in memory.
+type LocalHotCache struct {
+	mu   sync.RWMutex
+	arts []domain.HotArticle
+}
+
+func NewLocalHotCache() *LocalHotCache {
+	return &LocalHotCache{}
+}
+
+func (c *LocalHotCache) Set(_ context.Context, arts []domain.HotArticle) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.arts = arts
+	return nil
+}
+
+func (c *LocalHotCache) Get(_ context.Context) ([]domain.HotArticle, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.arts, nil
+}
+
+type HotConfig struct {
+	// Window limits the ranking to articles first published this recently.
+	Window time.Duration
+	// TopN is how many articles the list keeps.
+	TopN int
+	// Batch is how many articles are scored at once.
+	Batch int
+	// The weights of a like, a visible comment and a view.
+	LikeWeight    float64
+	CommentWeight float64
+	ViewWeight    float64
+	// Gravity is how fast scores decay with age; higher values favour newer
+	// articles.
+	Gravity float64
+	// LockTTL is how long the ranking lock outlives a computation that
+	// stopped extending it, e.g. because its instance crashed.
+	LockTTL time.Duration
+}
+
+// HotService ranks recently published articles by how much readers engage
+// with them, decayed by age:
+//
+//	score = (likes*LikeWeight + comments*CommentWeight + views*ViewWeight) / (ageHours+2)^Gravity
+//
+// The ranking is computed periodically by one instance at a time and read
+// from the cache. Each instance also keeps the last list it saw in memory and
+// serves it while the cache is unavailable or empty.
+type HotService struct {
+	articleRepo     *repository.ArticleRepository
+	interactionRepo *repository.InteractionRepository
+	commentRepo     *repository.CommentRepository
+	userRepo        *repository.UserRepository
+	cache           HotCache
+	local           *LocalHotCache
+	locker          Locker
+	cfg             HotConfig
+}
+
+func NewHotService(articleRepo *repository.ArticleRepository, interactionRepo *repository.InteractionRepository,
+	commentRepo *repository.CommentRepository, userRepo *repository.UserRepository,
+	cache HotCache, locker Locker, cfg HotConfig) *HotService {
+	cfg.Batch = max(cfg.Batch, 1)
+	return &HotService{
+		articleRepo:     articleRepo,
+		interactionRepo: interactionRepo,
+		commentRepo:     commentRepo,
+		userRepo:        userRepo,
+		cache:           cache,
+		local:           NewLocalHotCache(),
+		locker:          locker,
+		cfg:             cfg,
+	}
+}
+
+// Refresh computes the ranking and stores it, unless another instance is
+// already computing it. It reports whether it did.
+func (s *HotService) Refresh(ctx context.Context, now time.Time) (bool, error) {
+	lease, ok, err := s.locker.TryLock(ctx, "article:hot", s.cfg.LockTTL)
+	if err != nil || !ok {
+		return false, err
+	}
+	defer func() {
+		if err := lease.Release(context.WithoutCancel(ctx)); err != nil {
+			log.Printf("release hot ranking lock: %v", err)
+		}
+	}()
+	// Ranking may take longer than the lease. Keep extending it, and stop
+	// ranking once it is lost to another instance.
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go s.keepLease(ctx, lease, cancel)
+
+	arts, err := s.rank(ctx, now)
+	if err != nil {
+		if cause := context.Cause(ctx); cause != nil {
+			err = cause
+		}
+		return false, err
+	}
+	// Another instance may have taken over while ranking finished; its list
+	// is at least as fresh as ours.
+	if err = lease.Extend(ctx, s.cfg.LockTTL); err != nil {
+		return false, err
+	}
+	_ = s.local.Set(ctx, arts)
+	return true, s.cache.Set(ctx, arts)
+}
+
+// keepLease extends lease every third of LockTTL until ctx is done. When an
+// extension fails, it cancels ctx with the error.
+func (s *HotService) keepLease(ctx context.Context, lease Lease, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(s.cfg.LockTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := lease.Extend(ctx, s.cfg.LockTTL); err != nil {
+				if ctx.Err() == nil {
+					cancel(err)
+				}
+				return
+			}
+		}
+	}
+}
+
+func (s *HotService) rank(ctx context.Context, now time.Time) ([]domain.HotArticle, error) {
+	top := make([]domain.HotArticle, 0, s.cfg.TopN+s.cfg.Batch)
+	var cursor int64
+	for {
+		arts, err := s.articleRepo.FindPublishedSince(ctx, now.Add(-s.cfg.Window), cursor, s.cfg.Batch)
+		if err != nil {
+			return nil, err
+		}
+		if len(arts) == 0 {
+			break
+		}
+		ids := make([]int64, 0, len(arts))
+		for _, art := range arts {
+			ids = append(ids, art.ID)
+		}
+		ins, err := s.interactionRepo.Find(ctx, 0, ids)
+		if err != nil {
+			return nil, err
+		}
+		comments, err := s.commentRepo.CountVisible(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, art := range arts {
+			top = append(top, domain.HotArticle{
+				ArticleID: art.ID,
+				Score:     s.score(ins[art.ID], comments[art.ID], now.Sub(art.Ctime)),
+			})
+		}
+		// Only the best TopN so far can make the list.
+		slices.SortFunc(top, func(a, b domain.HotArticle) int {
+			// Newer articles first on a tie.
+			return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(b.ArticleID, a.ArticleID))
+		})
+		top = top[:min(len(top), s.cfg.TopN)]
+		if len(arts) < s.cfg.Batch {
+			break
+		}
+		cursor = arts[len(arts)-1].ID
+	}
+	return top, nil
+}
+
+func (s *HotService) score(in domain.Interaction, comments int64, age time.Duration) float64 {
+	engagement := float64(in.Likes)*s.cfg.LikeWeight +
+		float64(comments)*s.cfg.CommentWeight +
+		float64(in.Views)*s.cfg.ViewWeight
+	return engagement / math.Pow(max(age.Hours(), 0)+2, s.cfg.Gravity)
+}
+
+// Hot returns up to limit trending articles, best first. Articles taken down
+// since the ranking was computed are left out.
+func (s *HotService) Hot(ctx context.Context, limit int) ([]domain.Article, error) {
+	ranked, err := s.cache.Get(ctx)
+	if err != nil {
+		log.Printf("read hot articles from cache, serving local copy: %v", err)
+	}
+	if len(ranked) > 0 {
+		_ = s.local.Set(ctx, ranked)
+	} else {
+		ranked, _ = s.local.Get(ctx)
+	}
+
+	ids := make([]int64, 0, len(ranked))
+	for _, h := range ranked {
+		ids = append(ids, h.ArticleID)
+	}
+	arts, err := s.articleRepo.FindPublishedByIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Article, 0, min(len(ranked), limit))
+	for _, h := range ranked {
+		if len(res) == limit {
+			break
+		}
+		if art, ok := arts[h.ArticleID]; ok {
+			res = append(res, art)
+		}
+	}
+	return withArticleAuthors(ctx, s.userRepo, res)
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/event"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+// InteractionService handles likes, bookmarks and views of published
+// articles.
+type InteractionService struct {
+	repo        *repository.InteractionRepository
+	articleRepo *repository.ArticleRepository
+	views       *ViewAggregator
+	events      event.Publisher
+}
+
+func NewInteractionService(repo *repository.InteractionRepository, articleRepo *repository.ArticleRepository,
+	views *ViewAggregator, events event.Publisher) *InteractionService {
+	return &InteractionService{
+		repo:        repo,
+		articleRepo: articleRepo,
+		views:       views,
+		events:      events,
+	}
+}
+
+// Like likes a published article. Liking it again changes nothing.
+func (s *InteractionService) Like(ctx context.Context, userId, articleId int64) error {
+	art, err := s.published(ctx, articleId)
+	if err != nil {
+		return err
+	}
+	created, err := s.repo.Like(ctx, userId, articleId)
+	if err != nil {
+		return err
+	}
+	if created {
+		s.events.Publish(ctx, event.ArticleLiked{ArticleID: articleId, AuthorID: art.Author.ID, UserID: userId})
+	}
+	return nil
+}
+
+// Unlike takes a like back. It also works after the article was taken down.
+func (s *InteractionService) Unlike(ctx context.Context, userId, articleId int64) error {
+	_, err := s.repo.Unlike(ctx, userId, articleId)
+	return err
+}
+
+func (s *InteractionService) Bookmark(ctx context.Context, userId, articleId int64) error {
+	if _, err := s.published(ctx, articleId); err != nil {
+		return err
+	}
+	_, err := s.repo.Bookmark(ctx, userId, articleId)
+	return err
+}
+
+func (s *InteractionService) Unbookmark(ctx context.Context, userId, articleId int64) error {
+	_, err := s.repo.Unbookmark(ctx, userId, articleId)
+	return err
+}
+
+// View counts one read of an article by viewer. Views are buffered, so the
+// counters catch up within a flush interval.
+func (s *InteractionService) View(ctx context.Context, articleId int64, viewer string) {
+	s.views.Record(ctx, articleId, viewer)
+}
+
+// Interactions returns the counters of the given articles and what userId did
+// with them, keyed by article ID. userId is 0 for anonymous readers.
+func (s *InteractionService) Interactions(ctx context.Context, userId int64, articleIds []int64) (map[int64]domain.Interaction, error) {
+	return s.repo.Find(ctx, userId, articleIds)
+}
+
+func (s *InteractionService) published(ctx context.Context, articleId int64) (domain.Article, error) {
+	art, err := s.articleRepo.FindPublishedById(ctx, articleId)
+	if err != nil {
+		return domain.Article{}, err
+	}
+	if art.Status != domain.ArticleStatusPublished {
+		return domain.Article{}, ErrArticleNotFound
+	}
+	return art, nil
+}
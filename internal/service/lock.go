@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrLockLost = errors.New("lock lost")
+
+// Locker grants exclusive leases on named resources. A lease expires after
+// its TTL even if it is never released, so a crashed holder cannot block
+// everybody else forever.
+type Locker interface {
+	// TryLock takes the lease on key without waiting. It returns false when
+	// someone else holds it.
+	TryLock(ctx context.Context, key string, ttl time.Duration) (lease Lease, ok bool, err error)
+}
+
+// Lease is a lock held through a Locker.
+type Lease interface {
+	// Extend makes the lease last ttl from now. It returns ErrLockLost if the
+	// lease already expired, since someone else may hold the key by then.
+	Extend(ctx context.Context, ttl time.Duration) error
+	// Release gives the lease up. Releasing an expired lease does nothing.
+	Release(ctx context.Context) error
+}
+
+// RedisLocker shares leases between all server instances.
+type RedisLocker struct {
+	client redis.Cmdable
+}
+
+func NewRedisLocker(client redis.Cmdable) *RedisLocker {
+	return &RedisLocker{client: client}
+}
+
+func (l *RedisLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (Lease, bool, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, false, err
+	}
+	lease := &redisLease{client: l.client, key: "lock:" + key, token: hex.EncodeToString(b[:])}
+	ok, err := l.client.SetNX(ctx, lease.key, lease.token, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return lease, true, nil
+}
+
+type redisLease struct {
+	client redis.Cmdable
+	key    string
+	token  string
+}
+
+// extendScript and unlockScript only touch a lease that is still ours: once
+// it expired, another instance may hold the key.
+var (
+	extendScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+	unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+)
+
+func (l *redisLease) Extend(ctx context.Context, ttl time.Duration) error {
+	n, err := extendScript.Run(ctx, l.client, []string{l.key}, l.token, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (l *redisLease) Release(ctx context.Context) error {
+	return unlockScript.Run(ctx, l.client, []string{l.key}, l.token).Err()
+}
+
+// LocalLocker grants leases within this process only, so every instance
+// holds its own lease on the same key and does the guarded work itself.
+type LocalLocker struct {
+	mu     sync.Mutex
+	leases map[string]*localLease
+}
+
+type localLease struct {
+	locker  *LocalLocker
+	key     string
+	expires time.Time
+}
+
+func NewLocalLocker() *LocalLocker {
+	return &LocalLocker{leases: make(map[string]*localLease)}
+}
+
+func (l *LocalLocker) TryLock(_ context.Context, key string, ttl time.Duration) (Lease, bool, error) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if lease, ok := l.leases[key]; ok && now.Before(lease.expires) {
+		return nil, false, nil
+	}
+	lease := &localLease{locker: l, key: key, expires: now.Add(ttl)}
+	l.leases[key] = lease
+	return lease, true, nil
+}
+
+func (l *localLease) Extend(_ context.Context, ttl time.Duration) error {
+	now := time.Now()
+	l.locker.mu.Lock()
+	defer l.locker.mu.Unlock()
+	// Like in Redis, an expired lease may have been taken over since.
+	if l.locker.leases[l.key] != l || !now.Before(l.expires) {
+		return ErrLockLost
+	}
+	l.expires = now.Add(ttl)
+	return nil
+}
+
+func (l *localLease) Release(context.Context) error {
+	l.locker.mu.Lock()
+	defer l.locker.mu.Unlock()
+	if l.locker.leases[l.key] == l {
+		delete(l.locker.leases, l.key)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLocalLockerExtend(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocalLocker()
+
+	lease, ok, err := l.TryLock(ctx, "job", time.Hour)
+	if err != nil || !ok {
+		t.Fatalf("TryLock = %v, %v, want the lease", ok, err)
+	}
+	if err = lease.Extend(ctx, time.Hour); err != nil {
+		t.Fatalf("Extend(held) = %v", err)
+	}
+	if _, ok, _ = l.TryLock(ctx, "job", time.Hour); ok {
+		t.Fatal("TryLock succeeded while the lease was held")
+	}
+
+	// Once the lease expired and was taken over, it can no longer be
+	// extended and releasing it leaves the new holder alone.
+	if err = lease.Extend(ctx, 0); err != nil {
+		t.Fatalf("Extend(held) = %v", err)
+	}
+	other, ok, _ := l.TryLock(ctx, "job", time.Hour)
+	if !ok {
+		t.Fatal("TryLock failed after the lease expired")
+	}
+	if err = lease.Extend(ctx, time.Hour); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("Extend(lost) = %v, want ErrLockLost", err)
+	}
+	_ = lease.Release(ctx)
+	if err = other.Extend(ctx, time.Hour); err != nil {
+		t.Fatalf("Extend(new holder) = %v", err)
+	}
+}
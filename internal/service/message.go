@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/event"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+var (
+	ErrConversationNotFound = repository.ErrConversationNotFound
+	ErrInvalidMessage       = errors.New("invalid message")
+	ErrCannotMessageSelf    = errors.New("cannot message yourself")
+	// ErrMessageNotAllowed means the recipient's privacy settings do not let
+	// the sender message them.
+	ErrMessageNotAllowed = errors.New("recipient does not accept messages from you")
+)
+
+const maxMessageLength = 2000
+
+// MessageService manages private conversations between two users.
+//
+// Users may message whoever their privacy settings allow. Once the peer has
+// sent a message in a conversation, they can always be answered there, even
+// if their own settings would not allow starting it, unless one of them
+// blocked the other.
+type MessageService struct {
+	repo     *repository.MessageRepository
+	userRepo *repository.UserRepository
+	privacy  *PrivacyService
+	blocks   *BlockService
+	events   event.Publisher
+}
+
+func NewMessageService(repo *repository.MessageRepository, userRepo *repository.UserRepository,
+	privacy *PrivacyService, blocks *BlockService, events event.Publisher) *MessageService {
+	return &MessageService{
+		repo:     repo,
+		userRepo: userRepo,
+		privacy:  privacy,
+		blocks:   blocks,
+		events:   events,
+	}
+}
+
+// Open returns the conversation of userId with peerId, starting it if there
+// is none yet.
+func (s *MessageService) Open(ctx context.Context, userId, peerId int64) (domain.Conversation, error) {
+	if userId == peerId {
+		return domain.Conversation{}, ErrCannotMessageSelf
+	}
+	peer, err := s.peer(ctx, peerId)
+	if err != nil {
+		return domain.Conversation{}, err
+	}
+	id, err := s.repo.FindConversationID(ctx, userId, peerId)
+	switch {
+	case errors.Is(err, repository.ErrConversationNotFound):
+		// Only users who may send the first message can start one.
+		if err = s.checkAllowed(ctx, userId, peer, domain.Conversation{}); err != nil {
+			return domain.Conversation{}, err
+		}
+		id, err = s.repo.CreateConversation(ctx, userId, peerId)
+		if err != nil {
+			return domain.Conversation{}, err
+		}
+	case err != nil:
+		return domain.Conversation{}, err
+	}
+	return s.Conversation(ctx, userId, id)
+}
+
+// Conversation returns a conversation of userId.
+func (s *MessageService) Conversation(ctx context.Context, userId, id int64) (domain.Conversation, error) {
+	c, err := s.repo.FindConversation(ctx, id, userId)
+	if err != nil {
+		return domain.Conversation{}, err
+	}
+	cs := []domain.Conversation{c}
+	if err = s.fillPeers(ctx, cs); err != nil {
+		return domain.Conversation{}, err
+	}
+	return cs[0], nil
+}
+
+// Conversations returns up to limit conversations of a user after cursor,
+// most recently active first, and the cursor of the next page, which is zero
+// on the last page. Conversations without messages are left out.
+func (s *MessageService) Conversations(ctx context.Context, userId int64, cursor domain.ConversationCursor,
+	limit int) ([]domain.Conversation, domain.ConversationCursor, error) {
+	cs, err := s.repo.FindConversations(ctx, userId, cursor, limit)
+	if err != nil {
+		return nil, domain.ConversationCursor{}, err
+	}
+	if err = s.fillPeers(ctx, cs); err != nil {
+		return nil, domain.ConversationCursor{}, err
+	}
+	var next domain.ConversationCursor
+	if len(cs) == limit {
+		last := cs[len(cs)-1]
+		next = domain.ConversationCursor{Utime: last.Utime, ID: last.ID}
+	}
+	return cs, next, nil
+}
+
+func (s *MessageService) fillPeers(ctx context.Context, cs []domain.Conversation) error {
+	ids := make([]int64, 0, len(cs))
+	for _, c := range cs {
+		ids = append(ids, c.Peer.ID)
+	}
+	users, err := s.userRepo.FindByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range cs {
+		if u, ok := users[cs[i].Peer.ID]; ok {
+			cs[i].Peer = u
+		}
+	}
+	return nil
+}
+
+// Send sends a message in a conversation of senderId and returns it.
+func (s *MessageService) Send(ctx context.Context, senderId, conversationId int64, content string) (domain.Message, error) {
+	if err := validateMessage(content); err != nil {
+		return domain.Message{}, err
+	}
+	c, err := s.repo.FindConversation(ctx, conversationId, senderId)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	peer, err := s.peer(ctx, c.Peer.ID)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	if err = s.checkAllowed(ctx, senderId, peer, c); err != nil {
+		return domain.Message{}, err
+	}
+
+	msg, err := s.repo.AddMessage(ctx, c.ID, senderId, peer.ID, content)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	s.events.Publish(ctx, event.MessageSent{
+		MessageID:      msg.ID,
+		ConversationID: c.ID,
+		SenderID:       senderId,
+		RecipientID:    peer.ID,
+	})
+	return msg, nil
+}
+
+// checkAllowed reports whether senderId may message peer in c, which is the
+// zero value for a conversation that does not exist yet.
+func (s *MessageService) checkAllowed(ctx context.Context, senderId int64, peer domain.User, c domain.Conversation) error {
+	// Blocks end even conversations the peer started.
+	if err := s.blocks.Check(ctx, senderId, peer.ID); err != nil {
+		return err
+	}
+	if c.PeerSent {
+		return nil
+	}
+	ok, err := s.privacy.CanMessage(ctx, senderId, peer)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrMessageNotAllowed
+	}
+	return nil
+}
+
+// peer returns the other user of a conversation, who must still be around.
+func (s *MessageService) peer(ctx context.Context, id int64) (domain.User, error) {
+	u, err := s.userRepo.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return domain.User{}, ErrUserNotFound
+		}
+		return domain.User{}, err
+	}
+	if u.Deactivated || u.Guest {
+		return domain.User{}, ErrUserNotFound
+	}
+	return u, nil
+}
+
+// History returns up to limit messages of a conversation of userId older
+// than before, newest first. before is 0 for the newest messages.
+func (s *MessageService) History(ctx context.Context, userId, conversationId, before int64, limit int) ([]domain.Message, error) {
+	if _, err := s.repo.FindConversation(ctx, conversationId, userId); err != nil {
+		return nil, err
+	}
+	return s.repo.FindMessages(ctx, conversationId, before, limit)
+}
+
+// MarkRead marks the messages of a conversation up to messageId read by
+// userId, which the peer sees as a read receipt. Read cursors only move
+// forward.
+func (s *MessageService) MarkRead(ctx context.Context, userId, conversationId, messageId int64) error {
+	c, err := s.repo.FindConversation(ctx, conversationId, userId)
+	if err != nil {
+		return err
+	}
+	// Clients cannot read past the newest message.
+	upTo := min(messageId, c.LastMessage.ID)
+	if upTo <= c.LastReadID {
+		return nil
+	}
+	moved, err := s.repo.MarkRead(ctx, c.ID, userId, c.Peer.ID, upTo)
+	if err != nil || !moved {
+		return err
+	}
+	s.events.Publish(ctx, event.MessagesRead{
+		ConversationID: c.ID,
+		ReaderID:       userId,
+		PeerID:         c.Peer.ID,
+		MessageID:      upTo,
+	})
+	return nil
+}
+
+// UnreadCount counts the unread messages of a user across all conversations.
+func (s *MessageService) UnreadCount(ctx context.Context, userId int64) (int64, error) {
+	return s.repo.CountUnread(ctx, userId)
+}
+
+func validateMessage(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return fmt.Errorf("%w: content is required", ErrInvalidMessage)
+	}
+	if utf8.RuneCountInString(content) > maxMessageLength {
+		return fmt.Errorf("%w: content must be at most %d characters", ErrInvalidMessage, maxMessageLength)
+	}
+	return nil
+}
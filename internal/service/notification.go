@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/event"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+// notificationActors is how many of the most recent actors are shown per
+// notification, e.g. "Alice, Bob and 3 others liked your post".
+const notificationActors = 3
+
+// NotificationService keeps the notification inboxes. It only learns about
+// what happened from events; the features producing them do not know it.
+type NotificationService struct {
+	repo     *repository.NotificationRepository
+	userRepo *repository.UserRepository
+	events   event.Publisher
+}
+
+func NewNotificationService(repo *repository.NotificationRepository, userRepo *repository.UserRepository,
+	events event.Publisher) *NotificationService {
+	return &NotificationService{
+		repo:     repo,
+		userRepo: userRepo,
+		events:   events,
+	}
+}
+
+// Subscribe turns the events users should hear about into notifications.
+func (s *NotificationService) Subscribe(bus *event.Bus) {
+	bus.Subscribe(event.TopicUserFollowed, func(ctx context.Context, e event.Event) error {
+		ev := e.(event.UserFollowed)
+		return s.notify(ctx, domain.Notification{
+			UserID:   ev.FolloweeID,
+			Type:     domain.NotificationTypeFollow,
+			GroupKey: "follow",
+		}, ev.FollowerID)
+	})
+	bus.Subscribe(event.TopicArticleLiked, func(ctx context.Context, e event.Event) error {
+		ev := e.(event.ArticleLiked)
+		return s.notify(ctx, domain.Notification{
+			UserID:    ev.AuthorID,
+			Type:      domain.NotificationTypeLike,
+			GroupKey:  "like:" + strconv.FormatInt(ev.ArticleID, 10),
+			ArticleID: ev.ArticleID,
+		}, ev.UserID)
+	})
+	bus.Subscribe(event.TopicCommentPosted, func(ctx context.Context, e event.Event) error {
+		return s.commentPosted(ctx, e.(event.CommentPosted))
+	})
+	bus.Subscribe(event.TopicUserMentioned, func(ctx context.Context, e event.Event) error {
+		ev := e.(event.UserMentioned)
+		return s.notify(ctx, domain.Notification{
+			UserID:    ev.MentionedID,
+			Type:      domain.NotificationTypeMention,
+			ArticleID: ev.ArticleID,
+			CommentID: ev.CommentID,
+		}, ev.AuthorID)
+	})
+	bus.Subscribe(event.TopicFriendRequestAccepted, func(ctx context.Context, e event.Event) error {
+		ev := e.(event.FriendRequestAccepted)
+		return s.notify(ctx, domain.Notification{
+			UserID: ev.RequesterID,
+			Type:   domain.NotificationTypeFriendAccepted,
+		}, ev.AddresseeID)
+	})
+	bus.Subscribe(event.TopicLoginFailed, func(ctx context.Context, e event.Event) error {
+		ev := e.(event.LoginFailed)
+		return s.notify(ctx, domain.Notification{
+			UserID:   ev.UserID,
+			Type:     domain.NotificationTypeLoginFailed,
+			GroupKey: "login_failed",
+		}, 0)
+	})
+	bus.Subscribe(event.TopicHandleChanged, func(ctx context.Context, e event.Event) error {
+		ev := e.(event.HandleChanged)
+		return s.notify(ctx, domain.Notification{
+			UserID: ev.UserID,
+			Type:   domain.NotificationTypeHandleChanged,
+			Detail: ev.NewHandle,
+		}, 0)
+	})
+}
+
+// commentPosted notifies the author of the parent comment of a reply, and
+// the author of the article of any other comment on it.
+func (s *NotificationService) commentPosted(ctx context.Context, ev event.CommentPosted) error {
+	if ev.ParentAuthorID != 0 && ev.ParentAuthorID != ev.AuthorID {
+		err := s.notify(ctx, domain.Notification{
+			UserID:    ev.ParentAuthorID,
+			Type:      domain.NotificationTypeReply,
+			GroupKey:  "reply:" + strconv.FormatInt(ev.ParentID, 10),
+			ArticleID: ev.ArticleID,
+			CommentID: ev.ParentID,
+		}, ev.AuthorID)
+		if err != nil {
+			return err
+		}
+	}
+	if ev.ArticleAuthorID == ev.ParentAuthorID {
+		return nil
+	}
+	return s.notify(ctx, domain.Notification{
+		UserID:    ev.ArticleAuthorID,
+		Type:      domain.NotificationTypeComment,
+		GroupKey:  "comment:" + strconv.FormatInt(ev.ArticleID, 10),
+		ArticleID: ev.ArticleID,
+	}, ev.AuthorID)
+}
+
+// notify adds a notification unless users would be told about what they did
+// themselves.
+func (s *NotificationService) notify(ctx context.Context, n domain.Notification, actorId int64) error {
+	if n.UserID == 0 || n.UserID == actorId {
+		return nil
+	}
+	id, err := s.repo.Add(ctx, n, actorId)
+	if err != nil || id == 0 {
+		return err
+	}
+	s.events.Publish(ctx, event.NotificationAdded{NotificationID: id, UserID: n.UserID})
+	return nil
+}
+
+// Inbox returns up to limit notifications of a user after cursor, most
+// recently updated first, and the cursor of the next page, which is zero on
+// the last page.
+func (s *NotificationService) Inbox(ctx context.Context, userId int64, cursor domain.NotificationCursor,
+	limit int, unreadOnly bool) ([]domain.Notification, domain.NotificationCursor, error) {
+	ns, err := s.repo.FindByUser(ctx, userId, cursor, limit, unreadOnly, notificationActors)
+	if err != nil {
+		return nil, domain.NotificationCursor{}, err
+	}
+
+	var ids []int64
+	for _, n := range ns {
+		for _, a := range n.Actors {
+			ids = append(ids, a.ID)
+		}
+	}
+	users, err := s.userRepo.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, domain.NotificationCursor{}, err
+	}
+	for i := range ns {
+		actors := ns[i].Actors[:0]
+		for _, a := range ns[i].Actors {
+			// Deactivated users are left out but still counted.
+			if u, ok := users[a.ID]; ok && !u.Deactivated {
+				actors = append(actors, u)
+			}
+		}
+		ns[i].Actors = actors
+	}
+
+	var next domain.NotificationCursor
+	if len(ns) == limit {
+		last := ns[len(ns)-1]
+		next = domain.NotificationCursor{Utime: last.Utime, ID: last.ID}
+	}
+	return ns, next, nil
+}
+
+// MarkRead marks notifications of a user read. IDs of other users'
+// notifications are ignored.
+func (s *NotificationService) MarkRead(ctx context.Context, userId int64, ids []int64) error {
+	_, err := s.repo.MarkRead(ctx, userId, ids)
+	return err
+}
+
+func (s *NotificationService) MarkAllRead(ctx context.Context, userId int64) error {
+	_, err := s.repo.MarkAllRead(ctx, userId)
+	return err
+}
+
+func (s *NotificationService) UnreadCount(ctx context.Context, userId int64) (int64, error) {
+	return s.repo.CountUnread(ctx, userId)
+}
@@ -0,0 +1,543 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrOAuthClientNotFound     = repository.ErrOAuthClientNotFound
+	ErrInvalidRedirectURI      = errors.New("invalid redirect uri")
+	ErrUnsupportedResponseType = errors.New("unsupported response type")
+	ErrInvalidScope            = errors.New("invalid scope")
+	ErrInvalidPKCE             = errors.New("invalid or missing pkce parameters")
+	ErrInvalidClientAuth       = errors.New("client authentication failed")
+	ErrInvalidGrant            = errors.New("invalid authorization code")
+	ErrUnsupportedGrantType    = errors.New("unsupported grant type")
+	ErrInvalidAccessToken      = errors.New("invalid access token")
+)
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+
+	pkceMethodS256 = "S256"
+	tokenUseAccess = "access"
+)
+
+// SupportedScopes lists the scopes a client may request, in discovery order.
+var SupportedScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+type OAuthConfig struct {
+	// Issuer is the externally visible base URL, e.g. https://connectify.example.com.
+	Issuer         string
+	CodeTTL        time.Duration
+	AccessTokenTTL time.Duration
+	IDTokenTTL     time.Duration
+}
+
+// AuthorizeRequest carries the parameters of an authorization request as sent
+// by the client to the authorization endpoint.
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// AuthorizePrompt is what the consent screen needs to render.
+type AuthorizePrompt struct {
+	Client domain.OAuthClient
+	Scopes []string
+	// Consented is true when the user already granted every requested scope,
+	// so the frontend may approve without showing the screen again.
+	Consented bool
+}
+
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	ClientID     string
+	ClientSecret string
+	CodeVerifier string
+}
+
+type TokenResponse struct {
+	AccessToken string
+	IDToken     string
+	ExpiresIn   int64
+	Scope       string
+}
+
+// AccessTokenClaims are the claims of the access tokens issued to OAuth clients.
+// They are unrelated to the first-party UserClaims used by Connectify itself.
+type AccessTokenClaims struct {
+	Scope    string `json:"scope"`
+	ClientID string `json:"client_id"`
+	TokenUse string `json:"token_use"`
+	jwt.RegisteredClaims
+}
+
+type IDTokenClaims struct {
+	Nonce    string `json:"nonce,omitempty"`
+	AuthTime int64  `json:"auth_time"`
+	Email    string `json:"email,omitempty"`
+	Name     string `json:"name,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// OAuthStore keeps clients, consents and authorization codes.
+// *repository.OAuthRepository implements it.
+type OAuthStore interface {
+	CreateClient(ctx context.Context, client domain.OAuthClient) (int64, error)
+	FindClient(ctx context.Context, clientID string) (domain.OAuthClient, error)
+	FindClientsByOwner(ctx context.Context, ownerId int64) ([]domain.OAuthClient, error)
+	CreateCode(ctx context.Context, code domain.AuthorizationCode) error
+	// RedeemCode marks an unexpired, unused code as spent and returns it, so
+	// that each code can be exchanged only once.
+	RedeemCode(ctx context.Context, codeHash string) (domain.AuthorizationCode, error)
+	SaveConsent(ctx context.Context, consent domain.OAuthConsent) error
+	FindConsent(ctx context.Context, userId int64, clientID string) (domain.OAuthConsent, error)
+	FindConsentsByUser(ctx context.Context, userId int64) ([]domain.OAuthConsent, error)
+	DeleteConsent(ctx context.Context, userId int64, clientID string) error
+}
+
+// ProfileFinder looks up the user a token is issued for. *UserService
+// implements it.
+type ProfileFinder interface {
+	Profile(ctx context.Context, id int64) (domain.User, error)
+}
+
+type OAuthService struct {
+	repo    OAuthStore
+	userSvc ProfileFinder
+	keys    *SigningKeyManager
+	cfg     OAuthConfig
+}
+
+func NewOAuthService(repo OAuthStore, userSvc ProfileFinder,
+	keys *SigningKeyManager, cfg OAuthConfig) *OAuthService {
+	return &OAuthService{
+		repo:    repo,
+		userSvc: userSvc,
+		keys:    keys,
+		cfg:     cfg,
+	}
+}
+
+func (s *OAuthService) Issuer() string {
+	return s.cfg.Issuer
+}
+
+// RegisterClient creates a client owned by the given user. The plain secret is
+// returned only here; confidential clients must store it themselves.
+func (s *OAuthService) RegisterClient(ctx context.Context, ownerId int64, name string,
+	redirectURIs []string, public bool) (domain.OAuthClient, string, error) {
+	if len(redirectURIs) == 0 {
+		return domain.OAuthClient{}, "", ErrInvalidRedirectURI
+	}
+	for _, uri := range redirectURIs {
+		if !validRedirectURI(uri) {
+			return domain.OAuthClient{}, "", ErrInvalidRedirectURI
+		}
+	}
+
+	clientID, err := randomToken(16)
+	if err != nil {
+		return domain.OAuthClient{}, "", err
+	}
+	client := domain.OAuthClient{
+		ClientID:     clientID,
+		Name:         name,
+		RedirectURIs: redirectURIs,
+		Public:       public,
+		OwnerId:      ownerId,
+	}
+
+	var secret string
+	if !public {
+		secret, err = randomToken(32)
+		if err != nil {
+			return domain.OAuthClient{}, "", err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			return domain.OAuthClient{}, "", err
+		}
+		client.SecretHash = string(hash)
+	}
+
+	client.ID, err = s.repo.CreateClient(ctx, client)
+	if err != nil {
+		return domain.OAuthClient{}, "", err
+	}
+	return client, secret, nil
+}
+
+func (s *OAuthService) Clients(ctx context.Context, ownerId int64) ([]domain.OAuthClient, error) {
+	return s.repo.FindClientsByOwner(ctx, ownerId)
+}
+
+// CheckRedirect verifies the client and redirect URI of an authorization request.
+// Until it succeeds, errors must be shown to the user instead of being sent
+// to the redirect URI, otherwise the endpoint becomes an open redirector.
+func (s *OAuthService) CheckRedirect(ctx context.Context, req AuthorizeRequest) (domain.OAuthClient, error) {
+	client, err := s.repo.FindClient(ctx, req.ClientID)
+	if err != nil {
+		return domain.OAuthClient{}, err
+	}
+	if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		return domain.OAuthClient{}, ErrInvalidRedirectURI
+	}
+	return client, nil
+}
+
+// Prepare validates an authorization request for the logged-in user and
+// returns what the consent screen should show.
+func (s *OAuthService) Prepare(ctx context.Context, userId int64, req AuthorizeRequest) (AuthorizePrompt, error) {
+	client, err := s.CheckRedirect(ctx, req)
+	if err != nil {
+		return AuthorizePrompt{}, err
+	}
+	scopes, err := s.validateAuthorize(client, req)
+	if err != nil {
+		return AuthorizePrompt{}, err
+	}
+
+	prompt := AuthorizePrompt{Client: client, Scopes: scopes}
+	consent, err := s.repo.FindConsent(ctx, userId, client.ClientID)
+	switch {
+	case err == nil:
+		prompt.Consented = containsAll(consent.Scopes, scopes)
+	case !errors.Is(err, repository.ErrOAuthConsentNotFound):
+		return AuthorizePrompt{}, err
+	}
+	return prompt, nil
+}
+
+// Approve records the user's consent and returns the redirect URI carrying a
+// fresh authorization code.
+func (s *OAuthService) Approve(ctx context.Context, userId int64, req AuthorizeRequest) (string, error) {
+	client, err := s.CheckRedirect(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	scopes, err := s.validateAuthorize(client, req)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.repo.SaveConsent(ctx, domain.OAuthConsent{
+		UserId:   userId,
+		ClientID: client.ClientID,
+		Scopes:   scopes,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	code, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = s.repo.CreateCode(ctx, domain.AuthorizationCode{
+		CodeHash:            hashToken(code),
+		ClientID:            client.ClientID,
+		UserId:              userId,
+		RedirectURI:         req.RedirectURI,
+		Scopes:              scopes,
+		Nonce:               req.Nonce,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		AuthTime:            now,
+		ExpiresAt:           now.Add(s.cfg.CodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return redirectWith(req.RedirectURI, url.Values{"code": {code}, "state": {req.State}}), nil
+}
+
+// Deny returns the redirect URI that tells the client the user refused access.
+func (s *OAuthService) Deny(ctx context.Context, req AuthorizeRequest) (string, error) {
+	if _, err := s.CheckRedirect(ctx, req); err != nil {
+		return "", err
+	}
+	return AuthorizeErrorRedirect(req, "access_denied"), nil
+}
+
+// AuthorizeErrorRedirect builds an error redirect for a request whose redirect
+// URI has already been checked with CheckRedirect.
+func AuthorizeErrorRedirect(req AuthorizeRequest, code string) string {
+	return redirectWith(req.RedirectURI, url.Values{"error": {code}, "state": {req.State}})
+}
+
+// Exchange redeems an authorization code for an access token and ID token.
+func (s *OAuthService) Exchange(ctx context.Context, req TokenRequest) (TokenResponse, error) {
+	if req.GrantType != "authorization_code" {
+		return TokenResponse{}, ErrUnsupportedGrantType
+	}
+
+	client, err := s.repo.FindClient(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthClientNotFound) {
+			return TokenResponse{}, ErrInvalidClientAuth
+		}
+		return TokenResponse{}, err
+	}
+	if !client.Public {
+		if req.ClientSecret == "" ||
+			bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(req.ClientSecret)) != nil {
+			return TokenResponse{}, ErrInvalidClientAuth
+		}
+	}
+
+	code, err := s.repo.RedeemCode(ctx, hashToken(req.Code))
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthCodeNotFound) {
+			return TokenResponse{}, ErrInvalidGrant
+		}
+		return TokenResponse{}, err
+	}
+	if code.ClientID != client.ClientID || code.RedirectURI != req.RedirectURI {
+		return TokenResponse{}, ErrInvalidGrant
+	}
+	if code.CodeChallenge != "" && !verifyPKCE(code.CodeChallenge, req.CodeVerifier) {
+		return TokenResponse{}, ErrInvalidGrant
+	}
+
+	user, err := s.userSvc.Profile(ctx, code.UserId)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return TokenResponse{}, ErrInvalidGrant
+		}
+		return TokenResponse{}, err
+	}
+	if user.Deactivated {
+		return TokenResponse{}, ErrInvalidGrant
+	}
+
+	key, err := s.keys.Current(ctx)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	now := time.Now()
+	sub := strconv.FormatInt(user.ID, 10)
+	scope := strings.Join(code.Scopes, " ")
+
+	access := jwt.NewWithClaims(jwt.SigningMethodRS256, AccessTokenClaims{
+		Scope:    scope,
+		ClientID: client.ClientID,
+		TokenUse: tokenUseAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.Issuer,
+			Subject:   sub,
+			Audience:  jwt.ClaimStrings{s.cfg.Issuer},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.AccessTokenTTL)),
+		},
+	})
+	access.Header["kid"] = key.KID
+	accessStr, err := access.SignedString(key.PrivateKey)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	idClaims := IDTokenClaims{
+		Nonce:    code.Nonce,
+		AuthTime: code.AuthTime.Unix(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.Issuer,
+			Subject:   sub,
+			Audience:  jwt.ClaimStrings{client.ClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.IDTokenTTL)),
+		},
+	}
+	if slices.Contains(code.Scopes, ScopeEmail) {
+		idClaims.Email = user.Email
+	}
+	if slices.Contains(code.Scopes, ScopeProfile) {
+		idClaims.Name = user.Nickname
+	}
+	id := jwt.NewWithClaims(jwt.SigningMethodRS256, idClaims)
+	id.Header["kid"] = key.KID
+	idStr, err := id.SignedString(key.PrivateKey)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	return TokenResponse{
+		AccessToken: accessStr,
+		IDToken:     idStr,
+		ExpiresIn:   int64(s.cfg.AccessTokenTTL.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// UserInfo verifies an access token and returns the claims the granted scopes
+// allow the client to see.
+func (s *OAuthService) UserInfo(ctx context.Context, accessToken string) (map[string]any, error) {
+	var claims AccessTokenClaims
+	token, err := jwt.ParseWithClaims(accessToken, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := s.keys.Find(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		return &key.PrivateKey.PublicKey, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(s.cfg.Issuer),
+		jwt.WithAudience(s.cfg.Issuer),
+	)
+	if err != nil || !token.Valid || claims.TokenUse != tokenUseAccess {
+		return nil, ErrInvalidAccessToken
+	}
+
+	uid, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidAccessToken
+	}
+	user, err := s.userSvc.Profile(ctx, uid)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidAccessToken
+		}
+		return nil, err
+	}
+	if user.Deactivated {
+		return nil, ErrInvalidAccessToken
+	}
+
+	scopes := strings.Fields(claims.Scope)
+	info := map[string]any{"sub": claims.Subject}
+	if slices.Contains(scopes, ScopeEmail) {
+		info["email"] = user.Email
+		info["email_verified"] = false
+	}
+	if slices.Contains(scopes, ScopeProfile) {
+		info["name"] = user.Nickname
+	}
+	return info, nil
+}
+
+func (s *OAuthService) SigningKeys(ctx context.Context) ([]domain.SigningKey, error) {
+	return s.keys.Published(ctx)
+}
+
+func (s *OAuthService) Consents(ctx context.Context, userId int64) ([]domain.OAuthConsent, error) {
+	return s.repo.FindConsentsByUser(ctx, userId)
+}
+
+// RevokeConsent forgets a grant so the next sign-in asks the user again.
+// Tokens already issued stay valid until they expire.
+func (s *OAuthService) RevokeConsent(ctx context.Context, userId int64, clientID string) error {
+	return s.repo.DeleteConsent(ctx, userId, clientID)
+}
+
+func (s *OAuthService) validateAuthorize(client domain.OAuthClient, req AuthorizeRequest) ([]string, error) {
+	if req.ResponseType != "code" {
+		return nil, ErrUnsupportedResponseType
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if !slices.Contains(scopes, ScopeOpenID) {
+		return nil, ErrInvalidScope
+	}
+	for _, sc := range scopes {
+		if !slices.Contains(SupportedScopes, sc) {
+			return nil, ErrInvalidScope
+		}
+	}
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+
+	// Public clients cannot authenticate at the token endpoint, so PKCE is the
+	// only thing binding the code to the app that started the flow.
+	if req.CodeChallenge == "" {
+		if client.Public {
+			return nil, ErrInvalidPKCE
+		}
+		return scopes, nil
+	}
+	if req.CodeChallengeMethod != pkceMethodS256 {
+		return nil, ErrInvalidPKCE
+	}
+	return scopes, nil
+}
+
+func verifyPKCE(challenge, verifier string) bool {
+	// RFC 7636: the verifier is 43-128 characters long.
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func validRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Fragment != "" || u.Host == "" {
+		return false
+	}
+	return u.Scheme == "https" || u.Scheme == "http"
+}
+
+func redirectWith(base string, params url.Values) string {
+	u, _ := url.Parse(base)
+	q := u.Query()
+	for k, vs := range params {
+		if len(vs) == 0 || vs[0] == "" {
+			continue
+		}
+		q.Set(k, vs[0])
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func containsAll(have, want []string) bool {
+	for _, w := range want {
+		if !slices.Contains(have, w) {
+			return false
+		}
+	}
+	return true
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
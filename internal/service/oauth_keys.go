@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+)
+
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// SigningKeyStore persists signing keys. *repository.OAuthRepository
+// implements it.
+type SigningKeyStore interface {
+	CreateSigningKey(ctx context.Context, key domain.SigningKey) error
+	FindSigningKeysSince(ctx context.Context, since time.Time) ([]domain.SigningKey, error)
+	DeleteSigningKeysBefore(ctx context.Context, before time.Time) error
+}
+
+// SigningKeyManager owns the RSA keys used to sign OIDC tokens.
+//
+// Keys live in the database so every server instance signs with, and publishes,
+// the same key set. A new key is generated once the newest one is older than
+// rotateEvery; older keys stay in the published JWKS for retainFor so tokens
+// signed just before a rotation still verify.
+type SigningKeyManager struct {
+	repo        SigningKeyStore
+	rotateEvery time.Duration
+	retainFor   time.Duration
+
+	mu       sync.RWMutex
+	keys     []domain.SigningKey // newest first
+	loadedAt time.Time
+	missedAt time.Time // last reload forced by an unknown key ID
+}
+
+const (
+	// keyReloadInterval bounds how long an instance may keep using a stale
+	// view of the key set after another instance rotated.
+	keyReloadInterval = time.Minute
+	// keyMissReloadInterval rate-limits the reloads forced by unknown key IDs,
+	// so tokens with made-up key IDs cannot hammer the database.
+	keyMissReloadInterval = 5 * time.Second
+)
+
+func NewSigningKeyManager(repo SigningKeyStore, rotateEvery, retainFor time.Duration) *SigningKeyManager {
+	return &SigningKeyManager{
+		repo:        repo,
+		rotateEvery: rotateEvery,
+		retainFor:   retainFor,
+	}
+}
+
+// Current returns the key new tokens should be signed with, rotating if due.
+func (m *SigningKeyManager) Current(ctx context.Context) (domain.SigningKey, error) {
+	keys, err := m.load(ctx)
+	if err != nil {
+		return domain.SigningKey{}, err
+	}
+	if len(keys) > 0 && time.Since(keys[0].Ctime) < m.rotateEvery {
+		return keys[0], nil
+	}
+	return m.rotate(ctx)
+}
+
+// Find returns the key with the given key ID for verification. A key ID
+// missing from the cached set may belong to a key another instance just
+// rotated in, so the set is reloaded once before giving up.
+func (m *SigningKeyManager) Find(ctx context.Context, kid string) (domain.SigningKey, error) {
+	keys, err := m.load(ctx)
+	if err != nil {
+		return domain.SigningKey{}, err
+	}
+	if k, ok := findKey(keys, kid); ok {
+		return k, nil
+	}
+	m.mu.Lock()
+	due := time.Since(m.missedAt) >= keyMissReloadInterval
+	if due {
+		m.missedAt = time.Now()
+	}
+	m.mu.Unlock()
+	if !due {
+		return domain.SigningKey{}, ErrUnknownSigningKey
+	}
+	keys, err = m.reload(ctx)
+	if err != nil {
+		return domain.SigningKey{}, err
+	}
+	if k, ok := findKey(keys, kid); ok {
+		return k, nil
+	}
+	return domain.SigningKey{}, ErrUnknownSigningKey
+}
+
+func findKey(keys []domain.SigningKey, kid string) (domain.SigningKey, bool) {
+	for _, k := range keys {
+		if k.KID == kid {
+			return k, true
+		}
+	}
+	return domain.SigningKey{}, false
+}
+
+// Published returns every key that may still have signed a live token.
+func (m *SigningKeyManager) Published(ctx context.Context) ([]domain.SigningKey, error) {
+	return m.load(ctx)
+}
+
+func (m *SigningKeyManager) load(ctx context.Context) ([]domain.SigningKey, error) {
+	m.mu.RLock()
+	if time.Since(m.loadedAt) < keyReloadInterval {
+		keys := m.keys
+		m.mu.RUnlock()
+		return keys, nil
+	}
+	m.mu.RUnlock()
+	return m.reload(ctx)
+}
+
+func (m *SigningKeyManager) reload(ctx context.Context) ([]domain.SigningKey, error) {
+	keys, err := m.repo.FindSigningKeysSince(ctx, time.Now().Add(-(m.rotateEvery + m.retainFor)))
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.keys = keys
+	m.loadedAt = time.Now()
+	m.mu.Unlock()
+	return keys, nil
+}
+
+func (m *SigningKeyManager) rotate(ctx context.Context) (domain.SigningKey, error) {
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return domain.SigningKey{}, err
+	}
+	kid := make([]byte, 8)
+	if _, err = rand.Read(kid); err != nil {
+		return domain.SigningKey{}, err
+	}
+	key := domain.SigningKey{
+		KID:        hex.EncodeToString(kid),
+		PrivateKey: pk,
+		Ctime:      time.Now(),
+	}
+	// Two instances may rotate at the same moment. That is harmless: both keys
+	// are published and either one verifies its own tokens.
+	if err = m.repo.CreateSigningKey(ctx, key); err != nil {
+		return domain.SigningKey{}, err
+	}
+	// Keys that fell out of the published window can no longer verify anything.
+	if err = m.repo.DeleteSigningKeysBefore(ctx, time.Now().Add(-(m.rotateEvery + m.retainFor))); err != nil {
+		return domain.SigningKey{}, err
+	}
+	if _, err = m.reload(ctx); err != nil {
+		return domain.SigningKey{}, err
+	}
+	return key, nil
+}
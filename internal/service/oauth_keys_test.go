@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+)
+
+// memSigningKeys is an in-memory SigningKeyStore shared by several managers,
+// the way instances share the database. loads counts the key set reads.
+type memSigningKeys struct {
+	mu    sync.Mutex
+	keys  []domain.SigningKey
+	loads int
+}
+
+func (m *memSigningKeys) CreateSigningKey(_ context.Context, key domain.SigningKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = append([]domain.SigningKey{key}, m.keys...)
+	return nil
+}
+
+func (m *memSigningKeys) FindSigningKeysSince(_ context.Context, since time.Time) ([]domain.SigningKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loads++
+	var res []domain.SigningKey
+	for _, k := range m.keys {
+		if !k.Ctime.Before(since) {
+			res = append(res, k)
+		}
+	}
+	return res, nil
+}
+
+func (m *memSigningKeys) DeleteSigningKeysBefore(_ context.Context, before time.Time) error {
+	return nil
+}
+
+func TestSigningKeyManagerFindReloadsOnUnknownKey(t *testing.T) {
+	ctx := context.Background()
+	store := &memSigningKeys{}
+	verifier := NewSigningKeyManager(store, time.Hour, time.Hour)
+	signer := NewSigningKeyManager(store, time.Hour, time.Hour)
+
+	// The verifier caches the empty key set before the signer rotates.
+	if _, err := verifier.Published(ctx); err != nil {
+		t.Fatal(err)
+	}
+	key, err := signer.Current(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := verifier.Find(ctx, key.KID)
+	if err != nil {
+		t.Fatalf("Find(new key) = %v, want the key", err)
+	}
+	if got.KID != key.KID {
+		t.Fatalf("Find(new key) = %q, want %q", got.KID, key.KID)
+	}
+
+	// Made-up key IDs force at most one reload per interval. The lookup above
+	// already forced one, so pretend the interval has passed.
+	verifier.missedAt = time.Time{}
+	loads := store.loads
+	for i := 0; i < 3; i++ {
+		if _, err = verifier.Find(ctx, "unknown"); !errors.Is(err, ErrUnknownSigningKey) {
+			t.Fatalf("Find(unknown) = %v, want ErrUnknownSigningKey", err)
+		}
+	}
+	if store.loads != loads+1 {
+		t.Fatalf("unknown key IDs reloaded %d times, want 1", store.loads-loads)
+	}
+}
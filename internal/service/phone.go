@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrInvalidPhone     = errors.New("invalid phone number")
+	ErrPhoneCodeTooSoon = errors.New("a verification code was sent too recently")
+	ErrInvalidPhoneCode = errors.New("invalid or expired verification code")
+)
+
+// SMSSender delivers text messages.
+type SMSSender interface {
+	Send(ctx context.Context, phone, text string) error
+}
+
+// LogSMSSender writes messages to the log instead of sending them. It is
+// meant for development, before an SMS gateway is configured.
+type LogSMSSender struct{}
+
+func (LogSMSSender) Send(_ context.Context, phone, text string) error {
+	log.Printf("sms to %s: %s", phone, text)
+	return nil
+}
+
+// PhoneCodeStore keeps the verification codes sent to phone numbers.
+type PhoneCodeStore interface {
+	// Save stores code for phone until ttl passes, replacing any earlier
+	// code. It returns false without saving when the previous code was
+	// saved less than resendAfter ago.
+	Save(ctx context.Context, phone, code string, ttl, resendAfter time.Duration) (bool, error)
+	// Verify reports whether code is the one saved for phone. A matching
+	// code is deleted so it works only once, and so is a code that was
+	// guessed wrong maxTries times.
+	Verify(ctx context.Context, phone, code string, maxTries int) (bool, error)
+}
+
+type PhoneVerifierConfig struct {
+	// CodeTTL is how long a code can be used.
+	CodeTTL time.Duration
+	// ResendAfter is how long a number waits before it gets another code.
+	ResendAfter time.Duration
+	// MaxTries is how many wrong codes are accepted before the code is
+	// thrown away, so six digits cannot be guessed.
+	MaxTries int
+}
+
+func DefaultPhoneVerifierConfig() PhoneVerifierConfig {
+	return PhoneVerifierConfig{
+		CodeTTL:     5 * time.Minute,
+		ResendAfter: time.Minute,
+		MaxTries:    5,
+	}
+}
+
+// PhoneVerifier proves that a visitor controls a phone number by texting it
+// a one-time code.
+type PhoneVerifier struct {
+	store  PhoneCodeStore
+	sender SMSSender
+	cfg    PhoneVerifierConfig
+}
+
+func NewPhoneVerifier(store PhoneCodeStore, sender SMSSender, cfg PhoneVerifierConfig) *PhoneVerifier {
+	return &PhoneVerifier{store: store, sender: sender, cfg: cfg}
+}
+
+// SendCode texts a new code to phone, which must be normalized.
+func (v *PhoneVerifier) SendCode(ctx context.Context, phone string) error {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	ok, err := v.store.Save(ctx, phone, code, v.cfg.CodeTTL, v.cfg.ResendAfter)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrPhoneCodeTooSoon
+	}
+	text := fmt.Sprintf("Your Connectify verification code is %s. It expires in %d minutes.",
+		code, int(v.cfg.CodeTTL.Minutes()))
+	return v.sender.Send(ctx, phone, text)
+}
+
+// Verify checks the code texted to phone. It returns ErrInvalidPhoneCode
+// when the code is wrong, expired or already used.
+func (v *PhoneVerifier) Verify(ctx context.Context, phone, code string) error {
+	ok, err := v.store.Verify(ctx, phone, code, v.cfg.MaxTries)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidPhoneCode
+	}
+	return nil
+}
+
+// NormalizePhone returns phone in E.164 form, dropping the spaces, dashes,
+// dots and parentheses people type. Numbers must include the country code.
+func NormalizePhone(phone string) (string, error) {
+	phone = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, phone)
+	digits, ok := strings.CutPrefix(phone, "+")
+	if !ok || len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return "", ErrInvalidPhone
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", ErrInvalidPhone
+		}
+	}
+	return phone, nil
+}
+
+// RedisPhoneCodeStore shares codes between all server instances.
+type RedisPhoneCodeStore struct {
+	client redis.Cmdable
+}
+
+func NewRedisPhoneCodeStore(client redis.Cmdable) *RedisPhoneCodeStore {
+	return &RedisPhoneCodeStore{client: client}
+}
+
+func (s *RedisPhoneCodeStore) Save(ctx context.Context, phone, code string, ttl, resendAfter time.Duration) (bool, error) {
+	ok, err := s.client.SetNX(ctx, "phone:sent:"+phone, 1, resendAfter).Result()
+	if err != nil || !ok {
+		return false, err
+	}
+	_, err = s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Set(ctx, "phone:code:"+phone, code, ttl)
+		p.Del(ctx, "phone:tries:"+phone)
+		return nil
+	})
+	return err == nil, err
+}
+
+// verifyCodeScript checks a code and counts the wrong guesses in one step,
+// so concurrent guesses cannot get past the limit.
+var verifyCodeScript = redis.NewScript(`
+local code = redis.call("GET", KEYS[1])
+if not code then
+	return 0
+end
+if code == ARGV[1] then
+	redis.call("DEL", KEYS[1], KEYS[2])
+	return 1
+end
+local tries = redis.call("INCR", KEYS[2])
+redis.call("PEXPIRE", KEYS[2], redis.call("PTTL", KEYS[1]))
+if tries >= tonumber(ARGV[2]) then
+	redis.call("DEL", KEYS[1], KEYS[2])
+end
+return 0
+`)
+
+func (s *RedisPhoneCodeStore) Verify(ctx context.Context, phone, code string, maxTries int) (bool, error) {
+	n, err := verifyCodeScript.Run(ctx, s.client,
+		[]string{"phone:code:" + phone, "phone:tries:" + phone}, code, maxTries).Int()
+	return n == 1, err
+}
+
+// LocalPhoneCodeStore keeps codes in memory, so a code can only be verified
+// on the instance that texted it, and the resend limit only holds per
+// instance.
+type LocalPhoneCodeStore struct {
+	mu    sync.Mutex
+	codes map[string]*localPhoneCode
+}
+
+type localPhoneCode struct {
+	code       string
+	expires    time.Time
+	resendAt   time.Time
+	wrongTries int
+}
+
+func NewLocalPhoneCodeStore() *LocalPhoneCodeStore {
+	return &LocalPhoneCodeStore{codes: make(map[string]*localPhoneCode)}
+}
+
+func (s *LocalPhoneCodeStore) Save(_ context.Context, phone, code string, ttl, resendAfter time.Duration) (bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, c := range s.codes {
+		if now.After(c.expires) && now.After(c.resendAt) {
+			delete(s.codes, k)
+		}
+	}
+	if c, ok := s.codes[phone]; ok && now.Before(c.resendAt) {
+		return false, nil
+	}
+	s.codes[phone] = &localPhoneCode{code: code, expires: now.Add(ttl), resendAt: now.Add(resendAfter)}
+	return true, nil
+}
+
+func (s *LocalPhoneCodeStore) Verify(_ context.Context, phone, code string, maxTries int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.codes[phone]
+	if !ok || c.code == "" || time.Now().After(c.expires) {
+		return false, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(c.code), []byte(code)) == 1 {
+		// Keep the entry so the resend interval still applies.
+		c.code = ""
+		return true, nil
+	}
+	c.wrongTries++
+	if c.wrongTries >= maxTries {
+		c.code = ""
+	}
+	return false, nil
+}
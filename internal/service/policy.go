@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+var (
+	ErrDuplicatePolicy     = repository.ErrDuplicatePolicy
+	ErrPolicyNotFound      = repository.ErrPolicyNotFound
+	ErrUnknownPolicyKind   = errors.New("unknown policy kind")
+	ErrPolicyNotCurrent    = errors.New("policy is not the current version")
+	ErrPoliciesNotAccepted = errors.New("current policies must be accepted")
+)
+
+// latestPolicyTTL bounds how long a newly published version may go unnoticed
+// by an instance. Every authenticated request asks for the latest versions,
+// so they are cached in memory.
+const latestPolicyTTL = time.Minute
+
+// PolicyService is the registry of versioned legal documents (terms of
+// service, privacy policy) and of which versions each user accepted.
+type PolicyService struct {
+	repo *repository.PolicyRepository
+
+	mu       sync.RWMutex
+	latest   []domain.Policy
+	loadedAt time.Time
+}
+
+func NewPolicyService(repo *repository.PolicyRepository) *PolicyService {
+	return &PolicyService{
+		repo: repo,
+	}
+}
+
+// Publish adds a new policy version. A zero PublishedAt publishes immediately;
+// a future one lets legal announce a change before it takes effect.
+func (s *PolicyService) Publish(ctx context.Context, policy domain.Policy) (int64, error) {
+	if policy.Kind != domain.PolicyKindTerms && policy.Kind != domain.PolicyKindPrivacy {
+		return 0, ErrUnknownPolicyKind
+	}
+	if policy.PublishedAt.IsZero() {
+		policy.PublishedAt = time.Now()
+	}
+
+	id, err := s.repo.Create(ctx, policy)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+	return id, nil
+}
+
+// Latest returns the version currently in force for every policy kind.
+func (s *PolicyService) Latest(ctx context.Context) ([]domain.Policy, error) {
+	s.mu.RLock()
+	if time.Since(s.loadedAt) < latestPolicyTTL {
+		latest := s.latest
+		s.mu.RUnlock()
+		return latest, nil
+	}
+	s.mu.RUnlock()
+
+	latest, err := s.repo.FindLatest(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.latest = latest
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	return latest, nil
+}
+
+func (s *PolicyService) Get(ctx context.Context, id int64) (domain.Policy, error) {
+	return s.repo.FindByID(ctx, id)
+}
+
+// Pending returns the current policies the user has not accepted yet.
+func (s *PolicyService) Pending(ctx context.Context, userId int64) ([]domain.Policy, error) {
+	latest, err := s.Latest(ctx)
+	if err != nil || len(latest) == 0 {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(latest))
+	for _, p := range latest {
+		ids = append(ids, p.ID)
+	}
+	accepted, err := s.repo.FindAcceptedPolicyIds(ctx, userId, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []domain.Policy
+	for _, p := range latest {
+		if !slices.Contains(accepted, p.ID) {
+			pending = append(pending, p)
+		}
+	}
+	return pending, nil
+}
+
+// CheckSignupAcceptance verifies that a signup form accepted exactly the
+// versions currently in force, so nobody registers against a stale page.
+func (s *PolicyService) CheckSignupAcceptance(ctx context.Context, policyIds []int64) error {
+	latest, err := s.Latest(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range latest {
+		if !slices.Contains(policyIds, p.ID) {
+			return ErrPoliciesNotAccepted
+		}
+	}
+	return s.checkCurrent(latest, policyIds)
+}
+
+// Accept records that the user accepted the given current policy versions.
+func (s *PolicyService) Accept(ctx context.Context, userId int64, policyIds []int64, ip, userAgent string) error {
+	latest, err := s.Latest(ctx)
+	if err != nil {
+		return err
+	}
+	if err = s.checkCurrent(latest, policyIds); err != nil {
+		return err
+	}
+
+	consents := make([]domain.PolicyConsent, 0, len(policyIds))
+	for _, id := range policyIds {
+		consents = append(consents, domain.PolicyConsent{
+			UserId:    userId,
+			PolicyId:  id,
+			IP:        ip,
+			UserAgent: userAgent,
+		})
+	}
+	return s.repo.CreateConsents(ctx, consents)
+}
+
+// History returns every consent the user has given, newest first.
+func (s *PolicyService) History(ctx context.Context, userId int64) ([]domain.PolicyConsent, error) {
+	return s.repo.FindConsentsByUser(ctx, userId)
+}
+
+func (s *PolicyService) checkCurrent(latest []domain.Policy, policyIds []int64) error {
+	for _, id := range policyIds {
+		if !slices.ContainsFunc(latest, func(p domain.Policy) bool { return p.ID == id }) {
+			return ErrPolicyNotCurrent
+		}
+	}
+	return nil
+}
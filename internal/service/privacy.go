@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+var ErrInvalidPrivacySettings = errors.New("invalid privacy settings")
+
+const maxSearchResults = 20
+
+// FollowChecker reports whether one user follows another. The privacy rules
+// need it for the "followers" audience.
+type FollowChecker interface {
+	IsFollowing(ctx context.Context, followerId, followeeId int64) (bool, error)
+}
+
+// NoFollows is a FollowChecker for when there is no follow graph: nobody
+// follows anybody, so "followers" behaves like "nobody".
+type NoFollows struct{}
+
+func (NoFollows) IsFollowing(context.Context, int64, int64) (bool, error) {
+	return false, nil
+}
+
+// PrivacyService stores users' privacy settings and decides what other users
+// may see and do. Every path that returns another user's data must ask it.
+type PrivacyService struct {
+	repo    *repository.UserRepository
+	follows FollowChecker
+	blocks  *BlockService
+}
+
+func NewPrivacyService(repo *repository.UserRepository, follows FollowChecker, blocks *BlockService) *PrivacyService {
+	return &PrivacyService{
+		repo:    repo,
+		follows: follows,
+		blocks:  blocks,
+	}
+}
+
+func (s *PrivacyService) Settings(ctx context.Context, uid int64) (domain.PrivacySettings, error) {
+	user, err := s.repo.FindByID(ctx, uid)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return domain.PrivacySettings{}, ErrUserNotFound
+		}
+		return domain.PrivacySettings{}, err
+	}
+	return user.Privacy, nil
+}
+
+func (s *PrivacyService) UpdateSettings(ctx context.Context, uid int64, settings domain.PrivacySettings) error {
+	if !settings.ProfileVisibility.Valid() || !settings.MessagePermission.Valid() {
+		return ErrInvalidPrivacySettings
+	}
+	err := s.repo.UpdatePrivacy(ctx, uid, settings)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// CanViewProfile reports whether viewerId may see owner's profile. viewerId
+// is 0 for anonymous visitors.
+func (s *PrivacyService) CanViewProfile(ctx context.Context, viewerId int64, owner domain.User) (bool, error) {
+	return s.allowed(ctx, viewerId, owner.ID, owner.Privacy.ProfileVisibility)
+}
+
+// CanMessage reports whether senderId may send recipient direct messages.
+func (s *PrivacyService) CanMessage(ctx context.Context, senderId int64, recipient domain.User) (bool, error) {
+	if senderId == 0 {
+		return false, nil
+	}
+	return s.allowed(ctx, senderId, recipient.ID, recipient.Privacy.MessagePermission)
+}
+
+func (s *PrivacyService) allowed(ctx context.Context, actorId, ownerId int64, audience domain.Audience) (bool, error) {
+	if actorId != 0 && actorId == ownerId {
+		return true, nil
+	}
+	// Users who blocked each other see nothing of each other, whatever the
+	// audience.
+	if err := s.blocks.Check(ctx, actorId, ownerId); err != nil {
+		if errors.Is(err, ErrBlocked) {
+			return false, nil
+		}
+		return false, err
+	}
+	switch audience {
+	case domain.AudienceEveryone:
+		return true, nil
+	case domain.AudienceFollowers:
+		if actorId == 0 {
+			return false, nil
+		}
+		return s.follows.IsFollowing(ctx, actorId, ownerId)
+	}
+	return false, nil
+}
+
+// SearchResult is a user found by search. Users whose profile the viewer may
+// not see are returned with Restricted set, and callers must only show their
+// handle.
+type SearchResult struct {
+	User       domain.User
+	Restricted bool
+}
+
+// Search finds users by handle or nickname prefix. Users who opted out of
+// search, and users the viewer blocked or was blocked by, are never
+// returned.
+func (s *PrivacyService) Search(ctx context.Context, viewerId int64, query string) ([]SearchResult, error) {
+	users, err := s.repo.Search(ctx, query, maxSearchResults)
+	if err != nil {
+		return nil, err
+	}
+	invisible, err := s.blocks.Invisible(ctx, viewerId)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]SearchResult, 0, len(users))
+	for _, u := range users {
+		if invisible[u.ID] {
+			continue
+		}
+		ok, err := s.CanViewProfile(ctx, viewerId, u)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, SearchResult{User: u, Restricted: !ok})
+	}
+	return res, nil
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/event"
+	"github.com/redis/go-redis/v9"
+)
+
+// PushMessage is sent to every open real-time connection of a user.
+type PushMessage struct {
+	UserID int64 `json:"userId"`
+	// Type tells clients what happened, e.g. "notification".
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// PubSub carries push messages between server instances, since a user's
+// connections may be held by any of them.
+type PubSub interface {
+	Publish(ctx context.Context, msg PushMessage) error
+	// Subscribe calls h with every message published by any instance until
+	// ctx is done.
+	Subscribe(ctx context.Context, h func(PushMessage)) error
+}
+
+const pushChannel = "realtime:push"
+
+// RedisPubSub delivers messages to every instance subscribed to a Redis
+// channel.
+type RedisPubSub struct {
+	client *redis.Client
+}
+
+func NewRedisPubSub(client *redis.Client) *RedisPubSub {
+	return &RedisPubSub{client: client}
+}
+
+func (p *RedisPubSub) Publish(ctx context.Context, msg PushMessage) error {
+	val, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return p.client.Publish(ctx, pushChannel, val).Err()
+}
+
+func (p *RedisPubSub) Subscribe(ctx context.Context, h func(PushMessage)) error {
+	sub := p.client.Subscribe(ctx, pushChannel)
+	defer sub.Close()
+	// Wait for the subscription to be confirmed, so that connection errors
+	// are returned instead of being retried silently.
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case m, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			var msg PushMessage
+			if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
+				log.Printf("decode push message: %v", err)
+				continue
+			}
+			h(msg)
+		}
+	}
+}
+
+// LocalPubSub delivers messages within this instance only: users connected
+// to another instance miss them.
+type LocalPubSub struct {
+	mu       sync.RWMutex
+	handlers map[*func(PushMessage)]struct{}
+}
+
+func NewLocalPubSub() *LocalPubSub {
+	return &LocalPubSub{handlers: make(map[*func(PushMessage)]struct{})}
+}
+
+func (p *LocalPubSub) Publish(_ context.Context, msg PushMessage) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for h := range p.handlers {
+		(*h)(msg)
+	}
+	return nil
+}
+
+func (p *LocalPubSub) Subscribe(ctx context.Context, h func(PushMessage)) error {
+	p.mu.Lock()
+	p.handlers[&h] = struct{}{}
+	p.mu.Unlock()
+
+	<-ctx.Done()
+	p.mu.Lock()
+	delete(p.handlers, &h)
+	p.mu.Unlock()
+	return nil
+}
+
+type PushConfig struct {
+	// Buffer is how many messages may wait for a slow connection before it
+	// is dropped.
+	Buffer int
+	// MaxConnsPerUser bounds the connections of one user on an instance; the
+	// oldest is dropped when another one is opened.
+	MaxConnsPerUser int
+}
+
+// PushConn is an open real-time connection of a user, whatever the
+// transport.
+type PushConn struct {
+	UserID    int64
+	send      chan PushMessage
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Messages returns the messages to write to the connection.
+func (c *PushConn) Messages() <-chan PushMessage {
+	return c.send
+}
+
+// Done is closed when the service drops the connection: it fell too far
+// behind, the user opened too many others, or the server is shutting down.
+func (c *PushConn) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *PushConn) close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// PushService delivers messages to the users' open real-time connections on
+// every instance. It does not store them; clients that were not connected,
+// or were dropped, catch up through the regular endpoints.
+type PushService struct {
+	pubsub PubSub
+	cfg    PushConfig
+
+	mu     sync.Mutex
+	conns  map[int64][]*PushConn
+	closed bool
+}
+
+func NewPushService(pubsub PubSub, cfg PushConfig) *PushService {
+	return &PushService{
+		pubsub: pubsub,
+		cfg:    cfg,
+		conns:  make(map[int64][]*PushConn),
+	}
+}
+
+// Subscribe pushes the events users should see right away.
+func (s *PushService) Subscribe(bus *event.Bus) {
+	bus.Subscribe(event.TopicNotificationAdded, func(ctx context.Context, e event.Event) error {
+		ev := e.(event.NotificationAdded)
+		return s.Push(ctx, ev.UserID, "notification", map[string]int64{"id": ev.NotificationID})
+	})
+	bus.Subscribe(event.TopicMessageSent, func(ctx context.Context, e event.Event) error {
+		ev := e.(event.MessageSent)
+		return s.Push(ctx, ev.RecipientID, "message", map[string]int64{
+			"conversationId": ev.ConversationID,
+			"messageId":      ev.MessageID,
+		})
+	})
+	// Read receipts.
+	bus.Subscribe(event.TopicMessagesRead, func(ctx context.Context, e event.Event) error {
+		ev := e.(event.MessagesRead)
+		return s.Push(ctx, ev.PeerID, "read", map[string]int64{
+			"conversationId": ev.ConversationID,
+			"messageId":      ev.MessageID,
+		})
+	})
+}
+
+// Start delivers the messages published by every instance to the
+// connections held by this one until ctx is done.
+func (s *PushService) Start(ctx context.Context) {
+	go func() {
+		for {
+			err := s.pubsub.Subscribe(ctx, s.deliver)
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("subscribe to push messages: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}()
+}
+
+// Push sends data to every open connection of a user.
+func (s *PushService) Push(ctx context.Context, userId int64, typ string, data any) error {
+	val, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return s.pubsub.Publish(ctx, PushMessage{UserID: userId, Type: typ, Data: val})
+}
+
+func (s *PushService) deliver(msg PushMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var slow []*PushConn
+	for _, c := range s.conns[msg.UserID] {
+		select {
+		case c.send <- msg:
+		default:
+			slow = append(slow, c)
+		}
+	}
+	// Clients that do not keep up are dropped, which keeps the messages of
+	// everybody else flowing and memory bounded; they catch up after
+	// reconnecting.
+	for _, c := range slow {
+		s.remove(c)
+	}
+}
+
+// Connect registers a new connection of a user. The caller must Disconnect
+// it when the connection ends.
+func (s *PushService) Connect(userId int64) *PushConn {
+	c := &PushConn{
+		UserID: userId,
+		send:   make(chan PushMessage, s.cfg.Buffer),
+		done:   make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		c.close()
+		return c
+	}
+	if conns := s.conns[userId]; len(conns) >= s.cfg.MaxConnsPerUser {
+		s.remove(conns[0])
+	}
+	s.conns[userId] = append(s.conns[userId], c)
+	return c
+}
+
+func (s *PushService) Disconnect(c *PushConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(c)
+}
+
+// remove unregisters and closes a connection. s.mu must be held.
+func (s *PushService) remove(c *PushConn) {
+	c.close()
+	conns := slices.DeleteFunc(s.conns[c.UserID], func(other *PushConn) bool {
+		return other == c
+	})
+	if len(conns) == 0 {
+		delete(s.conns, c.UserID)
+		return
+	}
+	s.conns[c.UserID] = conns
+}
+
+// Close drops every connection and refuses new ones, so that long-lived
+// requests end when the server shuts down.
+func (s *PushService) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, conns := range s.conns {
+		for _, c := range conns {
+			c.close()
+		}
+	}
+	clear(s.conns)
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitSubscribed waits until n handlers are subscribed to p, since
+// Subscribe registers them on its own goroutine.
+func waitSubscribed(t *testing.T, p *LocalPubSub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		p.mu.RLock()
+		got := len(p.handlers)
+		p.mu.RUnlock()
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("subscribed handlers = %d, want %d", got, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func receive(t *testing.T, c *PushConn) PushMessage {
+	t.Helper()
+	select {
+	case msg := <-c.Messages():
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return PushMessage{}
+	}
+}
+
+func assertNoMessage(t *testing.T, c *PushConn) {
+	t.Helper()
+	select {
+	case msg := <-c.Messages():
+		t.Fatalf("unexpected message %+v", msg)
+	default:
+	}
+}
+
+func assertClosed(t *testing.T, c *PushConn, want bool) {
+	t.Helper()
+	select {
+	case <-c.Done():
+		if !want {
+			t.Fatal("connection was closed")
+		}
+	default:
+		if want {
+			t.Fatal("connection is still open")
+		}
+	}
+}
+
+func TestLocalPubSub(t *testing.T) {
+	p := NewLocalPubSub()
+	ctx, cancel := context.WithCancel(context.Background())
+	got1 := make(chan PushMessage, 1)
+	got2 := make(chan PushMessage, 1)
+	done := make(chan struct{})
+	go func() {
+		_ = p.Subscribe(ctx, func(m PushMessage) { got1 <- m })
+		close(done)
+	}()
+	go func() { _ = p.Subscribe(ctx, func(m PushMessage) { got2 <- m }) }()
+	waitSubscribed(t, p, 2)
+
+	msg := PushMessage{UserID: 1, Type: "notification", Data: json.RawMessage(`{"id":1}`)}
+	if err := p.Publish(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	for i, got := range []chan PushMessage{got1, got2} {
+		if m := <-got; m.UserID != 1 || m.Type != "notification" || string(m.Data) != `{"id":1}` {
+			t.Errorf("subscriber %d got %+v", i+1, m)
+		}
+	}
+
+	cancel()
+	<-done
+	waitSubscribed(t, p, 0)
+	if err := p.Publish(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(got1) != 0 || len(got2) != 0 {
+		t.Error("message delivered after the subscription ended")
+	}
+}
+
+func newTestPushService(t *testing.T, cfg PushConfig) (*PushService, *LocalPubSub) {
+	t.Helper()
+	p := NewLocalPubSub()
+	s := NewPushService(p, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	s.Start(ctx)
+	waitSubscribed(t, p, 1)
+	return s, p
+}
+
+func TestPushServiceDeliversToEveryConnectionOfTheUser(t *testing.T) {
+	s, _ := newTestPushService(t, PushConfig{Buffer: 4, MaxConnsPerUser: 3})
+	phone, laptop, other := s.Connect(1), s.Connect(1), s.Connect(2)
+
+	if err := s.Push(context.Background(), 1, "message", map[string]int64{"messageId": 7}); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*PushConn{phone, laptop} {
+		msg := receive(t, c)
+		if msg.Type != "message" || string(msg.Data) != `{"messageId":7}` {
+			t.Errorf("got %+v", msg)
+		}
+	}
+	assertNoMessage(t, other)
+
+	s.Disconnect(laptop)
+	assertClosed(t, laptop, true)
+	if err := s.Push(context.Background(), 1, "message", nil); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, phone)
+	assertNoMessage(t, laptop)
+}
+
+func TestPushServiceDropsSlowConnections(t *testing.T) {
+	s, _ := newTestPushService(t, PushConfig{Buffer: 2, MaxConnsPerUser: 2})
+	slow, fast := s.Connect(1), s.Connect(1)
+
+	for i := 0; i < 3; i++ {
+		if err := s.Push(context.Background(), 1, "notification", i); err != nil {
+			t.Fatal(err)
+		}
+		if i < 2 {
+			receive(t, fast)
+		}
+	}
+	// The third message did not fit into the slow buffer.
+	assertClosed(t, slow, true)
+	assertClosed(t, fast, false)
+	receive(t, fast)
+}
+
+func TestPushServiceLimitsConnectionsPerUser(t *testing.T) {
+	s, _ := newTestPushService(t, PushConfig{Buffer: 1, MaxConnsPerUser: 2})
+	oldest, second := s.Connect(1), s.Connect(1)
+	third := s.Connect(1)
+
+	assertClosed(t, oldest, true)
+	assertClosed(t, second, false)
+	assertClosed(t, third, false)
+}
+
+func TestPushServiceClose(t *testing.T) {
+	s, _ := newTestPushService(t, PushConfig{Buffer: 1, MaxConnsPerUser: 2})
+	a, b := s.Connect(1), s.Connect(2)
+
+	s.Close()
+	assertClosed(t, a, true)
+	assertClosed(t, b, true)
+	// Connections opened during shutdown end right away.
+	assertClosed(t, s.Connect(3), true)
+}
+
+func TestConnectTicket(t *testing.T) {
+	ctx := context.Background()
+	s := NewConnectTicketService(NewLocalTicketStore(), time.Minute)
+	issued := ConnectTicket{UserID: 1, UserAgent: "browser"}
+
+	ticket, err := s.Issue(ctx, issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Redeem(ctx, ticket, "browser")
+	if err != nil || got != issued {
+		t.Fatalf("Redeem = %+v, %v; want %+v", got, err, issued)
+	}
+	if _, err = s.Redeem(ctx, ticket, "browser"); !errors.Is(err, ErrInvalidTicket) {
+		t.Errorf("second Redeem error = %v, want ErrInvalidTicket", err)
+	}
+
+	ticket, err = s.Issue(ctx, issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Redeem(ctx, ticket, "curl"); !errors.Is(err, ErrInvalidTicket) {
+		t.Errorf("Redeem from another user agent error = %v, want ErrInvalidTicket", err)
+	}
+	// A ticket presented by the wrong client is used up as well.
+	if _, err = s.Redeem(ctx, ticket, "browser"); !errors.Is(err, ErrInvalidTicket) {
+		t.Errorf("Redeem after a mismatch error = %v, want ErrInvalidTicket", err)
+	}
+
+	if _, err = s.Redeem(ctx, "made-up", "browser"); !errors.Is(err, ErrInvalidTicket) {
+		t.Errorf("Redeem of unknown ticket error = %v, want ErrInvalidTicket", err)
+	}
+
+	expiring := NewConnectTicketService(NewLocalTicketStore(), time.Millisecond)
+	ticket, err = expiring.Issue(ctx, issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err = expiring.Redeem(ctx, ticket, "browser"); !errors.Is(err, ErrInvalidTicket) {
+		t.Errorf("Redeem of expired ticket error = %v, want ErrInvalidTicket", err)
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+var ErrRevisionNotFound = repository.ErrRevisionNotFound
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// RevisionDiff compares the content of two revisions of the same article.
+type RevisionDiff struct {
+	From domain.ArticleRevision
+	To   domain.ArticleRevision
+	// Unified is the change from From to To in unified diff format, empty when
+	// the content is identical.
+	Unified string
+}
+
+// Revisions returns one page of the author's revisions of an article, newest
+// first, without their content.
+func (s *ArticleService) Revisions(ctx context.Context, id, authorId int64, offset, limit int) ([]domain.ArticleRevision, error) {
+	if _, err := s.Draft(ctx, id, authorId); err != nil {
+		return nil, err
+	}
+	return s.repo.FindRevisions(ctx, id, offset, limit)
+}
+
+// Revision returns a single revision of the author's article.
+func (s *ArticleService) Revision(ctx context.Context, id, revisionId, authorId int64) (domain.ArticleRevision, error) {
+	if _, err := s.Draft(ctx, id, authorId); err != nil {
+		return domain.ArticleRevision{}, err
+	}
+	return s.repo.FindRevision(ctx, id, revisionId)
+}
+
+// Diff compares two revisions of the author's article, showing what changed
+// from fromId to toId. Either may be the older one.
+func (s *ArticleService) Diff(ctx context.Context, id, fromId, toId, authorId int64) (RevisionDiff, error) {
+	from, err := s.Revision(ctx, id, fromId, authorId)
+	if err != nil {
+		return RevisionDiff{}, err
+	}
+	to, err := s.repo.FindRevision(ctx, id, toId)
+	if err != nil {
+		return RevisionDiff{}, err
+	}
+
+	unified, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(from.Content),
+		B:        splitLines(to.Content),
+		FromFile: fmt.Sprintf("revision %d", from.ID),
+		FromDate: from.Ctime.UTC().Format("2006-01-02 15:04:05"),
+		ToFile:   fmt.Sprintf("revision %d", to.ID),
+		ToDate:   to.Ctime.UTC().Format("2006-01-02 15:04:05"),
+		Context:  diffContext,
+	})
+	if err != nil {
+		return RevisionDiff{}, err
+	}
+	return RevisionDiff{From: from, To: to, Unified: unified}, nil
+}
+
+// Restore makes a revision the current working copy. It is saved like any
+// other edit, so it records a new revision and a published article stays
+// unchanged until the author publishes again.
+func (s *ArticleService) Restore(ctx context.Context, id, revisionId, authorId int64) (domain.Article, error) {
+	rev, err := s.Revision(ctx, id, revisionId, authorId)
+	if err != nil {
+		return domain.Article{}, err
+	}
+	_, err = s.Save(ctx, domain.Article{
+		ID:      id,
+		Title:   rev.Title,
+		Content: rev.Content,
+		Author:  domain.Author{ID: authorId},
+	})
+	if err != nil {
+		return domain.Article{}, err
+	}
+	return s.Draft(ctx, id, authorId)
+}
+
+// pruneRevisions applies the retention limit after a save. Failing to prune
+// only leaves extra revisions behind until the next save, so it is logged
+// instead of failing the save.
+func (s *ArticleService) pruneRevisions(ctx context.Context, id int64) {
+	if _, err := s.repo.PruneRevisions(ctx, id, s.maxRevisions); err != nil {
+		log.Printf("prune revisions of article %d: %v", id, err)
+	}
+}
+
+// splitLines splits text into newline-terminated lines. Unlike
+// difflib.SplitLines it does not add an empty line after a trailing newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	lines := strings.SplitAfter(s, "\n")
+	return lines[:len(lines)-1]
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/event"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+var ErrArticleNotScheduled = errors.New("article is not scheduled")
+
+// maxScheduleAhead limits how far in the future a post can be queued.
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+// Schedule saves the working copy and queues it to be published at
+// publishAt. Later edits are published too, as long as they happen before
+// that time.
+func (s *ArticleService) Schedule(ctx context.Context, art domain.Article, publishAt time.Time) (int64, error) {
+	if err := validateArticle(art, true); err != nil {
+		return 0, err
+	}
+	if err := validatePublishAt(publishAt); err != nil {
+		return 0, err
+	}
+	id, err := s.Save(ctx, art)
+	if err != nil {
+		return 0, err
+	}
+	return id, s.repo.SetPublishAt(ctx, id, art.Author.ID, publishAt)
+}
+
+// Reschedule moves a scheduled article to a new time.
+func (s *ArticleService) Reschedule(ctx context.Context, id, authorId int64, publishAt time.Time) error {
+	if err := validatePublishAt(publishAt); err != nil {
+		return err
+	}
+	if _, err := s.scheduledDraft(ctx, id, authorId); err != nil {
+		return err
+	}
+	return s.repo.SetPublishAt(ctx, id, authorId, publishAt)
+}
+
+// CancelSchedule takes an article out of the queue. The working copy stays
+// as it is.
+func (s *ArticleService) CancelSchedule(ctx context.Context, id, authorId int64) error {
+	if _, err := s.scheduledDraft(ctx, id, authorId); err != nil {
+		return err
+	}
+	return s.repo.SetPublishAt(ctx, id, authorId, time.Time{})
+}
+
+// Scheduled returns one page of the author's scheduled articles, the next to
+// be published first.
+func (s *ArticleService) Scheduled(ctx context.Context, authorId int64, offset, limit int) ([]domain.Article, error) {
+	return s.repo.FindScheduledByAuthor(ctx, authorId, offset, limit)
+}
+
+// PublishDue publishes up to batch articles whose scheduled time has passed
+// and returns how many it published. It is safe to run on several instances
+// at once: each article is published by exactly one of them. An article that
+// fails does not hold up the rest of the batch; the failures are returned
+// together once the batch is done.
+func (s *ArticleService) PublishDue(ctx context.Context, now time.Time, batch int) (int, error) {
+	arts, err := s.repo.FindDue(ctx, now, batch)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	var errs []error
+	for _, art := range arts {
+		if err = validateArticle(art, true); err != nil {
+			// The author cleared the title after scheduling. Leave the
+			// article unpublished rather than retrying it forever.
+			log.Printf("cancel scheduled publish of article %d: %v", art.ID, err)
+			if err = s.repo.SetPublishAt(ctx, art.ID, art.Author.ID, time.Time{}); err != nil {
+				log.Printf("cancel scheduled publish of article %d: %v", art.ID, err)
+				errs = append(errs, fmt.Errorf("article %d: %w", art.ID, err))
+			}
+			continue
+		}
+		err = s.repo.PublishScheduled(ctx, art)
+		if errors.Is(err, repository.ErrScheduleChanged) {
+			continue
+		}
+		if err != nil {
+			log.Printf("publish scheduled article %d: %v", art.ID, err)
+			errs = append(errs, fmt.Errorf("article %d: %w", art.ID, err))
+			continue
+		}
+		s.pruneRevisions(ctx, art.ID)
+		s.events.Publish(ctx, event.ArticlePublished{ArticleID: art.ID, AuthorID: art.Author.ID})
+		published++
+	}
+	return published, errors.Join(errs...)
+}
+
+func (s *ArticleService) scheduledDraft(ctx context.Context, id, authorId int64) (domain.Article, error) {
+	art, err := s.Draft(ctx, id, authorId)
+	if err != nil {
+		return domain.Article{}, err
+	}
+	if art.PublishAt.IsZero() {
+		return domain.Article{}, ErrArticleNotScheduled
+	}
+	return art, nil
+}
+
+func validatePublishAt(publishAt time.Time) error {
+	now := time.Now()
+	if !publishAt.After(now) {
+		return fmt.Errorf("%w: publish time must be in the future", ErrInvalidArticle)
+	}
+	if publishAt.After(now.Add(maxScheduleAhead)) {
+		return fmt.Errorf("%w: publish time must be within a year", ErrInvalidArticle)
+	}
+	return nil
+}
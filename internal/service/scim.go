@@ -0,0 +1,395 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrScimUnauthorized  = errors.New("invalid scim bearer token")
+	ErrScimInvalidFilter = errors.New("invalid scim filter")
+	ErrScimInvalidPath   = errors.New("unsupported scim attribute path")
+	ErrScimInvalidValue  = errors.New("invalid scim attribute value")
+)
+
+// ScimPatchOp is one operation of a SCIM PATCH request (RFC 7644 §3.5.2).
+// Value holds the decoded JSON value.
+type ScimPatchOp struct {
+	Op    string
+	Path  string
+	Value any
+}
+
+// ScimUserStore is the part of the user repository SCIM provisioning needs.
+// *repository.UserRepository implements it.
+type ScimUserStore interface {
+	Create(ctx context.Context, user domain.User) (int64, error)
+	FindByTenantAndID(ctx context.Context, tenantId, id int64) (domain.User, error)
+	FindByTenant(ctx context.Context, tenantId int64, filters []domain.UserFilter,
+		offset, limit int) ([]domain.User, int64, error)
+	UpdateProvisioned(ctx context.Context, user domain.User) error
+}
+
+// ScimService maps SCIM 2.0 user provisioning onto the user repository.
+// Every operation is scoped to the tenant that authenticated the request, so
+// one directory can never see or modify another tenant's users.
+type ScimService struct {
+	tenantRepo *repository.ScimTenantRepository
+	userRepo   ScimUserStore
+}
+
+func NewScimService(tenantRepo *repository.ScimTenantRepository, userRepo ScimUserStore) *ScimService {
+	return &ScimService{
+		tenantRepo: tenantRepo,
+		userRepo:   userRepo,
+	}
+}
+
+// CreateTenant registers a tenant and returns its bearer token. The token is
+// not stored in plain text and cannot be shown again.
+func (s *ScimService) CreateTenant(ctx context.Context, name string) (domain.ScimTenant, string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return domain.ScimTenant{}, "", err
+	}
+	id, err := s.tenantRepo.Create(ctx, name, hashToken(token))
+	if err != nil {
+		return domain.ScimTenant{}, "", err
+	}
+	return domain.ScimTenant{ID: id, Name: name}, token, nil
+}
+
+func (s *ScimService) Authenticate(ctx context.Context, token string) (domain.ScimTenant, error) {
+	tenant, err := s.tenantRepo.FindByTokenHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrScimTenantNotFound) {
+			return domain.ScimTenant{}, ErrScimUnauthorized
+		}
+		return domain.ScimTenant{}, err
+	}
+	return tenant, nil
+}
+
+func (s *ScimService) CreateUser(ctx context.Context, tenantId int64, user domain.User) (domain.User, error) {
+	user.TenantId = tenantId
+	// Directories usually rely on SSO and send no password. Such users keep an
+	// empty hash, which never matches at login.
+	if user.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return domain.User{}, err
+		}
+		user.Password = string(hash)
+	}
+
+	id, err := s.userRepo.Create(ctx, user)
+	if err != nil {
+		if errors.Is(err, repository.ErrDuplicateEmail) {
+			return domain.User{}, ErrDuplicateEmail
+		}
+		return domain.User{}, err
+	}
+	return s.GetUser(ctx, tenantId, id)
+}
+
+func (s *ScimService) GetUser(ctx context.Context, tenantId, id int64) (domain.User, error) {
+	user, err := s.userRepo.FindByTenantAndID(ctx, tenantId, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return domain.User{}, ErrUserNotFound
+		}
+		return domain.User{}, err
+	}
+	return user, nil
+}
+
+// ListUsers returns one page of the tenant's users. startIndex is 1-based as
+// in SCIM; filter is a SCIM filter expression and may be empty.
+func (s *ScimService) ListUsers(ctx context.Context, tenantId int64, filter string,
+	startIndex, count int) ([]domain.User, int64, error) {
+	filters, err := parseScimFilter(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	users, total, err := s.userRepo.FindByTenant(ctx, tenantId, filters, startIndex-1, count)
+	if err != nil {
+		if errors.Is(err, repository.ErrUnsupportedFilter) {
+			return nil, 0, fmt.Errorf("%w: %w", ErrScimInvalidFilter, err)
+		}
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (s *ScimService) PatchUser(ctx context.Context, tenantId, id int64, ops []ScimPatchOp) (domain.User, error) {
+	user, err := s.GetUser(ctx, tenantId, id)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	for _, op := range ops {
+		if err = applyScimPatch(&user, op); err != nil {
+			return domain.User{}, err
+		}
+	}
+
+	if err = s.save(ctx, user); err != nil {
+		return domain.User{}, err
+	}
+	return s.GetUser(ctx, tenantId, id)
+}
+
+// DeactivateUser handles SCIM DELETE. The account is kept, so the user's
+// content survives and the directory can reactivate it later.
+func (s *ScimService) DeactivateUser(ctx context.Context, tenantId, id int64) error {
+	user, err := s.GetUser(ctx, tenantId, id)
+	if err != nil {
+		return err
+	}
+	if user.Deactivated {
+		return nil
+	}
+	user.Deactivated = true
+	return s.save(ctx, user)
+}
+
+func (s *ScimService) save(ctx context.Context, user domain.User) error {
+	err := s.userRepo.UpdateProvisioned(ctx, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrDuplicateEmail):
+			return ErrDuplicateEmail
+		case errors.Is(err, repository.ErrUserNotFound):
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// scimUserField maps a SCIM attribute path to the domain field it is stored in.
+// Attribute names are case-insensitive in SCIM.
+func scimUserField(path string) (string, bool) {
+	switch strings.ToLower(path) {
+	case "username", "emails.value", `emails[type eq "work"].value`:
+		return domain.UserFieldEmail, true
+	case "displayname", "name.formatted":
+		return domain.UserFieldNickname, true
+	case "externalid":
+		return domain.UserFieldExternalId, true
+	case "active":
+		return domain.UserFieldActive, true
+	}
+	return "", false
+}
+
+func applyScimPatch(user *domain.User, op ScimPatchOp) error {
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+		if op.Path == "" {
+			// Without a path the value is an object of attribute -> value.
+			attrs, ok := op.Value.(map[string]any)
+			if !ok {
+				return ErrScimInvalidValue
+			}
+			for path, v := range attrs {
+				if path == "name" {
+					// {"name": {"formatted": "..."}}
+					name, ok := v.(map[string]any)
+					if !ok {
+						return ErrScimInvalidValue
+					}
+					if formatted, ok := name["formatted"]; ok {
+						if err := setScimAttr(user, "name.formatted", formatted); err != nil {
+							return err
+						}
+					}
+					continue
+				}
+				if err := setScimAttr(user, path, v); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return setScimAttr(user, op.Path, op.Value)
+	case "remove":
+		field, ok := scimUserField(op.Path)
+		if !ok {
+			return ErrScimInvalidPath
+		}
+		switch field {
+		case domain.UserFieldNickname:
+			user.Nickname = ""
+		case domain.UserFieldExternalId:
+			user.ExternalId = ""
+		default:
+			// userName and active are required attributes.
+			return ErrScimInvalidValue
+		}
+		return nil
+	}
+	return ErrScimInvalidValue
+}
+
+func setScimAttr(user *domain.User, path string, value any) error {
+	field, ok := scimUserField(path)
+	if !ok {
+		return ErrScimInvalidPath
+	}
+
+	if field == domain.UserFieldActive {
+		// Some directories send booleans as the strings "True"/"False".
+		switch v := value.(type) {
+		case bool:
+			user.Deactivated = !v
+		case string:
+			switch strings.ToLower(v) {
+			case "true":
+				user.Deactivated = false
+			case "false":
+				user.Deactivated = true
+			default:
+				return ErrScimInvalidValue
+			}
+		default:
+			return ErrScimInvalidValue
+		}
+		return nil
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		return ErrScimInvalidValue
+	}
+	switch field {
+	case domain.UserFieldEmail:
+		if str == "" {
+			return ErrScimInvalidValue
+		}
+		user.Email = str
+	case domain.UserFieldNickname:
+		user.Nickname = str
+	case domain.UserFieldExternalId:
+		user.ExternalId = str
+	}
+	return nil
+}
+
+// parseScimFilter parses the subset of the SCIM filter grammar that identity
+// providers use in practice: comparisons joined by "and", e.g.
+//
+//	userName eq "alice@example.com" and active eq true
+func parseScimFilter(filter string) ([]domain.UserFilter, error) {
+	tokens, err := tokenizeScimFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []domain.UserFilter
+	for i := 0; i < len(tokens); {
+		if len(res) > 0 {
+			if !strings.EqualFold(tokens[i], "and") {
+				return nil, ErrScimInvalidFilter
+			}
+			i++
+		}
+		if i+1 >= len(tokens) {
+			return nil, ErrScimInvalidFilter
+		}
+
+		field, ok := scimUserField(tokens[i])
+		if !ok {
+			return nil, ErrScimInvalidFilter
+		}
+		op := strings.ToLower(tokens[i+1])
+		i += 2
+
+		cond := domain.UserFilter{Field: field, Op: op}
+		switch op {
+		case "pr":
+		case "eq", "ne", "co", "sw", "ew":
+			if i >= len(tokens) {
+				return nil, ErrScimInvalidFilter
+			}
+			cond.Value = unquoteScim(tokens[i])
+			i++
+		default:
+			return nil, ErrScimInvalidFilter
+		}
+		if err = checkScimFilter(cond); err != nil {
+			return nil, err
+		}
+		res = append(res, cond)
+	}
+	return res, nil
+}
+
+// checkScimFilter rejects comparisons that are valid SCIM but cannot be
+// answered: active is a boolean, so it only supports eq and ne against true
+// or false.
+func checkScimFilter(cond domain.UserFilter) error {
+	if cond.Field != domain.UserFieldActive {
+		return nil
+	}
+	if cond.Op != "eq" && cond.Op != "ne" {
+		return fmt.Errorf("%w: operator %q is not supported for active", ErrScimInvalidFilter, cond.Op)
+	}
+	if cond.Value != "true" && cond.Value != "false" {
+		return fmt.Errorf("%w: active must be compared to true or false", ErrScimInvalidFilter)
+	}
+	return nil
+}
+
+func tokenizeScimFilter(filter string) ([]string, error) {
+	var (
+		tokens []string
+		cur    strings.Builder
+	)
+	runes := []rune(filter)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '"':
+			// Quoted strings are kept with their quotes so "and" inside a value
+			// is not mistaken for the operator.
+			cur.WriteRune(r)
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				cur.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrScimInvalidFilter)
+			}
+			cur.WriteRune('"')
+		case unicode.IsSpace(r):
+			if cur.Len() > 0 {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens, nil
+}
+
+func unquoteScim(token string) string {
+	if len(token) >= 2 && token[0] == '"' && token[len(token)-1] == '"' {
+		return token[1 : len(token)-1]
+	}
+	// Unquoted values are booleans, numbers or null.
+	return strings.ToLower(token)
+}
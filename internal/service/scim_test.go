@@ -0,0 +1,358 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+// memScimUsers is an in-memory ScimUserStore. It only answers eq filters on
+// email and active, like a repository with a limited index would.
+type memScimUsers struct {
+	users   map[int64]domain.User
+	nextID  int64
+	updates int
+}
+
+func newMemScimUsers() *memScimUsers {
+	return &memScimUsers{users: map[int64]domain.User{}}
+}
+
+func (m *memScimUsers) Create(_ context.Context, user domain.User) (int64, error) {
+	for _, u := range m.users {
+		if u.Email == user.Email {
+			return 0, repository.ErrDuplicateEmail
+		}
+	}
+	m.nextID++
+	user.ID = m.nextID
+	m.users[user.ID] = user
+	return user.ID, nil
+}
+
+func (m *memScimUsers) FindByTenantAndID(_ context.Context, tenantId, id int64) (domain.User, error) {
+	u, ok := m.users[id]
+	if !ok || u.TenantId != tenantId {
+		return domain.User{}, repository.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (m *memScimUsers) FindByTenant(_ context.Context, tenantId int64, filters []domain.UserFilter,
+	offset, limit int) ([]domain.User, int64, error) {
+	var res []domain.User
+	for id := int64(1); id <= m.nextID; id++ {
+		u, ok := m.users[id]
+		if !ok || u.TenantId != tenantId {
+			continue
+		}
+		match := true
+		for _, f := range filters {
+			if f.Op != "eq" {
+				return nil, 0, fmt.Errorf("%w: operator %q", repository.ErrUnsupportedFilter, f.Op)
+			}
+			switch f.Field {
+			case domain.UserFieldEmail:
+				match = match && u.Email == f.Value
+			case domain.UserFieldActive:
+				match = match && (!u.Deactivated) == (f.Value == "true")
+			default:
+				return nil, 0, fmt.Errorf("%w: field %q", repository.ErrUnsupportedFilter, f.Field)
+			}
+		}
+		if match {
+			res = append(res, u)
+		}
+	}
+	total := int64(len(res))
+	res = res[min(offset, len(res)):]
+	return res[:min(limit, len(res))], total, nil
+}
+
+func (m *memScimUsers) UpdateProvisioned(_ context.Context, user domain.User) error {
+	if _, ok := m.users[user.ID]; !ok {
+		return repository.ErrUserNotFound
+	}
+	m.updates++
+	m.users[user.ID] = user
+	return nil
+}
+
+func newTestScimService(t *testing.T) (*ScimService, *memScimUsers, int64) {
+	t.Helper()
+	users := newMemScimUsers()
+	svc := NewScimService(nil, users)
+	u, err := svc.CreateUser(context.Background(), 1, domain.User{
+		Email:      "alice@example.com",
+		Nickname:   "Alice",
+		ExternalId: "ext-1",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return svc, users, u.ID
+}
+
+func TestParseScimFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		want    []domain.UserFilter
+		wantErr bool
+	}{
+		{name: "empty", filter: ""},
+		{
+			name:   "eq",
+			filter: `userName eq "alice@example.com"`,
+			want:   []domain.UserFilter{{Field: domain.UserFieldEmail, Op: "eq", Value: "alice@example.com"}},
+		},
+		{
+			name:   "case-insensitive attribute and operator",
+			filter: `USERNAME EQ "a@b.c"`,
+			want:   []domain.UserFilter{{Field: domain.UserFieldEmail, Op: "eq", Value: "a@b.c"}},
+		},
+		{
+			name:   "and inside a quoted value",
+			filter: `displayName co "Tom and Jerry" and active eq True`,
+			want: []domain.UserFilter{
+				{Field: domain.UserFieldNickname, Op: "co", Value: "Tom and Jerry"},
+				{Field: domain.UserFieldActive, Op: "eq", Value: "true"},
+			},
+		},
+		{
+			name:   "escaped quote",
+			filter: `externalId eq "a\"b"`,
+			want:   []domain.UserFilter{{Field: domain.UserFieldExternalId, Op: "eq", Value: `a"b`}},
+		},
+		{
+			name:   "present",
+			filter: `externalId pr`,
+			want:   []domain.UserFilter{{Field: domain.UserFieldExternalId, Op: "pr"}},
+		},
+		{name: "unknown attribute", filter: `title eq "x"`, wantErr: true},
+		{name: "unknown operator", filter: `userName gt "x"`, wantErr: true},
+		{name: "missing value", filter: `userName eq`, wantErr: true},
+		{name: "or", filter: `userName eq "a" or userName eq "b"`, wantErr: true},
+		{name: "unterminated string", filter: `userName eq "a`, wantErr: true},
+		{name: "active pr", filter: `active pr`, wantErr: true},
+		{name: "active co", filter: `active co "x"`, wantErr: true},
+		{name: "active not boolean", filter: `active eq "yes"`, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseScimFilter(tc.filter)
+			if tc.wantErr {
+				if !errors.Is(err, ErrScimInvalidFilter) {
+					t.Fatalf("err = %v, want ErrScimInvalidFilter", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestScimListUsers(t *testing.T) {
+	svc, users, id := newTestScimService(t)
+	ctx := context.Background()
+	if _, err := svc.CreateUser(ctx, 2, domain.User{Email: "bob@example.com"}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	got, total, err := svc.ListUsers(ctx, 1, `userName eq "alice@example.com" and active eq true`, 1, 10)
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if total != 1 || len(got) != 1 || got[0].ID != id {
+		t.Fatalf("got %+v (total %d), want only alice", got, total)
+	}
+
+	// Other tenants' users are never listed.
+	got, _, err = svc.ListUsers(ctx, 1, `userName eq "bob@example.com"`, 1, 10)
+	if err != nil || len(got) != 0 {
+		t.Fatalf("got %+v, %v; want no users", got, err)
+	}
+
+	// A filter the store cannot answer is reported as an invalid filter.
+	_, _, err = svc.ListUsers(ctx, 1, `userName co "alice"`, 1, 10)
+	if !errors.Is(err, ErrScimInvalidFilter) {
+		t.Fatalf("err = %v, want ErrScimInvalidFilter", err)
+	}
+	if users.updates != 0 {
+		t.Fatalf("listing wrote %d updates", users.updates)
+	}
+}
+
+func TestScimPatchUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     []ScimPatchOp
+		check   func(t *testing.T, u domain.User)
+		wantErr error
+	}{
+		{
+			name: "replace with path",
+			ops:  []ScimPatchOp{{Op: "replace", Path: "displayName", Value: "Al"}},
+			check: func(t *testing.T, u domain.User) {
+				if u.Nickname != "Al" {
+					t.Fatalf("Nickname = %q", u.Nickname)
+				}
+			},
+		},
+		{
+			name: "replace without path",
+			ops: []ScimPatchOp{{Op: "Replace", Value: map[string]any{
+				"userName": "al@example.com",
+				"name":     map[string]any{"formatted": "Al Ice"},
+			}}},
+			check: func(t *testing.T, u domain.User) {
+				if u.Email != "al@example.com" || u.Nickname != "Al Ice" {
+					t.Fatalf("got %q %q", u.Email, u.Nickname)
+				}
+			},
+		},
+		{
+			name: "deactivate with a string boolean",
+			ops:  []ScimPatchOp{{Op: "replace", Path: "active", Value: "False"}},
+			check: func(t *testing.T, u domain.User) {
+				if !u.Deactivated {
+					t.Fatal("user is still active")
+				}
+			},
+		},
+		{
+			name: "deactivate and reactivate",
+			ops: []ScimPatchOp{
+				{Op: "replace", Value: map[string]any{"active": false}},
+				{Op: "replace", Path: "active", Value: true},
+			},
+			check: func(t *testing.T, u domain.User) {
+				if u.Deactivated {
+					t.Fatal("user is still deactivated")
+				}
+			},
+		},
+		{
+			name: "remove optional attribute",
+			ops:  []ScimPatchOp{{Op: "remove", Path: "externalId"}},
+			check: func(t *testing.T, u domain.User) {
+				if u.ExternalId != "" {
+					t.Fatalf("ExternalId = %q", u.ExternalId)
+				}
+			},
+		},
+		{
+			name:    "remove required attribute",
+			ops:     []ScimPatchOp{{Op: "remove", Path: "userName"}},
+			wantErr: ErrScimInvalidValue,
+		},
+		{
+			name:    "unknown path",
+			ops:     []ScimPatchOp{{Op: "replace", Path: "title", Value: "x"}},
+			wantErr: ErrScimInvalidPath,
+		},
+		{
+			name:    "active not boolean",
+			ops:     []ScimPatchOp{{Op: "replace", Path: "active", Value: 1.0}},
+			wantErr: ErrScimInvalidValue,
+		},
+		{
+			name:    "empty userName",
+			ops:     []ScimPatchOp{{Op: "replace", Path: "userName", Value: ""}},
+			wantErr: ErrScimInvalidValue,
+		},
+		{
+			name:    "unknown op",
+			ops:     []ScimPatchOp{{Op: "move", Path: "displayName", Value: "x"}},
+			wantErr: ErrScimInvalidValue,
+		},
+		{
+			// A failing operation leaves the user unchanged, even after
+			// earlier operations in the same request succeeded.
+			name: "failure is atomic",
+			ops: []ScimPatchOp{
+				{Op: "replace", Path: "displayName", Value: "changed"},
+				{Op: "replace", Path: "title", Value: "x"},
+			},
+			wantErr: ErrScimInvalidPath,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			svc, users, id := newTestScimService(t)
+			before := users.users[id]
+			u, err := svc.PatchUser(context.Background(), 1, id, tc.ops)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tc.wantErr)
+				}
+				if !reflect.DeepEqual(users.users[id], before) {
+					t.Fatalf("user changed to %+v", users.users[id])
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PatchUser: %v", err)
+			}
+			tc.check(t, u)
+			if !reflect.DeepEqual(users.users[id], u) {
+				t.Fatalf("stored %+v, returned %+v", users.users[id], u)
+			}
+		})
+	}
+}
+
+func TestScimPatchUserOtherTenant(t *testing.T) {
+	svc, _, id := newTestScimService(t)
+	_, err := svc.PatchUser(context.Background(), 2, id, []ScimPatchOp{{Op: "replace", Path: "displayName", Value: "x"}})
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestScimDeactivateUser(t *testing.T) {
+	svc, users, id := newTestScimService(t)
+	ctx := context.Background()
+
+	if err := svc.DeactivateUser(ctx, 2, id); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("other tenant: err = %v, want ErrUserNotFound", err)
+	}
+	if err := svc.DeactivateUser(ctx, 1, 99); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("unknown user: err = %v, want ErrUserNotFound", err)
+	}
+
+	if err := svc.DeactivateUser(ctx, 1, id); err != nil {
+		t.Fatalf("DeactivateUser: %v", err)
+	}
+	u := users.users[id]
+	if !u.Deactivated {
+		t.Fatal("user is still active")
+	}
+	if u.Email != "alice@example.com" || u.Nickname != "Alice" {
+		t.Fatalf("deactivation changed the profile: %+v", u)
+	}
+
+	// Deactivating again does not write, so the deactivation time is kept.
+	if err := svc.DeactivateUser(ctx, 1, id); err != nil {
+		t.Fatalf("DeactivateUser again: %v", err)
+	}
+	if users.updates != 1 {
+		t.Fatalf("updates = %d, want 1", users.updates)
+	}
+
+	// Deactivated users can still be read and reactivated by the directory.
+	u, err := svc.PatchUser(ctx, 1, id, []ScimPatchOp{{Op: "replace", Path: "active", Value: true}})
+	if err != nil || u.Deactivated {
+		t.Fatalf("reactivate: %+v, %v", u, err)
+	}
+}
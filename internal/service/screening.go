@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository"
+)
+
+// ScreeningRule is one check of the signup screening pipeline. It returns an
+// empty reason to let the attempt through, or a reason and a detail for
+// reviewers to reject it.
+type ScreeningRule interface {
+	Check(ctx context.Context, attempt domain.SignupAttempt) (domain.ScreeningReason, string, error)
+}
+
+// SignupScreeningService runs signup attempts through its rules before an
+// account is created. Rules run in order and the first rejection wins, so
+// cheap checks should come first. Every decision is recorded.
+type SignupScreeningService struct {
+	repo  *repository.ScreeningRepository
+	rules []ScreeningRule
+}
+
+func NewSignupScreeningService(repo *repository.ScreeningRepository, rules ...ScreeningRule) *SignupScreeningService {
+	return &SignupScreeningService{
+		repo:  repo,
+		rules: rules,
+	}
+}
+
+func (s *SignupScreeningService) Screen(ctx context.Context, attempt domain.SignupAttempt) (domain.ScreeningDecision, error) {
+	decision := domain.ScreeningDecision{
+		Email:  attempt.Email,
+		IP:     attempt.IP,
+		Subnet: signupSubnet(attempt.IP),
+		Ctime:  time.Now(),
+	}
+	for _, rule := range s.rules {
+		reason, detail, err := rule.Check(ctx, attempt)
+		if err != nil {
+			return domain.ScreeningDecision{}, err
+		}
+		if reason != "" {
+			decision.Reason = reason
+			decision.Detail = detail
+			break
+		}
+	}
+
+	id, err := s.repo.Record(ctx, decision)
+	if err != nil {
+		// The record is for review only; losing it must not block signups.
+		log.Printf("record signup screening decision for %s: %v", attempt.IP, err)
+	}
+	decision.ID = id
+	return decision, nil
+}
+
+// signupSubnet groups addresses that are usually controlled by one party:
+// the /24 for IPv4 and the /64 for IPv6.
+func signupSubnet(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	bits := 64
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.String()
+}
+
+// emailDomain returns the lower-cased part of email after the last "@".
+func emailDomain(email string) string {
+	i := strings.LastIndexByte(email, '@')
+	if i < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSuffix(email[i+1:], "."))
+}
+
+// HoneypotRule rejects attempts that filled in the hidden honeypot field.
+type HoneypotRule struct{}
+
+func NewHoneypotRule() *HoneypotRule {
+	return &HoneypotRule{}
+}
+
+func (r *HoneypotRule) Check(_ context.Context, attempt domain.SignupAttempt) (domain.ScreeningReason, string, error) {
+	if attempt.Honeypot != "" {
+		return domain.ScreeningReasonHoneypot, "honeypot field was filled in", nil
+	}
+	return "", "", nil
+}
+
+// DisposableDomainRule rejects email addresses at throwaway mail providers.
+// Subdomains of a blocked domain are blocked too.
+type DisposableDomainRule struct {
+	domains map[string]struct{}
+}
+
+func NewDisposableDomainRule(domains []string) *DisposableDomainRule {
+	set := make(map[string]struct{}, len(domains))
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d != "" {
+			set[d] = struct{}{}
+		}
+	}
+	return &DisposableDomainRule{domains: set}
+}
+
+func (r *DisposableDomainRule) Check(_ context.Context, attempt domain.SignupAttempt) (domain.ScreeningReason, string, error) {
+	host := emailDomain(attempt.Email)
+	for host != "" {
+		if _, ok := r.domains[host]; ok {
+			return domain.ScreeningReasonDisposableEmail, "disposable domain " + host, nil
+		}
+		_, host, _ = strings.Cut(host, ".")
+	}
+	return "", "", nil
+}
+
+// VelocityRule limits how many signup attempts a single address and its
+// subnet may make within a window. Attempts are counted from the recorded
+// screening decisions, so rejected attempts count too.
+type VelocityRule struct {
+	repo      *repository.ScreeningRepository
+	window    time.Duration
+	perIP     int64
+	perSubnet int64
+}
+
+func NewVelocityRule(repo *repository.ScreeningRepository, window time.Duration, perIP, perSubnet int64) *VelocityRule {
+	return &VelocityRule{
+		repo:      repo,
+		window:    window,
+		perIP:     perIP,
+		perSubnet: perSubnet,
+	}
+}
+
+func (r *VelocityRule) Check(ctx context.Context, attempt domain.SignupAttempt) (domain.ScreeningReason, string, error) {
+	since := time.Now().Add(-r.window)
+
+	n, err := r.repo.CountByIPSince(ctx, attempt.IP, since)
+	if err != nil {
+		return "", "", err
+	}
+	if n >= r.perIP {
+		return domain.ScreeningReasonIPVelocity,
+			fmt.Sprintf("%d attempts from %s within %v", n, attempt.IP, r.window), nil
+	}
+
+	subnet := signupSubnet(attempt.IP)
+	if subnet == "" {
+		return "", "", nil
+	}
+	n, err = r.repo.CountBySubnetSince(ctx, subnet, since)
+	if err != nil {
+		return "", "", err
+	}
+	if n >= r.perSubnet {
+		return domain.ScreeningReasonSubnetVelocity,
+			fmt.Sprintf("%d attempts from %s within %v", n, subnet, r.window), nil
+	}
+	return "", "", nil
+}
+
+// MXResolver looks up mail servers. *net.Resolver implements it; tests and
+// offline environments can inject their own.
+type MXResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+// MXRule rejects email domains that cannot receive mail. Lookup failures other
+// than "no such domain" let the attempt through, so a DNS outage does not
+// stop all signups.
+type MXRule struct {
+	resolver MXResolver
+	timeout  time.Duration
+}
+
+func NewMXRule(resolver MXResolver, timeout time.Duration) *MXRule {
+	return &MXRule{
+		resolver: resolver,
+		timeout:  timeout,
+	}
+}
+
+func (r *MXRule) Check(ctx context.Context, attempt domain.SignupAttempt) (domain.ScreeningReason, string, error) {
+	host := emailDomain(attempt.Email)
+	if host == "" {
+		return "", "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	records, err := r.resolver.LookupMX(ctx, host)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return domain.ScreeningReasonNoMailServer, "no MX records for " + host, nil
+		}
+		log.Printf("lookup MX for %s: %v", host, err)
+		return "", "", nil
+	}
+	// A single "." record is a null MX (RFC 7505): the domain accepts no mail.
+	if len(records) == 0 || (len(records) == 1 && records[0].Host == ".") {
+		return domain.ScreeningReasonNoMailServer, "no MX records for " + host, nil
+	}
+	return "", "", nil
+}
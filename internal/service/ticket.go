@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrInvalidTicket = errors.New("invalid or expired ticket")
+
+// ConnectTicket is the session a ticket was issued to.
+type ConnectTicket struct {
+	UserID int64 `json:"userId"`
+	Guest  bool  `json:"guest"`
+	// UserAgent must match when the ticket is redeemed, like for tokens.
+	UserAgent string `json:"userAgent"`
+}
+
+// TicketStore keeps connect tickets until they are redeemed or expire.
+type TicketStore interface {
+	Save(ctx context.Context, ticket string, t ConnectTicket, ttl time.Duration) error
+	// Take returns the ticket and deletes it, so it works only once. ok is
+	// false for unknown and expired tickets.
+	Take(ctx context.Context, ticket string) (t ConnectTicket, ok bool, err error)
+}
+
+// ConnectTicketService issues one-time tickets for opening real-time
+// connections. Browsers cannot set headers on WebSockets and EventSource, so
+// the credential goes in the URL, where proxies and access logs see it. A
+// ticket is useless once it was used or a few seconds passed, unlike the
+// login token it stands in for.
+type ConnectTicketService struct {
+	store TicketStore
+	ttl   time.Duration
+}
+
+func NewConnectTicketService(store TicketStore, ttl time.Duration) *ConnectTicketService {
+	return &ConnectTicketService{store: store, ttl: ttl}
+}
+
+// TTL is how long a ticket can be redeemed.
+func (s *ConnectTicketService) TTL() time.Duration {
+	return s.ttl
+}
+
+func (s *ConnectTicketService) Issue(ctx context.Context, t ConnectTicket) (string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(b[:])
+	if err := s.store.Save(ctx, ticket, t, s.ttl); err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// Redeem uses up a ticket. It returns ErrInvalidTicket if the ticket is
+// unknown, expired, used, or was issued to another user agent.
+func (s *ConnectTicketService) Redeem(ctx context.Context, ticket, userAgent string) (ConnectTicket, error) {
+	t, ok, err := s.store.Take(ctx, ticket)
+	if err != nil {
+		return ConnectTicket{}, err
+	}
+	if !ok || t.UserAgent != userAgent {
+		return ConnectTicket{}, ErrInvalidTicket
+	}
+	return t, nil
+}
+
+// RedisTicketStore lets a ticket issued by one instance be redeemed on any
+// other, e.g. behind a load balancer without sticky sessions.
+type RedisTicketStore struct {
+	client redis.Cmdable
+}
+
+func NewRedisTicketStore(client redis.Cmdable) *RedisTicketStore {
+	return &RedisTicketStore{client: client}
+}
+
+func (s *RedisTicketStore) Save(ctx context.Context, ticket string, t ConnectTicket, ttl time.Duration) error {
+	val, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, "realtime:ticket:"+ticket, val, ttl).Err()
+}
+
+func (s *RedisTicketStore) Take(ctx context.Context, ticket string) (ConnectTicket, bool, error) {
+	val, err := s.client.GetDel(ctx, "realtime:ticket:"+ticket).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return ConnectTicket{}, false, nil
+	}
+	if err != nil {
+		return ConnectTicket{}, false, err
+	}
+	var t ConnectTicket
+	if err := json.Unmarshal(val, &t); err != nil {
+		return ConnectTicket{}, false, err
+	}
+	return t, true, nil
+}
+
+// LocalTicketStore keeps tickets in memory, so a ticket only works when the
+// connection lands on the instance that issued it.
+type LocalTicketStore struct {
+	mu      sync.Mutex
+	tickets map[string]localTicket
+}
+
+type localTicket struct {
+	ticket  ConnectTicket
+	expires time.Time
+}
+
+func NewLocalTicketStore() *LocalTicketStore {
+	return &LocalTicketStore{tickets: make(map[string]localTicket)}
+}
+
+func (s *LocalTicketStore) Save(_ context.Context, ticket string, t ConnectTicket, ttl time.Duration) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Tickets that were never redeemed are dropped here.
+	for k, lt := range s.tickets {
+		if now.After(lt.expires) {
+			delete(s.tickets, k)
+		}
+	}
+	s.tickets[ticket] = localTicket{ticket: t, expires: now.Add(ttl)}
+	return nil
+}
+
+func (s *LocalTicketStore) Take(_ context.Context, ticket string) (ConnectTicket, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lt, ok := s.tickets[ticket]
+	if !ok {
+		return ConnectTicket{}, false, nil
+	}
+	delete(s.tickets, ticket)
+	if time.Now().After(lt.expires) {
+		return ConnectTicket{}, false, nil
+	}
+	return lt.ticket, true, nil
+}
@@ -3,44 +3,66 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/url"
+	"time"
+	"unicode/utf8"
 
 	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/event"
 	"github.com/ktsoator/connectify/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
 var (
 	ErrDuplicateEmail        = repository.ErrDuplicateEmail
+	ErrDuplicatePhone        = repository.ErrDuplicatePhone
+	ErrDuplicateIdentity     = repository.ErrDuplicateIdentity
 	ErrUserNotFound          = repository.ErrUserNotFound
 	ErrInvalidUserOrPassword = errors.New("invalid email or password")
+	ErrUserDeactivated       = errors.New("user is deactivated")
+	ErrNotGuest              = errors.New("user is not a guest")
+	ErrInvalidProfile        = errors.New("invalid profile")
+)
+
+// Profile field limits, counted in characters.
+const (
+	maxNicknameLength = 32
+	maxIntroLength    = 256
+	maxLocationLength = 64
+	maxWebsites       = 5
+	maxURLLength      = 512
 )
 
 type UserService struct {
-	repo *repository.UserRepository
+	repo   *repository.UserRepository
+	events event.Publisher
 }
 
-func NewUserService(repo *repository.UserRepository) *UserService {
+func NewUserService(repo *repository.UserRepository, events event.Publisher) *UserService {
 	return &UserService{
-		repo: repo,
+		repo:   repo,
+		events: events,
 	}
 }
 
-func (s *UserService) Signup(ctx context.Context, user domain.User) error {
+// Signup creates the user and returns it with its new ID.
+func (s *UserService) Signup(ctx context.Context, user domain.User) (domain.User, error) {
 	// Hash the password using bcrypt before storing it
 	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
-		return err
+		return domain.User{}, err
 	}
 	user.Password = string(hash)
 
-	err = s.repo.Create(ctx, user)
+	user.ID, err = s.repo.Create(ctx, user)
 	if err != nil {
 		if errors.Is(err, repository.ErrDuplicateEmail) {
-			return ErrDuplicateEmail
+			return domain.User{}, ErrDuplicateEmail
 		}
-		return err
+		return domain.User{}, err
 	}
-	return nil
+	return user, nil
 }
 
 func (s *UserService) Login(ctx context.Context, email, password string) (domain.User, error) {
@@ -60,11 +82,20 @@ func (s *UserService) Login(ctx context.Context, email, password string) (domain
 	// 2. Compare the provided password with the stored hashed password
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
+		// Let the owner know someone is trying their password.
+		if !user.Deactivated {
+			s.events.Publish(ctx, event.LoginFailed{UserID: user.ID})
+		}
 		// If the password does not match, we also return the same generic error
 		// to ensure the error message is consistent regardless of whether the email or password was incorrect.
 		return domain.User{}, ErrInvalidUserOrPassword
 	}
 
+	// 3. Deactivated accounts (e.g. removed from an enterprise directory) cannot sign in.
+	if user.Deactivated {
+		return domain.User{}, ErrInvalidUserOrPassword
+	}
+
 	return user, nil
 }
 
@@ -82,9 +113,27 @@ func (s *UserService) Profile(ctx context.Context, id int64) (domain.User, error
 	return user, nil
 }
 
-func (s *UserService) Update(ctx context.Context, user domain.User) error {
+// CheckActive returns ErrUserNotFound if the user was deleted, e.g. a guest
+// cleaned up for inactivity, and ErrUserDeactivated if the user was
+// deactivated. Tokens issued before either happened must stop working.
+func (s *UserService) CheckActive(ctx context.Context, id int64) error {
+	user, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if user.Deactivated {
+		return ErrUserDeactivated
+	}
+	return nil
+}
+
+// Update applies a partial profile update after validating every field it sets.
+func (s *UserService) Update(ctx context.Context, id int64, patch domain.UserProfilePatch) error {
+	if err := validateProfilePatch(patch); err != nil {
+		return err
+	}
 	// Delegate the update operation to the repository layer
-	err := s.repo.Update(ctx, user)
+	err := s.repo.Update(ctx, id, patch)
 	if err != nil {
 		// Specifically handle the case where the user record being updated no longer exists
 		if errors.Is(err, repository.ErrUserNotFound) {
@@ -94,3 +143,205 @@ func (s *UserService) Update(ctx context.Context, user domain.User) error {
 	}
 	return nil
 }
+
+// CreateGuest creates an anonymous account so visitors can try the app
+// before registering.
+func (s *UserService) CreateGuest(ctx context.Context) (domain.User, error) {
+	user := domain.User{Guest: true}
+	id, err := s.repo.Create(ctx, user)
+	if err != nil {
+		return domain.User{}, err
+	}
+	user.ID = id
+	return user, nil
+}
+
+// UpgradeGuest converts a guest into a regular account with email and
+// password. The row is updated in place, so everything the guest created
+// stays attached to the same user ID. SignupWithPhone and SignupWithIdentity
+// convert guests the same way.
+func (s *UserService) UpgradeGuest(ctx context.Context, guestId int64, user domain.User) (domain.User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return domain.User{}, err
+	}
+	user.ID = guestId
+	user.Password = string(hash)
+
+	err = s.repo.UpgradeGuest(ctx, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrDuplicateEmail):
+			return domain.User{}, ErrDuplicateEmail
+		case errors.Is(err, repository.ErrUserNotFound):
+			return domain.User{}, ErrNotGuest
+		}
+		return domain.User{}, err
+	}
+	return s.Profile(ctx, guestId)
+}
+
+// LoginWithPhone returns the user who owns the verified phone number, or
+// ErrUserNotFound if nobody does yet.
+func (s *UserService) LoginWithPhone(ctx context.Context, phone string) (domain.User, error) {
+	user, err := s.repo.FindByPhone(ctx, phone)
+	if err != nil {
+		return domain.User{}, err
+	}
+	if user.Deactivated {
+		return domain.User{}, ErrUserDeactivated
+	}
+	return user, nil
+}
+
+// SignupWithPhone creates a user identified by a verified phone number. When
+// guestId is non-zero that guest is converted in place instead.
+func (s *UserService) SignupWithPhone(ctx context.Context, guestId int64, phone string) (domain.User, error) {
+	user := domain.User{Phone: phone}
+	if guestId != 0 {
+		user.ID = guestId
+		if err := s.repo.UpgradeGuest(ctx, user); err != nil {
+			return domain.User{}, s.upgradeError(err)
+		}
+		return s.Profile(ctx, guestId)
+	}
+	id, err := s.repo.Create(ctx, user)
+	if err != nil {
+		return domain.User{}, err
+	}
+	user.ID = id
+	return user, nil
+}
+
+// LoginWithIdentity returns the user linked to the third-party account, or
+// ErrUserNotFound if none is.
+func (s *UserService) LoginWithIdentity(ctx context.Context, identity domain.ExternalIdentity) (domain.User, error) {
+	user, err := s.repo.FindByIdentity(ctx, identity)
+	if err != nil {
+		return domain.User{}, err
+	}
+	if user.Deactivated {
+		return domain.User{}, ErrUserDeactivated
+	}
+	return user, nil
+}
+
+// SignupWithIdentity creates a user for a third-party account and links the
+// two. When guestId is non-zero that guest is converted in place instead.
+//
+// The provider's email is copied only if the provider verified it and no
+// other user has it. An existing account is never linked by email, since
+// that would hand it to whoever controls the third-party account.
+func (s *UserService) SignupWithIdentity(ctx context.Context, guestId int64,
+	identity domain.ExternalIdentity) (domain.User, error) {
+	user := domain.User{Nickname: truncateRunes(identity.Name, maxNicknameLength)}
+	if identity.EmailVerified && identity.Email != "" {
+		_, err := s.repo.FindByEmail(ctx, identity.Email)
+		switch {
+		case errors.Is(err, repository.ErrUserNotFound):
+			user.Email = identity.Email
+		case err != nil:
+			return domain.User{}, err
+		}
+	}
+	if guestId != 0 {
+		user.ID = guestId
+		if err := s.repo.UpgradeGuestWithIdentity(ctx, user, identity); err != nil {
+			return domain.User{}, s.upgradeError(err)
+		}
+		return s.Profile(ctx, guestId)
+	}
+	id, err := s.repo.CreateWithIdentity(ctx, user, identity)
+	if err != nil {
+		return domain.User{}, err
+	}
+	user.ID = id
+	return user, nil
+}
+
+// upgradeError maps the repository's "no such guest" to ErrNotGuest.
+func (s *UserService) upgradeError(err error) error {
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return ErrNotGuest
+	}
+	return err
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// TouchGuest records guest activity, which postpones its cleanup.
+func (s *UserService) TouchGuest(ctx context.Context, id int64) error {
+	return s.repo.UpdateLastActive(ctx, id, time.Now())
+}
+
+// DeleteInactiveGuests removes guests that have not been active for ttl.
+// Rows are deleted in batches to keep each statement short.
+func (s *UserService) DeleteInactiveGuests(ctx context.Context, ttl time.Duration, batch int) (int64, error) {
+	before := time.Now().Add(-ttl)
+	var total int64
+	for {
+		n, err := s.repo.DeleteInactiveGuests(ctx, before, batch)
+		total += n
+		if err != nil || n < int64(batch) {
+			return total, err
+		}
+	}
+}
+
+// validateProfilePatch checks the fields set in patch. The returned error wraps
+// ErrInvalidProfile and says which field is wrong.
+func validateProfilePatch(patch domain.UserProfilePatch) error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: "+format, append([]any{ErrInvalidProfile}, args...)...)
+	}
+
+	if patch.Nickname != nil && utf8.RuneCountInString(*patch.Nickname) > maxNicknameLength {
+		return invalid("nickname must be at most %d characters", maxNicknameLength)
+	}
+	if patch.Intro != nil && utf8.RuneCountInString(*patch.Intro) > maxIntroLength {
+		return invalid("intro must be at most %d characters", maxIntroLength)
+	}
+	if patch.Location != nil && utf8.RuneCountInString(*patch.Location) > maxLocationLength {
+		return invalid("location must be at most %d characters", maxLocationLength)
+	}
+	if patch.Birthday != nil && !patch.Birthday.IsZero() {
+		if patch.Birthday.After(time.Now()) || patch.Birthday.Year() < 1900 {
+			return invalid("birthday is out of range")
+		}
+	}
+	if patch.Gender != nil {
+		switch *patch.Gender {
+		case "", domain.GenderMale, domain.GenderFemale, domain.GenderOther:
+		default:
+			return invalid("gender must be one of %s, %s or %s",
+				domain.GenderMale, domain.GenderFemale, domain.GenderOther)
+		}
+	}
+	if patch.Websites != nil {
+		if len(*patch.Websites) > maxWebsites {
+			return invalid("at most %d websites are allowed", maxWebsites)
+		}
+		for _, site := range *patch.Websites {
+			if !isWebURL(site) {
+				return invalid("website %q must be an http or https URL", site)
+			}
+		}
+	}
+	if patch.AvatarURL != nil && *patch.AvatarURL != "" && !isWebURL(*patch.AvatarURL) {
+		return invalid("avatar URL must be an http or https URL")
+	}
+	return nil
+}
+
+func isWebURL(s string) bool {
+	if len(s) > maxURLLength {
+		return false
+	}
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
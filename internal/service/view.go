@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ktsoator/connectify/internal/repository"
+	"github.com/redis/go-redis/v9"
+)
+
+// ViewDeduper decides whether a view is counted. A viewer reading the same
+// article again within the window is not counted twice.
+type ViewDeduper interface {
+	FirstView(ctx context.Context, articleId int64, viewer string, window time.Duration) (bool, error)
+}
+
+// RedisViewDeduper shares the seen views between all server instances.
+type RedisViewDeduper struct {
+	client redis.Cmdable
+}
+
+func NewRedisViewDeduper(client redis.Cmdable) *RedisViewDeduper {
+	return &RedisViewDeduper{client: client}
+}
+
+func (d *RedisViewDeduper) FirstView(ctx context.Context, articleId int64, viewer string, window time.Duration) (bool, error) {
+	key := fmt.Sprintf("article:view:%d:%s", articleId, viewer)
+	return d.client.SetNX(ctx, key, 1, window).Result()
+}
+
+// LocalViewDeduper remembers views in memory. Every instance remembers its
+// own, so a viewer whose requests are spread over several instances counts
+// once on each of them within the window.
+type LocalViewDeduper struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	nextSweep time.Time
+}
+
+func NewLocalViewDeduper() *LocalViewDeduper {
+	return &LocalViewDeduper{seen: make(map[string]time.Time)}
+}
+
+func (d *LocalViewDeduper) FirstView(_ context.Context, articleId int64, viewer string, window time.Duration) (bool, error) {
+	key := fmt.Sprintf("%d:%s", articleId, viewer)
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if now.After(d.nextSweep) {
+		// Drop expired entries once per window so memory stays bounded by
+		// the views of a single window.
+		for k, expires := range d.seen {
+			if now.After(expires) {
+				delete(d.seen, k)
+			}
+		}
+		d.nextSweep = now.Add(window)
+	}
+	if expires, ok := d.seen[key]; ok && now.Before(expires) {
+		return false, nil
+	}
+	d.seen[key] = now.Add(window)
+	return true, nil
+}
+
+type ViewAggregatorConfig struct {
+	// FlushInterval is how often buffered views are written.
+	FlushInterval time.Duration
+	// FlushSize triggers an early flush once this many views are buffered.
+	FlushSize int
+	// DedupWindow is how long repeat views by the same viewer are ignored.
+	DedupWindow time.Duration
+}
+
+// ViewAggregator buffers article views in memory and writes them in batches,
+// turning many single-row updates into one small transaction per flush.
+// Every instance keeps its own buffer; flushes only add to the stored
+// counters, so instances flushing concurrently do not lose each other's views.
+type ViewAggregator struct {
+	repo  *repository.InteractionRepository
+	dedup ViewDeduper
+	cfg   ViewAggregatorConfig
+
+	mu      sync.Mutex
+	pending map[int64]int64
+	size    int
+
+	full chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewViewAggregator(repo *repository.InteractionRepository, dedup ViewDeduper, cfg ViewAggregatorConfig) *ViewAggregator {
+	return &ViewAggregator{
+		repo:    repo,
+		dedup:   dedup,
+		cfg:     cfg,
+		pending: make(map[int64]int64),
+		full:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Record buffers one view of an article. viewer identifies the reader, e.g.
+// the user ID or the client IP for anonymous readers.
+func (a *ViewAggregator) Record(ctx context.Context, articleId int64, viewer string) {
+	first, err := a.dedup.FirstView(ctx, articleId, viewer, a.cfg.DedupWindow)
+	if err != nil {
+		// Counting a repeat view is better than dropping views while the
+		// dedup store is down.
+		log.Printf("deduplicate view of article %d: %v", articleId, err)
+		first = true
+	}
+	if !first {
+		return
+	}
+
+	a.mu.Lock()
+	a.pending[articleId]++
+	a.size++
+	full := a.size >= a.cfg.FlushSize
+	a.mu.Unlock()
+	if full {
+		select {
+		case a.full <- struct{}{}:
+		default:
+			// A flush is already pending.
+		}
+	}
+}
+
+// Start flushes in the background until Stop is called.
+func (a *ViewAggregator) Start() {
+	go func() {
+		defer close(a.done)
+		ticker := time.NewTicker(a.cfg.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.stop:
+				return
+			case <-ticker.C:
+			case <-a.full:
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), a.cfg.FlushInterval)
+			if err := a.Flush(ctx); err != nil {
+				log.Printf("flush article views: %v", err)
+			}
+			cancel()
+		}
+	}()
+}
+
+// Stop ends the background flushing and writes what is still buffered. Call
+// it once the HTTP server no longer accepts requests, or views recorded
+// afterwards are lost.
+func (a *ViewAggregator) Stop(ctx context.Context) error {
+	close(a.stop)
+	<-a.done
+	return a.Flush(ctx)
+}
+
+// Flush writes the buffered views. If writing fails they are put back and
+// retried by the next flush.
+func (a *ViewAggregator) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	batch := a.pending
+	a.pending = make(map[int64]int64, len(batch))
+	a.size = 0
+	a.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if err := a.repo.IncrViews(ctx, batch); err != nil {
+		a.mu.Lock()
+		for id, n := range batch {
+			a.pending[id] += n
+			a.size += int(n)
+		}
+		a.mu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+type S3Config struct {
+	// Endpoint is the host[:port] of the S3 API, e.g. "s3.amazonaws.com" or
+	// "localhost:9000" for a local MinIO.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	UseSSL          bool
+	// PublicBaseURL is where objects are served from, e.g. a CDN in front of
+	// the bucket. Defaults to the path-style bucket URL on the endpoint.
+	PublicBaseURL string
+}
+
+// S3Storage keeps objects in a bucket of any S3-compatible service.
+type S3Storage struct {
+	client  *minio.Client
+	bucket  string
+	baseURL string
+}
+
+func NewS3Storage(cfg S3Config) (*S3Storage, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		Secure: cfg.UseSSL,
+		// A fixed region saves a bucket location lookup before the first request.
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := cfg.PublicBaseURL
+	if baseURL == "" {
+		scheme := "http"
+		if cfg.UseSSL {
+			scheme = "https"
+		}
+		baseURL = scheme + "://" + cfg.Endpoint + "/" + cfg.Bucket
+	}
+	return &S3Storage{
+		client:  client,
+		bucket:  cfg.Bucket,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+		// Keys are never reused for different content, so caches may keep them.
+		CacheControl: "public, max-age=31536000, immutable",
+	})
+	return err
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Storage) URL(key string) string {
+	return s.baseURL + "/" + key
+}
@@ -0,0 +1,231 @@
+package storage_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ktsoator/connectify/internal/storage"
+)
+
+type s3Object struct {
+	body         []byte
+	contentType  string
+	cacheControl string
+}
+
+// fakeS3 serves the part of the S3 API the storage backend uses, with
+// path-style bucket URLs. Objects can be read back anonymously, as from a
+// public bucket.
+type fakeS3 struct {
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string]s3Object
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		s3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	if r.Method != http.MethodGet && !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		s3Error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, err := readPayload(r)
+		if err != nil {
+			s3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[key] = s3Object{
+			body:         body,
+			contentType:  r.Header.Get("Content-Type"),
+			cacheControl: r.Header.Get("Cache-Control"),
+		}
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodGet:
+		obj, ok := f.objects[key]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("Cache-Control", obj.cacheControl)
+		_, _ = w.Write(obj.body)
+	case http.MethodDelete:
+		// Like S3, deleting a missing key succeeds.
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+}
+
+// readPayload returns the object data of a PUT. Over plain HTTP the client
+// signs every chunk, framing the body as
+// "<hex size>;chunk-signature=<sig>\r\n<data>\r\n" until a zero-size chunk.
+func readPayload(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var data bytes.Buffer
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			break
+		}
+		if _, err := io.CopyN(&data, br, size); err != nil {
+			return nil, err
+		}
+		if _, err := br.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+	if want := r.Header.Get("X-Amz-Decoded-Content-Length"); want != strconv.Itoa(data.Len()) {
+		return nil, fmt.Errorf("decoded %d bytes, header says %s", data.Len(), want)
+	}
+	return data.Bytes(), nil
+}
+
+func newS3Storage(t *testing.T, publicBaseURL string) (*storage.S3Storage, *fakeS3, string) {
+	t.Helper()
+	fake := &fakeS3{bucket: "uploads", objects: map[string]s3Object{}}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	endpoint := strings.TrimPrefix(srv.URL, "http://")
+	s, err := storage.NewS3Storage(storage.S3Config{
+		Endpoint:        endpoint,
+		Region:          "us-east-1",
+		Bucket:          "uploads",
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		PublicBaseURL:   publicBaseURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, fake, srv.URL
+}
+
+func TestS3StoragePutURLDelete(t *testing.T) {
+	ctx := context.Background()
+	s, fake, srvURL := newS3Storage(t, "")
+	key := "avatars/7/abc-256.png"
+	content := bytes.Repeat([]byte("png"), 1000)
+
+	err := s.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "image/png")
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	obj, ok := fake.objects[key]
+	if !ok {
+		t.Fatalf("object %q not stored", key)
+	}
+	if !bytes.Equal(obj.body, content) {
+		t.Errorf("stored %d bytes, want %d", len(obj.body), len(content))
+	}
+	if obj.contentType != "image/png" {
+		t.Errorf("Content-Type = %q, want image/png", obj.contentType)
+	}
+	if obj.cacheControl != "public, max-age=31536000, immutable" {
+		t.Errorf("Cache-Control = %q", obj.cacheControl)
+	}
+
+	// Without a public base URL objects are served from the bucket itself.
+	url := s.URL(key)
+	if want := srvURL + "/uploads/" + key; url != want {
+		t.Fatalf("URL = %q, want %q", url, want)
+	}
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !bytes.Equal(got, content) {
+		t.Errorf("GET %s = %d with %d bytes, want the stored object", url, res.StatusCode, len(got))
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok := fake.objects[key]; ok {
+		t.Error("object still stored after Delete")
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of missing object: %v", err)
+	}
+}
+
+func TestS3StoragePutReplaces(t *testing.T) {
+	ctx := context.Background()
+	s, fake, _ := newS3Storage(t, "")
+
+	for _, content := range []string{"first", "second"} {
+		if err := s.Put(ctx, "k", strings.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := string(fake.objects["k"].body); got != "second" {
+		t.Errorf("stored %q, want second", got)
+	}
+}
+
+func TestS3StoragePutError(t *testing.T) {
+	fake := &fakeS3{bucket: "other", objects: map[string]s3Object{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	s, err := storage.NewS3Storage(storage.S3Config{
+		Endpoint:        strings.TrimPrefix(srv.URL, "http://"),
+		Region:          "us-east-1",
+		Bucket:          "uploads",
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Put(context.Background(), "k", strings.NewReader("x"), 1, "text/plain")
+	if err == nil || !strings.Contains(err.Error(), "NoSuchBucket") {
+		t.Errorf("Put into missing bucket error = %v, want NoSuchBucket", err)
+	}
+}
+
+func TestS3StoragePublicBaseURL(t *testing.T) {
+	s, _, _ := newS3Storage(t, "https://cdn.example.com/media/")
+
+	if got, want := s.URL("avatars/1.png"), "https://cdn.example.com/media/avatars/1.png"; got != want {
+		t.Errorf("URL = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,18 @@
+// Package storage keeps user uploaded files in an object store.
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// ObjectStorage stores objects under slash-separated keys and serves them
+// from public URLs.
+type ObjectStorage interface {
+	// Put stores size bytes read from r under key, replacing any object there.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Delete removes the object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns the public URL the object is served from.
+	URL(key string) string
+}
@@ -0,0 +1,385 @@
+package article
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/markup"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+	"github.com/ktsoator/connectify/internal/web/user"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	abstractLength  = 128
+)
+
+type ArticleHandler struct {
+	svc            *service.ArticleService
+	interactionSvc *service.InteractionService
+}
+
+func NewArticleHandler(svc *service.ArticleService, interactionSvc *service.InteractionService) *ArticleHandler {
+	return &ArticleHandler{
+		svc:            svc,
+		interactionSvc: interactionSvc,
+	}
+}
+
+func (h *ArticleHandler) RegisterRoutes(r *gin.Engine) {
+	// Author routes work on the working copy and need a login.
+	ag := r.Group("/articles")
+	ag.POST("/edit", h.Edit)
+	ag.POST("/publish", h.Publish)
+	ag.POST("/unpublish", h.Unpublish)
+	ag.POST("/schedule", h.Schedule)
+	ag.POST("/reschedule", h.Reschedule)
+	ag.POST("/unschedule", h.Unschedule)
+	ag.GET("/scheduled", h.Scheduled)
+	ag.POST("/like", h.Like)
+	ag.POST("/unlike", h.Unlike)
+	ag.POST("/bookmark", h.Bookmark)
+	ag.POST("/unbookmark", h.Unbookmark)
+	ag.GET("/drafts", h.Drafts)
+	ag.GET("/drafts/:id", h.Draft)
+	ag.GET("/drafts/:id/revisions", h.Revisions)
+	ag.GET("/drafts/:id/revisions/:rid", h.Revision)
+	ag.POST("/drafts/:id/revisions/:rid/restore", h.Restore)
+	ag.GET("/drafts/:id/diff", h.Diff)
+
+	// Reader routes only see published copies.
+	pg := r.Group("/pub/articles")
+	pg.GET("", h.List)
+	pg.GET("/interactions", h.Interactions)
+	pg.GET("/:id", h.Detail)
+}
+
+type ArticleRequest struct {
+	// ID is 0 to create a new article.
+	ID      int64  `json:"id"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+type AuthorResponse struct {
+	ID       int64  `json:"id"`
+	Handle   string `json:"handle"`
+	Nickname string `json:"nickname"`
+}
+
+type ArticleResponse struct {
+	ID       int64          `json:"id"`
+	Title    string         `json:"title"`
+	Abstract string         `json:"abstract,omitempty"`
+	Content  string         `json:"content,omitempty"`
+	HTML     string         `json:"html,omitempty"`
+	Author   AuthorResponse `json:"author"`
+	Status   string         `json:"status"`
+	// PublishAt is set while the article is scheduled.
+	PublishAt int64 `json:"publishAt,omitempty"`
+	// Interaction is only returned to readers of published articles.
+	Interaction *InteractionResponse `json:"interaction,omitempty"`
+	Ctime       int64                `json:"ctime"`
+	Utime       int64                `json:"utime"`
+}
+
+func toArticleResponse(art domain.Article, withContent bool) ArticleResponse {
+	res := ArticleResponse{
+		ID:    art.ID,
+		Title: art.Title,
+		Author: AuthorResponse{
+			ID:       art.Author.ID,
+			Handle:   art.Author.Handle,
+			Nickname: art.Author.Nickname,
+		},
+		Status: art.Status.String(),
+		Ctime:  art.Ctime.UnixMilli(),
+		Utime:  art.Utime.UnixMilli(),
+	}
+	if !art.PublishAt.IsZero() {
+		res.PublishAt = art.PublishAt.UnixMilli()
+	}
+	if withContent {
+		res.Content = art.Content
+		res.HTML = art.HTML
+	} else {
+		res.Abstract = markup.Excerpt(art.HTML, abstractLength)
+	}
+	return res
+}
+
+type idResponse struct {
+	ID int64 `json:"id"`
+}
+
+// Edit saves the author's working copy without publishing it.
+func (h *ArticleHandler) Edit(c *gin.Context) {
+	var req ArticleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	id, err := h.svc.Save(c.Request.Context(), domain.Article{
+		ID:      req.ID,
+		Title:   req.Title,
+		Content: req.Content,
+		Author:  domain.Author{ID: claim.UserId},
+	})
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "article saved successfully",
+		Data: idResponse{ID: id},
+	})
+}
+
+// Publish saves the working copy and makes it visible to readers.
+func (h *ArticleHandler) Publish(c *gin.Context) {
+	var req ArticleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	id, err := h.svc.Publish(c.Request.Context(), domain.Article{
+		ID:      req.ID,
+		Title:   req.Title,
+		Content: req.Content,
+		Author:  domain.Author{ID: claim.UserId},
+	})
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "article published successfully",
+		Data: idResponse{ID: id},
+	})
+}
+
+func (h *ArticleHandler) Unpublish(c *gin.Context) {
+	type UnpublishRequest struct {
+		ID int64 `json:"id"`
+	}
+
+	var req UnpublishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	if err := h.svc.Unpublish(c.Request.Context(), req.ID, claim.UserId); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "article unpublished successfully",
+		Data: nil,
+	})
+}
+
+// Drafts lists the author's own articles in every status.
+func (h *ArticleHandler) Drafts(c *gin.Context) {
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	offset, limit := page(c)
+	arts, err := h.svc.Drafts(c.Request.Context(), claim.UserId, offset, limit)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	h.writeList(c, arts)
+}
+
+// Draft returns the author's working copy of an article.
+func (h *ArticleHandler) Draft(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.writeError(c, service.ErrArticleNotFound)
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	art, err := h.svc.Draft(c.Request.Context(), id, claim.UserId)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: toArticleResponse(art, true),
+	})
+}
+
+// List returns one page of published articles, newest first.
+func (h *ArticleHandler) List(c *gin.Context) {
+	offset, limit := page(c)
+	arts, err := h.svc.ListPublished(c.Request.Context(), offset, limit)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	ids := make([]int64, 0, len(arts))
+	for _, art := range arts {
+		ids = append(ids, art.ID)
+	}
+	ins, err := h.interactionSvc.Interactions(c.Request.Context(), viewerId(c), ids)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	res := make([]ArticleResponse, 0, len(arts))
+	for _, art := range arts {
+		r := toArticleResponse(art, false)
+		r.Interaction = toInteractionResponse(ins[art.ID])
+		res = append(res, r)
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+// Detail returns the published copy of an article.
+func (h *ArticleHandler) Detail(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.writeError(c, service.ErrArticleNotFound)
+		return
+	}
+
+	art, err := h.svc.Published(c.Request.Context(), id)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	h.interactionSvc.View(c.Request.Context(), id, viewerKey(c))
+	ins, err := h.interactionSvc.Interactions(c.Request.Context(), viewerId(c), []int64{id})
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	res := toArticleResponse(art, true)
+	res.Interaction = toInteractionResponse(ins[id])
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+func (h *ArticleHandler) writeList(c *gin.Context, arts []domain.Article) {
+	res := make([]ArticleResponse, 0, len(arts))
+	for _, art := range arts {
+		res = append(res, toArticleResponse(art, false))
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+func (h *ArticleHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidArticle):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  err.Error(),
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrArticleNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeArticleNotFound,
+			Msg:  "article not found",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrRevisionNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeRevisionNotFound,
+			Msg:  "revision not found",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrArticleNotScheduled):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "article is not scheduled",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrArticleNotPublished):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "article is not published",
+			Data: nil,
+		})
+	default:
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+	}
+}
+
+// page reads the offset and limit query parameters, clamping them to sane
+// values instead of rejecting the request.
+func page(c *gin.Context) (int, int) {
+	offset, err := strconv.Atoi(c.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultPageSize
+	}
+	return offset, min(limit, maxPageSize)
+}
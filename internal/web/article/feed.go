@@ -0,0 +1,116 @@
+package article
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+	"github.com/ktsoator/connectify/internal/web/user"
+)
+
+type FeedHandler struct {
+	svc            *service.FeedService
+	interactionSvc *service.InteractionService
+}
+
+func NewFeedHandler(svc *service.FeedService, interactionSvc *service.InteractionService) *FeedHandler {
+	return &FeedHandler{
+		svc:            svc,
+		interactionSvc: interactionSvc,
+	}
+}
+
+func (h *FeedHandler) RegisterRoutes(r *gin.Engine) {
+	r.GET("/articles/feed", h.Timeline)
+}
+
+// FeedResponse is one page of the home timeline. NextCursor is passed back as
+// cursor to load the next page and is empty on the last page.
+type FeedResponse struct {
+	Articles   []ArticleResponse `json:"articles"`
+	NextCursor string            `json:"nextCursor"`
+}
+
+// Timeline returns the caller's home timeline: the articles of the users they
+// follow and their own, newest first.
+func (h *FeedHandler) Timeline(c *gin.Context) {
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	cursor, ok := parseFeedCursor(c.Query("cursor"))
+	if !ok {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid cursor",
+			Data: nil,
+		})
+		return
+	}
+	_, limit := page(c)
+	arts, next, err := h.svc.Timeline(c.Request.Context(), claim.UserId, cursor, limit)
+	if err != nil {
+		h.writeError(c)
+		return
+	}
+
+	ids := make([]int64, 0, len(arts))
+	for _, art := range arts {
+		ids = append(ids, art.ID)
+	}
+	ins, err := h.interactionSvc.Interactions(c.Request.Context(), claim.UserId, ids)
+	if err != nil {
+		h.writeError(c)
+		return
+	}
+	res := FeedResponse{Articles: make([]ArticleResponse, 0, len(arts))}
+	for _, art := range arts {
+		r := toArticleResponse(art, false)
+		r.Interaction = toInteractionResponse(ins[art.ID])
+		res.Articles = append(res.Articles, r)
+	}
+	if !next.IsZero() {
+		res.NextCursor = fmt.Sprintf("%d-%d", next.PublishedAt.UnixMilli(), next.ArticleID)
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+func (h *FeedHandler) writeError(c *gin.Context) {
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeServerBusy,
+		Msg:  "system error",
+		Data: nil,
+	})
+}
+
+// parseFeedCursor reads a cursor of the form "<publishedAt>-<articleId>". An
+// empty cursor is the start of the feed.
+func parseFeedCursor(s string) (domain.FeedCursor, bool) {
+	if s == "" {
+		return domain.FeedCursor{}, true
+	}
+	ms, id, ok := strings.Cut(s, "-")
+	if !ok {
+		return domain.FeedCursor{}, false
+	}
+	publishedAt, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil || publishedAt <= 0 {
+		return domain.FeedCursor{}, false
+	}
+	articleId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return domain.FeedCursor{}, false
+	}
+	return domain.FeedCursor{PublishedAt: time.UnixMilli(publishedAt), ArticleID: articleId}, true
+}
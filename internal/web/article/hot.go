@@ -0,0 +1,64 @@
+package article
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+)
+
+type HotHandler struct {
+	svc            *service.HotService
+	interactionSvc *service.InteractionService
+}
+
+func NewHotHandler(svc *service.HotService, interactionSvc *service.InteractionService) *HotHandler {
+	return &HotHandler{
+		svc:            svc,
+		interactionSvc: interactionSvc,
+	}
+}
+
+func (h *HotHandler) RegisterRoutes(r *gin.Engine) {
+	r.GET("/articles/hot", h.Hot)
+}
+
+// Hot returns the trending articles, best first. Anybody may read them.
+func (h *HotHandler) Hot(c *gin.Context) {
+	_, limit := page(c)
+	arts, err := h.svc.Hot(c.Request.Context(), limit)
+	if err != nil {
+		h.writeError(c)
+		return
+	}
+
+	ids := make([]int64, 0, len(arts))
+	for _, art := range arts {
+		ids = append(ids, art.ID)
+	}
+	ins, err := h.interactionSvc.Interactions(c.Request.Context(), viewerId(c), ids)
+	if err != nil {
+		h.writeError(c)
+		return
+	}
+	res := make([]ArticleResponse, 0, len(arts))
+	for _, art := range arts {
+		r := toArticleResponse(art, false)
+		r.Interaction = toInteractionResponse(ins[art.ID])
+		res = append(res, r)
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+func (h *HotHandler) writeError(c *gin.Context) {
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeServerBusy,
+		Msg:  "system error",
+		Data: nil,
+	})
+}
@@ -0,0 +1,146 @@
+package article
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/web/resp"
+	"github.com/ktsoator/connectify/internal/web/user"
+)
+
+// maxInteractionIds caps the batch lookup at one page of articles.
+const maxInteractionIds = maxPageSize
+
+type InteractionResponse struct {
+	ArticleID  int64 `json:"articleId"`
+	Likes      int64 `json:"likes"`
+	Bookmarks  int64 `json:"bookmarks"`
+	Views      int64 `json:"views"`
+	Liked      bool  `json:"liked"`
+	Bookmarked bool  `json:"bookmarked"`
+}
+
+func toInteractionResponse(in domain.Interaction) *InteractionResponse {
+	return &InteractionResponse{
+		ArticleID:  in.ArticleID,
+		Likes:      in.Likes,
+		Bookmarks:  in.Bookmarks,
+		Views:      in.Views,
+		Liked:      in.Liked,
+		Bookmarked: in.Bookmarked,
+	}
+}
+
+type interactionRequest struct {
+	ID int64 `json:"id"`
+}
+
+func (h *ArticleHandler) Like(c *gin.Context) {
+	h.interact(c, h.interactionSvc.Like, "article liked successfully")
+}
+
+func (h *ArticleHandler) Unlike(c *gin.Context) {
+	h.interact(c, h.interactionSvc.Unlike, "article unliked successfully")
+}
+
+func (h *ArticleHandler) Bookmark(c *gin.Context) {
+	h.interact(c, h.interactionSvc.Bookmark, "article bookmarked successfully")
+}
+
+func (h *ArticleHandler) Unbookmark(c *gin.Context) {
+	h.interact(c, h.interactionSvc.Unbookmark, "article unbookmarked successfully")
+}
+
+// interact runs one of the per-user toggles for the article in the request
+// body. All of them are idempotent.
+func (h *ArticleHandler) interact(c *gin.Context, fn func(ctx context.Context, userId, articleId int64) error, msg string) {
+	var req interactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	if err := fn(c.Request.Context(), claim.UserId, req.ID); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  msg,
+		Data: nil,
+	})
+}
+
+// Interactions returns counters and the caller's own likes and bookmarks for
+// up to one page of articles, given as ids=1,2,3, so that lists can be
+// rendered with a single request.
+func (h *ArticleHandler) Interactions(c *gin.Context) {
+	var ids []int64
+	for _, s := range strings.Split(c.Query("ids"), ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidParam,
+				Msg:  "ids must be a comma-separated list of article ids",
+				Data: nil,
+			})
+			return
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) > maxInteractionIds {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "too many ids",
+			Data: nil,
+		})
+		return
+	}
+
+	ins, err := h.interactionSvc.Interactions(c.Request.Context(), viewerId(c), ids)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	res := make([]*InteractionResponse, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, toInteractionResponse(ins[id]))
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+// viewerId returns the logged-in reader, or 0 on the public routes when
+// nobody is logged in.
+func viewerId(c *gin.Context) int64 {
+	claim, ok := user.GetUserClaims(c)
+	if !ok {
+		return 0
+	}
+	return claim.UserId
+}
+
+// viewerKey identifies a reader for counting views: the user when logged in,
+// otherwise the client IP.
+func viewerKey(c *gin.Context) string {
+	if id := viewerId(c); id > 0 {
+		return "user:" + strconv.FormatInt(id, 10)
+	}
+	return "ip:" + c.ClientIP()
+}
@@ -0,0 +1,170 @@
+package article
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+	"github.com/ktsoator/connectify/internal/web/user"
+)
+
+type RevisionResponse struct {
+	ID      int64  `json:"id"`
+	Title   string `json:"title"`
+	Content string `json:"content,omitempty"`
+	Ctime   int64  `json:"ctime"`
+}
+
+func toRevisionResponse(rev domain.ArticleRevision) RevisionResponse {
+	return RevisionResponse{
+		ID:      rev.ID,
+		Title:   rev.Title,
+		Content: rev.Content,
+		Ctime:   rev.Ctime.UnixMilli(),
+	}
+}
+
+// Revisions lists the saved versions of the author's article, newest first.
+func (h *ArticleHandler) Revisions(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.writeError(c, service.ErrArticleNotFound)
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	offset, limit := page(c)
+	revs, err := h.svc.Revisions(c.Request.Context(), id, claim.UserId, offset, limit)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	res := make([]RevisionResponse, 0, len(revs))
+	for _, rev := range revs {
+		res = append(res, toRevisionResponse(rev))
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+// Revision returns a single saved version including its content.
+func (h *ArticleHandler) Revision(c *gin.Context) {
+	id, rid, ok := h.revisionParams(c)
+	if !ok {
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	rev, err := h.svc.Revision(c.Request.Context(), id, rid, claim.UserId)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: toRevisionResponse(rev),
+	})
+}
+
+// Restore makes a saved version the current working copy.
+func (h *ArticleHandler) Restore(c *gin.Context) {
+	id, rid, ok := h.revisionParams(c)
+	if !ok {
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	art, err := h.svc.Restore(c.Request.Context(), id, rid, claim.UserId)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "revision restored successfully",
+		Data: toArticleResponse(art, true),
+	})
+}
+
+// Diff shows the change between two revisions, given as the from and to
+// query parameters, as a unified diff.
+func (h *ArticleHandler) Diff(c *gin.Context) {
+	type DiffResponse struct {
+		From RevisionResponse `json:"from"`
+		To   RevisionResponse `json:"to"`
+		Diff string           `json:"diff"`
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.writeError(c, service.ErrArticleNotFound)
+		return
+	}
+	from, errFrom := strconv.ParseInt(c.Query("from"), 10, 64)
+	to, errTo := strconv.ParseInt(c.Query("to"), 10, 64)
+	if errFrom != nil || errTo != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "from and to must be revision ids",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	diff, err := h.svc.Diff(c.Request.Context(), id, from, to, claim.UserId)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	// The content is already in the diff.
+	diff.From.Content, diff.To.Content = "", ""
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: DiffResponse{
+			From: toRevisionResponse(diff.From),
+			To:   toRevisionResponse(diff.To),
+			Diff: diff.Unified,
+		},
+	})
+}
+
+// revisionParams reads the article and revision ids from the path, writing
+// the error response when either is malformed.
+func (h *ArticleHandler) revisionParams(c *gin.Context) (int64, int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.writeError(c, service.ErrArticleNotFound)
+		return 0, 0, false
+	}
+	rid, err := strconv.ParseInt(c.Param("rid"), 10, 64)
+	if err != nil {
+		h.writeError(c, service.ErrRevisionNotFound)
+		return 0, 0, false
+	}
+	return id, rid, true
+}
@@ -0,0 +1,132 @@
+package article
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/web/resp"
+	"github.com/ktsoator/connectify/internal/web/user"
+)
+
+// Schedule saves the working copy and queues it to be published later.
+func (h *ArticleHandler) Schedule(c *gin.Context) {
+	type ScheduleRequest struct {
+		ArticleRequest
+		// PublishAt is a Unix timestamp in milliseconds.
+		PublishAt int64 `json:"publishAt"`
+	}
+
+	var req ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	id, err := h.svc.Schedule(c.Request.Context(), domain.Article{
+		ID:      req.ID,
+		Title:   req.Title,
+		Content: req.Content,
+		Author:  domain.Author{ID: claim.UserId},
+	}, time.UnixMilli(req.PublishAt))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "article scheduled successfully",
+		Data: idResponse{ID: id},
+	})
+}
+
+func (h *ArticleHandler) Reschedule(c *gin.Context) {
+	type RescheduleRequest struct {
+		ID        int64 `json:"id"`
+		PublishAt int64 `json:"publishAt"`
+	}
+
+	var req RescheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	err := h.svc.Reschedule(c.Request.Context(), req.ID, claim.UserId, time.UnixMilli(req.PublishAt))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "article rescheduled successfully",
+		Data: nil,
+	})
+}
+
+// Unschedule cancels a scheduled publish and keeps the working copy.
+func (h *ArticleHandler) Unschedule(c *gin.Context) {
+	type UnscheduleRequest struct {
+		ID int64 `json:"id"`
+	}
+
+	var req UnscheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	if err := h.svc.CancelSchedule(c.Request.Context(), req.ID, claim.UserId); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "article unscheduled successfully",
+		Data: nil,
+	})
+}
+
+// Scheduled lists the author's queued articles, the next to be published first.
+func (h *ArticleHandler) Scheduled(c *gin.Context) {
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	offset, limit := page(c)
+	arts, err := h.svc.Scheduled(c.Request.Context(), claim.UserId, offset, limit)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	h.writeList(c, arts)
+}
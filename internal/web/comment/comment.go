@@ -0,0 +1,392 @@
+package comment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+	"github.com/ktsoator/connectify/internal/web/user"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	// firstReplies is how many replies are loaded with each thread.
+	firstReplies = 3
+)
+
+type CommentHandler struct {
+	svc *service.CommentService
+}
+
+func NewCommentHandler(svc *service.CommentService) *CommentHandler {
+	return &CommentHandler{
+		svc: svc,
+	}
+}
+
+func (h *CommentHandler) RegisterRoutes(r *gin.Engine) {
+	// Writing and reviewing comments needs a login.
+	ag := r.Group("/articles/comments")
+	ag.POST("", h.Post)
+	ag.POST("/edit", h.Edit)
+	ag.POST("/delete", h.Delete)
+	ag.GET("/pending", h.Pending)
+	ag.POST("/approve", h.Approve)
+	ag.POST("/reject", h.Reject)
+
+	// Reading is public.
+	r.GET("/pub/articles/:id/comments", h.Threads)
+	r.GET("/pub/comments/:id/replies", h.Replies)
+}
+
+type CommentResponse struct {
+	ID        int64  `json:"id"`
+	ArticleID int64  `json:"articleId"`
+	RootID    int64  `json:"rootId"`
+	ParentID  int64  `json:"parentId"`
+	Depth     int    `json:"depth"`
+	Author    Author `json:"author"`
+	// Content is empty for deleted comments.
+	Content string `json:"content"`
+	Status  string `json:"status"`
+	Ctime   int64  `json:"ctime"`
+	Utime   int64  `json:"utime"`
+}
+
+type Author struct {
+	ID       int64  `json:"id"`
+	Handle   string `json:"handle"`
+	Nickname string `json:"nickname"`
+}
+
+type ThreadResponse struct {
+	CommentResponse
+	Replies    []CommentResponse `json:"replies"`
+	ReplyCount int64             `json:"replyCount"`
+}
+
+// PageResponse is one page of comments. NextCursor is passed back as cursor
+// to load the next page and is 0 on the last page.
+type PageResponse[T any] struct {
+	Comments   []T   `json:"comments"`
+	NextCursor int64 `json:"nextCursor"`
+}
+
+func toCommentResponse(c domain.Comment) CommentResponse {
+	return CommentResponse{
+		ID:        c.ID,
+		ArticleID: c.ArticleID,
+		RootID:    c.RootID,
+		ParentID:  c.ParentID,
+		Depth:     c.Depth,
+		Author: Author{
+			ID:       c.Author.ID,
+			Handle:   c.Author.Handle,
+			Nickname: c.Author.Nickname,
+		},
+		Content: c.Content,
+		Status:  c.Status.String(),
+		Ctime:   c.Ctime.UnixMilli(),
+		Utime:   c.Utime.UnixMilli(),
+	}
+}
+
+func toCommentResponses(cs []domain.Comment) []CommentResponse {
+	res := make([]CommentResponse, 0, len(cs))
+	for _, c := range cs {
+		res = append(res, toCommentResponse(c))
+	}
+	return res
+}
+
+// Post adds a comment to an article, or a reply when parentId is set.
+func (h *CommentHandler) Post(c *gin.Context) {
+	type PostRequest struct {
+		ArticleID int64  `json:"articleId"`
+		ParentID  int64  `json:"parentId"`
+		Content   string `json:"content"`
+	}
+
+	var req PostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	cm, err := h.svc.Post(c.Request.Context(), domain.Comment{
+		ArticleID: req.ArticleID,
+		ParentID:  req.ParentID,
+		Author:    domain.Author{ID: claim.UserId},
+		Content:   req.Content,
+	})
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  postedMessage(cm),
+		Data: toCommentResponse(cm),
+	})
+}
+
+// Edit changes the caller's comment within the edit window.
+func (h *CommentHandler) Edit(c *gin.Context) {
+	type EditRequest struct {
+		ID      int64  `json:"id"`
+		Content string `json:"content"`
+	}
+
+	var req EditRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	cm, err := h.svc.Edit(c.Request.Context(), req.ID, claim.UserId, req.Content)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  postedMessage(cm),
+		Data: toCommentResponse(cm),
+	})
+}
+
+// Delete removes the caller's comment but keeps the replies to it.
+func (h *CommentHandler) Delete(c *gin.Context) {
+	h.byId(c, h.svc.Delete, "comment deleted successfully")
+}
+
+// Approve shows a held comment on one of the caller's articles.
+func (h *CommentHandler) Approve(c *gin.Context) {
+	h.byId(c, h.svc.Approve, "comment approved successfully")
+}
+
+// Reject hides a held comment on one of the caller's articles.
+func (h *CommentHandler) Reject(c *gin.Context) {
+	h.byId(c, h.svc.Reject, "comment rejected successfully")
+}
+
+// Pending lists the comments held for review on the caller's articles.
+func (h *CommentHandler) Pending(c *gin.Context) {
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	cursor, limit := page(c)
+	cs, err := h.svc.Pending(c.Request.Context(), claim.UserId, cursor, limit)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: PageResponse[CommentResponse]{
+			Comments:   toCommentResponses(cs),
+			NextCursor: nextCursor(cs, limit),
+		},
+	})
+}
+
+// Threads returns one page of an article's root comments, newest first, each
+// with its first replies.
+func (h *CommentHandler) Threads(c *gin.Context) {
+	articleId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.writeError(c, service.ErrArticleNotFound)
+		return
+	}
+
+	cursor, limit := page(c)
+	threads, err := h.svc.Threads(c.Request.Context(), articleId, viewerId(c), cursor, limit, firstReplies)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	res := make([]ThreadResponse, 0, len(threads))
+	roots := make([]domain.Comment, 0, len(threads))
+	for _, t := range threads {
+		res = append(res, ThreadResponse{
+			CommentResponse: toCommentResponse(t.Root),
+			Replies:         toCommentResponses(t.Replies),
+			ReplyCount:      t.ReplyCount,
+		})
+		roots = append(roots, t.Root)
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: PageResponse[ThreadResponse]{
+			Comments:   res,
+			NextCursor: nextCursor(roots, limit),
+		},
+	})
+}
+
+// Replies returns further replies of a thread, oldest first. Pass the ID of
+// the last reply already shown as cursor.
+func (h *CommentHandler) Replies(c *gin.Context) {
+	rootId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.writeError(c, service.ErrCommentNotFound)
+		return
+	}
+
+	cursor, limit := page(c)
+	cs, err := h.svc.Replies(c.Request.Context(), rootId, viewerId(c), cursor, limit)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: PageResponse[CommentResponse]{
+			Comments:   toCommentResponses(cs),
+			NextCursor: nextCursor(cs, limit),
+		},
+	})
+}
+
+// byId runs an action on the comment in the request body on behalf of the
+// caller.
+func (h *CommentHandler) byId(c *gin.Context, fn func(ctx context.Context, id, userId int64) error, msg string) {
+	type IdRequest struct {
+		ID int64 `json:"id"`
+	}
+
+	var req IdRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	if err := fn(c.Request.Context(), req.ID, claim.UserId); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  msg,
+		Data: nil,
+	})
+}
+
+func (h *CommentHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidComment):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  err.Error(),
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrArticleNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeArticleNotFound,
+			Msg:  "article not found",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrCommentNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeCommentNotFound,
+			Msg:  "comment not found",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrBlocked):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeUserBlocked,
+			Msg:  "you cannot comment on this user's content",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrCommentEditExpired):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeCommentEditExpired,
+			Msg:  "comment can no longer be edited",
+			Data: nil,
+		})
+	default:
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+	}
+}
+
+func postedMessage(c domain.Comment) string {
+	if c.Status == domain.CommentStatusPending {
+		return "comment is held for review"
+	}
+	return "comment saved successfully"
+}
+
+// nextCursor returns the ID of the last comment of a full page, or 0 when
+// the page is the last one.
+func nextCursor(cs []domain.Comment, limit int) int64 {
+	if len(cs) < limit {
+		return 0
+	}
+	return cs[len(cs)-1].ID
+}
+
+// page reads the cursor and limit query parameters, clamping them to sane
+// values instead of rejecting the request.
+func page(c *gin.Context) (int64, int) {
+	cursor, err := strconv.ParseInt(c.Query("cursor"), 10, 64)
+	if err != nil || cursor < 0 {
+		cursor = 0
+	}
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultPageSize
+	}
+	return cursor, min(limit, maxPageSize)
+}
+
+// viewerId returns the logged-in reader, or 0 when nobody is logged in.
+func viewerId(c *gin.Context) int64 {
+	claim, ok := user.GetUserClaims(c)
+	if !ok {
+		return 0
+	}
+	return claim.UserId
+}
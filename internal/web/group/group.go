@@ -0,0 +1,939 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+	"github.com/ktsoator/connectify/internal/web/user"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// GroupHandler serves groups. It only parses requests and maps errors; the
+// service decides what the caller's role allows.
+type GroupHandler struct {
+	svc     *service.GroupService
+	userSvc *service.UserService
+}
+
+func NewGroupHandler(svc *service.GroupService, userSvc *service.UserService) *GroupHandler {
+	return &GroupHandler{
+		svc:     svc,
+		userSvc: userSvc,
+	}
+}
+
+func (h *GroupHandler) RegisterRoutes(r *gin.Engine) {
+	rg := r.Group("/groups")
+	rg.POST("", h.Create)
+	rg.GET("", h.List)
+	rg.GET("/invites", h.MyInvites)
+	rg.GET("/:id", h.Get)
+	rg.PUT("/:id", h.Update)
+	rg.DELETE("/:id", h.Delete)
+
+	rg.GET("/:id/members", h.Members)
+	rg.POST("/:id/join", h.Join)
+	rg.POST("/:id/leave", h.Leave)
+	rg.POST("/:id/kick", h.Kick)
+	rg.POST("/:id/role", h.SetRole)
+	rg.POST("/:id/transfer", h.Transfer)
+
+	rg.GET("/:id/requests", h.Requests)
+	rg.POST("/:id/requests/approve", h.Approve)
+	rg.POST("/:id/requests/decline", h.Decline)
+	rg.POST("/:id/requests/cancel", h.CancelRequest)
+
+	rg.GET("/:id/invites", h.Invites)
+	rg.POST("/:id/invites", h.Invite)
+	rg.POST("/:id/invites/accept", h.AcceptInvite)
+	rg.POST("/:id/invites/decline", h.DeclineInvite)
+	rg.POST("/:id/invites/revoke", h.RevokeInvite)
+
+	rg.GET("/:id/bans", h.Bans)
+	rg.POST("/:id/bans", h.Ban)
+	rg.POST("/:id/bans/remove", h.Unban)
+
+	rg.GET("/:id/posts", h.Posts)
+	rg.POST("/:id/posts", h.Post)
+	rg.DELETE("/:id/posts/:postId", h.DeletePost)
+}
+
+type GroupSettingsRequest struct {
+	Visibility string `json:"visibility"`
+	JoinPolicy string `json:"joinPolicy"`
+	PostPolicy string `json:"postPolicy"`
+}
+
+type GroupRequest struct {
+	Name        string               `json:"name"`
+	Description string               `json:"description"`
+	Settings    GroupSettingsRequest `json:"settings"`
+}
+
+type handleRequest struct {
+	Handle string `json:"handle"`
+}
+
+type GroupSettingsResponse struct {
+	Visibility string `json:"visibility"`
+	JoinPolicy string `json:"joinPolicy"`
+	PostPolicy string `json:"postPolicy"`
+}
+
+type GroupResponse struct {
+	ID          int64                 `json:"id"`
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	OwnerID     int64                 `json:"ownerId"`
+	Settings    GroupSettingsResponse `json:"settings"`
+	MemberCount int64                 `json:"memberCount"`
+	// Role is the caller's role in the group, "none" for non-members. It is
+	// left out where the caller's role is not looked up.
+	Role  string `json:"role,omitempty"`
+	Ctime int64  `json:"ctime"`
+	Utime int64  `json:"utime"`
+}
+
+type GroupUserResponse struct {
+	ID        int64  `json:"id"`
+	Handle    string `json:"handle"`
+	Nickname  string `json:"nickname"`
+	AvatarURL string `json:"avatarUrl"`
+}
+
+type MemberResponse struct {
+	User GroupUserResponse `json:"user"`
+	Role string            `json:"role"`
+	// Joined is when the user joined, in Unix milliseconds.
+	Joined int64 `json:"joined"`
+}
+
+// PendingResponse is a join request or an invite of a group.
+type PendingResponse struct {
+	User GroupUserResponse `json:"user"`
+	// InviterID is the admin who sent an invite, 0 for join requests.
+	InviterID int64 `json:"inviterId"`
+	Ctime     int64 `json:"ctime"`
+}
+
+// InviteResponse is an invite sent to the caller.
+type InviteResponse struct {
+	Group     GroupResponse `json:"group"`
+	InviterID int64         `json:"inviterId"`
+	Ctime     int64         `json:"ctime"`
+}
+
+type BanResponse struct {
+	User     GroupUserResponse `json:"user"`
+	BannedBy int64             `json:"bannedBy"`
+	Ctime    int64             `json:"ctime"`
+}
+
+type PostResponse struct {
+	ID      int64             `json:"id"`
+	GroupID int64             `json:"groupId"`
+	Author  GroupUserResponse `json:"author"`
+	Content string            `json:"content"`
+	Ctime   int64             `json:"ctime"`
+}
+
+// PageResponse is one page of a list. NextCursor is passed back as cursor,
+// or before for posts, to load the next page and is 0 on the last page.
+type PageResponse[T any] struct {
+	Items      []T   `json:"items"`
+	NextCursor int64 `json:"nextCursor"`
+}
+
+func toGroupResponse(g domain.Group) GroupResponse {
+	return GroupResponse{
+		ID:          g.ID,
+		Name:        g.Name,
+		Description: g.Description,
+		OwnerID:     g.OwnerID,
+		Settings: GroupSettingsResponse{
+			Visibility: string(g.Settings.Visibility),
+			JoinPolicy: string(g.Settings.JoinPolicy),
+			PostPolicy: string(g.Settings.PostPolicy),
+		},
+		MemberCount: g.MemberCount,
+		Ctime:       g.Ctime.UnixMilli(),
+		Utime:       g.Utime.UnixMilli(),
+	}
+}
+
+func toGroupUserResponse(u domain.User) GroupUserResponse {
+	return GroupUserResponse{
+		ID:        u.ID,
+		Handle:    u.Handle,
+		Nickname:  u.Nickname,
+		AvatarURL: u.AvatarURL,
+	}
+}
+
+func toDomainGroup(req GroupRequest) domain.Group {
+	return domain.Group{
+		Name:        req.Name,
+		Description: req.Description,
+		Settings: domain.GroupSettings{
+			Visibility: domain.GroupVisibility(req.Settings.Visibility),
+			JoinPolicy: domain.GroupJoinPolicy(req.Settings.JoinPolicy),
+			PostPolicy: domain.GroupPostPolicy(req.Settings.PostPolicy),
+		},
+	}
+}
+
+// Create creates a group owned by the caller. Settings left out default to a
+// public group that users ask to join and all members post in.
+func (h *GroupHandler) Create(c *gin.Context) {
+	var req GroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.invalidRequest(c, "invalid request")
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	g, err := h.svc.Create(c.Request.Context(), claim.UserId, toDomainGroup(req))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	res := toGroupResponse(g)
+	res.Role = domain.GroupRoleOwner.String()
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "group created",
+		Data: res,
+	})
+}
+
+// List lists the caller's groups, most recently joined first.
+func (h *GroupHandler) List(c *gin.Context) {
+	cursor, ok := parseCursor(c, "cursor")
+	if !ok {
+		h.invalidRequest(c, "invalid cursor")
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	limit := pageSize(c)
+	groups, members, err := h.svc.Groups(c.Request.Context(), claim.UserId, cursor, limit)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	res := PageResponse[GroupResponse]{Items: make([]GroupResponse, 0, len(groups))}
+	for i, g := range groups {
+		gr := toGroupResponse(g)
+		gr.Role = members[i].Role.String()
+		res.Items = append(res.Items, gr)
+	}
+	if len(members) == limit {
+		res.NextCursor = members[len(members)-1].ID
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+func (h *GroupHandler) Get(c *gin.Context) {
+	id, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	g, role, err := h.svc.Group(c.Request.Context(), claim.UserId, id)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	res := toGroupResponse(g)
+	res.Role = role.String()
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+// Update changes the name, description and settings of a group. Settings
+// left out keep their current value.
+func (h *GroupHandler) Update(c *gin.Context) {
+	id, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+	var req GroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.invalidRequest(c, "invalid request")
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	g := toDomainGroup(req)
+	g.ID = id
+	g, err := h.svc.Update(c.Request.Context(), claim.UserId, g)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "group updated",
+		Data: toGroupResponse(g),
+	})
+}
+
+func (h *GroupHandler) Delete(c *gin.Context) {
+	h.self(c, func(ctx context.Context, userId, groupId int64) error {
+		return h.svc.Delete(ctx, userId, groupId)
+	}, "group deleted")
+}
+
+// Members lists the members of a group in the order they joined.
+func (h *GroupHandler) Members(c *gin.Context) {
+	id, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+	cursor, ok := parseCursor(c, "cursor")
+	if !ok {
+		h.invalidRequest(c, "invalid cursor")
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	limit := pageSize(c)
+	ms, err := h.svc.Members(c.Request.Context(), claim.UserId, id, cursor, limit)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	res := PageResponse[MemberResponse]{Items: make([]MemberResponse, 0, len(ms))}
+	for _, m := range ms {
+		res.Items = append(res.Items, MemberResponse{
+			User:   toGroupUserResponse(m.User),
+			Role:   m.Role.String(),
+			Joined: m.Ctime.UnixMilli(),
+		})
+	}
+	if len(ms) == limit {
+		res.NextCursor = ms[len(ms)-1].ID
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+// Join joins a group the caller was invited to, or else asks to join it.
+func (h *GroupHandler) Join(c *gin.Context) {
+	id, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	joined, err := h.svc.Join(c.Request.Context(), claim.UserId, id)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	msg := "join request sent"
+	if joined {
+		msg = "you joined the group"
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  msg,
+		Data: nil,
+	})
+}
+
+func (h *GroupHandler) Leave(c *gin.Context) {
+	h.self(c, h.svc.Leave, "you left the group")
+}
+
+// Kick removes the member with the given handle. They may join again.
+func (h *GroupHandler) Kick(c *gin.Context) {
+	h.onUser(c, h.svc.Kick, "member removed")
+}
+
+// SetRole makes a member an admin or a plain member again.
+func (h *GroupHandler) SetRole(c *gin.Context) {
+	type SetRoleRequest struct {
+		Handle string `json:"handle"`
+		Role   string `json:"role"`
+	}
+
+	id, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+	var req SetRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Handle == "" {
+		h.invalidRequest(c, "invalid request")
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	u, err := user.UserByHandle(c.Request.Context(), h.userSvc, req.Handle)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	err = h.svc.SetRole(c.Request.Context(), claim.UserId, id, u.ID, domain.ParseGroupRole(req.Role))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "role updated",
+		Data: nil,
+	})
+}
+
+// Transfer hands the group over to the member with the given handle. The
+// caller stays on as an admin.
+func (h *GroupHandler) Transfer(c *gin.Context) {
+	h.onUser(c, h.svc.TransferOwnership, "ownership transferred")
+}
+
+// Requests lists the pending join requests of a group, newest first.
+func (h *GroupHandler) Requests(c *gin.Context) {
+	h.pending(c, h.svc.Requests)
+}
+
+func (h *GroupHandler) Approve(c *gin.Context) {
+	h.onUser(c, h.svc.Approve, "join request approved")
+}
+
+func (h *GroupHandler) Decline(c *gin.Context) {
+	h.onUser(c, h.svc.Decline, "join request declined")
+}
+
+// CancelRequest withdraws the caller's join request.
+func (h *GroupHandler) CancelRequest(c *gin.Context) {
+	h.self(c, h.svc.CancelRequest, "join request cancelled")
+}
+
+// Invites lists the unanswered invites of a group, newest first.
+func (h *GroupHandler) Invites(c *gin.Context) {
+	h.pending(c, h.svc.Invites)
+}
+
+// Invite invites the user with the given handle. If they already asked to
+// join, they are let in instead.
+func (h *GroupHandler) Invite(c *gin.Context) {
+	id, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+	var req handleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Handle == "" {
+		h.invalidRequest(c, "invalid request")
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	u, err := user.UserByHandle(c.Request.Context(), h.userSvc, req.Handle)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	joined, err := h.svc.Invite(c.Request.Context(), claim.UserId, id, u.ID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	msg := "user invited"
+	if joined {
+		msg = "user added to the group"
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  msg,
+		Data: nil,
+	})
+}
+
+func (h *GroupHandler) AcceptInvite(c *gin.Context) {
+	h.self(c, h.svc.AcceptInvite, "you joined the group")
+}
+
+func (h *GroupHandler) DeclineInvite(c *gin.Context) {
+	h.self(c, h.svc.DeclineInvite, "invite declined")
+}
+
+func (h *GroupHandler) RevokeInvite(c *gin.Context) {
+	h.onUser(c, h.svc.RevokeInvite, "invite revoked")
+}
+
+// MyInvites lists the invites the caller has not answered, newest first.
+func (h *GroupHandler) MyInvites(c *gin.Context) {
+	cursor, ok := parseCursor(c, "cursor")
+	if !ok {
+		h.invalidRequest(c, "invalid cursor")
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	limit := pageSize(c)
+	ps, groups, err := h.svc.MyInvites(c.Request.Context(), claim.UserId, cursor, limit)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	res := PageResponse[InviteResponse]{Items: make([]InviteResponse, 0, len(ps))}
+	for _, p := range ps {
+		g, ok := groups[p.GroupID]
+		if !ok {
+			continue
+		}
+		res.Items = append(res.Items, InviteResponse{
+			Group:     toGroupResponse(g),
+			InviterID: p.InviterID,
+			Ctime:     p.Ctime.UnixMilli(),
+		})
+	}
+	if len(ps) == limit {
+		res.NextCursor = ps[len(ps)-1].ID
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+// Bans lists the users banned from a group, newest first.
+func (h *GroupHandler) Bans(c *gin.Context) {
+	id, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+	cursor, ok := parseCursor(c, "cursor")
+	if !ok {
+		h.invalidRequest(c, "invalid cursor")
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	limit := pageSize(c)
+	bs, err := h.svc.Bans(c.Request.Context(), claim.UserId, id, cursor, limit)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	res := PageResponse[BanResponse]{Items: make([]BanResponse, 0, len(bs))}
+	for _, b := range bs {
+		res.Items = append(res.Items, BanResponse{
+			User:     toGroupUserResponse(b.User),
+			BannedBy: b.BannedBy,
+			Ctime:    b.Ctime.UnixMilli(),
+		})
+	}
+	if len(bs) == limit {
+		res.NextCursor = bs[len(bs)-1].ID
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+// Ban removes the user with the given handle from the group and keeps them
+// out.
+func (h *GroupHandler) Ban(c *gin.Context) {
+	h.onUser(c, h.svc.Ban, "user banned")
+}
+
+func (h *GroupHandler) Unban(c *gin.Context) {
+	h.onUser(c, h.svc.Unban, "user unbanned")
+}
+
+// Posts lists the posts of a group, newest first. Older pages are loaded
+// with before set to the previous page's nextCursor.
+func (h *GroupHandler) Posts(c *gin.Context) {
+	id, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+	before, ok := parseCursor(c, "before")
+	if !ok {
+		h.invalidRequest(c, "invalid cursor")
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	limit := pageSize(c)
+	ps, err := h.svc.Posts(c.Request.Context(), claim.UserId, id, before, limit)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	res := PageResponse[PostResponse]{Items: make([]PostResponse, 0, len(ps))}
+	for _, p := range ps {
+		res.Items = append(res.Items, toPostResponse(p))
+	}
+	if len(ps) == limit {
+		res.NextCursor = ps[len(ps)-1].ID
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+func (h *GroupHandler) Post(c *gin.Context) {
+	type PostRequest struct {
+		Content string `json:"content"`
+	}
+
+	id, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+	var req PostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.invalidRequest(c, "invalid request")
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	p, err := h.svc.Post(c.Request.Context(), claim.UserId, id, req.Content)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "post published",
+		Data: toPostResponse(p),
+	})
+}
+
+func (h *GroupHandler) DeletePost(c *gin.Context) {
+	id, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+	postId, err := strconv.ParseInt(c.Param("postId"), 10, 64)
+	if err != nil {
+		h.invalidRequest(c, "invalid post id")
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	if err := h.svc.DeletePost(c.Request.Context(), claim.UserId, id, postId); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "post deleted",
+		Data: nil,
+	})
+}
+
+func toPostResponse(p domain.GroupPost) PostResponse {
+	return PostResponse{
+		ID:      p.ID,
+		GroupID: p.GroupID,
+		Author:  toGroupUserResponse(p.Author),
+		Content: p.Content,
+		Ctime:   p.Ctime.UnixMilli(),
+	}
+}
+
+// self runs an action of the caller on a group.
+func (h *GroupHandler) self(c *gin.Context, act func(ctx context.Context, userId, groupId int64) error, msg string) {
+	id, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	if err := act(c.Request.Context(), claim.UserId, id); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  msg,
+		Data: nil,
+	})
+}
+
+// onUser runs an action of the caller on the user with the handle in the
+// request body.
+func (h *GroupHandler) onUser(c *gin.Context, act func(ctx context.Context, actorId, groupId, userId int64) error,
+	msg string) {
+	id, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+	var req handleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Handle == "" {
+		h.invalidRequest(c, "invalid request")
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	u, err := user.UserByHandle(c.Request.Context(), h.userSvc, req.Handle)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	if err = act(c.Request.Context(), claim.UserId, id, u.ID); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  msg,
+		Data: nil,
+	})
+}
+
+// pending lists the join requests or invites of a group.
+func (h *GroupHandler) pending(c *gin.Context,
+	list func(ctx context.Context, actorId, groupId, cursor int64, limit int) ([]domain.GroupPending, error)) {
+	id, ok := h.groupID(c)
+	if !ok {
+		return
+	}
+	cursor, ok := parseCursor(c, "cursor")
+	if !ok {
+		h.invalidRequest(c, "invalid cursor")
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	limit := pageSize(c)
+	ps, err := list(c.Request.Context(), claim.UserId, id, cursor, limit)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	res := PageResponse[PendingResponse]{Items: make([]PendingResponse, 0, len(ps))}
+	for _, p := range ps {
+		res.Items = append(res.Items, PendingResponse{
+			User:      toGroupUserResponse(p.User),
+			InviterID: p.InviterID,
+			Ctime:     p.Ctime.UnixMilli(),
+		})
+	}
+	if len(ps) == limit {
+		res.NextCursor = ps[len(ps)-1].ID
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+// groupID reads the group ID from the path, answering the request if it is
+// invalid.
+func (h *GroupHandler) groupID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.invalidRequest(c, "invalid group id")
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *GroupHandler) invalidRequest(c *gin.Context, msg string) {
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeInvalidParam,
+		Msg:  msg,
+		Data: nil,
+	})
+}
+
+func (h *GroupHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidGroup), errors.Is(err, service.ErrInvalidGroupPost):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  err.Error(),
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeUserNotFound,
+			Msg:  "user not found",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrGroupNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeGroupNotFound,
+			Msg:  "group not found",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrGroupPermissionDenied):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeGroupPermissionDenied,
+			Msg:  "you are not allowed to do this in this group",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrGroupMemberNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeGroupMemberNotFound,
+			Msg:  "not a member of this group",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrAlreadyGroupMember):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeAlreadyGroupMember,
+			Msg:  "already a member of this group",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrGroupPendingNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeGroupPendingNotFound,
+			Msg:  "join request or invite not found",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrGroupInviteOnly):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeGroupInviteOnly,
+			Msg:  "this group can only be joined by invite",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrGroupBanned):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeGroupBanned,
+			Msg:  "banned from this group",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrGroupBanNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeGroupBanNotFound,
+			Msg:  "user is not banned",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrGroupOwnerCannotLeave):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeGroupOwnerCannotLeave,
+			Msg:  "transfer the group to another member before leaving",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrGroupPostNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeGroupPostNotFound,
+			Msg:  "post not found",
+			Data: nil,
+		})
+	default:
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+	}
+}
+
+func pageSize(c *gin.Context) int {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		return defaultPageSize
+	}
+	return min(limit, maxPageSize)
+}
+
+// parseCursor reads an ID cursor from the query. A missing cursor is the
+// start of the list.
+func parseCursor(c *gin.Context, key string) (int64, bool) {
+	s := c.Query(key)
+	if s == "" {
+		return 0, true
+	}
+	cursor, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || cursor <= 0 {
+		return 0, false
+	}
+	return cursor, true
+}
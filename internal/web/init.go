@@ -8,7 +8,10 @@ import (
 	"github.com/ktsoator/connectify/internal/web/middleware"
 )
 
-func InitRouter() *gin.Engine {
+// InitRouter creates the engine with the global middlewares. Extra middlewares
+// run after JWT authentication, so they can rely on the claim being set for
+// protected routes.
+func InitRouter(mdls ...gin.HandlerFunc) *gin.Engine {
 	server := gin.Default()
 
 	server.Use(cors.New(cors.Config{
@@ -78,8 +81,37 @@ func InitRouter() *gin.Engine {
 	// Ignore authentication for the following paths
 	server.Use(middleware.NewLoginJwtMiddlewareBuilder().
 		IgnorePath("/user/login_jwt").
-		IgnorePath("/user/signup").
+		IgnorePath("/user/guest").
+		// Signup also converts the caller's guest account when a token is sent
+		OptionalPath("/user/signup").
+		OptionalPath("/user/login_phone").
+		OptionalPath("/user/login_oauth").
+		IgnorePath("/user/phone/code").
+		// OIDC protocol endpoints authenticate clients on their own
+		IgnorePath("/.well-known/openid-configuration").
+		IgnorePath("/oauth2/jwks").
+		IgnorePath("/oauth2/token").
+		IgnorePath("/oauth2/userinfo").
+		// SCIM provisioning uses per-tenant bearer tokens
+		IgnorePrefix("/scim/v2/").
+		// Uploaded files served from local storage
+		IgnorePrefix("/uploads/").
+		// Public profile pages and search; privacy settings depend on the viewer
+		OptionalPrefix("/u/").
+		OptionalPath("/users/search").
+		// Published articles
+		OptionalPrefix("/pub/").
+		OptionalPath("/articles/hot").
+		// Published policy documents are shown on the signup form
+		IgnorePath("/policies").
+		IgnorePrefix("/policies/").
+		// Browsers cannot send headers when opening real-time connections;
+		// they present a one-time ticket instead
+		OptionalPath("/realtime/ws").
+		OptionalPath("/realtime/sse").
 		Build())
 
+	server.Use(mdls...)
+
 	return server
 }
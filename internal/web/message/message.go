@@ -0,0 +1,417 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+	"github.com/ktsoator/connectify/internal/web/user"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type MessageHandler struct {
+	svc     *service.MessageService
+	userSvc *service.UserService
+}
+
+func NewMessageHandler(svc *service.MessageService, userSvc *service.UserService) *MessageHandler {
+	return &MessageHandler{
+		svc:     svc,
+		userSvc: userSvc,
+	}
+}
+
+func (h *MessageHandler) RegisterRoutes(r *gin.Engine) {
+	rg := r.Group("/messages")
+	rg.GET("/unread_count", h.UnreadCount)
+	rg.POST("/conversations", h.Open)
+	rg.GET("/conversations", h.Conversations)
+	rg.GET("/conversations/:id", h.Conversation)
+	rg.GET("/conversations/:id/messages", h.History)
+	rg.POST("/conversations/:id/messages", h.Send)
+	rg.POST("/conversations/:id/read", h.MarkRead)
+}
+
+type PeerResponse struct {
+	ID        int64  `json:"id"`
+	Handle    string `json:"handle"`
+	Nickname  string `json:"nickname"`
+	AvatarURL string `json:"avatarUrl"`
+}
+
+type MessageResponse struct {
+	ID             int64  `json:"id"`
+	ConversationID int64  `json:"conversationId"`
+	SenderID       int64  `json:"senderId"`
+	Content        string `json:"content"`
+	Ctime          int64  `json:"ctime"`
+}
+
+type ConversationResponse struct {
+	ID   int64        `json:"id"`
+	Peer PeerResponse `json:"peer"`
+	// LastMessage is null while the conversation has no messages.
+	LastMessage *MessageResponse `json:"lastMessage"`
+	Unread      int64            `json:"unread"`
+	// LastReadID is the newest message the caller has read. The caller's
+	// messages up to PeerLastReadID were read by the peer.
+	LastReadID     int64 `json:"lastReadId"`
+	PeerLastReadID int64 `json:"peerLastReadId"`
+	Ctime          int64 `json:"ctime"`
+	Utime          int64 `json:"utime"`
+}
+
+// ConversationListResponse is one page of conversations. NextCursor is passed
+// back as cursor to load the next page and is empty on the last page.
+type ConversationListResponse struct {
+	Conversations []ConversationResponse `json:"conversations"`
+	NextCursor    string                 `json:"nextCursor"`
+}
+
+// HistoryResponse is one page of messages, newest first. NextCursor is passed
+// back as before to load older messages and is 0 on the last page.
+type HistoryResponse struct {
+	Messages   []MessageResponse `json:"messages"`
+	NextCursor int64             `json:"nextCursor"`
+}
+
+func toMessageResponse(m domain.Message) MessageResponse {
+	return MessageResponse{
+		ID:             m.ID,
+		ConversationID: m.ConversationID,
+		SenderID:       m.SenderID,
+		Content:        m.Content,
+		Ctime:          m.Ctime.UnixMilli(),
+	}
+}
+
+func toConversationResponse(c domain.Conversation) ConversationResponse {
+	res := ConversationResponse{
+		ID: c.ID,
+		Peer: PeerResponse{
+			ID:        c.Peer.ID,
+			Handle:    c.Peer.Handle,
+			Nickname:  c.Peer.Nickname,
+			AvatarURL: c.Peer.AvatarURL,
+		},
+		Unread:         c.Unread,
+		LastReadID:     c.LastReadID,
+		PeerLastReadID: c.PeerLastReadID,
+		Ctime:          c.Ctime.UnixMilli(),
+		Utime:          c.Utime.UnixMilli(),
+	}
+	if c.LastMessage.ID != 0 {
+		m := toMessageResponse(c.LastMessage)
+		res.LastMessage = &m
+	}
+	return res
+}
+
+// Open returns the caller's conversation with the user with the given handle,
+// starting it if needed.
+func (h *MessageHandler) Open(c *gin.Context) {
+	type OpenRequest struct {
+		Handle string `json:"handle"`
+	}
+
+	var req OpenRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Handle == "" {
+		h.invalidRequest(c, "invalid request")
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	peer, err := user.UserByHandle(c.Request.Context(), h.userSvc, req.Handle)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	conv, err := h.svc.Open(c.Request.Context(), claim.UserId, peer.ID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: toConversationResponse(conv),
+	})
+}
+
+// Conversations lists the caller's conversations, most recently active first.
+func (h *MessageHandler) Conversations(c *gin.Context) {
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	cursor, ok := parseCursor(c.Query("cursor"))
+	if !ok {
+		h.invalidRequest(c, "invalid cursor")
+		return
+	}
+	convs, next, err := h.svc.Conversations(c.Request.Context(), claim.UserId, cursor, pageSize(c))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	res := ConversationListResponse{Conversations: make([]ConversationResponse, 0, len(convs))}
+	for _, conv := range convs {
+		res.Conversations = append(res.Conversations, toConversationResponse(conv))
+	}
+	if !next.IsZero() {
+		res.NextCursor = fmt.Sprintf("%d-%d", next.Utime.UnixMilli(), next.ID)
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+func (h *MessageHandler) Conversation(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.invalidRequest(c, "invalid conversation id")
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	conv, err := h.svc.Conversation(c.Request.Context(), claim.UserId, id)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: toConversationResponse(conv),
+	})
+}
+
+// History returns the messages of a conversation, newest first. Older pages
+// are loaded with before set to the previous page's nextCursor.
+func (h *MessageHandler) History(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.invalidRequest(c, "invalid conversation id")
+		return
+	}
+	var before int64
+	if s := c.Query("before"); s != "" {
+		before, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || before <= 0 {
+			h.invalidRequest(c, "invalid cursor")
+			return
+		}
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	limit := pageSize(c)
+	msgs, err := h.svc.History(c.Request.Context(), claim.UserId, id, before, limit)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	res := HistoryResponse{Messages: make([]MessageResponse, 0, len(msgs))}
+	for _, m := range msgs {
+		res.Messages = append(res.Messages, toMessageResponse(m))
+	}
+	if len(msgs) == limit {
+		res.NextCursor = msgs[len(msgs)-1].ID
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+func (h *MessageHandler) Send(c *gin.Context) {
+	type SendRequest struct {
+		Content string `json:"content"`
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.invalidRequest(c, "invalid conversation id")
+		return
+	}
+	var req SendRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.invalidRequest(c, "invalid request")
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	msg, err := h.svc.Send(c.Request.Context(), claim.UserId, id, req.Content)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "message sent",
+		Data: toMessageResponse(msg),
+	})
+}
+
+// MarkRead marks the conversation read up to the given message.
+func (h *MessageHandler) MarkRead(c *gin.Context) {
+	type MarkReadRequest struct {
+		MessageID int64 `json:"messageId"`
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		h.invalidRequest(c, "invalid conversation id")
+		return
+	}
+	var req MarkReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.MessageID <= 0 {
+		h.invalidRequest(c, "invalid request")
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	if err := h.svc.MarkRead(c.Request.Context(), claim.UserId, id, req.MessageID); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "conversation marked read",
+		Data: nil,
+	})
+}
+
+// UnreadCount returns how many messages the caller has not read across all
+// conversations.
+func (h *MessageHandler) UnreadCount(c *gin.Context) {
+	type UnreadCountResponse struct {
+		Unread int64 `json:"unread"`
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	n, err := h.svc.UnreadCount(c.Request.Context(), claim.UserId)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: UnreadCountResponse{Unread: n},
+	})
+}
+
+func (h *MessageHandler) invalidRequest(c *gin.Context, msg string) {
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeInvalidParam,
+		Msg:  msg,
+		Data: nil,
+	})
+}
+
+func (h *MessageHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidMessage):
+		h.invalidRequest(c, err.Error())
+	case errors.Is(err, service.ErrCannotMessageSelf):
+		h.invalidRequest(c, "you cannot message yourself")
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeUserNotFound,
+			Msg:  "user not found",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrConversationNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeConversationNotFound,
+			Msg:  "conversation not found",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrBlocked):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeUserBlocked,
+			Msg:  "you cannot message this user",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrMessageNotAllowed):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeMessageNotAllowed,
+			Msg:  "this user does not accept messages from you",
+			Data: nil,
+		})
+	default:
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+	}
+}
+
+func pageSize(c *gin.Context) int {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		return defaultPageSize
+	}
+	return min(limit, maxPageSize)
+}
+
+// parseCursor reads a cursor of the form "<utime>-<id>". An empty cursor is
+// the start of the list.
+func parseCursor(s string) (domain.ConversationCursor, bool) {
+	if s == "" {
+		return domain.ConversationCursor{}, true
+	}
+	ms, id, ok := strings.Cut(s, "-")
+	if !ok {
+		return domain.ConversationCursor{}, false
+	}
+	utime, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil || utime <= 0 {
+		return domain.ConversationCursor{}, false
+	}
+	cid, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return domain.ConversationCursor{}, false
+	}
+	return domain.ConversationCursor{Utime: time.UnixMilli(utime), ID: cid}, true
+}
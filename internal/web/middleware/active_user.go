@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+	"github.com/ktsoator/connectify/internal/web/user"
+)
+
+// ActiveUserMiddlewareBuilder rejects tokens of users that were deleted or
+// deactivated after the token was issued, such as guests removed by the
+// cleanup job or users deprovisioned over SCIM. Tokens are otherwise valid
+// until they expire. It must run after the JWT login middleware.
+type ActiveUserMiddlewareBuilder struct {
+	svc *service.UserService
+}
+
+func NewActiveUserMiddlewareBuilder(svc *service.UserService) *ActiveUserMiddlewareBuilder {
+	return &ActiveUserMiddlewareBuilder{svc: svc}
+}
+
+func (a *ActiveUserMiddlewareBuilder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		// Public routes carry no claim; there is nobody to check.
+		claim, ok := user.GetUserClaims(ctx)
+		if !ok {
+			ctx.Next()
+			return
+		}
+
+		err := a.svc.CheckActive(ctx.Request.Context(), claim.UserId)
+		switch {
+		case err == nil:
+			ctx.Next()
+		case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrUserDeactivated):
+			ctx.AbortWithStatusJSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidCreds,
+				Msg:  "unauthorized",
+				Data: nil,
+			})
+		default:
+			ctx.AbortWithStatusJSON(http.StatusOK, resp.Result{
+				Code: resp.CodeServerBusy,
+				Msg:  "system error",
+				Data: nil,
+			})
+		}
+	}
+}
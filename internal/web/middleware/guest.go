@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+	"github.com/ktsoator/connectify/internal/web/user"
+)
+
+// maxTrackedGuests bounds the in-memory activity map; stale entries are
+// dropped once it grows past this size.
+const maxTrackedGuests = 10000
+
+// GuestGuardMiddlewareBuilder limits guest tokens to an allow-list of routes
+// and records guest activity, which keeps active guests from being cleaned up.
+// It must run after the JWT login middleware.
+type GuestGuardMiddlewareBuilder struct {
+	svc        *service.UserService
+	paths      []string
+	prefixes   []string
+	touchEvery time.Duration
+
+	mu        sync.Mutex
+	lastTouch map[int64]time.Time
+}
+
+// NewGuestGuardMiddlewareBuilder creates the guard. Guest activity is written
+// to the database at most once per touchEvery per guest and instance.
+func NewGuestGuardMiddlewareBuilder(svc *service.UserService, touchEvery time.Duration) *GuestGuardMiddlewareBuilder {
+	return &GuestGuardMiddlewareBuilder{
+		svc:        svc,
+		touchEvery: touchEvery,
+		lastTouch:  make(map[int64]time.Time),
+	}
+}
+
+// AllowPath lets guests use the given path.
+func (g *GuestGuardMiddlewareBuilder) AllowPath(path string) *GuestGuardMiddlewareBuilder {
+	g.paths = append(g.paths, path)
+	return g
+}
+
+// AllowPrefix lets guests use every path under prefix.
+func (g *GuestGuardMiddlewareBuilder) AllowPrefix(prefix string) *GuestGuardMiddlewareBuilder {
+	g.prefixes = append(g.prefixes, prefix)
+	return g
+}
+
+func (g *GuestGuardMiddlewareBuilder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claim, ok := user.GetUserClaims(ctx)
+		if !ok || !claim.Guest {
+			ctx.Next()
+			return
+		}
+
+		path := ctx.Request.URL.Path
+		if !slices.Contains(g.paths, path) && !slices.ContainsFunc(g.prefixes, func(p string) bool {
+			return strings.HasPrefix(path, p)
+		}) {
+			ctx.AbortWithStatusJSON(http.StatusOK, resp.Result{
+				Code: resp.CodeGuestNotAllowed,
+				Msg:  "please sign up to use this feature",
+				Data: nil,
+			})
+			return
+		}
+
+		if g.shouldTouch(claim.UserId) {
+			// Activity tracking must never fail the request.
+			if err := g.svc.TouchGuest(ctx.Request.Context(), claim.UserId); err != nil {
+				log.Printf("touch guest %d: %v", claim.UserId, err)
+			}
+		}
+		ctx.Next()
+	}
+}
+
+func (g *GuestGuardMiddlewareBuilder) shouldTouch(uid int64) bool {
+	now := time.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if last, ok := g.lastTouch[uid]; ok && now.Sub(last) < g.touchEvery {
+		return false
+	}
+	if len(g.lastTouch) >= maxTrackedGuests {
+		for id, last := range g.lastTouch {
+			if now.Sub(last) >= g.touchEvery {
+				delete(g.lastTouch, id)
+			}
+		}
+	}
+	g.lastTouch[uid] = now
+	return true
+}
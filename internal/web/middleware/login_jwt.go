@@ -20,7 +20,10 @@ const (
 )
 
 type LoginJwtMiddlewareBuilder struct {
-	paths []string
+	paths            []string
+	prefixes         []string
+	optionalPaths    []string
+	optionalPrefixes []string
 }
 
 func NewLoginJwtMiddlewareBuilder() *LoginJwtMiddlewareBuilder {
@@ -32,34 +35,65 @@ func (l *LoginJwtMiddlewareBuilder) IgnorePath(paths string) *LoginJwtMiddleware
 	return l
 }
 
+// IgnorePrefix skips authentication for every path under prefix, for route
+// groups that authenticate requests on their own.
+func (l *LoginJwtMiddlewareBuilder) IgnorePrefix(prefix string) *LoginJwtMiddlewareBuilder {
+	l.prefixes = append(l.prefixes, prefix)
+	return l
+}
+
+// OptionalPath lets anonymous requests through but still identifies the user
+// when a valid token is sent, e.g. signup converting a guest account.
+func (l *LoginJwtMiddlewareBuilder) OptionalPath(path string) *LoginJwtMiddlewareBuilder {
+	l.optionalPaths = append(l.optionalPaths, path)
+	return l
+}
+
+// OptionalPrefix is OptionalPath for every path under prefix.
+func (l *LoginJwtMiddlewareBuilder) OptionalPrefix(prefix string) *LoginJwtMiddlewareBuilder {
+	l.optionalPrefixes = append(l.optionalPrefixes, prefix)
+	return l
+}
+
 func (l *LoginJwtMiddlewareBuilder) Build() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		if slices.Contains(l.paths, ctx.Request.RequestURI) {
+		path := ctx.Request.URL.Path
+		if slices.Contains(l.paths, path) || slices.ContainsFunc(l.prefixes, func(p string) bool {
+			return strings.HasPrefix(path, p)
+		}) {
 			ctx.Next()
 			return
 		}
 
+		optional := slices.Contains(l.optionalPaths, path) || slices.ContainsFunc(l.optionalPrefixes, func(p string) bool {
+			return strings.HasPrefix(path, p)
+		})
+		unauthorized := func() {
+			if optional {
+				// Continue anonymously; handlers check whether a claim is set.
+				ctx.Next()
+				return
+			}
+			ctx.AbortWithStatusJSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidCreds,
+				Msg:  "unauthorized",
+				Data: nil,
+			})
+		}
+
 		// JWT verification logic
 		// Get JWT tokenHeader from request header, validate it
 		// If validation fails, return 401 unauthorized error
 		// If validation succeeds, call ctx.Next() to continue processing the request
 		tokenHeader := ctx.GetHeader("Authorization")
 		if tokenHeader == "" {
-			ctx.AbortWithStatusJSON(http.StatusOK, resp.Result{
-				Code: resp.CodeInvalidCreds,
-				Msg:  "unauthorized",
-				Data: nil,
-			})
+			unauthorized()
 			return
 		}
 
 		segs := strings.Split(tokenHeader, " ")
 		if len(segs) != 2 || segs[0] != "Bearer" {
-			ctx.AbortWithStatusJSON(http.StatusOK, resp.Result{
-				Code: resp.CodeInvalidCreds,
-				Msg:  "unauthorized",
-				Data: nil,
-			})
+			unauthorized()
 			return
 		}
 		claim := user.UserClaims{} // Custom Claims structure
@@ -69,20 +103,12 @@ func (l *LoginJwtMiddlewareBuilder) Build() gin.HandlerFunc {
 		})
 
 		if err != nil || !jwtToken.Valid { // Token expired, return false
-			ctx.AbortWithStatusJSON(http.StatusOK, resp.Result{
-				Code: resp.CodeInvalidCreds,
-				Msg:  "unauthorized",
-				Data: nil,
-			})
+			unauthorized()
 			return
 		}
 
 		if claim.UserAgent != ctx.Request.UserAgent() { // Check if UserAgent is consistent
-			ctx.AbortWithStatusJSON(http.StatusOK, resp.Result{
-				Code: resp.CodeInvalidCreds,
-				Msg:  "unauthorized",
-				Data: nil,
-			})
+			unauthorized()
 			return
 		}
 
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+	"github.com/ktsoator/connectify/internal/web/user"
+)
+
+// PolicyConsentMiddlewareBuilder blocks logged-in users from protected routes
+// until they accept the policy versions currently in force.
+// It must run after the JWT login middleware.
+type PolicyConsentMiddlewareBuilder struct {
+	svc   *service.PolicyService
+	paths []string
+}
+
+func NewPolicyConsentMiddlewareBuilder(svc *service.PolicyService) *PolicyConsentMiddlewareBuilder {
+	return &PolicyConsentMiddlewareBuilder{svc: svc}
+}
+
+func (p *PolicyConsentMiddlewareBuilder) IgnorePath(path string) *PolicyConsentMiddlewareBuilder {
+	p.paths = append(p.paths, path)
+	return p
+}
+
+func (p *PolicyConsentMiddlewareBuilder) Build() gin.HandlerFunc {
+	type PendingPolicy struct {
+		ID      int64  `json:"id"`
+		Kind    string `json:"kind"`
+		Version string `json:"version"`
+		Title   string `json:"title"`
+	}
+
+	return func(ctx *gin.Context) {
+		if slices.Contains(p.paths, ctx.Request.URL.Path) {
+			ctx.Next()
+			return
+		}
+
+		// Public routes carry no claim; there is nobody to ask for consent.
+		claimAny, exists := ctx.Get("claim")
+		if !exists {
+			ctx.Next()
+			return
+		}
+		claim, ok := claimAny.(user.UserClaims)
+		if !ok {
+			ctx.Next()
+			return
+		}
+
+		pending, err := p.svc.Pending(ctx.Request.Context(), claim.UserId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusOK, resp.Result{
+				Code: resp.CodeServerBusy,
+				Msg:  "system error",
+				Data: nil,
+			})
+			return
+		}
+		if len(pending) == 0 {
+			ctx.Next()
+			return
+		}
+
+		data := make([]PendingPolicy, 0, len(pending))
+		for _, policy := range pending {
+			data = append(data, PendingPolicy{
+				ID:      policy.ID,
+				Kind:    policy.Kind,
+				Version: policy.Version,
+				Title:   policy.Title,
+			})
+		}
+		ctx.AbortWithStatusJSON(http.StatusOK, resp.Result{
+			Code: resp.CodePolicyConsentRequired,
+			Msg:  "please accept the updated policies",
+			Data: data,
+		})
+	}
+}
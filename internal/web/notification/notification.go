@@ -0,0 +1,292 @@
+package notification
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+	"github.com/ktsoator/connectify/internal/web/user"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	// maxReadIds bounds how many notifications are marked read at once.
+	maxReadIds = 100
+	// namedActors is how many actors a message names before "and N others".
+	namedActors = 2
+)
+
+type NotificationHandler struct {
+	svc *service.NotificationService
+}
+
+func NewNotificationHandler(svc *service.NotificationService) *NotificationHandler {
+	return &NotificationHandler{
+		svc: svc,
+	}
+}
+
+func (h *NotificationHandler) RegisterRoutes(r *gin.Engine) {
+	rg := r.Group("/notifications")
+	rg.GET("", h.Inbox)
+	rg.GET("/unread_count", h.UnreadCount)
+	rg.POST("/read", h.MarkRead)
+	rg.POST("/read_all", h.MarkAllRead)
+}
+
+type ActorResponse struct {
+	ID        int64  `json:"id"`
+	Handle    string `json:"handle"`
+	Nickname  string `json:"nickname"`
+	AvatarURL string `json:"avatarUrl"`
+}
+
+type NotificationResponse struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+	// Message is a ready to show summary, e.g. "alice and 3 others liked your
+	// post".
+	Message string `json:"message"`
+	// Actors are the most recent users who took part; Count is how many took
+	// part in total.
+	Actors    []ActorResponse `json:"actors"`
+	Count     int64           `json:"count"`
+	ArticleID int64           `json:"articleId,omitempty"`
+	CommentID int64           `json:"commentId,omitempty"`
+	Read      bool            `json:"read"`
+	Ctime     int64           `json:"ctime"`
+	Utime     int64           `json:"utime"`
+}
+
+// InboxResponse is one page of notifications. NextCursor is passed back as
+// cursor to load the next page and is empty on the last page.
+type InboxResponse struct {
+	Notifications []NotificationResponse `json:"notifications"`
+	NextCursor    string                 `json:"nextCursor"`
+}
+
+func toNotificationResponse(n domain.Notification) NotificationResponse {
+	actors := make([]ActorResponse, 0, len(n.Actors))
+	for _, a := range n.Actors {
+		actors = append(actors, ActorResponse{
+			ID:        a.ID,
+			Handle:    a.Handle,
+			Nickname:  a.Nickname,
+			AvatarURL: a.AvatarURL,
+		})
+	}
+	return NotificationResponse{
+		ID:        n.ID,
+		Type:      n.Type.String(),
+		Message:   message(n),
+		Actors:    actors,
+		Count:     n.Count,
+		ArticleID: n.ArticleID,
+		CommentID: n.CommentID,
+		Read:      n.Read,
+		Ctime:     n.Ctime.UnixMilli(),
+		Utime:     n.Utime.UnixMilli(),
+	}
+}
+
+func message(n domain.Notification) string {
+	switch n.Type {
+	case domain.NotificationTypeFollow:
+		return actorNames(n) + " followed you"
+	case domain.NotificationTypeLike:
+		return actorNames(n) + " liked your post"
+	case domain.NotificationTypeComment:
+		return actorNames(n) + " commented on your post"
+	case domain.NotificationTypeReply:
+		return actorNames(n) + " replied to your comment"
+	case domain.NotificationTypeMention:
+		return actorNames(n) + " mentioned you in a comment"
+	case domain.NotificationTypeFriendAccepted:
+		return actorNames(n) + " accepted your friend request"
+	case domain.NotificationTypeLoginFailed:
+		if n.Count == 1 {
+			return "Someone failed to sign in to your account"
+		}
+		return fmt.Sprintf("Someone failed to sign in to your account %d times", n.Count)
+	case domain.NotificationTypeHandleChanged:
+		return "Your handle was changed to @" + n.Detail
+	}
+	return ""
+}
+
+// actorNames summarizes the actors, e.g. "alice", "alice and bob" or
+// "alice, bob and 3 others".
+func actorNames(n domain.Notification) string {
+	var names []string
+	for _, a := range n.Actors[:min(len(n.Actors), namedActors)] {
+		name := a.Nickname
+		if name == "" {
+			name = a.Handle
+		}
+		names = append(names, name)
+	}
+	others := n.Count - int64(len(names))
+	switch {
+	case len(names) == 0:
+		return "Someone"
+	case others == 1:
+		return strings.Join(names, ", ") + " and 1 other"
+	case others > 1:
+		return fmt.Sprintf("%s and %d others", strings.Join(names, ", "), others)
+	case len(names) == 1:
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// Inbox returns the caller's notifications, most recently updated first. With
+// unread=true only unread ones are returned.
+func (h *NotificationHandler) Inbox(c *gin.Context) {
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	cursor, ok := parseCursor(c.Query("cursor"))
+	if !ok {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid cursor",
+			Data: nil,
+		})
+		return
+	}
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+
+	ns, next, err := h.svc.Inbox(c.Request.Context(), claim.UserId, cursor, limit, c.Query("unread") == "true")
+	if err != nil {
+		h.writeError(c)
+		return
+	}
+	res := InboxResponse{Notifications: make([]NotificationResponse, 0, len(ns))}
+	for _, n := range ns {
+		res.Notifications = append(res.Notifications, toNotificationResponse(n))
+	}
+	if !next.IsZero() {
+		res.NextCursor = fmt.Sprintf("%d-%d", next.Utime.UnixMilli(), next.ID)
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+// UnreadCount returns how many notifications the caller has not read, e.g.
+// for a badge.
+func (h *NotificationHandler) UnreadCount(c *gin.Context) {
+	type UnreadCountResponse struct {
+		Unread int64 `json:"unread"`
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	n, err := h.svc.UnreadCount(c.Request.Context(), claim.UserId)
+	if err != nil {
+		h.writeError(c)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: UnreadCountResponse{Unread: n},
+	})
+}
+
+// MarkRead marks the given notifications of the caller read.
+func (h *NotificationHandler) MarkRead(c *gin.Context) {
+	type MarkReadRequest struct {
+		IDs []int64 `json:"ids"`
+	}
+
+	var req MarkReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.IDs) == 0 || len(req.IDs) > maxReadIds {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	if err := h.svc.MarkRead(c.Request.Context(), claim.UserId, req.IDs); err != nil {
+		h.writeError(c)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "notifications marked read",
+		Data: nil,
+	})
+}
+
+// MarkAllRead marks every notification of the caller read.
+func (h *NotificationHandler) MarkAllRead(c *gin.Context) {
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	if err := h.svc.MarkAllRead(c.Request.Context(), claim.UserId); err != nil {
+		h.writeError(c)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "all notifications marked read",
+		Data: nil,
+	})
+}
+
+func (h *NotificationHandler) writeError(c *gin.Context) {
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeServerBusy,
+		Msg:  "system error",
+		Data: nil,
+	})
+}
+
+// parseCursor reads a cursor of the form "<updatedAt>-<id>". An empty cursor
+// is the start of the inbox.
+func parseCursor(s string) (domain.NotificationCursor, bool) {
+	if s == "" {
+		return domain.NotificationCursor{}, true
+	}
+	ms, id, ok := strings.Cut(s, "-")
+	if !ok {
+		return domain.NotificationCursor{}, false
+	}
+	utime, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil || utime <= 0 {
+		return domain.NotificationCursor{}, false
+	}
+	nid, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return domain.NotificationCursor{}, false
+	}
+	return domain.NotificationCursor{Utime: time.UnixMilli(utime), ID: nid}, true
+}
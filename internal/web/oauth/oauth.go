@@ -0,0 +1,479 @@
+package oauth
+
+import (
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+	"github.com/ktsoator/connectify/internal/web/user"
+)
+
+// OAuthHandler exposes Connectify as an OpenID Connect identity provider.
+//
+// Protocol endpoints (discovery, JWKS, token, userinfo) speak plain OAuth 2.0
+// JSON as required by the specs. Endpoints used by our own frontend (client
+// registration, the consent screen, consent management) use resp.Result like
+// the rest of the API and require the usual Connectify login.
+type OAuthHandler struct {
+	svc *service.OAuthService
+}
+
+func NewOAuthHandler(svc *service.OAuthService) *OAuthHandler {
+	return &OAuthHandler{
+		svc: svc,
+	}
+}
+
+func (h *OAuthHandler) RegisterRoutes(r *gin.Engine) {
+	r.GET("/.well-known/openid-configuration", h.Discovery)
+
+	rg := r.Group("/oauth2")
+
+	rg.GET("/jwks", h.JWKS)
+	rg.POST("/token", h.Token)
+	rg.GET("/userinfo", h.UserInfo)
+	rg.POST("/userinfo", h.UserInfo)
+
+	rg.POST("/clients", h.RegisterClient)
+	rg.GET("/clients", h.Clients)
+
+	rg.GET("/authorize", h.AuthorizePrompt)
+	rg.POST("/authorize", h.AuthorizeDecision)
+
+	rg.GET("/consents", h.Consents)
+	rg.DELETE("/consents/:clientId", h.RevokeConsent)
+}
+
+func (h *OAuthHandler) Discovery(c *gin.Context) {
+	issuer := h.svc.Issuer()
+	c.JSON(http.StatusOK, gin.H{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth2/authorize",
+		"token_endpoint":                        issuer + "/oauth2/token",
+		"userinfo_endpoint":                     issuer + "/oauth2/userinfo",
+		"jwks_uri":                              issuer + "/oauth2/jwks",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      service.SupportedScopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "email", "email_verified", "name"},
+	})
+}
+
+func (h *OAuthHandler) JWKS(c *gin.Context) {
+	keys, err := h.svc.SigningKeys(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	jwks := make([]gin.H, 0, len(keys))
+	for _, k := range keys {
+		pub := k.PrivateKey.PublicKey
+		jwks = append(jwks, gin.H{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": k.KID,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		})
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": jwks})
+}
+
+func (h *OAuthHandler) Token(c *gin.Context) {
+	req := service.TokenRequest{
+		GrantType:    c.PostForm("grant_type"),
+		Code:         c.PostForm("code"),
+		RedirectURI:  c.PostForm("redirect_uri"),
+		ClientID:     c.PostForm("client_id"),
+		ClientSecret: c.PostForm("client_secret"),
+		CodeVerifier: c.PostForm("code_verifier"),
+	}
+	// client_secret_basic takes precedence over credentials in the body.
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID = id
+		req.ClientSecret = secret
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	tokens, err := h.svc.Exchange(c.Request.Context(), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnsupportedGrantType):
+			tokenError(c, http.StatusBadRequest, "unsupported_grant_type", err)
+		case errors.Is(err, service.ErrInvalidClientAuth):
+			c.Header("WWW-Authenticate", `Basic realm="connectify"`)
+			tokenError(c, http.StatusUnauthorized, "invalid_client", err)
+		case errors.Is(err, service.ErrInvalidGrant):
+			tokenError(c, http.StatusBadRequest, "invalid_grant", err)
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": tokens.AccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   tokens.ExpiresIn,
+		"id_token":     tokens.IDToken,
+		"scope":        tokens.Scope,
+	})
+}
+
+func (h *OAuthHandler) UserInfo(c *gin.Context) {
+	segs := strings.Split(c.GetHeader("Authorization"), " ")
+	if len(segs) != 2 || segs[0] != "Bearer" {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	info, err := h.svc.UserInfo(c.Request.Context(), segs[1])
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAccessToken) {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+func (h *OAuthHandler) RegisterClient(c *gin.Context) {
+	type RegisterClientRequest struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirectUris"`
+		Public       bool     `json:"public"`
+	}
+	type RegisterClientResponse struct {
+		ClientID     string   `json:"clientId"`
+		ClientSecret string   `json:"clientSecret,omitempty"`
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirectUris"`
+		Public       bool     `json:"public"`
+	}
+
+	var req RegisterClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	client, secret, err := h.svc.RegisterClient(c.Request.Context(), claim.UserId,
+		strings.TrimSpace(req.Name), req.RedirectURIs, req.Public)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRedirectURI) {
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidParam,
+				Msg:  "invalid redirect uri",
+				Data: nil,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "client registered successfully",
+		Data: RegisterClientResponse{
+			ClientID:     client.ClientID,
+			ClientSecret: secret,
+			Name:         client.Name,
+			RedirectURIs: client.RedirectURIs,
+			Public:       client.Public,
+		},
+	})
+}
+
+func (h *OAuthHandler) Clients(c *gin.Context) {
+	type ClientResponse struct {
+		ClientID     string   `json:"clientId"`
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirectUris"`
+		Public       bool     `json:"public"`
+		Ctime        int64    `json:"ctime"`
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	clients, err := h.svc.Clients(c.Request.Context(), claim.UserId)
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	res := make([]ClientResponse, 0, len(clients))
+	for _, cl := range clients {
+		res = append(res, ClientResponse{
+			ClientID:     cl.ClientID,
+			Name:         cl.Name,
+			RedirectURIs: cl.RedirectURIs,
+			Public:       cl.Public,
+			Ctime:        cl.Ctime.UnixMilli(),
+		})
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+// AuthorizePrompt validates an authorization request and returns the data for
+// the consent screen. The frontend forwards the query string it received from
+// the client unchanged.
+func (h *OAuthHandler) AuthorizePrompt(c *gin.Context) {
+	type ScreenResponse struct {
+		ClientID   string   `json:"clientId"`
+		ClientName string   `json:"clientName"`
+		Scopes     []string `json:"scopes"`
+		Consented  bool     `json:"consented"`
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	req := service.AuthorizeRequest{
+		ResponseType:        c.Query("response_type"),
+		ClientID:            c.Query("client_id"),
+		RedirectURI:         c.Query("redirect_uri"),
+		Scope:               c.Query("scope"),
+		State:               c.Query("state"),
+		Nonce:               c.Query("nonce"),
+		CodeChallenge:       c.Query("code_challenge"),
+		CodeChallengeMethod: c.Query("code_challenge_method"),
+	}
+	prompt, err := h.svc.Prepare(c.Request.Context(), claim.UserId, req)
+	if err != nil {
+		h.authorizeError(c, req, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: ScreenResponse{
+			ClientID:   prompt.Client.ClientID,
+			ClientName: prompt.Client.Name,
+			Scopes:     prompt.Scopes,
+			Consented:  prompt.Consented,
+		},
+	})
+}
+
+// AuthorizeDecision records the user's answer on the consent screen and
+// returns the URL the frontend should navigate to.
+func (h *OAuthHandler) AuthorizeDecision(c *gin.Context) {
+	type DecisionRequest struct {
+		ResponseType        string `json:"responseType"`
+		ClientID            string `json:"clientId"`
+		RedirectURI         string `json:"redirectUri"`
+		Scope               string `json:"scope"`
+		State               string `json:"state"`
+		Nonce               string `json:"nonce"`
+		CodeChallenge       string `json:"codeChallenge"`
+		CodeChallengeMethod string `json:"codeChallengeMethod"`
+		Approve             bool   `json:"approve"`
+	}
+	type DecisionResponse struct {
+		RedirectTo string `json:"redirectTo"`
+	}
+
+	var body DecisionRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	req := service.AuthorizeRequest{
+		ResponseType:        body.ResponseType,
+		ClientID:            body.ClientID,
+		RedirectURI:         body.RedirectURI,
+		Scope:               body.Scope,
+		State:               body.State,
+		Nonce:               body.Nonce,
+		CodeChallenge:       body.CodeChallenge,
+		CodeChallengeMethod: body.CodeChallengeMethod,
+	}
+
+	var (
+		redirect string
+		err      error
+	)
+	if body.Approve {
+		redirect, err = h.svc.Approve(c.Request.Context(), claim.UserId, req)
+	} else {
+		redirect, err = h.svc.Deny(c.Request.Context(), req)
+	}
+	if err != nil {
+		h.authorizeError(c, req, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: DecisionResponse{RedirectTo: redirect},
+	})
+}
+
+func (h *OAuthHandler) Consents(c *gin.Context) {
+	type ConsentResponse struct {
+		ClientID string   `json:"clientId"`
+		Scopes   []string `json:"scopes"`
+		Utime    int64    `json:"utime"`
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	consents, err := h.svc.Consents(c.Request.Context(), claim.UserId)
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	res := make([]ConsentResponse, 0, len(consents))
+	for _, cs := range consents {
+		res = append(res, ConsentResponse{
+			ClientID: cs.ClientID,
+			Scopes:   cs.Scopes,
+			Utime:    cs.Utime.UnixMilli(),
+		})
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+func (h *OAuthHandler) RevokeConsent(c *gin.Context) {
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	err := h.svc.RevokeConsent(c.Request.Context(), claim.UserId, c.Param("clientId"))
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "consent revoked successfully",
+		Data: nil,
+	})
+}
+
+func (h *OAuthHandler) authorizeError(c *gin.Context, req service.AuthorizeRequest, err error) {
+	type ErrorResponse struct {
+		RedirectTo string `json:"redirectTo"`
+	}
+
+	switch {
+	case errors.Is(err, service.ErrOAuthClientNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeOAuthClientNotFound,
+			Msg:  "unknown client",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrInvalidRedirectURI):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeOAuthInvalidRedirect,
+			Msg:  "redirect uri is not registered for this client",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrUnsupportedResponseType):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeOAuthInvalidRequest,
+			Msg:  "unsupported response type",
+			Data: ErrorResponse{RedirectTo: service.AuthorizeErrorRedirect(req, "unsupported_response_type")},
+		})
+	case errors.Is(err, service.ErrInvalidScope):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeOAuthInvalidRequest,
+			Msg:  "invalid scope",
+			Data: ErrorResponse{RedirectTo: service.AuthorizeErrorRedirect(req, "invalid_scope")},
+		})
+	case errors.Is(err, service.ErrInvalidPKCE):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeOAuthInvalidRequest,
+			Msg:  "invalid or missing pkce parameters",
+			Data: ErrorResponse{RedirectTo: service.AuthorizeErrorRedirect(req, "invalid_request")},
+		})
+	default:
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+	}
+}
+
+func tokenError(c *gin.Context, status int, code string, err error) {
+	c.JSON(status, gin.H{
+		"error":             code,
+		"error_description": err.Error(),
+	})
+}
@@ -0,0 +1,609 @@
+package oauth_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/repository"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/oauth"
+	"github.com/ktsoator/connectify/internal/web/resp"
+	"github.com/ktsoator/connectify/internal/web/user"
+)
+
+// memOAuthStore keeps clients, consents, codes and signing keys in memory.
+type memOAuthStore struct {
+	mu       sync.Mutex
+	clients  map[string]domain.OAuthClient
+	consents map[string]domain.OAuthConsent
+	codes    map[string]domain.AuthorizationCode
+	used     map[string]bool
+	keys     []domain.SigningKey
+}
+
+func newMemOAuthStore() *memOAuthStore {
+	return &memOAuthStore{
+		clients:  map[string]domain.OAuthClient{},
+		consents: map[string]domain.OAuthConsent{},
+		codes:    map[string]domain.AuthorizationCode{},
+		used:     map[string]bool{},
+	}
+}
+
+func (m *memOAuthStore) CreateClient(_ context.Context, client domain.OAuthClient) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	client.ID = int64(len(m.clients) + 1)
+	client.Ctime = time.Now()
+	m.clients[client.ClientID] = client
+	return client.ID, nil
+}
+
+func (m *memOAuthStore) FindClient(_ context.Context, clientID string) (domain.OAuthClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.clients[clientID]
+	if !ok {
+		return domain.OAuthClient{}, repository.ErrOAuthClientNotFound
+	}
+	return c, nil
+}
+
+func (m *memOAuthStore) FindClientsByOwner(_ context.Context, ownerId int64) ([]domain.OAuthClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []domain.OAuthClient
+	for _, c := range m.clients {
+		if c.OwnerId == ownerId {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+func (m *memOAuthStore) CreateCode(_ context.Context, code domain.AuthorizationCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes[code.CodeHash] = code
+	return nil
+}
+
+func (m *memOAuthStore) RedeemCode(_ context.Context, codeHash string) (domain.AuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code, ok := m.codes[codeHash]
+	if !ok || m.used[codeHash] || !code.ExpiresAt.After(time.Now()) {
+		return domain.AuthorizationCode{}, repository.ErrOAuthCodeNotFound
+	}
+	m.used[codeHash] = true
+	return code, nil
+}
+
+func (m *memOAuthStore) SaveConsent(_ context.Context, consent domain.OAuthConsent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	consent.Utime = time.Now()
+	m.consents[fmt.Sprint(consent.UserId, consent.ClientID)] = consent
+	return nil
+}
+
+func (m *memOAuthStore) FindConsent(_ context.Context, userId int64, clientID string) (domain.OAuthConsent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.consents[fmt.Sprint(userId, clientID)]
+	if !ok {
+		return domain.OAuthConsent{}, repository.ErrOAuthConsentNotFound
+	}
+	return c, nil
+}
+
+func (m *memOAuthStore) FindConsentsByUser(_ context.Context, userId int64) ([]domain.OAuthConsent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []domain.OAuthConsent
+	for _, c := range m.consents {
+		if c.UserId == userId {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+func (m *memOAuthStore) DeleteConsent(_ context.Context, userId int64, clientID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.consents, fmt.Sprint(userId, clientID))
+	return nil
+}
+
+func (m *memOAuthStore) CreateSigningKey(_ context.Context, key domain.SigningKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys = append([]domain.SigningKey{key}, m.keys...)
+	return nil
+}
+
+func (m *memOAuthStore) FindSigningKeysSince(_ context.Context, since time.Time) ([]domain.SigningKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []domain.SigningKey
+	for _, k := range m.keys {
+		if k.Ctime.After(since) {
+			res = append(res, k)
+		}
+	}
+	return res, nil
+}
+
+func (m *memOAuthStore) DeleteSigningKeysBefore(context.Context, time.Time) error {
+	return nil
+}
+
+type memProfiles map[int64]domain.User
+
+func (m memProfiles) Profile(_ context.Context, id int64) (domain.User, error) {
+	u, ok := m[id]
+	if !ok {
+		return domain.User{}, service.ErrUserNotFound
+	}
+	return u, nil
+}
+
+const (
+	testUserId   = 7
+	redirectURI  = "https://client.example.com/callback"
+	codeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk-long-enough"
+)
+
+type testProvider struct {
+	t   *testing.T
+	srv *httptest.Server
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	// The consent endpoints need a logged-in Connectify user; the protocol
+	// endpoints ignore the claim.
+	r.Use(func(c *gin.Context) {
+		c.Set("claim", user.UserClaims{UserId: testUserId})
+	})
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	store := newMemOAuthStore()
+	users := memProfiles{testUserId: {ID: testUserId, Email: "alice@example.com", Nickname: "Alice"}}
+	keys := service.NewSigningKeyManager(store, time.Hour, time.Hour)
+	svc := service.NewOAuthService(store, users, keys, service.OAuthConfig{
+		Issuer:         srv.URL,
+		CodeTTL:        time.Minute,
+		AccessTokenTTL: time.Hour,
+		IDTokenTTL:     time.Hour,
+	})
+	oauth.NewOAuthHandler(svc).RegisterRoutes(r)
+	return &testProvider{t: t, srv: srv}
+}
+
+func (p *testProvider) do(req *http.Request, out any) int {
+	p.t.Helper()
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		p.t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+	}
+	defer res.Body.Close()
+	if out != nil {
+		if err = json.NewDecoder(res.Body).Decode(out); err != nil {
+			p.t.Fatalf("%s %s: decode: %v", req.Method, req.URL, err)
+		}
+	}
+	return res.StatusCode
+}
+
+func (p *testProvider) get(path string, out any) int {
+	p.t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, p.srv.URL+path, nil)
+	return p.do(req, out)
+}
+
+func (p *testProvider) postJSON(path string, body, out any) {
+	p.t.Helper()
+	b, _ := json.Marshal(body)
+	req, _ := http.NewRequest(http.MethodPost, p.srv.URL+path, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	p.do(req, out)
+}
+
+// result decodes a resp.Result whose Data has the given type.
+type result[T any] struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data T      `json:"data"`
+}
+
+type client struct {
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+}
+
+func (p *testProvider) registerClient(public bool) client {
+	p.t.Helper()
+	var res result[client]
+	p.postJSON("/oauth2/clients", map[string]any{
+		"name":         "Example",
+		"redirectUris": []string{redirectURI},
+		"public":       public,
+	}, &res)
+	if res.Code != resp.CodeSuccess {
+		p.t.Fatalf("register client: %+v", res)
+	}
+	return res.Data
+}
+
+type authorizeParams struct {
+	ClientID            string `json:"clientId"`
+	RedirectURI         string `json:"redirectUri"`
+	ResponseType        string `json:"responseType"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	Nonce               string `json:"nonce"`
+	CodeChallenge       string `json:"codeChallenge"`
+	CodeChallengeMethod string `json:"codeChallengeMethod"`
+	Approve             bool   `json:"approve"`
+}
+
+func newAuthorizeParams(clientID string) authorizeParams {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return authorizeParams{
+		ClientID:            clientID,
+		RedirectURI:         redirectURI,
+		ResponseType:        "code",
+		Scope:               "openid email profile",
+		State:               "xyz",
+		Nonce:               "n-0S6_WzA2Mj",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(sum[:]),
+		CodeChallengeMethod: "S256",
+		Approve:             true,
+	}
+}
+
+func (a authorizeParams) query() string {
+	return url.Values{
+		"client_id":             {a.ClientID},
+		"redirect_uri":          {a.RedirectURI},
+		"response_type":         {a.ResponseType},
+		"scope":                 {a.Scope},
+		"state":                 {a.State},
+		"nonce":                 {a.Nonce},
+		"code_challenge":        {a.CodeChallenge},
+		"code_challenge_method": {a.CodeChallengeMethod},
+	}.Encode()
+}
+
+type redirect struct {
+	RedirectTo string `json:"redirectTo"`
+}
+
+// authorize approves the request on the consent screen and returns the
+// redirect the frontend would follow.
+func (p *testProvider) authorize(params authorizeParams) result[redirect] {
+	p.t.Helper()
+	var res result[redirect]
+	p.postJSON("/oauth2/authorize", params, &res)
+	return res
+}
+
+func (p *testProvider) code(params authorizeParams) string {
+	p.t.Helper()
+	res := p.authorize(params)
+	if res.Code != resp.CodeSuccess {
+		p.t.Fatalf("authorize: %+v", res)
+	}
+	u, err := url.Parse(res.Data.RedirectTo)
+	if err != nil {
+		p.t.Fatalf("redirect %q: %v", res.Data.RedirectTo, err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != redirectURI {
+		p.t.Fatalf("redirected to %q, want %q", got, redirectURI)
+	}
+	if got := u.Query().Get("state"); got != params.State {
+		p.t.Fatalf("state = %q, want %q", got, params.State)
+	}
+	return u.Query().Get("code")
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+	Error       string `json:"error"`
+}
+
+func (p *testProvider) token(cl client, form url.Values) (int, tokenResponse) {
+	p.t.Helper()
+	form.Set("grant_type", "authorization_code")
+	if cl.ClientSecret == "" {
+		form.Set("client_id", cl.ClientID)
+	}
+	req, _ := http.NewRequest(http.MethodPost, p.srv.URL+"/oauth2/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cl.ClientSecret != "" {
+		req.SetBasicAuth(cl.ClientID, cl.ClientSecret)
+	}
+	var res tokenResponse
+	status := p.do(req, &res)
+	return status, res
+}
+
+// jwksKeyfunc verifies tokens against the keys published at jwksURI, the way
+// a relying party would.
+func (p *testProvider) jwksKeyfunc(jwksURI string) jwt.Keyfunc {
+	p.t.Helper()
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Alg string `json:"alg"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	req, _ := http.NewRequest(http.MethodGet, jwksURI, nil)
+	if status := p.do(req, &set); status != http.StatusOK || len(set.Keys) == 0 {
+		p.t.Fatalf("jwks: status %d, %d keys", status, len(set.Keys))
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || k.Alg != "RS256" {
+			p.t.Fatalf("unexpected key %+v", k)
+		}
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil {
+			p.t.Fatalf("key %s is not base64url", k.Kid)
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		if k, ok := keys[kid]; ok {
+			return k, nil
+		}
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+}
+
+func TestOIDCAuthorizationCodeFlow(t *testing.T) {
+	p := newTestProvider(t)
+
+	var disco map[string]any
+	if status := p.get("/.well-known/openid-configuration", &disco); status != http.StatusOK {
+		t.Fatalf("discovery: status %d", status)
+	}
+	if disco["issuer"] != p.srv.URL {
+		t.Fatalf("issuer = %v, want %s", disco["issuer"], p.srv.URL)
+	}
+	for key, path := range map[string]string{
+		"authorization_endpoint": "/oauth2/authorize",
+		"token_endpoint":         "/oauth2/token",
+		"userinfo_endpoint":      "/oauth2/userinfo",
+		"jwks_uri":               "/oauth2/jwks",
+	} {
+		if disco[key] != p.srv.URL+path {
+			t.Fatalf("%s = %v", key, disco[key])
+		}
+	}
+
+	cl := p.registerClient(false)
+	params := newAuthorizeParams(cl.ClientID)
+
+	var prompt result[struct {
+		ClientID  string   `json:"clientId"`
+		Scopes    []string `json:"scopes"`
+		Consented bool     `json:"consented"`
+	}]
+	p.get("/oauth2/authorize?"+params.query(), &prompt)
+	if prompt.Code != resp.CodeSuccess || prompt.Data.Consented ||
+		!slices.Equal(prompt.Data.Scopes, []string{"email", "openid", "profile"}) {
+		t.Fatalf("first prompt: %+v", prompt)
+	}
+
+	code := p.code(params)
+
+	p.get("/oauth2/authorize?"+params.query(), &prompt)
+	if !prompt.Data.Consented {
+		t.Fatalf("second prompt should remember the consent: %+v", prompt)
+	}
+
+	status, tokens := p.token(cl, url.Values{
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {codeVerifier},
+	})
+	if status != http.StatusOK || tokens.TokenType != "Bearer" || tokens.AccessToken == "" || tokens.IDToken == "" {
+		t.Fatalf("token: status %d, %+v", status, tokens)
+	}
+
+	var claims service.IDTokenClaims
+	_, err := jwt.ParseWithClaims(tokens.IDToken, &claims, p.jwksKeyfunc(disco["jwks_uri"].(string)),
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(p.srv.URL),
+		jwt.WithAudience(cl.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		t.Fatalf("id_token does not verify against the JWKS: %v", err)
+	}
+	if claims.Subject != fmt.Sprint(testUserId) || claims.Nonce != params.Nonce ||
+		claims.Email != "alice@example.com" || claims.Name != "Alice" || claims.AuthTime == 0 {
+		t.Fatalf("id_token claims: %+v", claims)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, disco["userinfo_endpoint"].(string), nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	var info map[string]any
+	if status = p.do(req, &info); status != http.StatusOK {
+		t.Fatalf("userinfo: status %d", status)
+	}
+	if info["sub"] != fmt.Sprint(testUserId) || info["email"] != "alice@example.com" || info["name"] != "Alice" {
+		t.Fatalf("userinfo: %+v", info)
+	}
+
+	// The ID token is not an access token.
+	req, _ = http.NewRequest(http.MethodGet, disco["userinfo_endpoint"].(string), nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.IDToken)
+	if status = p.do(req, nil); status != http.StatusUnauthorized {
+		t.Fatalf("userinfo with id_token: status %d", status)
+	}
+
+	// A code can be redeemed only once.
+	status, tokens = p.token(cl, url.Values{
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {codeVerifier},
+	})
+	if status != http.StatusBadRequest || tokens.Error != "invalid_grant" {
+		t.Fatalf("second redemption: status %d, %+v", status, tokens)
+	}
+}
+
+func TestOIDCTokenErrors(t *testing.T) {
+	p := newTestProvider(t)
+	cl := p.registerClient(false)
+	params := newAuthorizeParams(cl.ClientID)
+
+	tests := []struct {
+		name       string
+		client     client
+		form       url.Values
+		wantStatus int
+		wantError  string
+	}{
+		{
+			name:       "redirect_uri mismatch",
+			client:     cl,
+			form:       url.Values{"redirect_uri": {"https://client.example.com/other"}, "code_verifier": {codeVerifier}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+		},
+		{
+			name:       "wrong code_verifier",
+			client:     cl,
+			form:       url.Values{"redirect_uri": {redirectURI}, "code_verifier": {strings.Repeat("a", 43)}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+		},
+		{
+			name:       "missing code_verifier",
+			client:     cl,
+			form:       url.Values{"redirect_uri": {redirectURI}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_grant",
+		},
+		{
+			name:       "wrong client secret",
+			client:     client{ClientID: cl.ClientID, ClientSecret: "wrong"},
+			form:       url.Values{"redirect_uri": {redirectURI}, "code_verifier": {codeVerifier}},
+			wantStatus: http.StatusUnauthorized,
+			wantError:  "invalid_client",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			code := p.code(params)
+			tc.form.Set("code", code)
+			status, res := p.token(tc.client, tc.form)
+			if status != tc.wantStatus || res.Error != tc.wantError {
+				t.Fatalf("status %d, %+v; want %d %s", status, res, tc.wantStatus, tc.wantError)
+			}
+			if tc.wantError != "invalid_grant" {
+				return
+			}
+			// The failed attempt spent the code, so it cannot be retried with
+			// the right parameters.
+			status, res = p.token(cl, url.Values{
+				"code":          {code},
+				"redirect_uri":  {redirectURI},
+				"code_verifier": {codeVerifier},
+			})
+			if status != http.StatusBadRequest || res.Error != "invalid_grant" {
+				t.Fatalf("retry: status %d, %+v", status, res)
+			}
+		})
+	}
+
+	status, res := p.token(cl, url.Values{"code": {"made-up"}, "redirect_uri": {redirectURI}})
+	if status != http.StatusBadRequest || res.Error != "invalid_grant" {
+		t.Fatalf("unknown code: status %d, %+v", status, res)
+	}
+}
+
+func TestOIDCAuthorizeErrors(t *testing.T) {
+	p := newTestProvider(t)
+	confidential := p.registerClient(false)
+	public := p.registerClient(true)
+
+	// An unregistered redirect URI is never redirected to.
+	params := newAuthorizeParams(confidential.ClientID)
+	params.RedirectURI = "https://attacker.example.com/callback"
+	res := p.authorize(params)
+	if res.Code != resp.CodeOAuthInvalidRedirect || res.Data.RedirectTo != "" {
+		t.Fatalf("unregistered redirect: %+v", res)
+	}
+
+	params = newAuthorizeParams("unknown")
+	if res = p.authorize(params); res.Code != resp.CodeOAuthClientNotFound {
+		t.Fatalf("unknown client: %+v", res)
+	}
+
+	// Public clients must use PKCE; the error goes back to the client.
+	params = newAuthorizeParams(public.ClientID)
+	params.CodeChallenge, params.CodeChallengeMethod = "", ""
+	res = p.authorize(params)
+	if res.Code != resp.CodeOAuthInvalidRequest || !strings.Contains(res.Data.RedirectTo, "error=invalid_request") {
+		t.Fatalf("public client without pkce: %+v", res)
+	}
+
+	params = newAuthorizeParams(public.ClientID)
+	params.CodeChallengeMethod = "plain"
+	if res = p.authorize(params); res.Code != resp.CodeOAuthInvalidRequest {
+		t.Fatalf("plain pkce: %+v", res)
+	}
+
+	params = newAuthorizeParams(confidential.ClientID)
+	params.Scope = "email"
+	res = p.authorize(params)
+	if res.Code != resp.CodeOAuthInvalidRequest || !strings.Contains(res.Data.RedirectTo, "error=invalid_scope") {
+		t.Fatalf("missing openid scope: %+v", res)
+	}
+
+	// A public client authenticates with PKCE alone.
+	params = newAuthorizeParams(public.ClientID)
+	status, tokens := p.token(public, url.Values{
+		"code":          {p.code(params)},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {codeVerifier},
+	})
+	if status != http.StatusOK || tokens.IDToken == "" {
+		t.Fatalf("public client token: status %d, %+v", status, tokens)
+	}
+}
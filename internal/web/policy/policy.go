@@ -0,0 +1,197 @@
+package policy
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+	"github.com/ktsoator/connectify/internal/web/user"
+)
+
+type PolicyHandler struct {
+	svc *service.PolicyService
+}
+
+func NewPolicyHandler(svc *service.PolicyService) *PolicyHandler {
+	return &PolicyHandler{
+		svc: svc,
+	}
+}
+
+func (h *PolicyHandler) RegisterRoutes(r *gin.Engine) {
+	pg := r.Group("/policies")
+	pg.GET("", h.Latest)
+	pg.GET("/:id", h.Detail)
+
+	ug := r.Group("/user")
+	ug.GET("/consents", h.History)
+	ug.POST("/consents", h.Accept)
+}
+
+type PolicyResponse struct {
+	ID          int64  `json:"id"`
+	Kind        string `json:"kind"`
+	Version     string `json:"version"`
+	Title       string `json:"title"`
+	Content     string `json:"content,omitempty"`
+	PublishedAt int64  `json:"publishedAt"`
+}
+
+// Latest returns the policy versions currently in force, e.g. for the signup form.
+func (h *PolicyHandler) Latest(c *gin.Context) {
+	policies, err := h.svc.Latest(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	res := make([]PolicyResponse, 0, len(policies))
+	for _, p := range policies {
+		res = append(res, PolicyResponse{
+			ID:          p.ID,
+			Kind:        p.Kind,
+			Version:     p.Version,
+			Title:       p.Title,
+			PublishedAt: p.PublishedAt.UnixMilli(),
+		})
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+func (h *PolicyHandler) Detail(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	p, err := h.svc.Get(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, service.ErrPolicyNotFound) {
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidParam,
+				Msg:  "policy not found",
+				Data: nil,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: PolicyResponse{
+			ID:          p.ID,
+			Kind:        p.Kind,
+			Version:     p.Version,
+			Title:       p.Title,
+			Content:     p.Content,
+			PublishedAt: p.PublishedAt.UnixMilli(),
+		},
+	})
+}
+
+func (h *PolicyHandler) History(c *gin.Context) {
+	type ConsentResponse struct {
+		PolicyId   int64  `json:"policyId"`
+		Kind       string `json:"kind"`
+		Version    string `json:"version"`
+		AcceptedAt int64  `json:"acceptedAt"`
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	consents, err := h.svc.History(c.Request.Context(), claim.UserId)
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	res := make([]ConsentResponse, 0, len(consents))
+	for _, cs := range consents {
+		res = append(res, ConsentResponse{
+			PolicyId:   cs.PolicyId,
+			Kind:       cs.Kind,
+			Version:    cs.Version,
+			AcceptedAt: cs.AcceptedAt.UnixMilli(),
+		})
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+func (h *PolicyHandler) Accept(c *gin.Context) {
+	type AcceptRequest struct {
+		PolicyIds []int64 `json:"policyIds"`
+	}
+
+	var req AcceptRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.PolicyIds) == 0 {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	err := h.svc.Accept(c.Request.Context(), claim.UserId, req.PolicyIds, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		if errors.Is(err, service.ErrPolicyNotCurrent) {
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidParam,
+				Msg:  "policy version is no longer current",
+				Data: nil,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "policies accepted successfully",
+		Data: nil,
+	})
+}
@@ -0,0 +1,301 @@
+package realtime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+	"github.com/ktsoator/connectify/internal/web/user"
+)
+
+// maxClientMessage bounds what clients may send over a WebSocket. They have
+// nothing to say besides keeping the connection alive.
+const maxClientMessage = 512
+
+type Config struct {
+	// PingInterval is how often a heartbeat is sent.
+	PingInterval time.Duration
+	// IdleTimeout closes a WebSocket once nothing, not even a reply to a
+	// heartbeat, was received for this long. It must exceed PingInterval.
+	IdleTimeout time.Duration
+	// WriteTimeout closes a connection whose client stops reading.
+	WriteTimeout time.Duration
+	// AllowedOrigins are the web apps that may open WebSockets.
+	AllowedOrigins []string
+}
+
+type RealtimeHandler struct {
+	svc       *service.PushService
+	tickets   *service.ConnectTicketService
+	userSvc   *service.UserService
+	policySvc *service.PolicyService
+	cfg       Config
+	upgrader  websocket.Upgrader
+}
+
+func NewRealtimeHandler(svc *service.PushService, tickets *service.ConnectTicketService,
+	userSvc *service.UserService, policySvc *service.PolicyService, cfg Config) *RealtimeHandler {
+	return &RealtimeHandler{
+		svc:       svc,
+		tickets:   tickets,
+		userSvc:   userSvc,
+		policySvc: policySvc,
+		cfg:       cfg,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				// Clients other than browsers send no origin.
+				origin := r.Header.Get("Origin")
+				return origin == "" || slices.Contains(cfg.AllowedOrigins, origin)
+			},
+		},
+	}
+}
+
+func (h *RealtimeHandler) RegisterRoutes(r *gin.Engine) {
+	rg := r.Group("/realtime")
+	rg.POST("/ticket", h.Ticket)
+	rg.GET("/ws", h.WebSocket)
+	rg.GET("/sse", h.SSE)
+}
+
+// Frame is what clients receive for every message, e.g.
+// {"type":"notification","data":{"id":42}}.
+type Frame struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Ticket issues a one-time ticket for opening a connection. Browsers pass it
+// in the ticket query parameter, since they cannot set the Authorization
+// header on WebSockets and EventSource.
+func (h *RealtimeHandler) Ticket(c *gin.Context) {
+	type TicketResponse struct {
+		Ticket string `json:"ticket"`
+		// ExpiresIn is how many seconds the ticket can be used.
+		ExpiresIn int64 `json:"expiresIn"`
+	}
+
+	claim := user.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	ticket, err := h.tickets.Issue(c.Request.Context(), service.ConnectTicket{
+		UserID:    claim.UserId,
+		Guest:     claim.Guest,
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: TicketResponse{
+			Ticket:    ticket,
+			ExpiresIn: int64(h.tickets.TTL().Seconds()),
+		},
+	})
+}
+
+// connectingUser identifies the caller by their token or, failing that, by
+// a ticket. If neither works it writes an error response and aborts.
+//
+// Tokens went through the middlewares that reject deactivated users and
+// users with pending policies. Tickets skip them, so the same checks are
+// repeated for the user a ticket was issued to.
+func (h *RealtimeHandler) connectingUser(c *gin.Context) int64 {
+	if claim, ok := user.GetUserClaims(c); ok {
+		return claim.UserId
+	}
+	ctx := c.Request.Context()
+	t, err := h.tickets.Redeem(ctx, c.Query("ticket"), c.Request.UserAgent())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTicket) {
+			c.AbortWithStatusJSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidCreds,
+				Msg:  "unauthorized",
+				Data: nil,
+			})
+			return 0
+		}
+		c.AbortWithStatusJSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return 0
+	}
+
+	err = h.userSvc.CheckActive(ctx, t.UserID)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) || errors.Is(err, service.ErrUserDeactivated) {
+			c.AbortWithStatusJSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidCreds,
+				Msg:  "unauthorized",
+				Data: nil,
+			})
+			return 0
+		}
+		c.AbortWithStatusJSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return 0
+	}
+	pending, err := h.policySvc.Pending(ctx, t.UserID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return 0
+	}
+	if len(pending) > 0 {
+		// The pending policies are listed by any other route.
+		c.AbortWithStatusJSON(http.StatusOK, resp.Result{
+			Code: resp.CodePolicyConsentRequired,
+			Msg:  "please accept the updated policies",
+			Data: nil,
+		})
+		return 0
+	}
+	return t.UserID
+}
+
+// WebSocket streams the caller's messages over a WebSocket, one JSON frame
+// per message.
+func (h *RealtimeHandler) WebSocket(c *gin.Context) {
+	userId := h.connectingUser(c)
+	if c.IsAborted() {
+		return
+	}
+
+	ws, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already replied.
+		return
+	}
+	defer ws.Close()
+
+	conn := h.svc.Connect(userId)
+	defer h.svc.Disconnect(conn)
+
+	// Reading is needed to process heartbeat replies and to notice that the
+	// client went away.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		ws.SetReadLimit(maxClientMessage)
+		alive := func(string) error {
+			return ws.SetReadDeadline(time.Now().Add(h.cfg.IdleTimeout))
+		}
+		_ = alive("")
+		ws.SetPongHandler(alive)
+		for {
+			if _, _, err := ws.NextReader(); err != nil {
+				return
+			}
+			_ = alive("")
+		}
+	}()
+
+	ping := time.NewTicker(h.cfg.PingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case msg := <-conn.Messages():
+			_ = ws.SetWriteDeadline(time.Now().Add(h.cfg.WriteTimeout))
+			if err := ws.WriteJSON(Frame{Type: msg.Type, Data: msg.Data}); err != nil {
+				return
+			}
+		case <-ping.C:
+			err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(h.cfg.WriteTimeout))
+			if err != nil {
+				return
+			}
+		case <-conn.Done():
+			// Tell the client to reconnect, e.g. after it fell behind.
+			_ = ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "reconnect"),
+				time.Now().Add(h.cfg.WriteTimeout))
+			return
+		case <-gone:
+			return
+		}
+	}
+}
+
+// SSE streams the caller's messages as Server-Sent Events, named after the
+// message type.
+func (h *RealtimeHandler) SSE(c *gin.Context) {
+	userId := h.connectingUser(c)
+	if c.IsAborted() {
+		return
+	}
+
+	w := c.Writer
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Proxies must not buffer the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	conn := h.svc.Connect(userId)
+	defer h.svc.Disconnect(conn)
+
+	// A client that stops reading makes writes block until the deadline.
+	// The server may not support deadlines, in which case the heartbeat
+	// still notices clients that went away.
+	write := func(s string) bool {
+		if err := rc.SetWriteDeadline(time.Now().Add(h.cfg.WriteTimeout)); err != nil &&
+			!errors.Is(err, http.ErrNotSupported) {
+			return false
+		}
+		if _, err := w.WriteString(s); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	// Browsers reconnect on their own after the given number of milliseconds.
+	if !write(fmt.Sprintf("retry: %d\n\n", (5 * time.Second).Milliseconds())) {
+		return
+	}
+
+	ping := time.NewTicker(h.cfg.PingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case msg := <-conn.Messages():
+			if !write(fmt.Sprintf("event: %s\ndata: %s\n\n", msg.Type, msg.Data)) {
+				return
+			}
+		case <-ping.C:
+			// Comments are ignored by clients but keep proxies from closing
+			// the idle connection.
+			if !write(": ping\n\n") {
+				return
+			}
+		case <-conn.Done():
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
@@ -19,6 +19,127 @@ const (
 	// CodeUserNotFound indicates that the requested user does not exist.
 	CodeUserNotFound = 40103
 
+	// CodePolicyConsentRequired indicates that the user must accept the current
+	// terms of service or privacy policy first. The pending policies are returned in Data.
+	CodePolicyConsentRequired = 40104
+
+	// CodeGuestNotAllowed indicates that a guest account tried to use a feature
+	// that requires signing up.
+	CodeGuestNotAllowed = 40105
+
+	// CodePhoneCodeTooSoon indicates that a verification code was already
+	// texted to the number a moment ago.
+	CodePhoneCodeTooSoon = 40106
+
+	// CodeInvalidPhoneCode indicates that the phone verification code is
+	// wrong, expired or already used.
+	CodeInvalidPhoneCode = 40107
+
+	// CodeSignupRejected indicates that signup screening flagged the attempt as
+	// abusive. The rejection reason is returned in Data.
+	CodeSignupRejected = 40108
+
+	// CodeHandleUnavailable indicates that the requested handle is taken or
+	// still reserved for its previous owner.
+	CodeHandleUnavailable = 40109
+
+	// CodeHandleCooldown indicates that the handle was changed too recently.
+	// When the next change is allowed is returned in Data.
+	CodeHandleCooldown = 40110
+
+	// CodeProfileRestricted indicates that the owner's privacy settings hide
+	// the profile from the viewer. Only the handle is returned in Data.
+	CodeProfileRestricted = 40111
+
+	// CodeFriendRequestNotFound indicates that the friend request does not
+	// exist or was not sent by or to the caller.
+	CodeFriendRequestNotFound = 40112
+
+	// CodeFriendRequestClosed indicates that the friend request was already
+	// accepted, declined or cancelled.
+	CodeFriendRequestClosed = 40113
+
+	// CodeAlreadyFriends indicates that a friend request was sent to a friend.
+	CodeAlreadyFriends = 40114
+
+	// CodeUserBlocked indicates that the caller and the other user blocked
+	// each other, or one of them blocked the other.
+	CodeUserBlocked = 40115
+
+	// CodeOAuthClientNotFound indicates that the OAuth client_id is unknown.
+	CodeOAuthClientNotFound = 40201
+
+	// CodeOAuthInvalidRedirect indicates that the redirect_uri is not registered for the client.
+	// The error must be shown to the user instead of redirecting.
+	CodeOAuthInvalidRedirect = 40202
+
+	// CodeOAuthInvalidRequest indicates that an authorization request is malformed
+	// (unsupported response type, unknown scope, missing PKCE). The redirect back
+	// to the client carrying the error is returned in Data.
+	CodeOAuthInvalidRequest = 40203
+
+	// CodeArticleNotFound indicates that the article does not exist, is not
+	// published, or belongs to another author.
+	CodeArticleNotFound = 40301
+
+	// CodeRevisionNotFound indicates that the article has no such revision,
+	// e.g. because the retention limit already removed it.
+	CodeRevisionNotFound = 40302
+
+	// CodeCommentNotFound indicates that the comment does not exist, is hidden
+	// from the caller, or cannot be changed by them.
+	CodeCommentNotFound = 40303
+
+	// CodeCommentEditExpired indicates that the edit window of the comment has
+	// passed.
+	CodeCommentEditExpired = 40304
+
+	// CodeConversationNotFound indicates that the conversation does not exist
+	// or the caller does not take part in it.
+	CodeConversationNotFound = 40401
+
+	// CodeMessageNotAllowed indicates that the recipient's privacy settings do
+	// not let the caller message them.
+	CodeMessageNotAllowed = 40402
+
+	// CodeGroupNotFound indicates that the group does not exist.
+	CodeGroupNotFound = 40501
+
+	// CodeGroupPermissionDenied indicates that the caller's role in the group
+	// does not allow the action.
+	CodeGroupPermissionDenied = 40502
+
+	// CodeGroupMemberNotFound indicates that the user is not a member of the
+	// group.
+	CodeGroupMemberNotFound = 40503
+
+	// CodeAlreadyGroupMember indicates that the user is already a member of
+	// the group.
+	CodeAlreadyGroupMember = 40504
+
+	// CodeGroupPendingNotFound indicates that there is no such join request
+	// or invite.
+	CodeGroupPendingNotFound = 40505
+
+	// CodeGroupInviteOnly indicates that the group can only be joined by
+	// invite.
+	CodeGroupInviteOnly = 40506
+
+	// CodeGroupBanned indicates that the user is banned from the group.
+	CodeGroupBanned = 40507
+
+	// CodeGroupBanNotFound indicates that the user is not banned from the
+	// group.
+	CodeGroupBanNotFound = 40508
+
+	// CodeGroupOwnerCannotLeave indicates that the owner tried to leave the
+	// group without transferring it first.
+	CodeGroupOwnerCannotLeave = 40509
+
+	// CodeGroupPostNotFound indicates that the post does not exist in the
+	// group.
+	CodeGroupPostNotFound = 40510
+
 	// CodeServerBusy indicates an internal server error or unexpected failure.
 	// This maps to a 500 Internal Server Error, telling the client to retry later.
 	CodeServerBusy = 50001
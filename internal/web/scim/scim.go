@@ -0,0 +1,344 @@
+package scim
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/user"
+)
+
+const (
+	schemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	schemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	schemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	schemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	contentType = "application/scim+json"
+
+	defaultPageSize = 100
+	maxPageSize     = 100
+)
+
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created"`
+	LastModified string `json:"lastModified"`
+	Location     string `json:"location"`
+}
+
+// User is the SCIM representation of a Connectify user.
+type User struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	ExternalId  string   `json:"externalId,omitempty"`
+	UserName    string   `json:"userName"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Name        *Name    `json:"name,omitempty"`
+	Emails      []Email  `json:"emails,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+	// Password is write-only and never returned.
+	Password string `json:"password,omitempty"`
+	Meta     *Meta  `json:"meta,omitempty"`
+}
+
+// ScimHandler serves the SCIM 2.0 Users endpoint for enterprise directories.
+// Responses follow RFC 7644 rather than resp.Result because directories are
+// generic SCIM clients.
+type ScimHandler struct {
+	svc *service.ScimService
+}
+
+func NewScimHandler(svc *service.ScimService) *ScimHandler {
+	return &ScimHandler{
+		svc: svc,
+	}
+}
+
+func (h *ScimHandler) RegisterRoutes(r *gin.Engine) {
+	rg := r.Group("/scim/v2", h.Authenticate)
+
+	rg.POST("/Users", h.CreateUser)
+	rg.GET("/Users", h.ListUsers)
+	rg.GET("/Users/:id", h.GetUser)
+	rg.PATCH("/Users/:id", h.PatchUser)
+	rg.DELETE("/Users/:id", h.DeactivateUser)
+}
+
+// Authenticate resolves the tenant from the bearer token and stores it in the
+// context for the handlers below.
+func (h *ScimHandler) Authenticate(c *gin.Context) {
+	segs := strings.Split(c.GetHeader("Authorization"), " ")
+	if len(segs) != 2 || segs[0] != "Bearer" {
+		scimError(c, http.StatusUnauthorized, "", "missing bearer token")
+		c.Abort()
+		return
+	}
+
+	tenant, err := h.svc.Authenticate(c.Request.Context(), segs[1])
+	if err != nil {
+		if errors.Is(err, service.ErrScimUnauthorized) {
+			scimError(c, http.StatusUnauthorized, "", "invalid bearer token")
+			c.Abort()
+			return
+		}
+		scimError(c, http.StatusInternalServerError, "", "system error")
+		c.Abort()
+		return
+	}
+
+	c.Set("scimTenant", tenant)
+	c.Next()
+}
+
+func (h *ScimHandler) CreateUser(c *gin.Context) {
+	tenant := c.MustGet("scimTenant").(domain.ScimTenant)
+
+	var req User
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	if ok, _ := user.ValidateEmail(req.UserName); !ok {
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName must be an email address")
+		return
+	}
+
+	u, err := h.svc.CreateUser(c.Request.Context(), tenant.ID, domain.User{
+		Email:       req.UserName,
+		Password:    req.Password,
+		Nickname:    displayName(req),
+		ExternalId:  req.ExternalId,
+		Deactivated: req.Active != nil && !*req.Active,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrDuplicateEmail) {
+			scimError(c, http.StatusConflict, "uniqueness", "userName already exists")
+			return
+		}
+		scimError(c, http.StatusInternalServerError, "", "system error")
+		return
+	}
+
+	c.Header("Location", resourceLocation(c, u.ID))
+	scimJSON(c, http.StatusCreated, toScimUser(c, u))
+}
+
+func (h *ScimHandler) GetUser(c *gin.Context) {
+	tenant := c.MustGet("scimTenant").(domain.ScimTenant)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		scimError(c, http.StatusNotFound, "", "user not found")
+		return
+	}
+
+	u, err := h.svc.GetUser(c.Request.Context(), tenant.ID, id)
+	if err != nil {
+		h.userError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, toScimUser(c, u))
+}
+
+func (h *ScimHandler) ListUsers(c *gin.Context) {
+	type ListResponse struct {
+		Schemas      []string `json:"schemas"`
+		TotalResults int64    `json:"totalResults"`
+		StartIndex   int      `json:"startIndex"`
+		ItemsPerPage int      `json:"itemsPerPage"`
+		Resources    []User   `json:"Resources"`
+	}
+
+	tenant := c.MustGet("scimTenant").(domain.ScimTenant)
+
+	// Out-of-range values are clamped instead of rejected, as RFC 7644 §3.4.2.4 asks.
+	startIndex, err := strconv.Atoi(c.DefaultQuery("startIndex", "1"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(defaultPageSize)))
+	if err != nil || count < 0 {
+		count = defaultPageSize
+	}
+	count = min(count, maxPageSize)
+
+	users, total, err := h.svc.ListUsers(c.Request.Context(), tenant.ID, c.Query("filter"), startIndex, count)
+	if err != nil {
+		if errors.Is(err, service.ErrScimInvalidFilter) {
+			scimError(c, http.StatusBadRequest, "invalidFilter", "unsupported filter expression")
+			return
+		}
+		scimError(c, http.StatusInternalServerError, "", "system error")
+		return
+	}
+
+	resources := make([]User, 0, len(users))
+	for _, u := range users {
+		resources = append(resources, toScimUser(c, u))
+	}
+	scimJSON(c, http.StatusOK, ListResponse{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func (h *ScimHandler) PatchUser(c *gin.Context) {
+	type Operation struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}
+	type PatchRequest struct {
+		Schemas    []string    `json:"schemas"`
+		Operations []Operation `json:"Operations"`
+	}
+
+	tenant := c.MustGet("scimTenant").(domain.ScimTenant)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		scimError(c, http.StatusNotFound, "", "user not found")
+		return
+	}
+
+	var req PatchRequest
+	if err = c.ShouldBindJSON(&req); err != nil || len(req.Operations) == 0 {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "invalid patch request")
+		return
+	}
+	if len(req.Schemas) > 0 && req.Schemas[0] != schemaPatchOp {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "unexpected schema")
+		return
+	}
+
+	ops := make([]service.ScimPatchOp, 0, len(req.Operations))
+	for _, op := range req.Operations {
+		ops = append(ops, service.ScimPatchOp{Op: op.Op, Path: op.Path, Value: op.Value})
+	}
+
+	u, err := h.svc.PatchUser(c.Request.Context(), tenant.ID, id, ops)
+	if err != nil {
+		h.userError(c, err)
+		return
+	}
+	scimJSON(c, http.StatusOK, toScimUser(c, u))
+}
+
+func (h *ScimHandler) DeactivateUser(c *gin.Context) {
+	tenant := c.MustGet("scimTenant").(domain.ScimTenant)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		scimError(c, http.StatusNotFound, "", "user not found")
+		return
+	}
+
+	if err = h.svc.DeactivateUser(c.Request.Context(), tenant.ID, id); err != nil {
+		h.userError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *ScimHandler) userError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		scimError(c, http.StatusNotFound, "", "user not found")
+	case errors.Is(err, service.ErrDuplicateEmail):
+		scimError(c, http.StatusConflict, "uniqueness", "userName already exists")
+	case errors.Is(err, service.ErrScimInvalidPath):
+		scimError(c, http.StatusBadRequest, "invalidPath", "unsupported attribute path")
+	case errors.Is(err, service.ErrScimInvalidValue):
+		scimError(c, http.StatusBadRequest, "invalidValue", "invalid attribute value")
+	default:
+		scimError(c, http.StatusInternalServerError, "", "system error")
+	}
+}
+
+func toScimUser(c *gin.Context, u domain.User) User {
+	active := !u.Deactivated
+	res := User{
+		Schemas:     []string{schemaUser},
+		ID:          strconv.FormatInt(u.ID, 10),
+		ExternalId:  u.ExternalId,
+		UserName:    u.Email,
+		DisplayName: u.Nickname,
+		Emails:      []Email{{Value: u.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &Meta{
+			ResourceType: "User",
+			Created:      u.Ctime.UTC().Format(time.RFC3339),
+			LastModified: u.Utime.UTC().Format(time.RFC3339),
+			Location:     resourceLocation(c, u.ID),
+		},
+	}
+	if u.Nickname != "" {
+		res.Name = &Name{Formatted: u.Nickname}
+	}
+	return res
+}
+
+// displayName picks the best available name from a SCIM user payload.
+func displayName(u User) string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	if u.Name == nil {
+		return ""
+	}
+	if u.Name.Formatted != "" {
+		return u.Name.Formatted
+	}
+	return strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName)
+}
+
+func resourceLocation(c *gin.Context, id int64) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + "/scim/v2/Users/" + strconv.FormatInt(id, 10)
+}
+
+func scimJSON(c *gin.Context, status int, body any) {
+	// gin keeps a Content-Type that is already set, so this must come first.
+	c.Header("Content-Type", contentType)
+	c.JSON(status, body)
+}
+
+func scimError(c *gin.Context, status int, scimType, detail string) {
+	type ErrorResponse struct {
+		Schemas  []string `json:"schemas"`
+		Status   string   `json:"status"`
+		ScimType string   `json:"scimType,omitempty"`
+		Detail   string   `json:"detail"`
+	}
+
+	scimJSON(c, status, ErrorResponse{
+		Schemas:  []string{schemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
@@ -0,0 +1,133 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+)
+
+// multipartOverhead is allowed on top of the file itself for the multipart
+// boundaries and headers.
+const multipartOverhead = 64 << 10
+
+type AvatarHandler struct {
+	svc      *service.AvatarService
+	maxBytes int64
+}
+
+// NewAvatarHandler creates the handler. maxBytes is the largest accepted
+// image file; larger request bodies are cut off before they are read.
+func NewAvatarHandler(svc *service.AvatarService, maxBytes int64) *AvatarHandler {
+	return &AvatarHandler{
+		svc:      svc,
+		maxBytes: maxBytes,
+	}
+}
+
+func (h *AvatarHandler) RegisterRoutes(r *gin.Engine) {
+	r.POST("/user/avatar", h.Upload)
+}
+
+// Upload takes a multipart form with the image in the "avatar" field.
+func (h *AvatarHandler) Upload(c *gin.Context) {
+	type AvatarResponse struct {
+		AvatarURL string `json:"avatarUrl"`
+		// Thumbnails maps the edge length in pixels to the URL.
+		Thumbnails map[string]string `json:"thumbnails"`
+	}
+
+	claim := MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxBytes+multipartOverhead)
+	fh, err := c.FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.tooLarge(c)
+			return
+		}
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "avatar file is required",
+			Data: nil,
+		})
+		return
+	}
+	if fh.Size > h.maxBytes {
+		h.tooLarge(c)
+		return
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+	defer f.Close()
+
+	urls, err := h.svc.Upload(c.Request.Context(), claim.UserId, f)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrAvatarTooLarge):
+			h.tooLarge(c)
+		case errors.Is(err, service.ErrAvatarDimensions):
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidParam,
+				Msg:  "avatar image dimensions are too large",
+				Data: nil,
+			})
+		case errors.Is(err, service.ErrUnsupportedImage):
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidParam,
+				Msg:  "avatar must be a JPEG, PNG, GIF or WebP image",
+				Data: nil,
+			})
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeUserNotFound,
+				Msg:  "user not found",
+				Data: nil,
+			})
+		default:
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeServerBusy,
+				Msg:  "system error",
+				Data: nil,
+			})
+		}
+		return
+	}
+
+	res := AvatarResponse{Thumbnails: make(map[string]string, len(urls))}
+	largest := 0
+	for size, url := range urls {
+		res.Thumbnails[strconv.Itoa(size)] = url
+		if size > largest {
+			largest, res.AvatarURL = size, url
+		}
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "avatar updated successfully",
+		Data: res,
+	})
+}
+
+func (h *AvatarHandler) tooLarge(c *gin.Context) {
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeInvalidParam,
+		Msg:  "avatar must be at most " + strconv.FormatInt(h.maxBytes>>20, 10) + " MB",
+		Data: nil,
+	})
+}
@@ -0,0 +1,167 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+)
+
+type BlockHandler struct {
+	svc     *service.BlockService
+	userSvc *service.UserService
+}
+
+func NewBlockHandler(svc *service.BlockService, userSvc *service.UserService) *BlockHandler {
+	return &BlockHandler{
+		svc:     svc,
+		userSvc: userSvc,
+	}
+}
+
+func (h *BlockHandler) RegisterRoutes(r *gin.Engine) {
+	rg := r.Group("/user")
+	rg.GET("/blocks", h.Blocked)
+	rg.POST("/blocks", h.Block)
+	rg.POST("/blocks/remove", h.Unblock)
+
+	rg.GET("/mutes", h.Muted)
+	rg.POST("/mutes", h.Mute)
+	rg.POST("/mutes/remove", h.Unmute)
+}
+
+// BlockedUserResponse is a user in a block or mute list.
+type BlockedUserResponse struct {
+	ID        int64  `json:"id"`
+	Handle    string `json:"handle"`
+	Nickname  string `json:"nickname"`
+	AvatarURL string `json:"avatarUrl"`
+	// Since is when the user was blocked or muted, in Unix milliseconds.
+	Since int64 `json:"since"`
+}
+
+// BlockListResponse is one page of blocked or muted users. NextCursor is
+// passed back as cursor to load the next page and is 0 on the last page.
+type BlockListResponse struct {
+	Users      []BlockedUserResponse `json:"users"`
+	NextCursor int64                 `json:"nextCursor"`
+}
+
+// Block blocks the user with the given handle. Both users stop following
+// each other and are no longer friends.
+func (h *BlockHandler) Block(c *gin.Context) {
+	h.change(c, h.svc.Block, "user blocked")
+}
+
+func (h *BlockHandler) Unblock(c *gin.Context) {
+	h.change(c, h.svc.Unblock, "user unblocked")
+}
+
+// Mute hides the articles and comments of the user with the given handle
+// from the caller. The muted user is not told.
+func (h *BlockHandler) Mute(c *gin.Context) {
+	h.change(c, h.svc.Mute, "user muted")
+}
+
+func (h *BlockHandler) Unmute(c *gin.Context) {
+	h.change(c, h.svc.Unmute, "user unmuted")
+}
+
+func (h *BlockHandler) change(c *gin.Context, fn func(ctx context.Context, userId, targetId int64) error, msg string) {
+	var req handleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	u, err := UserByHandle(c.Request.Context(), h.userSvc, req.Handle)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	if err = fn(c.Request.Context(), claim.UserId, u.ID); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  msg,
+		Data: nil,
+	})
+}
+
+// Blocked lists the users the caller blocked, most recent first.
+func (h *BlockHandler) Blocked(c *gin.Context) {
+	h.list(c, h.svc.Blocked)
+}
+
+// Muted lists the users the caller muted, most recent first.
+func (h *BlockHandler) Muted(c *gin.Context) {
+	h.list(c, h.svc.Muted)
+}
+
+func (h *BlockHandler) list(c *gin.Context,
+	fn func(ctx context.Context, userId, cursor int64, limit int) ([]domain.Block, int64, error)) {
+	claim := MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	cursor, limit := listPage(c)
+	bs, next, err := fn(c.Request.Context(), claim.UserId, cursor, limit)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	users := make([]BlockedUserResponse, 0, len(bs))
+	for _, b := range bs {
+		users = append(users, BlockedUserResponse{
+			ID:        b.Target.ID,
+			Handle:    b.Target.Handle,
+			Nickname:  b.Target.Nickname,
+			AvatarURL: b.Target.AvatarURL,
+			Since:     b.Ctime.UnixMilli(),
+		})
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: BlockListResponse{Users: users, NextCursor: next},
+	})
+}
+
+func (h *BlockHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrCannotBlockSelf):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "you cannot block or mute yourself",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeUserNotFound,
+			Msg:  "user not found",
+			Data: nil,
+		})
+	default:
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+	}
+}
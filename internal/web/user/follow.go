@@ -0,0 +1,306 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+)
+
+const (
+	defaultListPageSize = 20
+	maxListPageSize     = 100
+	// maxFollowCheckIds bounds a batch "is following" lookup.
+	maxFollowCheckIds = 100
+)
+
+// FollowUserResponse is a user in a follower or following list.
+type FollowUserResponse struct {
+	ID        int64  `json:"id"`
+	Handle    string `json:"handle"`
+	Nickname  string `json:"nickname"`
+	AvatarURL string `json:"avatarUrl"`
+	// FollowedAt is when the follow happened, in Unix milliseconds.
+	FollowedAt int64 `json:"followedAt"`
+	// Following tells whether the viewer follows this user. It is always
+	// false for anonymous viewers.
+	Following bool `json:"following"`
+}
+
+// FollowListResponse is one page of a follow list. NextCursor is passed back
+// as cursor to load the next page and is 0 on the last page.
+type FollowListResponse struct {
+	Users      []FollowUserResponse `json:"users"`
+	NextCursor int64                `json:"nextCursor"`
+}
+
+// Follow makes the caller follow the user with the given handle.
+func (h *UserHandler) Follow(c *gin.Context) {
+	h.changeFollow(c, h.followSvc.Follow, "followed successfully")
+}
+
+// Unfollow makes the caller stop following the user with the given handle.
+func (h *UserHandler) Unfollow(c *gin.Context) {
+	h.changeFollow(c, h.followSvc.Unfollow, "unfollowed successfully")
+}
+
+func (h *UserHandler) changeFollow(c *gin.Context, fn func(ctx context.Context, followerId, followeeId int64) error, msg string) {
+	var req handleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := h.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	u, ok := h.findByHandle(c, req.Handle)
+	if !ok {
+		return
+	}
+	if err := fn(c.Request.Context(), claim.UserId, u.ID); err != nil {
+		h.followError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  msg,
+		Data: nil,
+	})
+}
+
+// Relationship tells whether the caller and the user with the given handle
+// follow each other.
+func (h *UserHandler) Relationship(c *gin.Context) {
+	type RelationshipResponse struct {
+		Following  bool `json:"following"`
+		FollowedBy bool `json:"followedBy"`
+		Mutual     bool `json:"mutual"`
+	}
+
+	claim := h.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	u, ok := h.findByHandle(c, c.Query("handle"))
+	if !ok {
+		return
+	}
+	rel, err := h.followSvc.Relationship(c.Request.Context(), claim.UserId, u.ID)
+	if err != nil {
+		h.followError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: RelationshipResponse{
+			Following:  rel.Following,
+			FollowedBy: rel.FollowedBy,
+			Mutual:     rel.Mutual(),
+		},
+	})
+}
+
+// CheckFollowing tells, for a comma-separated list of user IDs, which of those
+// users the caller follows, so that lists can render follow buttons without
+// one request per user.
+func (h *UserHandler) CheckFollowing(c *gin.Context) {
+	claim := h.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	var ids []int64
+	for _, s := range strings.Split(c.Query("ids"), ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidParam,
+				Msg:  "ids must be a comma-separated list of user IDs",
+				Data: nil,
+			})
+			return
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) > maxFollowCheckIds {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "too many ids",
+			Data: nil,
+		})
+		return
+	}
+
+	following, err := h.followSvc.FollowingAmong(c.Request.Context(), claim.UserId, ids)
+	if err != nil {
+		h.followError(c, err)
+		return
+	}
+	res := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		res[id] = following[id]
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
+
+// Followers lists the followers of a user, most recent first, if the viewer
+// may see the user's profile.
+func (h *UserHandler) Followers(c *gin.Context) {
+	h.followList(c, h.followSvc.Followers)
+}
+
+// Following lists the users a user follows, most recent first, if the viewer
+// may see the user's profile.
+func (h *UserHandler) Following(c *gin.Context) {
+	h.followList(c, h.followSvc.Following)
+}
+
+func (h *UserHandler) followList(c *gin.Context,
+	fn func(ctx context.Context, userId, cursor int64, limit int) ([]service.FollowListEntry, int64, error)) {
+	u, ok := h.findByHandle(c, strings.TrimPrefix(c.Param("handle"), "@"))
+	if !ok {
+		return
+	}
+
+	var viewerId int64
+	if claim, ok := GetUserClaims(c); ok {
+		viewerId = claim.UserId
+	}
+	visible, err := h.privacySvc.CanViewProfile(c.Request.Context(), viewerId, u)
+	if err != nil {
+		h.followError(c, err)
+		return
+	}
+	if !visible {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeProfileRestricted,
+			Msg:  "this profile is private",
+			Data: nil,
+		})
+		return
+	}
+
+	cursor, limit := listPage(c)
+	entries, next, err := fn(c.Request.Context(), u.ID, cursor, limit)
+	if err != nil {
+		h.followError(c, err)
+		return
+	}
+
+	following := map[int64]bool{}
+	if viewerId != 0 {
+		ids := make([]int64, 0, len(entries))
+		for _, e := range entries {
+			ids = append(ids, e.User.ID)
+		}
+		following, err = h.followSvc.FollowingAmong(c.Request.Context(), viewerId, ids)
+		if err != nil {
+			h.followError(c, err)
+			return
+		}
+	}
+
+	users := make([]FollowUserResponse, 0, len(entries))
+	for _, e := range entries {
+		users = append(users, FollowUserResponse{
+			ID:         e.User.ID,
+			Handle:     e.User.Handle,
+			Nickname:   e.User.Nickname,
+			AvatarURL:  e.User.AvatarURL,
+			FollowedAt: e.Follow.Ctime.UnixMilli(),
+			Following:  following[e.User.ID],
+		})
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: FollowListResponse{Users: users, NextCursor: next},
+	})
+}
+
+// findByHandle looks up a user by current handle, writing the error response
+// and returning false when there is none.
+func (h *UserHandler) findByHandle(c *gin.Context, handle string) (domain.User, bool) {
+	u, err := UserByHandle(c.Request.Context(), h.svc, handle)
+	if err != nil {
+		h.followError(c, err)
+		return domain.User{}, false
+	}
+	return u, true
+}
+
+// UserByHandle looks up a user by current handle.
+func UserByHandle(ctx context.Context, svc *service.UserService, handle string) (domain.User, error) {
+	u, err := svc.FindByHandle(ctx, handle)
+	if err != nil {
+		return domain.User{}, err
+	}
+	if !strings.EqualFold(u.Handle, handle) {
+		// Old handles only redirect profile pages. Acting on them would target
+		// a user the client does not know under that handle any more.
+		return domain.User{}, service.ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (h *UserHandler) followError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrCannotFollowSelf):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "you cannot follow yourself",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrBlocked):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeUserBlocked,
+			Msg:  "you cannot follow this user",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeUserNotFound,
+			Msg:  "user not found",
+			Data: nil,
+		})
+	default:
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+	}
+}
+
+// listPage reads the cursor and limit query parameters, clamping them to
+// sane values instead of rejecting the request.
+func listPage(c *gin.Context) (int64, int) {
+	cursor, err := strconv.ParseInt(c.Query("cursor"), 10, 64)
+	if err != nil || cursor < 0 {
+		cursor = 0
+	}
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultListPageSize
+	}
+	return cursor, min(limit, maxListPageSize)
+}
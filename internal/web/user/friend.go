@@ -0,0 +1,317 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+)
+
+type FriendHandler struct {
+	svc     *service.FriendService
+	userSvc *service.UserService
+}
+
+func NewFriendHandler(svc *service.FriendService, userSvc *service.UserService) *FriendHandler {
+	return &FriendHandler{
+		svc:     svc,
+		userSvc: userSvc,
+	}
+}
+
+func (h *FriendHandler) RegisterRoutes(r *gin.Engine) {
+	rg := r.Group("/user/friends")
+	rg.GET("", h.List)
+	rg.POST("/remove", h.Unfriend)
+
+	rg.POST("/requests", h.Send)
+	rg.GET("/requests/incoming", h.Incoming)
+	rg.GET("/requests/outgoing", h.Outgoing)
+	rg.POST("/requests/accept", h.Accept)
+	rg.POST("/requests/decline", h.Decline)
+	rg.POST("/requests/cancel", h.Cancel)
+}
+
+type FriendRequestResponse struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"`
+	// User is the other side: the requester of incoming requests, the
+	// addressee of outgoing ones.
+	User  FriendUserResponse `json:"user"`
+	Ctime int64              `json:"ctime"`
+	Utime int64              `json:"utime"`
+}
+
+type FriendUserResponse struct {
+	ID        int64  `json:"id"`
+	Handle    string `json:"handle"`
+	Nickname  string `json:"nickname"`
+	AvatarURL string `json:"avatarUrl"`
+	// FriendsSince is when the friendship started, in Unix milliseconds. It
+	// is only set in friend lists.
+	FriendsSince int64 `json:"friendsSince,omitempty"`
+}
+
+// FriendListResponse is one page of friends. NextCursor is passed back as
+// cursor to load the next page and is 0 on the last page.
+type FriendListResponse struct {
+	Friends    []FriendUserResponse `json:"friends"`
+	NextCursor int64                `json:"nextCursor"`
+}
+
+// FriendRequestListResponse is one page of friend requests.
+type FriendRequestListResponse struct {
+	Requests   []FriendRequestResponse `json:"requests"`
+	NextCursor int64                   `json:"nextCursor"`
+}
+
+func toFriendUserResponse(u domain.User) FriendUserResponse {
+	return FriendUserResponse{
+		ID:        u.ID,
+		Handle:    u.Handle,
+		Nickname:  u.Nickname,
+		AvatarURL: u.AvatarURL,
+	}
+}
+
+func toFriendRequestResponse(r domain.FriendRequest, other domain.User) FriendRequestResponse {
+	return FriendRequestResponse{
+		ID:     r.ID,
+		Status: r.Status.String(),
+		User:   toFriendUserResponse(other),
+		Ctime:  r.Ctime.UnixMilli(),
+		Utime:  r.Utime.UnixMilli(),
+	}
+}
+
+// Send asks the user with the given handle to become friends. If they already
+// asked the caller, the two become friends right away.
+func (h *FriendHandler) Send(c *gin.Context) {
+	var req handleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	u, err := UserByHandle(c.Request.Context(), h.userSvc, req.Handle)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	fr, err := h.svc.Send(c.Request.Context(), claim.UserId, u.ID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	msg := "friend request sent"
+	if fr.Status == domain.FriendRequestStatusAccepted {
+		msg = "you are now friends"
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  msg,
+		Data: toFriendRequestResponse(fr, u),
+	})
+}
+
+// Accept accepts a request sent to the caller.
+func (h *FriendHandler) Accept(c *gin.Context) {
+	h.answer(c, func(ctx context.Context, id, userId int64) error {
+		_, err := h.svc.Accept(ctx, id, userId)
+		return err
+	}, "friend request accepted")
+}
+
+// Decline turns down a request sent to the caller.
+func (h *FriendHandler) Decline(c *gin.Context) {
+	h.answer(c, h.svc.Decline, "friend request declined")
+}
+
+// Cancel withdraws a request the caller sent.
+func (h *FriendHandler) Cancel(c *gin.Context) {
+	h.answer(c, h.svc.Cancel, "friend request cancelled")
+}
+
+func (h *FriendHandler) answer(c *gin.Context, fn func(ctx context.Context, id, userId int64) error, msg string) {
+	type IdRequest struct {
+		ID int64 `json:"id"`
+	}
+
+	var req IdRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	if err := fn(c.Request.Context(), req.ID, claim.UserId); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  msg,
+		Data: nil,
+	})
+}
+
+// Unfriend ends the friendship with the user with the given handle.
+func (h *FriendHandler) Unfriend(c *gin.Context) {
+	var req handleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	u, err := UserByHandle(c.Request.Context(), h.userSvc, req.Handle)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	if err = h.svc.Unfriend(c.Request.Context(), claim.UserId, u.ID); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "friend removed",
+		Data: nil,
+	})
+}
+
+// List returns the caller's friends, most recent first.
+func (h *FriendHandler) List(c *gin.Context) {
+	claim := MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	cursor, limit := listPage(c)
+	entries, next, err := h.svc.Friends(c.Request.Context(), claim.UserId, cursor, limit)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	friends := make([]FriendUserResponse, 0, len(entries))
+	for _, e := range entries {
+		f := toFriendUserResponse(e.User)
+		f.FriendsSince = e.Friendship.Ctime.UnixMilli()
+		friends = append(friends, f)
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: FriendListResponse{Friends: friends, NextCursor: next},
+	})
+}
+
+// Incoming returns the pending requests sent to the caller, newest first.
+func (h *FriendHandler) Incoming(c *gin.Context) {
+	h.requests(c, h.svc.Incoming)
+}
+
+// Outgoing returns the pending requests the caller sent, newest first.
+func (h *FriendHandler) Outgoing(c *gin.Context) {
+	h.requests(c, h.svc.Outgoing)
+}
+
+func (h *FriendHandler) requests(c *gin.Context,
+	fn func(ctx context.Context, userId, cursor int64, limit int) ([]service.FriendRequestEntry, int64, error)) {
+	claim := MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	cursor, limit := listPage(c)
+	entries, next, err := fn(c.Request.Context(), claim.UserId, cursor, limit)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	res := make([]FriendRequestResponse, 0, len(entries))
+	for _, e := range entries {
+		res = append(res, toFriendRequestResponse(e.Request, e.User))
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: FriendRequestListResponse{Requests: res, NextCursor: next},
+	})
+}
+
+func (h *FriendHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrCannotFriendSelf):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "you cannot befriend yourself",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeUserNotFound,
+			Msg:  "user not found",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrBlocked):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeUserBlocked,
+			Msg:  "you cannot befriend this user",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrAlreadyFriends):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeAlreadyFriends,
+			Msg:  "you are already friends",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrFriendRequestNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeFriendRequestNotFound,
+			Msg:  "friend request not found",
+			Data: nil,
+		})
+	case errors.Is(err, service.ErrFriendRequestClosed):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeFriendRequestClosed,
+			Msg:  "friend request was already answered",
+			Data: nil,
+		})
+	default:
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+	}
+}
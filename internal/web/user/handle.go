@@ -0,0 +1,238 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+)
+
+// PublicProfileResponse is what anyone can see of a user. It must never
+// include the email or other private fields.
+type PublicProfileResponse struct {
+	Handle    string   `json:"handle"`
+	Nickname  string   `json:"nickname"`
+	Intro     string   `json:"intro"`
+	IntroHTML string   `json:"introHtml"`
+	Location  string   `json:"location"`
+	Websites  []string `json:"websites"`
+	AvatarURL string   `json:"avatarUrl"`
+	JoinedAt  int64    `json:"joinedAt"`
+	Followers int64    `json:"followers"`
+	Following int64    `json:"following"`
+}
+
+func toPublicProfileResponse(u domain.User, stats domain.FollowStats) PublicProfileResponse {
+	res := PublicProfileResponse{
+		Handle:    u.Handle,
+		Nickname:  u.Nickname,
+		Intro:     u.Intro,
+		IntroHTML: u.IntroHTML,
+		Location:  u.Location,
+		Websites:  u.Websites,
+		AvatarURL: u.AvatarURL,
+		JoinedAt:  u.Ctime.UnixMilli(),
+		Followers: stats.Followers,
+		Following: stats.Following,
+	}
+	if res.Websites == nil {
+		res.Websites = []string{}
+	}
+	return res
+}
+
+type handleRequest struct {
+	Handle string `json:"handle"`
+}
+
+// ClaimHandle sets the first handle of a user.
+func (h *UserHandler) ClaimHandle(c *gin.Context) {
+	var req handleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := h.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	u, err := h.svc.ClaimHandle(c.Request.Context(), claim.UserId, req.Handle)
+	h.handleResult(c, u, err)
+}
+
+// ChangeHandle replaces the handle of a user. Links to the old handle
+// redirect to the new one.
+func (h *UserHandler) ChangeHandle(c *gin.Context) {
+	var req handleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := h.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	u, err := h.svc.ChangeHandle(c.Request.Context(), claim.UserId, req.Handle)
+	if errors.Is(err, service.ErrHandleCooldown) {
+		type CooldownResponse struct {
+			// AllowedAt is when the next change is allowed, in Unix milliseconds.
+			AllowedAt int64 `json:"allowedAt"`
+		}
+		data := CooldownResponse{}
+		if profile, perr := h.svc.Profile(c.Request.Context(), claim.UserId); perr == nil {
+			data.AllowedAt = h.svc.HandleChangeAllowedAt(profile).UnixMilli()
+		}
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeHandleCooldown,
+			Msg:  "handle was changed too recently",
+			Data: data,
+		})
+		return
+	}
+	h.handleResult(c, u, err)
+}
+
+func (h *UserHandler) handleResult(c *gin.Context, u domain.User, err error) {
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidHandle):
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidParam,
+				Msg:  "handle must be 3-20 letters, digits or underscores and not only digits",
+				Data: nil,
+			})
+		case errors.Is(err, service.ErrReservedHandle), errors.Is(err, service.ErrHandleUnavailable):
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeHandleUnavailable,
+				Msg:  "handle is not available",
+				Data: nil,
+			})
+		case errors.Is(err, service.ErrHandleClaimed):
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidParam,
+				Msg:  "handle already claimed, change it instead",
+				Data: nil,
+			})
+		case errors.Is(err, service.ErrNoHandle):
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidParam,
+				Msg:  "no handle to change, claim one first",
+				Data: nil,
+			})
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeUserNotFound,
+				Msg:  "user not found",
+				Data: nil,
+			})
+		default:
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeServerBusy,
+				Msg:  "system error",
+				Data: nil,
+			})
+		}
+		return
+	}
+	stats, err := h.followSvc.Stats(c.Request.Context(), u.ID)
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "handle updated successfully",
+		Data: toProfileResponse(u, stats),
+	})
+}
+
+// PublicProfile serves the public page data of a user by handle, as far as
+// the owner's privacy settings allow the viewer. Old handles redirect to the
+// current one, temporarily: once released, another user may claim them.
+func (h *UserHandler) PublicProfile(c *gin.Context) {
+	handle := strings.TrimPrefix(c.Param("handle"), "@")
+
+	u, err := h.svc.FindByHandle(c.Request.Context(), handle)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeUserNotFound,
+				Msg:  "user not found",
+				Data: nil,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	if !strings.EqualFold(u.Handle, handle) {
+		c.Redirect(http.StatusFound, "/u/"+u.Handle)
+		return
+	}
+
+	var viewerId int64
+	if claim, ok := GetUserClaims(c); ok {
+		viewerId = claim.UserId
+	}
+	visible, err := h.privacySvc.CanViewProfile(c.Request.Context(), viewerId, u)
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+	if !visible {
+		type RestrictedResponse struct {
+			Handle string `json:"handle"`
+		}
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeProfileRestricted,
+			Msg:  "this profile is private",
+			Data: RestrictedResponse{Handle: u.Handle},
+		})
+		return
+	}
+	stats, err := h.followSvc.Stats(c.Request.Context(), u.ID)
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: toPublicProfileResponse(u, stats),
+	})
+}
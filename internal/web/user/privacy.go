@@ -0,0 +1,170 @@
+package user
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+)
+
+type PrivacySettingsResponse struct {
+	ProfileVisibility domain.Audience `json:"profileVisibility"`
+	Searchable        bool            `json:"searchable"`
+	MessagePermission domain.Audience `json:"messagePermission"`
+}
+
+func (h *UserHandler) GetPrivacy(c *gin.Context) {
+	claim := h.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	settings, err := h.privacySvc.Settings(c.Request.Context(), claim.UserId)
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeUserNotFound,
+				Msg:  "user not found",
+				Data: nil,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: PrivacySettingsResponse(settings),
+	})
+}
+
+// UpdatePrivacy replaces all privacy settings; fields missing from the
+// request are reset to their defaults.
+func (h *UserHandler) UpdatePrivacy(c *gin.Context) {
+	defaults := domain.DefaultPrivacySettings()
+	req := PrivacySettingsResponse(defaults)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	claim := h.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	settings := domain.PrivacySettings(req)
+	err := h.privacySvc.UpdateSettings(c.Request.Context(), claim.UserId, settings)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidPrivacySettings):
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidParam,
+				Msg:  "audiences must be everyone, followers or nobody",
+				Data: nil,
+			})
+		case errors.Is(err, service.ErrUserNotFound):
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeUserNotFound,
+				Msg:  "user not found",
+				Data: nil,
+			})
+		default:
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeServerBusy,
+				Msg:  "system error",
+				Data: nil,
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "privacy settings updated successfully",
+		Data: PrivacySettingsResponse(settings),
+	})
+}
+
+// Search finds users by handle or nickname prefix. Users who opted out of
+// search never show up, and users whose profile the viewer may not see show
+// up with their handle only.
+func (h *UserHandler) Search(c *gin.Context) {
+	type SearchResult struct {
+		PublicProfileResponse
+		Restricted bool `json:"restricted"`
+	}
+
+	query := strings.TrimPrefix(strings.TrimSpace(c.Query("q")), "@")
+	if len(query) < 2 {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "query must be at least 2 characters",
+			Data: nil,
+		})
+		return
+	}
+
+	var viewerId int64
+	if claim, ok := GetUserClaims(c); ok {
+		viewerId = claim.UserId
+	}
+
+	found, err := h.privacySvc.Search(c.Request.Context(), viewerId, query)
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	ids := make([]int64, 0, len(found))
+	for _, f := range found {
+		if !f.Restricted {
+			ids = append(ids, f.User.ID)
+		}
+	}
+	stats, err := h.followSvc.StatsOf(c.Request.Context(), ids)
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	res := make([]SearchResult, 0, len(found))
+	for _, f := range found {
+		if f.Restricted {
+			res = append(res, SearchResult{
+				PublicProfileResponse: PublicProfileResponse{Handle: f.User.Handle, Websites: []string{}},
+				Restricted:            true,
+			})
+			continue
+		}
+		res = append(res, SearchResult{PublicProfileResponse: toPublicProfileResponse(f.User, stats[f.User.ID])})
+	}
+
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "success",
+		Data: res,
+	})
+}
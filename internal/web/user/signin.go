@@ -0,0 +1,372 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ktsoator/connectify/internal/domain"
+	"github.com/ktsoator/connectify/internal/service"
+	"github.com/ktsoator/connectify/internal/web/resp"
+)
+
+// SignInHandler signs users in with a phone number or a third-party account
+// instead of an email and password. Both sign up on first use, and a guest
+// signing up keeps their account: the same row is converted in place, as
+// with Signup.
+type SignInHandler struct {
+	svc          *service.UserService
+	policySvc    *service.PolicyService
+	screeningSvc *service.SignupScreeningService
+	phone        *service.PhoneVerifier
+	providers    map[string]service.IdentityProvider
+}
+
+// NewSignInHandler creates the handler. providers maps the names clients
+// request to the configured identity providers.
+func NewSignInHandler(svc *service.UserService, policySvc *service.PolicyService,
+	screeningSvc *service.SignupScreeningService, phone *service.PhoneVerifier,
+	providers map[string]service.IdentityProvider) *SignInHandler {
+	return &SignInHandler{
+		svc:          svc,
+		policySvc:    policySvc,
+		screeningSvc: screeningSvc,
+		phone:        phone,
+		providers:    providers,
+	}
+}
+
+func (h *SignInHandler) RegisterRoutes(r *gin.Engine) {
+	rg := r.Group("/user")
+	rg.POST("/phone/code", h.SendPhoneCode)
+	rg.POST("/login_phone", h.LoginPhone)
+	rg.POST("/login_oauth", h.LoginOAuth)
+}
+
+// SignInResponse tells a client whether signing in created the account.
+type SignInResponse struct {
+	UserId     int64 `json:"userId"`
+	Registered bool  `json:"registered"`
+}
+
+// SendPhoneCode texts a verification code to a phone number. Texts cost
+// money and bots send them to premium numbers, so every request goes through
+// signup screening.
+func (h *SignInHandler) SendPhoneCode(c *gin.Context) {
+	type CodeRequest struct {
+		Phone string `json:"phone"`
+		// Website is a honeypot, see UserHandler.Signup.
+		Website string `json:"website"`
+	}
+	type RejectedResponse struct {
+		Reason domain.ScreeningReason `json:"reason"`
+	}
+
+	var req CodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+	phone, err := service.NormalizePhone(req.Phone)
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "phone format error",
+			Data: nil,
+		})
+		return
+	}
+
+	decision, err := h.screeningSvc.Screen(c.Request.Context(), domain.SignupAttempt{
+		IP:       c.ClientIP(),
+		Honeypot: req.Website,
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+	if !decision.Allowed() {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeSignupRejected,
+			Msg:  "signup rejected",
+			Data: RejectedResponse{Reason: decision.Reason},
+		})
+		return
+	}
+
+	err = h.phone.SendCode(c.Request.Context(), phone)
+	if err != nil {
+		if errors.Is(err, service.ErrPhoneCodeTooSoon) {
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodePhoneCodeTooSoon,
+				Msg:  "a code was sent recently, please wait before requesting another",
+				Data: nil,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "verification code sent",
+		Data: nil,
+	})
+}
+
+// LoginPhone signs in with a texted verification code, signing up if the
+// number is new.
+func (h *SignInHandler) LoginPhone(c *gin.Context) {
+	type PhoneLoginRequest struct {
+		Phone string `json:"phone"`
+		Code  string `json:"code"`
+		// AcceptedPolicyIds are only needed when the number is new.
+		AcceptedPolicyIds []int64 `json:"acceptedPolicyIds"`
+	}
+
+	var req PhoneLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+	phone, err := service.NormalizePhone(req.Phone)
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "phone format error",
+			Data: nil,
+		})
+		return
+	}
+
+	err = h.phone.Verify(c.Request.Context(), phone, req.Code)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidPhoneCode) {
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidPhoneCode,
+				Msg:  "invalid or expired verification code",
+				Data: nil,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	h.signIn(c, req.AcceptedPolicyIds,
+		func(ctx context.Context) (domain.User, error) {
+			return h.svc.LoginWithPhone(ctx, phone)
+		},
+		func(ctx context.Context, guestId int64) (domain.User, error) {
+			return h.svc.SignupWithPhone(ctx, guestId, phone)
+		})
+}
+
+// LoginOAuth signs in with an authorization code from a third-party
+// identity provider, signing up if the account is new. New accounts go
+// through signup screening like email signups.
+func (h *SignInHandler) LoginOAuth(c *gin.Context) {
+	type OAuthLoginRequest struct {
+		Provider string `json:"provider"`
+		Code     string `json:"code"`
+		// RedirectURI is where the provider sent the user back with the code.
+		RedirectURI string `json:"redirectUri"`
+		// AcceptedPolicyIds are only needed when the account is new.
+		AcceptedPolicyIds []int64 `json:"acceptedPolicyIds"`
+	}
+	type RejectedResponse struct {
+		Reason domain.ScreeningReason `json:"reason"`
+	}
+
+	var req OAuthLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+	provider, ok := h.providers[req.Provider]
+	if !ok {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "unknown identity provider",
+			Data: nil,
+		})
+		return
+	}
+
+	identity, err := provider.Identify(c.Request.Context(), req.Code, req.RedirectURI)
+	if err != nil {
+		if errors.Is(err, service.ErrIdentityRejected) {
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidCreds,
+				Msg:  "third-party sign-in failed",
+				Data: nil,
+			})
+			return
+		}
+		log.Printf("identify with %s: %v", req.Provider, err)
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	h.signIn(c, req.AcceptedPolicyIds,
+		func(ctx context.Context) (domain.User, error) {
+			return h.svc.LoginWithIdentity(ctx, identity)
+		},
+		func(ctx context.Context, guestId int64) (domain.User, error) {
+			decision, err := h.screeningSvc.Screen(ctx, domain.SignupAttempt{
+				Email: identity.Email,
+				IP:    c.ClientIP(),
+			})
+			if err != nil {
+				return domain.User{}, err
+			}
+			if !decision.Allowed() {
+				c.JSON(http.StatusOK, resp.Result{
+					Code: resp.CodeSignupRejected,
+					Msg:  "signup rejected",
+					Data: RejectedResponse{Reason: decision.Reason},
+				})
+				c.Abort()
+				return domain.User{}, nil
+			}
+			return h.svc.SignupWithIdentity(ctx, guestId, identity)
+		})
+}
+
+// signIn finishes a sign-in whose credentials were checked. It logs in the
+// user returned by login; when there is none yet, it checks the accepted
+// policies and signs up with signup, passing the caller's guest ID if they
+// have a guest token. signup may answer the request itself and abort it.
+func (h *SignInHandler) signIn(c *gin.Context, acceptedPolicyIds []int64,
+	login func(ctx context.Context) (domain.User, error),
+	signup func(ctx context.Context, guestId int64) (domain.User, error)) {
+	ctx := c.Request.Context()
+	u, err := login(ctx)
+	switch {
+	case err == nil:
+		setJwtToken(c, u)
+		if c.IsAborted() {
+			return
+		}
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeSuccess,
+			Msg:  "user logged in successfully",
+			Data: SignInResponse{UserId: u.ID},
+		})
+		return
+	case errors.Is(err, service.ErrUserDeactivated):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidCreds,
+			Msg:  "account is deactivated",
+			Data: nil,
+		})
+		return
+	case !errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	err = h.policySvc.CheckSignupAcceptance(ctx, acceptedPolicyIds)
+	if err != nil {
+		if errors.Is(err, service.ErrPoliciesNotAccepted) || errors.Is(err, service.ErrPolicyNotCurrent) {
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodePolicyConsentRequired,
+				Msg:  "please accept the current terms of service and privacy policy",
+				Data: nil,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	var guestId int64
+	if claim, ok := GetUserClaims(c); ok && claim.Guest {
+		guestId = claim.UserId
+	}
+	u, err = signup(ctx, guestId)
+	if c.IsAborted() {
+		return
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrDuplicateEmail),
+			errors.Is(err, service.ErrDuplicatePhone),
+			errors.Is(err, service.ErrDuplicateIdentity):
+			// Someone signed up with the same credentials at the same time.
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeUserExist,
+				Msg:  "user already exists",
+				Data: nil,
+			})
+		case errors.Is(err, service.ErrNotGuest):
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeUserNotFound,
+				Msg:  "guest account no longer exists",
+				Data: nil,
+			})
+		default:
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeServerBusy,
+				Msg:  "system error",
+				Data: nil,
+			})
+		}
+		return
+	}
+
+	// As in Signup, the account exists by now, so a failure is only logged.
+	err = h.policySvc.Accept(ctx, u.ID, acceptedPolicyIds, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		log.Printf("record signup policy consent for user %d: %v", u.ID, err)
+	}
+
+	setJwtToken(c, u)
+	if c.IsAborted() {
+		return
+	}
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "user registered successfully",
+		Data: SignInResponse{UserId: u.ID, Registered: true},
+	})
+}
@@ -1,7 +1,10 @@
 package user
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"time"
 
@@ -18,6 +21,8 @@ type UserClaims struct {
 	UserId    int64
 	UserEmail string
 	UserAgent string
+	// Guest tokens only reach the routes allowed by the guest guard middleware.
+	Guest bool
 	jwt.RegisteredClaims
 }
 
@@ -27,12 +32,22 @@ const (
 )
 
 type UserHandler struct {
-	svc *service.UserService
+	svc          *service.UserService
+	policySvc    *service.PolicyService
+	screeningSvc *service.SignupScreeningService
+	privacySvc   *service.PrivacyService
+	followSvc    *service.FollowService
 }
 
-func NewUserHandler(service *service.UserService) *UserHandler {
+func NewUserHandler(service *service.UserService, policySvc *service.PolicyService,
+	screeningSvc *service.SignupScreeningService, privacySvc *service.PrivacyService,
+	followSvc *service.FollowService) *UserHandler {
 	return &UserHandler{
-		svc: service,
+		svc:          service,
+		policySvc:    policySvc,
+		screeningSvc: screeningSvc,
+		privacySvc:   privacySvc,
+		followSvc:    followSvc,
 	}
 }
 
@@ -40,6 +55,7 @@ func (h *UserHandler) RegisterRoutes(r *gin.Engine) {
 	rg := r.Group("/user")
 
 	rg.POST("/signup", h.Signup)
+	rg.POST("/guest", h.CreateGuest)
 
 	// rg.POST("/login", h.Login)
 	rg.POST("/login_jwt", h.LoginJwt)
@@ -48,9 +64,28 @@ func (h *UserHandler) RegisterRoutes(r *gin.Engine) {
 	rg.GET("/profile_jwt", h.GetProfileJwt)
 
 	rg.PUT("/profile", h.UpdateProfile)
+	rg.PATCH("/profile", h.PatchProfile)
 
 	rg.POST("/logout", h.Logout)
 
+	rg.POST("/handle", h.ClaimHandle)
+	rg.PUT("/handle", h.ChangeHandle)
+
+	rg.GET("/privacy", h.GetPrivacy)
+	rg.PUT("/privacy", h.UpdatePrivacy)
+
+	rg.POST("/follow", h.Follow)
+	rg.POST("/unfollow", h.Unfollow)
+	rg.GET("/relationship", h.Relationship)
+	rg.GET("/following/check", h.CheckFollowing)
+
+	// Public profile pages and search, readable without logging in as far as
+	// each user's privacy settings allow.
+	r.GET("/u/:handle", h.PublicProfile)
+	r.GET("/u/:handle/followers", h.Followers)
+	r.GET("/u/:handle/following", h.Following)
+	r.GET("/users/search", h.Search)
+
 }
 
 func (h *UserHandler) Signup(c *gin.Context) {
@@ -58,6 +93,13 @@ func (h *UserHandler) Signup(c *gin.Context) {
 		Email           string `json:"email"`
 		Password        string `json:"password"`
 		ConfirmPassword string `json:"confirmPassword"`
+		// AcceptedPolicyIds are the policy versions shown on the signup form.
+		AcceptedPolicyIds []int64 `json:"acceptedPolicyIds"`
+		// Website is a honeypot: the form hides it, so only bots fill it in.
+		Website string `json:"website"`
+	}
+	type RejectedResponse struct {
+		Reason domain.ScreeningReason `json:"reason"`
 	}
 
 	var req SignUpRequest
@@ -115,10 +157,62 @@ func (h *UserHandler) Signup(c *gin.Context) {
 		return
 	}
 
-	err = h.svc.Signup(c.Request.Context(), domain.User{
+	decision, err := h.screeningSvc.Screen(c.Request.Context(), domain.SignupAttempt{
 		Email:    req.Email,
-		Password: req.Password,
+		IP:       c.ClientIP(),
+		Honeypot: req.Website,
 	})
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+	if !decision.Allowed() {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeSignupRejected,
+			Msg:  "signup rejected",
+			Data: RejectedResponse{Reason: decision.Reason},
+		})
+		return
+	}
+
+	err = h.policySvc.CheckSignupAcceptance(c.Request.Context(), req.AcceptedPolicyIds)
+	if err != nil {
+		if errors.Is(err, service.ErrPoliciesNotAccepted) || errors.Is(err, service.ErrPolicyNotCurrent) {
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodePolicyConsentRequired,
+				Msg:  "please accept the current terms of service and privacy policy",
+				Data: nil,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	// A guest signing up keeps their account: the same row is converted in place.
+	claim, isGuest := GetUserClaims(c)
+	isGuest = isGuest && claim.Guest
+
+	var u domain.User
+	if isGuest {
+		u, err = h.svc.UpgradeGuest(c.Request.Context(), claim.UserId, domain.User{
+			Email:    req.Email,
+			Password: req.Password,
+		})
+	} else {
+		u, err = h.svc.Signup(c.Request.Context(), domain.User{
+			Email:    req.Email,
+			Password: req.Password,
+		})
+	}
 	if err != nil {
 		if errors.Is(err, service.ErrDuplicateEmail) {
 			c.JSON(http.StatusOK, resp.Result{
@@ -128,6 +222,15 @@ func (h *UserHandler) Signup(c *gin.Context) {
 			})
 			return
 		}
+		if errors.Is(err, service.ErrNotGuest) {
+			// The guest was cleaned up or already upgraded with another token.
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeUserNotFound,
+				Msg:  "guest account no longer exists",
+				Data: nil,
+			})
+			return
+		}
 		c.JSON(http.StatusOK, resp.Result{
 			Code: resp.CodeServerBusy,
 			Msg:  "system error",
@@ -136,6 +239,22 @@ func (h *UserHandler) Signup(c *gin.Context) {
 		return
 	}
 
+	// The account already exists at this point, so a failure here is only logged.
+	// The policy consent middleware will ask the user to accept again on the next request.
+	err = h.policySvc.Accept(c.Request.Context(), u.ID, req.AcceptedPolicyIds,
+		c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		log.Printf("record signup policy consent for user %d: %v", u.ID, err)
+	}
+
+	if isGuest {
+		// Replace the guest token with a regular one.
+		h.SetJwtToken(c, u)
+		if c.IsAborted() {
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, resp.Result{
 		Code: resp.CodeSuccess,
 		Msg:  "user registered successfully",
@@ -143,6 +262,101 @@ func (h *UserHandler) Signup(c *gin.Context) {
 	})
 }
 
+// CreateGuest creates an anonymous account and logs the visitor in with a
+// guest token. Signing up later with that token upgrades the same account.
+//
+// Anyone can call it, so it goes through signup screening like Signup does:
+// guests and signups from one address share the same velocity limits.
+func (h *UserHandler) CreateGuest(c *gin.Context) {
+	type GuestRequest struct {
+		AcceptedPolicyIds []int64 `json:"acceptedPolicyIds"`
+		// Website is a honeypot, see Signup.
+		Website string `json:"website"`
+	}
+	type GuestResponse struct {
+		UserId int64 `json:"userId"`
+	}
+	type RejectedResponse struct {
+		Reason domain.ScreeningReason `json:"reason"`
+	}
+
+	var req GuestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	decision, err := h.screeningSvc.Screen(c.Request.Context(), domain.SignupAttempt{
+		IP:       c.ClientIP(),
+		Honeypot: req.Website,
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+	if !decision.Allowed() {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeSignupRejected,
+			Msg:  "signup rejected",
+			Data: RejectedResponse{Reason: decision.Reason},
+		})
+		return
+	}
+
+	err = h.policySvc.CheckSignupAcceptance(c.Request.Context(), req.AcceptedPolicyIds)
+	if err != nil {
+		if errors.Is(err, service.ErrPoliciesNotAccepted) || errors.Is(err, service.ErrPolicyNotCurrent) {
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodePolicyConsentRequired,
+				Msg:  "please accept the current terms of service and privacy policy",
+				Data: nil,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	u, err := h.svc.CreateGuest(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
+	err = h.policySvc.Accept(c.Request.Context(), u.ID, req.AcceptedPolicyIds,
+		c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		log.Printf("record guest policy consent for user %d: %v", u.ID, err)
+	}
+
+	h.SetJwtToken(c, u)
+	if c.IsAborted() {
+		return
+	}
+
+	c.JSON(http.StatusOK, resp.Result{
+		Code: resp.CodeSuccess,
+		Msg:  "guest created successfully",
+		Data: GuestResponse{UserId: u.ID},
+	})
+}
+
 func (h *UserHandler) Login(c *gin.Context) {
 	type LoginRequest struct {
 		Email    string `json:"email"`
@@ -239,12 +453,6 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 }
 
 func (h *UserHandler) GetProfileJwt(c *gin.Context) {
-	type ProfileResponse struct {
-		Email    string `json:"email"`
-		Nickname string `json:"nickname"`
-		Intro    string `json:"intro"`
-	}
-
 	claim := h.MustGetUserClaims(c)
 	if c.IsAborted() {
 		return
@@ -267,15 +475,20 @@ func (h *UserHandler) GetProfileJwt(c *gin.Context) {
 		})
 		return
 	}
+	stats, err := h.followSvc.Stats(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, resp.Result{
 		Code: resp.CodeSuccess,
 		Msg:  "success",
-		Data: ProfileResponse{
-			Email:    user.Email,
-			Nickname: user.Nickname,
-			Intro:    user.Intro,
-		},
+		Data: toProfileResponse(user, stats),
 	})
 }
 
@@ -291,10 +504,12 @@ func (h *UserHandler) Logout(c *gin.Context) {
 	})
 }
 
+// UpdateProfile updates the nickname and intro. Fields missing from the
+// request keep their values.
 func (h *UserHandler) UpdateProfile(c *gin.Context) {
 	type UpdateProfileRequest struct {
-		Nickname string `json:"nickname"`
-		Intro    string `json:"intro"`
+		Nickname *string `json:"nickname"`
+		Intro    *string `json:"intro"`
 	}
 
 	var req UpdateProfileRequest
@@ -307,24 +522,59 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	session := sessions.Default(c)
-	uidVal := session.Get("userId")
-	uid, ok := uidVal.(int64)
-	if !ok {
-		c.JSON(http.StatusOK, resp.Result{
-			Code: resp.CodeServerBusy,
-			Msg:  "login expired or invalid session",
-			Data: nil,
-		})
+	claim := h.MustGetUserClaims(c)
+	if c.IsAborted() {
 		return
 	}
 
-	err := h.svc.Update(c.Request.Context(), domain.User{
-		ID:       uid,
+	h.updateProfile(c, claim.UserId, domain.UserProfilePatch{
 		Nickname: req.Nickname,
 		Intro:    req.Intro,
 	})
+}
+
+// PatchProfile applies a JSON Merge Patch (RFC 7396) to the profile: members
+// that are absent stay unchanged and members set to null are cleared.
+func (h *UserHandler) PatchProfile(c *gin.Context) {
+	var doc map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&doc); err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  "invalid request",
+			Data: nil,
+		})
+		return
+	}
+
+	patch, err := parseProfilePatch(doc)
 	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeInvalidParam,
+			Msg:  err.Error(),
+			Data: nil,
+		})
+		return
+	}
+
+	claim := h.MustGetUserClaims(c)
+	if c.IsAborted() {
+		return
+	}
+
+	h.updateProfile(c, claim.UserId, patch)
+}
+
+func (h *UserHandler) updateProfile(c *gin.Context, uid int64, patch domain.UserProfilePatch) {
+	err := h.svc.Update(c.Request.Context(), uid, patch)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidProfile) {
+			c.JSON(http.StatusOK, resp.Result{
+				Code: resp.CodeInvalidParam,
+				Msg:  err.Error(),
+				Data: nil,
+			})
+			return
+		}
 		if errors.Is(err, service.ErrUserNotFound) {
 			c.JSON(http.StatusOK, resp.Result{
 				Code: resp.CodeUserNotFound,
@@ -341,13 +591,122 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 		return
 	}
 
+	user, err := h.svc.Profile(c.Request.Context(), uid)
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+	stats, err := h.followSvc.Stats(c.Request.Context(), uid)
+	if err != nil {
+		c.JSON(http.StatusOK, resp.Result{
+			Code: resp.CodeServerBusy,
+			Msg:  "system error",
+			Data: nil,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, resp.Result{
 		Code: resp.CodeSuccess,
 		Msg:  "user profile updated successfully",
-		Data: nil,
+		Data: toProfileResponse(user, stats),
 	})
 }
 
+// parseProfilePatch decodes a merge patch document. Unknown members are
+// rejected so typos do not silently do nothing.
+func parseProfilePatch(doc map[string]json.RawMessage) (domain.UserProfilePatch, error) {
+	var patch domain.UserProfilePatch
+	for key, raw := range doc {
+		var err error
+		switch key {
+		case "nickname":
+			patch.Nickname, err = decodeNullable[string](raw)
+		case "intro":
+			patch.Intro, err = decodeNullable[string](raw)
+		case "location":
+			patch.Location, err = decodeNullable[string](raw)
+		case "gender":
+			patch.Gender, err = decodeNullable[string](raw)
+		case "avatarUrl":
+			patch.AvatarURL, err = decodeNullable[string](raw)
+		case "websites":
+			patch.Websites, err = decodeNullable[[]string](raw)
+		case "birthday":
+			var day *string
+			day, err = decodeNullable[string](raw)
+			if err == nil {
+				var t time.Time
+				if *day != "" {
+					t, err = time.Parse(time.DateOnly, *day)
+				}
+				patch.Birthday = &t
+			}
+		default:
+			return domain.UserProfilePatch{}, fmt.Errorf("unknown field %q", key)
+		}
+		if err != nil {
+			return domain.UserProfilePatch{}, fmt.Errorf("invalid value for %q", key)
+		}
+	}
+	return patch, nil
+}
+
+// decodeNullable decodes a merge patch member. null becomes a pointer to the
+// zero value, which clears the field.
+func decodeNullable[T any](raw json.RawMessage) (*T, error) {
+	v := new(T)
+	if string(raw) == "null" {
+		return v, nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+type ProfileResponse struct {
+	Email     string   `json:"email"`
+	Handle    string   `json:"handle"`
+	Nickname  string   `json:"nickname"`
+	Intro     string   `json:"intro"`
+	IntroHTML string   `json:"introHtml"`
+	Birthday  string   `json:"birthday"`
+	Location  string   `json:"location"`
+	Websites  []string `json:"websites"`
+	Gender    string   `json:"gender"`
+	AvatarURL string   `json:"avatarUrl"`
+	Followers int64    `json:"followers"`
+	Following int64    `json:"following"`
+}
+
+func toProfileResponse(u domain.User, stats domain.FollowStats) ProfileResponse {
+	res := ProfileResponse{
+		Email:     u.Email,
+		Handle:    u.Handle,
+		Nickname:  u.Nickname,
+		Intro:     u.Intro,
+		IntroHTML: u.IntroHTML,
+		Location:  u.Location,
+		Websites:  u.Websites,
+		Gender:    u.Gender,
+		AvatarURL: u.AvatarURL,
+		Followers: stats.Followers,
+		Following: stats.Following,
+	}
+	if res.Websites == nil {
+		res.Websites = []string{}
+	}
+	if !u.Birthday.IsZero() {
+		res.Birthday = u.Birthday.Format(time.DateOnly)
+	}
+	return res
+}
+
 func ValidatePassword(password string) (bool, error) {
 	re := regexp2.MustCompile(passwordRegex, 0)
 	return re.MatchString(password)
@@ -405,6 +764,24 @@ func (h *UserHandler) LoginJwt(c *gin.Context) {
 }
 
 func (u *UserHandler) MustGetUserClaims(c *gin.Context) UserClaims {
+	return MustGetUserClaims(c)
+}
+
+// GetUserClaims returns the claims of the logged-in user, if any. Use it on
+// routes where logging in is optional.
+func GetUserClaims(c *gin.Context) (UserClaims, bool) {
+	claimAny, exists := c.Get("claim")
+	if !exists {
+		return UserClaims{}, false
+	}
+	claim, ok := claimAny.(UserClaims)
+	return claim, ok
+}
+
+// MustGetUserClaims returns the claims stored in the context by the JWT login
+// middleware. If they are missing it writes an error response and aborts, so
+// callers must check c.IsAborted() before continuing.
+func MustGetUserClaims(c *gin.Context) UserClaims {
 	// Get user information from claim stored in context by middleware
 	claimAny, exists := c.Get("claim")
 	if !exists {
@@ -432,10 +809,17 @@ func (u *UserHandler) MustGetUserClaims(c *gin.Context) UserClaims {
 }
 
 func (u *UserHandler) SetJwtToken(c *gin.Context, user domain.User) {
+	setJwtToken(c, user)
+}
+
+// setJwtToken issues a token for user in the Jwt-Token header. It aborts the
+// request when signing fails.
+func setJwtToken(c *gin.Context, user domain.User) {
 	claims := UserClaims{
 		UserId:    user.ID,
 		UserEmail: user.Email,
 		UserAgent: c.Request.UserAgent(),
+		Guest:     user.Guest,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(30 * time.Minute)),
 		},